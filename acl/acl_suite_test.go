@@ -0,0 +1,15 @@
+package acl_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_acl.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "ACL Suite", []Reporter{junitReporter})
+}
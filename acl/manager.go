@@ -0,0 +1,144 @@
+package acl
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pborman/uuid/uuid"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// Manager creates and deletes the ACL users of a redis. The users are kept
+// as user directives in a file of their own and in the live redis.conf, so
+// that they survive a restart of redis and a rewrite of its config.
+type Manager struct {
+	ConfPath  string
+	UsersPath string
+	Connect   func() (client.Client, error)
+	sync.Mutex
+}
+
+// CreateUser creates or replaces the user with a new generated password,
+// which is returned. ErrNotSupported is returned for redis versions without
+// ACLs.
+func (manager *Manager) CreateUser(name string, scope Scope) (string, error) {
+	password := uuid.NewRandom().String()
+	if err := manager.SetUser(name, password, scope); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// SetUser creates or replaces the user with the given password, so that the
+// replicas of an instance accept the credentials created on its master.
+func (manager *Manager) SetUser(name, password string, scope Scope) error {
+	if err := scope.Validate(); err != nil {
+		return err
+	}
+
+	manager.Lock()
+	defer manager.Unlock()
+
+	redisClient, err := manager.Connect()
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	version, err := redisClient.RedisVersion()
+	if err != nil {
+		return err
+	}
+
+	if !Supported(version) {
+		return ErrNotSupported
+	}
+
+	user := NewUser(name, password, scope, version)
+
+	if err := redisClient.SetACLUser(name, user.Rules()...); err != nil {
+		return err
+	}
+
+	users, err := LoadUsers(manager.UsersPath)
+	if err != nil {
+		return err
+	}
+
+	users = append(withoutUser(users, name), user.Param())
+	return manager.save(users)
+}
+
+// DeleteUser deletes the user and disconnects its clients. Deleting a user
+// that does not exist is not an error, so that bindings made without a user
+// can be removed.
+func (manager *Manager) DeleteUser(name string) error {
+	manager.Lock()
+	defer manager.Unlock()
+
+	users, err := LoadUsers(manager.UsersPath)
+	if err != nil {
+		return err
+	}
+
+	remainingUsers := withoutUser(users, name)
+	if len(remainingUsers) == len(users) {
+		return nil
+	}
+
+	redisClient, err := manager.Connect()
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	if err := redisClient.DeleteACLUser(name); err != nil {
+		return err
+	}
+
+	return manager.save(remainingUsers)
+}
+
+func (manager *Manager) save(users redisconf.Conf) error {
+	if err := users.Save(manager.UsersPath); err != nil {
+		return err
+	}
+
+	conf, err := redisconf.Load(manager.ConfPath)
+	if err != nil {
+		return err
+	}
+
+	ApplyUsers(&conf, users)
+
+	return conf.Save(manager.ConfPath)
+}
+
+// LoadUsers reads the user directives kept at path. A missing file means
+// that there are no users.
+func LoadUsers(path string) (redisconf.Conf, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return redisconf.Conf{}, nil
+	}
+
+	return redisconf.Load(path)
+}
+
+// ApplyUsers replaces the user directives of conf.
+func ApplyUsers(conf *redisconf.Conf, users redisconf.Conf) {
+	conf.Delete(userDirective)
+	*conf = append(*conf, users...)
+}
+
+func withoutUser(users redisconf.Conf, name string) redisconf.Conf {
+	remaining := redisconf.Conf{}
+	for _, user := range users {
+		if user.Key != userDirective || !strings.HasPrefix(user.Value, name+" ") {
+			remaining = append(remaining, user)
+		}
+	}
+	return remaining
+}
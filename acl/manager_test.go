@@ -0,0 +1,192 @@
+package acl_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manager", func() {
+	var (
+		manager      *acl.Manager
+		fakeClient   *fakes.Client
+		connectCount int
+		tmpDir       string
+		confPath     string
+		usersPath    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "acl-manager")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		confPath = filepath.Join(tmpDir, "redis.conf")
+		usersPath = filepath.Join(tmpDir, "users.conf")
+
+		err = redisconf.New(
+			redisconf.Param{Key: "port", Value: "6379"},
+			redisconf.Param{Key: "requirepass", Value: "admin-password"},
+		).Save(confPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeClient = &fakes.Client{Version: "6.2.14"}
+		connectCount = 0
+
+		manager = &acl.Manager{
+			ConfPath:  confPath,
+			UsersPath: usersPath,
+			Connect: func() (client.Client, error) {
+				connectCount++
+				return fakeClient, nil
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("CreateUser", func() {
+		It("creates the user in redis with a generated password", func() {
+			password, err := manager.CreateUser("binding-id", acl.Scope{ReadOnly: true})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(password).ShouldNot(BeEmpty())
+
+			user := acl.NewUser("binding-id", password, acl.Scope{ReadOnly: true}, "6.2.14")
+			Ω(fakeClient.ACLUsers["binding-id"]).Should(Equal(user.Rules()))
+			Ω(fakeClient.DisconnectCallCount).Should(Equal(1))
+		})
+
+		It("keeps the user in the users file and in redis.conf", func() {
+			password, err := manager.CreateUser("binding-id", acl.Scope{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			user := acl.NewUser("binding-id", password, acl.Scope{}, "6.2.14")
+
+			users, err := acl.LoadUsers(usersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(users).Should(Equal(redisconf.New(user.Param())))
+
+			conf, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf).Should(ContainElement(user.Param()))
+			Ω(conf.Get("requirepass")).Should(Equal("admin-password"))
+		})
+
+		It("does not keep the password in plain text", func() {
+			password, err := manager.CreateUser("binding-id", acl.Scope{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(usersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).ShouldNot(ContainSubstring(password))
+		})
+
+		Context("when redis does not support ACLs", func() {
+			BeforeEach(func() {
+				fakeClient.Version = "5.0.14"
+			})
+
+			It("returns ErrNotSupported without creating a user", func() {
+				_, err := manager.CreateUser("binding-id", acl.Scope{})
+				Ω(err).Should(Equal(acl.ErrNotSupported))
+				Ω(fakeClient.ACLUsers).Should(BeEmpty())
+
+				_, err = os.Stat(usersPath)
+				Ω(os.IsNotExist(err)).Should(BeTrue())
+			})
+		})
+
+		Context("when redis rejects the user", func() {
+			BeforeEach(func() {
+				fakeClient.ExpectedSetACLUserErr = errors.New("ERR Error in ACL SETUSER modifier")
+			})
+
+			It("returns the error and does not keep the user", func() {
+				_, err := manager.CreateUser("binding-id", acl.Scope{})
+				Ω(err).Should(MatchError("ERR Error in ACL SETUSER modifier"))
+
+				users, err := acl.LoadUsers(usersPath)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(users).Should(BeEmpty())
+			})
+		})
+
+		It("rejects invalid scopes before connecting", func() {
+			_, err := manager.CreateUser("binding-id", acl.Scope{KeyPrefix: "*"})
+			Ω(err).Should(HaveOccurred())
+			Ω(connectCount).Should(Equal(0))
+		})
+	})
+
+	Describe("SetUser", func() {
+		It("creates the user with the given password", func() {
+			err := manager.SetUser("binding-id", "master-password", acl.Scope{KeyPrefix: "app:"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			user := acl.NewUser("binding-id", "master-password", acl.Scope{KeyPrefix: "app:"}, "6.2.14")
+			Ω(fakeClient.ACLUsers["binding-id"]).Should(Equal(user.Rules()))
+
+			users, err := acl.LoadUsers(usersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(users).Should(Equal(redisconf.New(user.Param())))
+		})
+	})
+
+	Describe("DeleteUser", func() {
+		BeforeEach(func() {
+			_, err := manager.CreateUser("binding-id", acl.Scope{})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = manager.CreateUser("other-binding-id", acl.Scope{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("deletes the user from redis, the users file and redis.conf", func() {
+			err := manager.DeleteUser("binding-id")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeClient.DeletedACLUsers).Should(Equal([]string{"binding-id"}))
+
+			users, err := acl.LoadUsers(usersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(users).Should(HaveLen(1))
+			Ω(users[0].Value).Should(HavePrefix("other-binding-id "))
+
+			conf, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf).Should(ContainElement(users[0]))
+			Ω(conf).Should(HaveLen(3))
+		})
+
+		It("does nothing for users that do not exist", func() {
+			connectCount = 0
+			err := manager.DeleteUser("unknown")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(connectCount).Should(Equal(0))
+		})
+
+		Context("when redis fails to delete the user", func() {
+			BeforeEach(func() {
+				fakeClient.ExpectedDeleteACLUserErr = errors.New("connection reset")
+			})
+
+			It("returns the error and keeps the user", func() {
+				err := manager.DeleteUser("binding-id")
+				Ω(err).Should(MatchError("connection reset"))
+
+				users, err := acl.LoadUsers(usersPath)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(users).Should(HaveLen(2))
+			})
+		})
+	})
+})
@@ -0,0 +1,105 @@
+package acl
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pborman/uuid/uuid"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+const defaultUser = "default"
+
+var ErrGracePeriodNotSupported = errors.New("keeping the old password valid requires redis 6 or later")
+
+// Rotation asks for a new password, keeping the old one valid for
+// GracePeriodSeconds.
+type Rotation struct {
+	GracePeriodSeconds int `json:"grace_period_seconds"`
+}
+
+func (rotation Rotation) GracePeriod() time.Duration {
+	return time.Duration(rotation.GracePeriodSeconds) * time.Second
+}
+
+// PasswordRotator replaces the requirepass of a running redis and of its
+// config file, without a restart and without touching the data.
+//
+// During a grace period the old password is kept as a second password of the
+// default user. The old password is dropped by a timer, so it stays valid
+// until redis restarts if the process running the timer exits first.
+type PasswordRotator struct {
+	ConfPath string
+	Connect  func(password string) (client.Client, error)
+	Logger   lager.Logger
+}
+
+// Rotate sets a new generated password, which is returned.
+func (rotator *PasswordRotator) Rotate(gracePeriod time.Duration) (string, error) {
+	conf, err := redisconf.Load(rotator.ConfPath)
+	if err != nil {
+		return "", err
+	}
+	oldPassword := conf.Password()
+
+	redisClient, err := rotator.Connect(oldPassword)
+	if err != nil {
+		return "", err
+	}
+	defer redisClient.Disconnect()
+
+	if gracePeriod > 0 {
+		version, err := redisClient.RedisVersion()
+		if err != nil {
+			return "", err
+		}
+
+		if !Supported(version) {
+			return "", ErrGracePeriodNotSupported
+		}
+	}
+
+	newPassword := uuid.NewRandom().String()
+	if err := redisClient.SetPassword(newPassword); err != nil {
+		return "", err
+	}
+
+	conf.Set("requirepass", newPassword)
+	if err := conf.Save(rotator.ConfPath); err != nil {
+		if revertErr := redisClient.SetPassword(oldPassword); revertErr != nil {
+			rotator.Logger.Error("reverting-password-failed", revertErr)
+		}
+		return "", err
+	}
+
+	if gracePeriod > 0 {
+		if err := redisClient.SetACLUser(defaultUser, ">"+oldPassword); err != nil {
+			return "", err
+		}
+
+		time.AfterFunc(gracePeriod, func() {
+			rotator.dropPassword(newPassword, oldPassword)
+		})
+	}
+
+	return newPassword, nil
+}
+
+func (rotator *PasswordRotator) dropPassword(currentPassword, oldPassword string) {
+	redisClient, err := rotator.Connect(currentPassword)
+	if err != nil {
+		rotator.Logger.Error("dropping-old-password-failed", err)
+		return
+	}
+	defer redisClient.Disconnect()
+
+	if err := redisClient.SetACLUser(defaultUser, "<"+oldPassword); err != nil {
+		rotator.Logger.Error("dropping-old-password-failed", err)
+		return
+	}
+
+	rotator.Logger.Info("old-password-dropped")
+}
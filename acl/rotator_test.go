@@ -0,0 +1,131 @@
+package acl_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PasswordRotator", func() {
+	var (
+		rotator            *acl.PasswordRotator
+		fakeClient         *fakes.Client
+		expiryClient       *fakes.Client
+		connectedPasswords chan string
+		tmpDir             string
+		confPath           string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "password-rotator")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		confPath = filepath.Join(tmpDir, "redis.conf")
+		err = redisconf.New(
+			redisconf.Param{Key: "port", Value: "6379"},
+			redisconf.Param{Key: "requirepass", Value: "old-password"},
+		).Save(confPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeClient = &fakes.Client{Version: "6.2.14"}
+		expiryClient = &fakes.Client{}
+		connectedPasswords = make(chan string, 2)
+
+		rotator = &acl.PasswordRotator{
+			ConfPath: confPath,
+			Connect: func(password string) (client.Client, error) {
+				connectedPasswords <- password
+				if password == "old-password" {
+					return fakeClient, nil
+				}
+				return expiryClient, nil
+			},
+			Logger: lagertest.NewTestLogger("password-rotator"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("sets a new password in redis and in the config file", func() {
+		password, err := rotator.Rotate(0)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(password).ShouldNot(BeEmpty())
+		Ω(password).ShouldNot(Equal("old-password"))
+
+		Ω(<-connectedPasswords).Should(Equal("old-password"))
+		Ω(fakeClient.Passwords).Should(Equal([]string{password}))
+
+		conf, err := redisconf.Load(confPath)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.Password()).Should(Equal(password))
+		Ω(conf.Get("port")).Should(Equal("6379"))
+	})
+
+	It("does not keep the old password without a grace period", func() {
+		_, err := rotator.Rotate(0)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fakeClient.ACLUsers).Should(BeEmpty())
+	})
+
+	Context("with a grace period", func() {
+		It("keeps the old password valid until the grace period is over", func() {
+			password, err := rotator.Rotate(time.Millisecond * 50)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeClient.ACLUsers).Should(Equal(map[string][]string{
+				"default": {">old-password"},
+			}))
+
+			Ω(<-connectedPasswords).Should(Equal("old-password"))
+			Eventually(connectedPasswords).Should(Receive(Equal(password)))
+			Eventually(func() []string {
+				return expiryClient.ACLUsers["default"]
+			}).Should(Equal([]string{"<old-password"}))
+		})
+
+		Context("when redis does not support ACLs", func() {
+			BeforeEach(func() {
+				fakeClient.Version = "5.0.14"
+			})
+
+			It("does not change the password", func() {
+				_, err := rotator.Rotate(time.Minute)
+				Ω(err).Should(Equal(acl.ErrGracePeriodNotSupported))
+				Ω(fakeClient.Passwords).Should(BeEmpty())
+
+				conf, err := redisconf.Load(confPath)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(conf.Password()).Should(Equal("old-password"))
+			})
+		})
+	})
+
+	Context("when redis rejects the new password", func() {
+		BeforeEach(func() {
+			fakeClient.ExpectedSetPasswordErr = errors.New("ERR unknown command")
+		})
+
+		It("keeps the old password in the config file", func() {
+			_, err := rotator.Rotate(0)
+			Ω(err).Should(MatchError("ERR unknown command"))
+
+			conf, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf.Password()).Should(Equal("old-password"))
+		})
+	})
+})
@@ -0,0 +1,103 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+const userDirective = "user"
+
+var (
+	ErrNotSupported = errors.New("per-binding users require redis 6 or later")
+
+	keyPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_:.\-/]*$`)
+)
+
+// Scope restricts what the user of a binding may do.
+type Scope struct {
+	ReadOnly  bool   `json:"read_only"`
+	KeyPrefix string `json:"key_prefix"`
+}
+
+func (scope Scope) IsRestricted() bool {
+	return scope.ReadOnly || scope.KeyPrefix != ""
+}
+
+func (scope Scope) Validate() error {
+	if !keyPrefixPattern.MatchString(scope.KeyPrefix) {
+		return errors.New("key_prefix may only contain letters, digits and the characters _ : . - /")
+	}
+	return nil
+}
+
+// User is an ACL user of a binding. Only a hash of its password is kept.
+type User struct {
+	Name         string
+	PasswordHash string
+	Scope        Scope
+	AllChannels  bool
+}
+
+func NewUser(name, password string, scope Scope, redisVersion string) User {
+	hash := sha256.Sum256([]byte(password))
+
+	return User{
+		Name:         name,
+		PasswordHash: hex.EncodeToString(hash[:]),
+		Scope:        scope,
+		AllChannels:  versionAtLeast(redisVersion, 6, 2),
+	}
+}
+
+// Rules returns the ACL rules of the user, in the form accepted by both
+// ACL SETUSER and the user directive of redis.conf.
+func (user User) Rules() []string {
+	rules := []string{"reset", "on", "#" + user.PasswordHash, "~" + user.Scope.KeyPrefix + "*"}
+
+	if user.AllChannels {
+		rules = append(rules, "allchannels")
+	}
+
+	if user.Scope.ReadOnly {
+		return append(rules, "+@read", "+@connection")
+	}
+
+	return append(rules, "+@all", "-@admin")
+}
+
+func (user User) Param() redisconf.Param {
+	return redisconf.Param{
+		Key:   userDirective,
+		Value: user.Name + " " + strings.Join(user.Rules(), " "),
+	}
+}
+
+// Supported reports whether a redis-server of the given version has ACLs.
+func Supported(redisVersion string) bool {
+	return versionAtLeast(redisVersion, 6, 0)
+}
+
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	versionMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+
+	versionMinor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+
+	return versionMajor > major || (versionMajor == major && versionMinor >= minor)
+}
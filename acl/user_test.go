@@ -0,0 +1,56 @@
+package acl_test
+
+import (
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("User", func() {
+	const passwordHash = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+
+	It("grants everything but admin commands on all keys by default", func() {
+		user := acl.NewUser("binding-id", "secret", acl.Scope{}, "6.0.9")
+		Ω(user.Rules()).Should(Equal([]string{"reset", "on", "#" + passwordHash, "~*", "+@all", "-@admin"}))
+	})
+
+	It("only grants read commands to read-only users", func() {
+		user := acl.NewUser("binding-id", "secret", acl.Scope{ReadOnly: true}, "6.0.9")
+		Ω(user.Rules()).Should(Equal([]string{"reset", "on", "#" + passwordHash, "~*", "+@read", "+@connection"}))
+	})
+
+	It("restricts users to their key prefix", func() {
+		user := acl.NewUser("binding-id", "secret", acl.Scope{KeyPrefix: "app:"}, "6.0.9")
+		Ω(user.Rules()).Should(ContainElement("~app:*"))
+	})
+
+	It("grants access to all pub/sub channels on redis versions that restrict them", func() {
+		user := acl.NewUser("binding-id", "secret", acl.Scope{}, "7.0.11")
+		Ω(user.Rules()).Should(ContainElement("allchannels"))
+	})
+
+	It("renders as a redis.conf user directive", func() {
+		user := acl.NewUser("binding-id", "secret", acl.Scope{ReadOnly: true}, "6.0.9")
+		Ω(user.Param().Key).Should(Equal("user"))
+		Ω(user.Param().Value).Should(Equal("binding-id reset on #" + passwordHash + " ~* +@read +@connection"))
+	})
+
+	Describe("Supported", func() {
+		It("is true from redis 6 onwards", func() {
+			Ω(acl.Supported("5.0.14")).Should(BeFalse())
+			Ω(acl.Supported("2.8.24")).Should(BeFalse())
+			Ω(acl.Supported("6.0.0")).Should(BeTrue())
+			Ω(acl.Supported("7.2.4")).Should(BeTrue())
+			Ω(acl.Supported("")).Should(BeFalse())
+		})
+	})
+
+	Describe("Scope", func() {
+		It("rejects key prefixes with glob characters", func() {
+			Ω(acl.Scope{KeyPrefix: "app:*"}.Validate()).Should(HaveOccurred())
+			Ω(acl.Scope{KeyPrefix: "app [1]"}.Validate()).Should(HaveOccurred())
+			Ω(acl.Scope{KeyPrefix: "my-app/cache:"}.Validate()).ShouldNot(HaveOccurred())
+		})
+	})
+})
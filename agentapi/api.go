@@ -2,33 +2,191 @@ package agentapi
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/redisinfo"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
 )
 
 type redisResetter interface {
 	ResetRedis() error
+	ApplyConfig(overrides redisconf.Conf) error
 }
 
-func New(resetter redisResetter, configPath string) http.Handler {
+type dataImporter interface {
+	ImportData(source importer.Source) error
+	WaitForSync() error
+}
+
+type userManager interface {
+	CreateUser(name string, scope acl.Scope) (string, error)
+	SetUser(name, password string, scope acl.Scope) error
+	DeleteUser(name string) error
+}
+
+type passwordRotator interface {
+	Rotate(gracePeriod time.Duration) (string, error)
+}
+
+type versionReader interface {
+	RedisVersion() (string, error)
+}
+
+type sentinelManager interface {
+	Monitor(monitor sentinel.Monitor) error
+	Reset() error
+	Master(masterName string) (sentinel.Address, error)
+}
+
+type clusterManager interface {
+	NodeID() (string, error)
+	Join(join cluster.Join) error
+	WaitUntilReady() error
+	Reset() error
+}
+
+type keyCounter interface {
+	KeyCount() (int, error)
+}
+
+type infoReader interface {
+	Info() (redisinfo.Info, error)
+}
+
+type sentinelPort struct {
+	Port int `json:"port"`
+}
+
+type clusterNode struct {
+	NodeID string `json:"node_id"`
+}
+
+type keyCount struct {
+	Keys int `json:"keys"`
+}
+
+// binding is the scope of the user of a binding. The password is only given
+// for the replicas of an instance, which take the user of their master.
+type binding struct {
+	acl.Scope
+	Password string `json:"password,omitempty"`
+}
+
+type credentials struct {
+	Port         int    `json:"port"`
+	TLSPort      int    `json:"tls_port,omitempty"`
+	CACert       string `json:"ca_cert,omitempty"`
+	RedisVersion string `json:"redis_version,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password"`
+}
+
+// Dependencies are what the handlers of the agent work with. ConfigPath is
+// the live redis.conf and SentinelPort the port of the sentinel of the node,
+// 0 when the node has none.
+type Dependencies struct {
+	Resetter        redisResetter
+	DataImporter    dataImporter
+	UserManager     userManager
+	PasswordRotator passwordRotator
+	VersionReader   versionReader
+	KeyCounter      keyCounter
+	InfoReader      infoReader
+	SentinelManager sentinelManager
+	SentinelPort    int
+	ClusterManager  clusterManager
+	ConfigPath      string
+}
+
+func New(dependencies Dependencies) http.Handler {
 	router := mux.NewRouter()
 
 	router.Path("/").
 		Methods("DELETE").
-		HandlerFunc(resetHandler(resetter))
+		HandlerFunc(resetHandler(dependencies.Resetter, dependencies.SentinelManager, dependencies.ClusterManager))
 
 	router.Path("/").
 		Methods("GET").
-		HandlerFunc(credentialsHandler(configPath))
+		HandlerFunc(credentialsHandler(dependencies.VersionReader, dependencies.ConfigPath))
+
+	router.Path("/keys").
+		Methods("GET").
+		HandlerFunc(keyCountHandler(dependencies.KeyCounter))
+
+	router.Path("/info").
+		Methods("GET").
+		HandlerFunc(infoHandler(dependencies.InfoReader))
+
+	router.Path("/config").
+		Methods("PUT").
+		HandlerFunc(configHandler(dependencies.Resetter))
+
+	router.Path("/data").
+		Methods("PUT").
+		HandlerFunc(importHandler(dependencies.DataImporter))
+
+	router.Path("/replication").
+		Methods("GET").
+		HandlerFunc(replicationHandler(dependencies.DataImporter))
+
+	router.Path("/sentinel").
+		Methods("PUT").
+		HandlerFunc(monitorHandler(dependencies.SentinelManager, dependencies.SentinelPort))
+
+	router.Path("/sentinel/{master_name}").
+		Methods("GET").
+		HandlerFunc(masterHandler(dependencies.SentinelManager))
+
+	router.Path("/cluster").
+		Methods("GET").
+		HandlerFunc(clusterNodeHandler(dependencies.ClusterManager))
+
+	router.Path("/cluster").
+		Methods("PUT").
+		HandlerFunc(joinClusterHandler(dependencies.ClusterManager))
+
+	router.Path("/cluster/ready").
+		Methods("GET").
+		HandlerFunc(clusterReadyHandler(dependencies.ClusterManager))
+
+	router.Path("/bindings/{binding_id}").
+		Methods("PUT").
+		HandlerFunc(createUserHandler(dependencies.UserManager, dependencies.VersionReader, dependencies.ConfigPath))
+
+	router.Path("/bindings/{binding_id}").
+		Methods("DELETE").
+		HandlerFunc(deleteUserHandler(dependencies.UserManager))
+
+	router.Path("/password").
+		Methods("PUT").
+		HandlerFunc(rotatePasswordHandler(dependencies.PasswordRotator, dependencies.VersionReader, dependencies.ConfigPath))
 
 	return router
 }
 
-func resetHandler(resetter redisResetter) http.HandlerFunc {
+// resetHandler stops the sentinel before redis is reset, so that it cannot
+// make the fresh redis a replica again. Redis leaves its cluster first, so
+// that it no longer takes part in the gossip of the other nodes.
+func resetHandler(resetter redisResetter, sentinelManager sentinelManager, clusterManager clusterManager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if err := sentinelManager.Reset(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := clusterManager.Reset(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		err := resetter.ResetRedis()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -39,27 +197,276 @@ func resetHandler(resetter redisResetter) http.HandlerFunc {
 	}
 }
 
-func credentialsHandler(configPath string) http.HandlerFunc {
+func configHandler(resetter redisResetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		overrides := redisconf.Conf{}
+		if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := resetter.ApplyConfig(overrides)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func importHandler(dataImporter dataImporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := importer.Source{}
+		if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := dataImporter.ImportData(source)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// replicationHandler answers once a replica has completed the initial sync
+// with its master.
+func replicationHandler(dataImporter dataImporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := dataImporter.WaitForSync()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// monitorHandler has the sentinel of the node watch a master and returns the
+// port the sentinel listens on.
+func monitorHandler(sentinelManager sentinelManager, port int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		monitor := sentinel.Monitor{}
+		if err := json.NewDecoder(r.Body).Decode(&monitor); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := monitor.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := sentinelManager.Monitor(monitor)
+		if err == sentinel.ErrNotConfigured {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sentinelPort{Port: port})
+	}
+}
+
+// masterHandler returns the address of the current master as the sentinel of
+// the node sees it.
+func masterHandler(sentinelManager sentinelManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		master, err := sentinelManager.Master(mux.Vars(r)["master_name"])
+		if err == sentinel.ErrNotConfigured {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err == sentinel.ErrUnknownMaster {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(master)
+	}
+}
+
+// clusterNodeHandler returns the ID of the node in its cluster.
+func clusterNodeHandler(clusterManager clusterManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeID, err := clusterManager.NodeID()
+		if err == cluster.ErrNotEnabled {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(clusterNode{NodeID: nodeID})
+	}
+}
+
+// joinClusterHandler has the node meet its peers and take its slots or its
+// master.
+func joinClusterHandler(clusterManager clusterManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		join := cluster.Join{}
+		if err := json.NewDecoder(r.Body).Decode(&join); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := join.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := clusterManager.Join(join)
+		if err == cluster.ErrNotEnabled {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// clusterReadyHandler answers once the node sees every slot of its cluster
+// served.
+func clusterReadyHandler(clusterManager clusterManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := clusterManager.WaitUntilReady()
+		if err == cluster.ErrNotEnabled {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func createUserHandler(userManager userManager, versionReader versionReader, configPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		binding := binding{}
+		if err := json.NewDecoder(r.Body).Decode(&binding); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := binding.Scope.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		credentials, err := loadCredentials(versionReader, configPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		bindingID := mux.Vars(r)["binding_id"]
+		password := binding.Password
+		if password != "" {
+			err = userManager.SetUser(bindingID, password, binding.Scope)
+		} else {
+			password, err = userManager.CreateUser(bindingID, binding.Scope)
+		}
+		if err == acl.ErrNotSupported {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		credentials.Username = bindingID
+		credentials.Password = password
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(credentials)
+	}
+}
+
+func deleteUserHandler(userManager userManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := userManager.DeleteUser(mux.Vars(r)["binding_id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func rotatePasswordHandler(passwordRotator passwordRotator, versionReader versionReader, configPath string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		conf, err := redisconf.Load(configPath)
+		rotation := acl.Rotation{}
+		if err := json.NewDecoder(r.Body).Decode(&rotation); err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if rotation.GracePeriodSeconds < 0 {
+			http.Error(w, "grace_period_seconds must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		credentials, err := loadCredentials(versionReader, configPath)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		port, err := strconv.Atoi(conf.Get("port"))
+		password, err := passwordRotator.Rotate(rotation.GracePeriod())
+		if err == acl.ErrGracePeriodNotSupported {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		password := conf.Get("requirepass")
 
-		credentials := struct {
-			Port     int    `json:"port"`
-			Password string `json:"password"`
-		}{
-			Port:     port,
-			Password: password,
+		credentials.Password = password
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(credentials)
+	}
+}
+
+func credentialsHandler(versionReader versionReader, configPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		credentials, err := loadCredentials(versionReader, configPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -68,3 +475,68 @@ func credentialsHandler(configPath string) http.HandlerFunc {
 		encoder.Encode(credentials)
 	}
 }
+
+// keyCountHandler reports how many keys redis holds. It fails when redis does
+// not answer, which lets the broker check a node before handing it out.
+func keyCountHandler(keyCounter keyCounter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := keyCounter.KeyCount()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keyCount{Keys: keys})
+	}
+}
+
+// infoHandler reports the memory, clients, persistence, replication, keyspace
+// and stats sections of the INFO of redis.
+func infoHandler(infoReader infoReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, err := infoReader.Info()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// loadCredentials reads the connection details of redis from its config. The
+// redis version is informational only, so it is left out when redis cannot be
+// asked for it.
+func loadCredentials(versionReader versionReader, configPath string) (credentials, error) {
+	conf, err := redisconf.Load(configPath)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	port, err := strconv.Atoi(conf.Get("port"))
+	if err != nil {
+		return credentials{}, err
+	}
+
+	caCert, err := conf.CACert()
+	if err != nil {
+		return credentials{}, err
+	}
+
+	credentials := credentials{
+		Port:     port,
+		TLSPort:  conf.TLSPort(),
+		CACert:   caCert,
+		Password: conf.Password(),
+	}
+
+	if version, err := versionReader.RedisVersion(); err == nil {
+		credentials.RedisVersion = version
+	}
+
+	return credentials, nil
+}
@@ -7,24 +7,198 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/agentapi"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/redisinfo"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 type fakeRedisResetter struct {
-	deleteAllData func() error
+	deleteAllData    func() error
+	appliedOverrides redisconf.Conf
+	applyConfigErr   error
 }
 
 func (client *fakeRedisResetter) ResetRedis() error {
 	return client.deleteAllData()
 }
 
+func (client *fakeRedisResetter) ApplyConfig(overrides redisconf.Conf) error {
+	client.appliedOverrides = overrides
+	return client.applyConfigErr
+}
+
+type fakeDataImporter struct {
+	importedSources []importer.Source
+	importErr       error
+	syncCount       int
+	syncErr         error
+}
+
+func (dataImporter *fakeDataImporter) ImportData(source importer.Source) error {
+	dataImporter.importedSources = append(dataImporter.importedSources, source)
+	return dataImporter.importErr
+}
+
+func (dataImporter *fakeDataImporter) WaitForSync() error {
+	dataImporter.syncCount++
+	return dataImporter.syncErr
+}
+
+type fakeUserManager struct {
+	createdUsers  map[string]acl.Scope
+	userPasswords map[string]string
+	deletedUsers  []string
+	createUserErr error
+	deleteUserErr error
+}
+
+func (manager *fakeUserManager) CreateUser(name string, scope acl.Scope) (string, error) {
+	if manager.createUserErr != nil {
+		return "", manager.createUserErr
+	}
+	manager.createdUsers[name] = scope
+	return "user-password", nil
+}
+
+func (manager *fakeUserManager) SetUser(name, password string, scope acl.Scope) error {
+	if manager.createUserErr != nil {
+		return manager.createUserErr
+	}
+	manager.createdUsers[name] = scope
+	manager.userPasswords[name] = password
+	return nil
+}
+
+func (manager *fakeUserManager) DeleteUser(name string) error {
+	manager.deletedUsers = append(manager.deletedUsers, name)
+	return manager.deleteUserErr
+}
+
+type fakeSentinelManager struct {
+	monitors   []sentinel.Monitor
+	monitorErr error
+	resetCount int
+	resetErr   error
+	masters    map[string]sentinel.Address
+	masterErr  error
+}
+
+func (manager *fakeSentinelManager) Monitor(monitor sentinel.Monitor) error {
+	if manager.monitorErr != nil {
+		return manager.monitorErr
+	}
+	manager.monitors = append(manager.monitors, monitor)
+	return nil
+}
+
+func (manager *fakeSentinelManager) Reset() error {
+	manager.resetCount++
+	return manager.resetErr
+}
+
+func (manager *fakeSentinelManager) Master(masterName string) (sentinel.Address, error) {
+	if manager.masterErr != nil {
+		return sentinel.Address{}, manager.masterErr
+	}
+	master, ok := manager.masters[masterName]
+	if !ok {
+		return sentinel.Address{}, sentinel.ErrUnknownMaster
+	}
+	return master, nil
+}
+
+type fakeClusterManager struct {
+	nodeID     string
+	nodeIDErr  error
+	joins      []cluster.Join
+	joinErr    error
+	readyErr   error
+	resetCount int
+	resetErr   error
+}
+
+func (manager *fakeClusterManager) NodeID() (string, error) {
+	return manager.nodeID, manager.nodeIDErr
+}
+
+func (manager *fakeClusterManager) Join(join cluster.Join) error {
+	if manager.joinErr != nil {
+		return manager.joinErr
+	}
+	manager.joins = append(manager.joins, join)
+	return nil
+}
+
+func (manager *fakeClusterManager) WaitUntilReady() error {
+	return manager.readyErr
+}
+
+func (manager *fakeClusterManager) Reset() error {
+	manager.resetCount++
+	return manager.resetErr
+}
+
+type fakePasswordRotator struct {
+	gracePeriods []time.Duration
+	rotateErr    error
+}
+
+func (rotator *fakePasswordRotator) Rotate(gracePeriod time.Duration) (string, error) {
+	if rotator.rotateErr != nil {
+		return "", rotator.rotateErr
+	}
+	rotator.gracePeriods = append(rotator.gracePeriods, gracePeriod)
+	return "new-password", nil
+}
+
+type fakeVersionReader struct {
+	version    string
+	versionErr error
+}
+
+func (reader *fakeVersionReader) RedisVersion() (string, error) {
+	return reader.version, reader.versionErr
+}
+
+type fakeKeyCounter struct {
+	keys     int
+	countErr error
+}
+
+func (counter *fakeKeyCounter) KeyCount() (int, error) {
+	return counter.keys, counter.countErr
+}
+
+type fakeInfoReader struct {
+	info    redisinfo.Info
+	infoErr error
+}
+
+func (reader *fakeInfoReader) Info() (redisinfo.Info, error) {
+	return reader.info, reader.infoErr
+}
+
 var _ = Describe("redis agent HTTP API", func() {
 	var server *httptest.Server
 	var redisClient *fakeRedisResetter
+	var dataImporter *fakeDataImporter
+	var userManager *fakeUserManager
+	var passwordRotator *fakePasswordRotator
+	var versionReader *fakeVersionReader
+	var keyCounter *fakeKeyCounter
+	var infoReader *fakeInfoReader
+	var sentinelManager *fakeSentinelManager
+	var clusterManager *fakeClusterManager
 	var deleteCount int
 	var configPath string
 	var response *http.Response
@@ -34,11 +208,31 @@ var _ = Describe("redis agent HTTP API", func() {
 		configPath, err = filepath.Abs("assets/redis.conf")
 		Ω(err).ShouldNot(HaveOccurred())
 		redisClient = &fakeRedisResetter{}
+		dataImporter = &fakeDataImporter{}
+		userManager = &fakeUserManager{createdUsers: map[string]acl.Scope{}, userPasswords: map[string]string{}}
+		passwordRotator = &fakePasswordRotator{}
+		versionReader = &fakeVersionReader{version: "6.0.5"}
+		keyCounter = &fakeKeyCounter{}
+		infoReader = &fakeInfoReader{}
+		sentinelManager = &fakeSentinelManager{masters: map[string]sentinel.Address{}}
+		clusterManager = &fakeClusterManager{nodeID: "node-id"}
 		deleteCount = 0
 	})
 
 	JustBeforeEach(func() {
-		handler := agentapi.New(redisClient, configPath)
+		handler := agentapi.New(agentapi.Dependencies{
+			Resetter:        redisClient,
+			DataImporter:    dataImporter,
+			UserManager:     userManager,
+			PasswordRotator: passwordRotator,
+			VersionReader:   versionReader,
+			KeyCounter:      keyCounter,
+			InfoReader:      infoReader,
+			SentinelManager: sentinelManager,
+			SentinelPort:    26379,
+			ClusterManager:  clusterManager,
+			ConfigPath:      configPath,
+		})
 		server = httptest.NewServer(handler)
 	})
 
@@ -62,6 +256,39 @@ var _ = Describe("redis agent HTTP API", func() {
 
 				Ω(response["port"]).Should(Equal(float64(1234))) // json.Unmarshal provides float64s by default
 				Ω(response["password"]).Should(Equal("an-password"))
+				Ω(response["redis_version"]).Should(Equal("6.0.5"))
+				Ω(response).ShouldNot(HaveKey("tls_port"))
+				Ω(response).ShouldNot(HaveKey("ca_cert"))
+			})
+		})
+
+		Context("When TLS is enabled", func() {
+			BeforeEach(func() {
+				configPath = "assets/redis-tls.conf"
+			})
+
+			It("returns the TLS port and the CA certificate", func() {
+				credentials := map[string]interface{}{}
+				err := json.NewDecoder(response.Body).Decode(&credentials)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(credentials["tls_port"]).Should(Equal(float64(6380)))
+				Ω(credentials["ca_cert"]).Should(ContainSubstring("an-ca-cert"))
+			})
+		})
+
+		Context("When the redis version cannot be read", func() {
+			BeforeEach(func() {
+				versionReader.versionErr = errors.New("connection refused")
+			})
+
+			It("returns the credentials without the version", func() {
+				credentials := map[string]interface{}{}
+				err := json.NewDecoder(response.Body).Decode(&credentials)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(credentials["port"]).Should(Equal(float64(1234)))
+				Ω(credentials).ShouldNot(HaveKey("redis_version"))
 			})
 		})
 
@@ -83,6 +310,95 @@ var _ = Describe("redis agent HTTP API", func() {
 		})
 	})
 
+	Describe("GET /keys", func() {
+		JustBeforeEach(func() {
+			response = makeRequest("GET", server.URL+"/keys")
+		})
+
+		Context("when redis answers", func() {
+			BeforeEach(func() {
+				keyCounter.keys = 3
+			})
+
+			It("returns the number of keys", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				body := map[string]interface{}{}
+				err := json.NewDecoder(response.Body).Decode(&body)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(body).Should(Equal(map[string]interface{}{"keys": float64(3)}))
+			})
+		})
+
+		Context("when redis does not answer", func() {
+			BeforeEach(func() {
+				keyCounter.countErr = errors.New("connection refused")
+			})
+
+			It("returns 503 with the error", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+
+				body, err := ioutil.ReadAll(response.Body)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(body)).Should(ContainSubstring("connection refused"))
+			})
+		})
+	})
+
+	Describe("GET /info", func() {
+		JustBeforeEach(func() {
+			response = makeRequest("GET", server.URL+"/info")
+		})
+
+		Context("when redis answers", func() {
+			BeforeEach(func() {
+				infoReader.info = redisinfo.Parse(map[string]string{
+					"used_memory":       "1024",
+					"connected_clients": "2",
+					"role":              "master",
+					"db0":               "keys=3,expires=1,avg_ttl=0",
+				})
+			})
+
+			It("returns the sections of INFO", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(response.Header.Get("Content-Type")).Should(Equal("application/json"))
+
+				info := redisinfo.Info{}
+				err := json.NewDecoder(response.Body).Decode(&info)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(info).Should(Equal(infoReader.info))
+			})
+
+			It("names the fields after those of INFO", func() {
+				body := map[string]map[string]interface{}{}
+				err := json.NewDecoder(response.Body).Decode(&body)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(body["memory"]["used_memory"]).Should(Equal(float64(1024)))
+				Ω(body["clients"]["connected_clients"]).Should(Equal(float64(2)))
+				Ω(body["replication"]["role"]).Should(Equal("master"))
+				Ω(body["keyspace"]["db0"]).Should(HaveKeyWithValue("keys", float64(3)))
+				Ω(body).Should(HaveKey("persistence"))
+				Ω(body).Should(HaveKey("stats"))
+			})
+		})
+
+		Context("when redis does not answer", func() {
+			BeforeEach(func() {
+				infoReader.infoErr = errors.New("connection refused")
+			})
+
+			It("returns 503 with the error", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+
+				body, err := ioutil.ReadAll(response.Body)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(body)).Should(ContainSubstring("connection refused"))
+			})
+		})
+	})
+
 	Describe("DELETE /", func() {
 		Context("When it can connect to Redis successfully", func() {
 			JustBeforeEach(func() {
@@ -98,6 +414,14 @@ var _ = Describe("redis agent HTTP API", func() {
 				Ω(deleteCount).To(Equal(1))
 			})
 
+			It("stops the sentinel", func() {
+				Ω(sentinelManager.resetCount).To(Equal(1))
+			})
+
+			It("resets the cluster state", func() {
+				Ω(clusterManager.resetCount).To(Equal(1))
+			})
+
 			It("returns HTTP 200 OK", func() {
 				Ω(response.StatusCode).Should(Equal(200))
 			})
@@ -124,6 +448,478 @@ var _ = Describe("redis agent HTTP API", func() {
 		})
 	})
 
+	Describe("PUT /config", func() {
+		var requestBody string
+
+		BeforeEach(func() {
+			requestBody = `[{"key":"maxmemory-policy","value":"noeviction"}]`
+		})
+
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("PUT", server.URL+"/config", strings.NewReader(requestBody))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err = http.DefaultClient.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("applies the overrides", func() {
+			Ω(response.StatusCode).Should(Equal(200))
+			Ω(redisClient.appliedOverrides).Should(Equal(redisconf.New(
+				redisconf.Param{Key: "maxmemory-policy", Value: "noeviction"},
+			)))
+		})
+
+		Context("when the body is not valid", func() {
+			BeforeEach(func() {
+				requestBody = "{{"
+			})
+
+			It("returns 400", func() {
+				Ω(response.StatusCode).Should(Equal(400))
+			})
+		})
+
+		Context("when applying the overrides goes wrong", func() {
+			BeforeEach(func() {
+				redisClient.applyConfigErr = errors.New("monit is sad")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(500))
+			})
+		})
+	})
+
+	Describe("PUT /data", func() {
+		var requestBody string
+
+		BeforeEach(func() {
+			requestBody = `{"host":"10.0.0.1","port":3456,"password":"secret"}`
+		})
+
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("PUT", server.URL+"/data", strings.NewReader(requestBody))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err = http.DefaultClient.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("imports the data from the source", func() {
+			Ω(response.StatusCode).Should(Equal(200))
+			Ω(dataImporter.importedSources).Should(Equal([]importer.Source{
+				{Host: "10.0.0.1", Port: 3456, Password: "secret"},
+			}))
+		})
+
+		Context("when the body is not valid", func() {
+			BeforeEach(func() {
+				requestBody = "{{"
+			})
+
+			It("returns 400", func() {
+				Ω(response.StatusCode).Should(Equal(400))
+			})
+		})
+
+		Context("when importing the data goes wrong", func() {
+			BeforeEach(func() {
+				dataImporter.importErr = errors.New("sync timed out")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(500))
+			})
+		})
+	})
+
+	Context("when the sentinel cannot be stopped", func() {
+		JustBeforeEach(func() {
+			sentinelManager.resetErr = errors.New("monit timed out")
+			redisClient.deleteAllData = func() error {
+				deleteCount++
+				return nil
+			}
+			response = makeRequest("DELETE", server.URL)
+		})
+
+		It("returns 500 without resetting redis", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			Ω(deleteCount).Should(Equal(0))
+		})
+	})
+
+	Context("when redis cannot leave its cluster", func() {
+		JustBeforeEach(func() {
+			clusterManager.resetErr = errors.New("ERR CLUSTER RESET can't be called with master nodes containing keys")
+			redisClient.deleteAllData = func() error {
+				deleteCount++
+				return nil
+			}
+			response = makeRequest("DELETE", server.URL)
+		})
+
+		It("returns 500 without resetting redis", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			Ω(deleteCount).Should(Equal(0))
+		})
+	})
+
+	Describe("GET /cluster", func() {
+		It("returns the ID of the node", func() {
+			response = makeRequest("GET", server.URL+"/cluster")
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			body, err := ioutil.ReadAll(response.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(body).Should(MatchJSON(`{"node_id":"node-id"}`))
+		})
+
+		It("returns 409 when cluster mode is not enabled", func() {
+			clusterManager.nodeIDErr = cluster.ErrNotEnabled
+
+			response = makeRequest("GET", server.URL+"/cluster")
+			Ω(response.StatusCode).Should(Equal(http.StatusConflict))
+		})
+	})
+
+	Describe("PUT /cluster", func() {
+		var requestBody string
+
+		BeforeEach(func() {
+			requestBody = `{"peers":[{"host":"10.0.0.2","port":6379}],"slots":{"first":0,"last":5460}}`
+		})
+
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("PUT", server.URL+"/cluster", strings.NewReader(requestBody))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err = http.DefaultClient.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("has the node join the cluster", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			Ω(clusterManager.joins).Should(Equal([]cluster.Join{{
+				Peers: []cluster.Address{{Host: "10.0.0.2", Port: 6379}},
+				Slots: &cluster.Slots{First: 0, Last: 5460},
+			}}))
+		})
+
+		Context("when the join is invalid", func() {
+			BeforeEach(func() {
+				requestBody = `{"slots":{"first":0,"last":5460},"master_id":"master-id"}`
+			})
+
+			It("returns 400", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+				Ω(clusterManager.joins).Should(BeEmpty())
+			})
+		})
+
+		Context("when the node cannot join", func() {
+			BeforeEach(func() {
+				clusterManager.joinErr = errors.New("timed out replicating master-id")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("GET /cluster/ready", func() {
+		It("waits for the cluster", func() {
+			response = makeRequest("GET", server.URL+"/cluster/ready")
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+		})
+
+		It("returns 500 when the cluster does not become ready", func() {
+			clusterManager.readyErr = errors.New("timed out waiting for the cluster")
+
+			response = makeRequest("GET", server.URL+"/cluster/ready")
+			Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Describe("PUT /sentinel", func() {
+		var requestBody string
+
+		BeforeEach(func() {
+			requestBody = `{"master_name":"instance-id","host":"10.0.0.1","port":6379,"quorum":2,"password":"secret","sentinel_password":"sentinel-secret"}`
+		})
+
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("PUT", server.URL+"/sentinel", strings.NewReader(requestBody))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err = http.DefaultClient.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("has the sentinel watch the master and returns its port", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			Ω(sentinelManager.monitors).Should(Equal([]sentinel.Monitor{{
+				MasterName: "instance-id",
+				Host:       "10.0.0.1",
+				Port:       6379,
+				Quorum:     2,
+				Password:   "secret",
+
+				SentinelPassword: "sentinel-secret",
+			}}))
+
+			body, err := ioutil.ReadAll(response.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(body).Should(MatchJSON(`{"port":26379}`))
+		})
+
+		Context("when the master is incomplete", func() {
+			BeforeEach(func() {
+				requestBody = `{"master_name":"instance-id"}`
+			})
+
+			It("returns 400", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("when sentinel is not configured on the node", func() {
+			BeforeEach(func() {
+				sentinelManager.monitorErr = sentinel.ErrNotConfigured
+			})
+
+			It("returns 501", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusNotImplemented))
+			})
+		})
+	})
+
+	Describe("GET /sentinel/:master_name", func() {
+		It("returns the current master", func() {
+			sentinelManager.masters["instance-id"] = sentinel.Address{Host: "10.0.0.2", Port: 6379}
+
+			response = makeRequest("GET", server.URL+"/sentinel/instance-id")
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			body, err := ioutil.ReadAll(response.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(body).Should(MatchJSON(`{"host":"10.0.0.2","port":6379}`))
+		})
+
+		It("returns 404 for masters the sentinel does not watch", func() {
+			response = makeRequest("GET", server.URL+"/sentinel/unknown")
+			Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("returns 503 when the sentinel does not answer", func() {
+			sentinelManager.masterErr = errors.New("connection refused")
+
+			response = makeRequest("GET", server.URL+"/sentinel/instance-id")
+			Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Describe("GET /replication", func() {
+		JustBeforeEach(func() {
+			response = makeRequest("GET", server.URL+"/replication")
+		})
+
+		It("waits for the initial sync with the master", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			Ω(dataImporter.syncCount).Should(Equal(1))
+		})
+
+		Context("when the sync does not complete", func() {
+			BeforeEach(func() {
+				dataImporter.syncErr = errors.New("timed out")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("PUT /bindings/:binding_id", func() {
+		var requestBody string
+
+		BeforeEach(func() {
+			requestBody = `{"read_only":true,"key_prefix":"app:"}`
+		})
+
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("PUT", server.URL+"/bindings/binding-id", strings.NewReader(requestBody))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err = http.DefaultClient.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("creates a user for the binding and returns its credentials", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+			Ω(userManager.createdUsers).Should(Equal(map[string]acl.Scope{
+				"binding-id": {ReadOnly: true, KeyPrefix: "app:"},
+			}))
+
+			credentials := map[string]interface{}{}
+			err := json.NewDecoder(response.Body).Decode(&credentials)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(Equal(map[string]interface{}{
+				"port":          float64(1234),
+				"redis_version": "6.0.5",
+				"username":      "binding-id",
+				"password":      "user-password",
+			}))
+		})
+
+		Context("when the password of the user is given", func() {
+			BeforeEach(func() {
+				requestBody = `{"read_only":true,"password":"master-password"}`
+			})
+
+			It("creates the user with that password", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+				Ω(userManager.createdUsers).Should(Equal(map[string]acl.Scope{
+					"binding-id": {ReadOnly: true},
+				}))
+				Ω(userManager.userPasswords).Should(Equal(map[string]string{
+					"binding-id": "master-password",
+				}))
+
+				credentials := map[string]interface{}{}
+				err := json.NewDecoder(response.Body).Decode(&credentials)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(credentials["password"]).Should(Equal("master-password"))
+			})
+		})
+
+		Context("when the scope is not valid", func() {
+			BeforeEach(func() {
+				requestBody = `{"key_prefix":"*"}`
+			})
+
+			It("returns 400", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+				Ω(userManager.createdUsers).Should(BeEmpty())
+			})
+		})
+
+		Context("when redis does not support ACLs", func() {
+			BeforeEach(func() {
+				userManager.createUserErr = acl.ErrNotSupported
+			})
+
+			It("returns 501", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusNotImplemented))
+			})
+		})
+
+		Context("when creating the user goes wrong", func() {
+			BeforeEach(func() {
+				userManager.createUserErr = errors.New("connection refused")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("DELETE /bindings/:binding_id", func() {
+		JustBeforeEach(func() {
+			response = makeRequest("DELETE", server.URL+"/bindings/binding-id")
+		})
+
+		It("deletes the user of the binding", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			Ω(userManager.deletedUsers).Should(Equal([]string{"binding-id"}))
+		})
+
+		Context("when deleting the user goes wrong", func() {
+			BeforeEach(func() {
+				userManager.deleteUserErr = errors.New("connection refused")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("PUT /password", func() {
+		var requestBody string
+
+		BeforeEach(func() {
+			requestBody = `{"grace_period_seconds":300}`
+		})
+
+		JustBeforeEach(func() {
+			request, err := http.NewRequest("PUT", server.URL+"/password", strings.NewReader(requestBody))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err = http.DefaultClient.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("rotates the password with the grace period and returns the new credentials", func() {
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			Ω(passwordRotator.gracePeriods).Should(Equal([]time.Duration{5 * time.Minute}))
+
+			credentials := map[string]interface{}{}
+			err := json.NewDecoder(response.Body).Decode(&credentials)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(Equal(map[string]interface{}{
+				"port":          float64(1234),
+				"redis_version": "6.0.5",
+				"password":      "new-password",
+			}))
+		})
+
+		Context("without a body", func() {
+			BeforeEach(func() {
+				requestBody = ""
+			})
+
+			It("rotates the password without a grace period", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(passwordRotator.gracePeriods).Should(Equal([]time.Duration{0}))
+			})
+		})
+
+		Context("when the grace period is negative", func() {
+			BeforeEach(func() {
+				requestBody = `{"grace_period_seconds":-1}`
+			})
+
+			It("returns 400", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+				Ω(passwordRotator.gracePeriods).Should(BeEmpty())
+			})
+		})
+
+		Context("when redis cannot keep the old password", func() {
+			BeforeEach(func() {
+				passwordRotator.rotateErr = acl.ErrGracePeriodNotSupported
+			})
+
+			It("returns 501", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusNotImplemented))
+			})
+		})
+
+		Context("when the rotation fails", func() {
+			BeforeEach(func() {
+				passwordRotator.rotateErr = errors.New("connection refused")
+			})
+
+			It("returns 500", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
 	Describe("All other HTTP methods", func() {
 		for _, method := range []string{"POST", "PUT"} {
 			requestMethod := method
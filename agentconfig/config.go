@@ -2,8 +2,13 @@ package agentconfig
 
 import (
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
 )
 
 type AuthConfiguration struct {
@@ -12,11 +17,68 @@ type AuthConfiguration struct {
 }
 
 type Config struct {
-	DefaultConfPath     string            `yaml:"default_conf_path"`
-	ConfPath            string            `yaml:"conf_path"`
-	MonitExecutablePath string            `yaml:"monit_executable_path"`
-	Port                string            `yaml:"backend_port"`
-	AuthConfiguration   AuthConfiguration `yaml:"auth"`
+	DefaultConfPath     string                `yaml:"default_conf_path"`
+	ConfPath            string                `yaml:"conf_path"`
+	OverridesConfPath   string                `yaml:"overrides_conf_path"`
+	UsersConfPath       string                `yaml:"users_conf_path"`
+	MonitExecutablePath string                `yaml:"monit_executable_path"`
+	Port                string                `yaml:"backend_port"`
+	AuthConfiguration   AuthConfiguration     `yaml:"auth"`
+	TLS                 TLSConfiguration      `yaml:"tls"`
+	APITLS              APITLSConfiguration   `yaml:"api_tls"`
+	Sentinel            SentinelConfiguration `yaml:"sentinel"`
+
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
+}
+
+// ShutdownTimeout is how long the agent waits for in-flight requests, such
+// as a reset, when it is asked to stop.
+func (config *Config) ShutdownTimeout() time.Duration {
+	if config.ShutdownTimeoutSeconds <= 0 {
+		return shutdown.DefaultTimeout
+	}
+	return time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+}
+
+// APITLSConfiguration makes the agent serve its API with TLS. With a client
+// CA certificate only clients presenting a certificate issued by that CA are
+// accepted.
+type APITLSConfiguration struct {
+	CertFile         string `yaml:"cert_file"`
+	KeyFile          string `yaml:"key_file"`
+	ClientCACertFile string `yaml:"client_ca_cert_file"`
+}
+
+// TLSEnabled tells whether the agent serves its API with TLS.
+func (config *Config) TLSEnabled() bool {
+	return config.APITLS.CertFile != ""
+}
+
+// TLSConfiguration lets redis accept TLS connections on a port of its own,
+// using operator-supplied certificate files. TLS is off without a port.
+type TLSConfiguration struct {
+	Port       int    `yaml:"port"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	CACertFile string `yaml:"ca_cert_file"`
+}
+
+// SentinelConfiguration lets the agent run redis-sentinel for instances of
+// sentinel plans. Sentinel is off without a port.
+type SentinelConfiguration struct {
+	Port                  int    `yaml:"port"`
+	ConfPath              string `yaml:"conf_path"`
+	DownAfterMilliseconds int    `yaml:"down_after_milliseconds"`
+}
+
+// RedisTLS is the TLS configuration in the form redisconf applies it.
+func (config *Config) RedisTLS() redisconf.TLS {
+	return redisconf.TLS{
+		Port:       config.TLS.Port,
+		CertFile:   config.TLS.CertFile,
+		KeyFile:    config.TLS.KeyFile,
+		CACertFile: config.TLS.CACertFile,
+	}
 }
 
 func Load(path string) (*Config, error) {
@@ -30,5 +92,17 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.OverridesConfPath == "" {
+		config.OverridesConfPath = config.ConfPath + ".overrides"
+	}
+
+	if config.UsersConfPath == "" {
+		config.UsersConfPath = config.ConfPath + ".users"
+	}
+
+	if config.Sentinel.ConfPath == "" {
+		config.Sentinel.ConfPath = filepath.Join(filepath.Dir(config.ConfPath), "sentinel.conf")
+	}
+
 	return config, nil
 }
@@ -3,11 +3,13 @@ package agentconfig_test
 import (
 	"path"
 	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/pivotal-cf/cf-redis-broker/agentconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
 var _ = Describe("Config", func() {
@@ -38,6 +40,14 @@ var _ = Describe("Config", func() {
 				Expect(config.ConfPath).To(Equal("/conf/path"))
 			})
 
+			It("Defaults the overrides_conf_path to sit next to the conf_path", func() {
+				Expect(config.OverridesConfPath).To(Equal("/conf/path.overrides"))
+			})
+
+			It("Defaults the users_conf_path to sit next to the conf_path", func() {
+				Expect(config.UsersConfPath).To(Equal("/conf/path.users"))
+			})
+
 			It("Has the correct monit_executable_path", func() {
 				Expect(config.MonitExecutablePath).To(Equal("/foo/monit"))
 			})
@@ -50,6 +60,41 @@ var _ = Describe("Config", func() {
 				Expect(config.AuthConfiguration.Username).To(Equal("admin"))
 				Expect(config.AuthConfiguration.Password).To(Equal("secret"))
 			})
+
+			It("Has the TLS settings for its API", func() {
+				Expect(config.TLSEnabled()).To(BeTrue())
+				Expect(config.APITLS).To(Equal(agentconfig.APITLSConfiguration{
+					CertFile:         "/certs/agent.crt",
+					KeyFile:          "/certs/agent.key",
+					ClientCACertFile: "/certs/broker-ca.crt",
+				}))
+			})
+
+			It("Has the shutdown timeout", func() {
+				Expect(config.ShutdownTimeout()).To(Equal(time.Minute))
+			})
+
+			It("Waits 30 seconds for in-flight requests by default", func() {
+				config.ShutdownTimeoutSeconds = 0
+				Expect(config.ShutdownTimeout()).To(Equal(30 * time.Second))
+			})
+
+			It("Has the sentinel settings", func() {
+				Expect(config.Sentinel).To(Equal(agentconfig.SentinelConfiguration{
+					Port:                  26379,
+					ConfPath:              "/conf/sentinel.conf",
+					DownAfterMilliseconds: 3000,
+				}))
+			})
+
+			It("Has the TLS settings for redis", func() {
+				Expect(config.RedisTLS()).To(Equal(redisconf.TLS{
+					Port:       6380,
+					CertFile:   "/certs/redis.crt",
+					KeyFile:    "/certs/redis.key",
+					CACertFile: "/certs/ca.crt",
+				}))
+			})
 		})
 	})
 })
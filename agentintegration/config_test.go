@@ -0,0 +1,88 @@
+package agentintegration_test
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/pivotal-cf/cf-redis-broker/integration/helpers"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PUT /config", func() {
+	var (
+		redisConn redis.Conn
+		aofPath   string
+	)
+
+	BeforeEach(func() {
+		agentSession = startAgent()
+		redisSession, aofPath = startRedisAndBlockUntilUp()
+	})
+
+	AfterEach(func() {
+		stopAgent(agentSession)
+		stopRedisAndDeleteData(redisConn, aofPath)
+	})
+
+	It("keeps the data when AOF is switched off", func() {
+		redisConn = applyConfig(`[{"key":"appendonly","value":"no"}]`)
+
+		value, err := redis.String(redisConn.Do("GET", "TEST-KEY"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(value).Should(Equal("TEST-VALUE"))
+	})
+
+	It("keeps the data when AOF is switched back on", func() {
+		redisConn = applyConfig(`[{"key":"appendonly","value":"no"}]`)
+		_, err := redisConn.Do("SET", "OTHER-KEY", "OTHER-VALUE")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		redisConn = applyConfig(`[{"key":"appendonly","value":"yes"}]`)
+
+		values, err := redis.Strings(redisConn.Do("MGET", "TEST-KEY", "OTHER-KEY"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(values).Should(Equal([]string{"TEST-VALUE", "OTHER-VALUE"}))
+	})
+})
+
+// applyConfig has the agent apply the overrides, restarts redis the way monit
+// would and connects to it again.
+func applyConfig(overrides string) redis.Conn {
+	redisRestarted := make(chan bool)
+	httpRequestReturned := make(chan bool)
+
+	go checkRedisStopAndStart(redisRestarted)
+	go doConfigRequest(overrides, httpRequestReturned)
+
+	select {
+	case <-redisRestarted:
+		<-httpRequestReturned
+	case <-httpRequestReturned:
+		Fail("PUT request returned before redis had been restarted")
+	case <-time.After(time.Second * 10):
+		Fail("Test timed out after 10 seconds")
+	}
+
+	conf, err := redisconf.Load(redisConfPath)
+	Ω(err).ShouldNot(HaveOccurred())
+	Expect(helpers.ServiceAvailable(uint(conf.Port()))).To(BeTrue())
+
+	return helpers.BuildRedisClientFromConf(conf)
+}
+
+func doConfigRequest(overrides string, c chan<- bool) {
+	defer GinkgoRecover()
+
+	request, _ := http.NewRequest("PUT", "http://127.0.0.1:9876/config", strings.NewReader(overrides))
+	request.SetBasicAuth("admin", "supersecretpassword")
+	response, err := http.DefaultClient.Do(request)
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(response.StatusCode).To(Equal(http.StatusOK))
+
+	c <- true
+}
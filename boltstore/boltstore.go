@@ -0,0 +1,198 @@
+package boltstore
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+var (
+	nodesBucket    = []byte("dedicated-nodes")
+	bindingsBucket = []byte("dedicated-bindings")
+	sharedBucket   = []byte("shared-instances")
+
+	nodesKey = []byte("nodes")
+)
+
+// openTimeout is how long Open waits for another process to close the
+// database.
+const openTimeout = time.Second
+
+// Store keeps the state of both the dedicated nodes and the shared instances
+// in a BoltDB file. Every save is a transaction that only writes what
+// changed, so binding an instance does not rewrite the bindings of all the
+// others.
+type Store struct {
+	db *bolt.DB
+}
+
+type nodes struct {
+	AvailableInstances []*redis.Instance `json:"available_instances"`
+	AllocatedInstances []*redis.Instance `json:"allocated_instances"`
+	AddedNodes         []string          `json:"added_nodes,omitempty"`
+	RemovedNodes       []string          `json:"removed_nodes,omitempty"`
+}
+
+// Open opens the database at path, creating it if needed. Only one process
+// can have the database open at a time.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{nodesBucket, bindingsBucket, sharedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+// IsEmpty reports whether nothing was ever saved, e.g. because the state was
+// not migrated from the statefile yet.
+func (store *Store) IsEmpty() (bool, error) {
+	empty := true
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{nodesBucket, bindingsBucket, sharedBucket} {
+			if key, _ := tx.Bucket(bucket).Cursor().First(); key != nil {
+				empty = false
+			}
+		}
+		return nil
+	})
+
+	return empty, err
+}
+
+func (store *Store) Load() (redis.Statefile, error) {
+	state := redis.Statefile{
+		InstanceBindings: map[string][]string{},
+	}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		if nodesBytes := tx.Bucket(nodesBucket).Get(nodesKey); nodesBytes != nil {
+			saved := nodes{}
+			if err := json.Unmarshal(nodesBytes, &saved); err != nil {
+				return err
+			}
+			state.AvailableInstances = saved.AvailableInstances
+			state.AllocatedInstances = saved.AllocatedInstances
+			state.AddedNodes = saved.AddedNodes
+			state.RemovedNodes = saved.RemovedNodes
+		}
+
+		return tx.Bucket(bindingsBucket).ForEach(func(instanceID, bindingsBytes []byte) error {
+			bindings := []string{}
+			if err := json.Unmarshal(bindingsBytes, &bindings); err != nil {
+				return err
+			}
+			state.InstanceBindings[string(instanceID)] = bindings
+			return nil
+		})
+	})
+
+	return state, err
+}
+
+func (store *Store) Save(update redis.StateUpdate) error {
+	nodesBytes, err := json.Marshal(nodes{
+		AvailableInstances: update.AvailableInstances,
+		AllocatedInstances: update.AllocatedInstances,
+		AddedNodes:         update.AddedNodes,
+		RemovedNodes:       update.RemovedNodes,
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(nodesBucket).Put(nodesKey, nodesBytes); err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(bindingsBucket)
+		for instanceID, bindings := range update.Bindings {
+			if bindings == nil {
+				if err := bucket.Delete([]byte(instanceID)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			bindingsBytes, err := json.Marshal(bindings)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(instanceID), bindingsBytes); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (store *Store) Metadata(instanceID string) (redis.InstanceMetadata, error) {
+	metadata := redis.InstanceMetadata{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		metadataBytes := tx.Bucket(sharedBucket).Get([]byte(instanceID))
+		if metadataBytes == nil {
+			return nil
+		}
+		return json.Unmarshal(metadataBytes, &metadata)
+	})
+
+	return metadata, err
+}
+
+func (store *Store) AllMetadata() (map[string]redis.InstanceMetadata, error) {
+	allMetadata := map[string]redis.InstanceMetadata{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sharedBucket).ForEach(func(instanceID, metadataBytes []byte) error {
+			metadata := redis.InstanceMetadata{}
+			if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+				return err
+			}
+			allMetadata[string(instanceID)] = metadata
+			return nil
+		})
+	})
+
+	return allMetadata, err
+}
+
+func (store *Store) PutMetadata(instanceID string, metadata redis.InstanceMetadata) error {
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sharedBucket).Put([]byte(instanceID), metadataBytes)
+	})
+}
+
+func (store *Store) DeleteMetadata(instanceID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sharedBucket).Delete([]byte(instanceID))
+	})
+}
@@ -0,0 +1,15 @@
+package boltstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBoltstore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_boltstore.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Boltstore Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,157 @@
+package boltstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/boltstore"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		tmpDir string
+		dbPath string
+		store  *boltstore.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "boltstore")
+		Ω(err).ShouldNot(HaveOccurred())
+		dbPath = filepath.Join(tmpDir, "state.db")
+
+		store, err = boltstore.Open(dbPath)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	reopen := func() {
+		Ω(store.Close()).Should(Succeed())
+
+		var err error
+		store, err = boltstore.Open(dbPath)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	It("refuses to open a database another store has open", func() {
+		_, err := boltstore.Open(dbPath)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("is empty until something is saved", func() {
+		Ω(store.IsEmpty()).Should(BeTrue())
+
+		err := store.PutMetadata("instance-1", redis.InstanceMetadata{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(store.IsEmpty()).Should(BeFalse())
+	})
+
+	Describe("the dedicated state", func() {
+		It("is empty before anything is saved", func() {
+			state, err := store.Load()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.AllocatedInstances).Should(BeEmpty())
+			Ω(state.InstanceBindings).Should(BeEmpty())
+		})
+
+		It("loads what was saved", func() {
+			err := store.Save(redis.StateUpdate{
+				AvailableInstances: []*redis.Instance{{Host: "10.0.0.1"}},
+				AllocatedInstances: []*redis.Instance{{ID: "instance-1", Host: "10.0.0.2"}},
+				Bindings:           map[string][]string{"instance-1": {"binding-1"}},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			reopen()
+
+			state, err := store.Load()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.AvailableInstances).Should(Equal([]*redis.Instance{{Host: "10.0.0.1"}}))
+			Ω(state.AllocatedInstances).Should(Equal([]*redis.Instance{{ID: "instance-1", Host: "10.0.0.2"}}))
+			Ω(state.InstanceBindings).Should(Equal(map[string][]string{"instance-1": {"binding-1"}}))
+		})
+
+		It("keeps the bindings of instances that are not in an update", func() {
+			err := store.Save(redis.StateUpdate{
+				Bindings: map[string][]string{
+					"instance-1": {"binding-1"},
+					"instance-2": {"binding-2"},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save(redis.StateUpdate{
+				Bindings: map[string][]string{"instance-1": {"binding-1", "binding-3"}},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			state, err := store.Load()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.InstanceBindings).Should(Equal(map[string][]string{
+				"instance-1": {"binding-1", "binding-3"},
+				"instance-2": {"binding-2"},
+			}))
+		})
+
+		It("removes the bindings of instances updated with nil", func() {
+			err := store.Save(redis.StateUpdate{
+				Bindings: map[string][]string{"instance-1": {}},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save(redis.StateUpdate{
+				Bindings: map[string][]string{"instance-1": nil},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			state, err := store.Load()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.InstanceBindings).Should(BeEmpty())
+		})
+	})
+
+	Describe("the shared metadata", func() {
+		It("lists the instances with their metadata", func() {
+			err := store.PutMetadata("instance-1", redis.InstanceMetadata{PlanID: "small-id"})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = store.PutMetadata("instance-2", redis.InstanceMetadata{
+				PlanID:     "large-id",
+				Parameters: map[string]string{"timeout": "30"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			reopen()
+
+			allMetadata, err := store.AllMetadata()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(allMetadata).Should(HaveLen(2))
+			Ω(allMetadata["instance-2"].Parameters).Should(Equal(map[string]string{"timeout": "30"}))
+
+			metadata, err := store.Metadata("instance-1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metadata.PlanID).Should(Equal("small-id"))
+		})
+
+		It("forgets deleted instances", func() {
+			err := store.PutMetadata("instance-1", redis.InstanceMetadata{PlanID: "small-id"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(store.DeleteMetadata("instance-1")).Should(Succeed())
+
+			allMetadata, err := store.AllMetadata()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(allMetadata).Should(BeEmpty())
+
+			metadata, err := store.Metadata("instance-1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metadata).Should(Equal(redis.InstanceMetadata{}))
+		})
+	})
+})
@@ -0,0 +1,210 @@
+package broker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
+)
+
+type OperationStore interface {
+	Start(kind operation.Kind, instanceID, planID string, parameters map[string]string) (operation.Operation, error)
+	Finish(operationID, description string, operationErr error) error
+	Find(instanceID, operationID string) (operation.Operation, error)
+	InProgress() []operation.Operation
+}
+
+var errInterruptedByRestart = errors.New("the operation was interrupted by a broker restart")
+
+// ProvisionInstance creates the instance in the background when the
+// platform accepts incomplete operations and an operation store is
+// configured. Otherwise the instance is created before returning.
+func (redisServiceBroker *RedisServiceBroker) ProvisionInstance(instanceID string, details serviceapi.ProvisionDetails, acceptsIncomplete bool) (string, error) {
+	instanceCreator, plan, err := redisServiceBroker.instanceCreatorForNewInstance(instanceID, details.ServiceDetails)
+	if err != nil {
+		return "", err
+	}
+
+	parameters, err := redisServiceBroker.validateParameters(details.Parameters)
+	if err != nil {
+		return "", err
+	}
+
+	if !acceptsIncomplete || redisServiceBroker.Operations == nil {
+		return "", redisServiceBroker.create(instanceCreator, instanceID, plan, parameters)
+	}
+
+	op, err := redisServiceBroker.startOperation(operation.Provision, instanceID, plan.ID, parameters)
+	if err != nil {
+		return "", err
+	}
+
+	redisServiceBroker.runInBackground(op, "", func() error {
+		return redisServiceBroker.create(instanceCreator, instanceID, plan, parameters)
+	})
+
+	return op.ID, nil
+}
+
+func (redisServiceBroker *RedisServiceBroker) DeprovisionInstance(instanceID string, acceptsIncomplete bool) (string, error) {
+	instanceCreator, err := redisServiceBroker.instanceCreatorForExistingInstance(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	if !acceptsIncomplete || redisServiceBroker.Operations == nil {
+		return "", redisServiceBroker.destroy(instanceCreator, instanceID)
+	}
+
+	op, err := redisServiceBroker.startOperation(operation.Deprovision, instanceID, "", nil)
+	if err != nil {
+		return "", err
+	}
+
+	redisServiceBroker.runInBackground(op, "", func() error {
+		return redisServiceBroker.destroy(instanceCreator, instanceID)
+	})
+
+	return op.ID, nil
+}
+
+func (redisServiceBroker *RedisServiceBroker) LastOperation(instanceID, operationID string) (serviceapi.LastOperation, error) {
+	if redisServiceBroker.Operations == nil {
+		return serviceapi.LastOperation{}, serviceapi.ErrOperationNotFound
+	}
+
+	op, err := redisServiceBroker.Operations.Find(instanceID, operationID)
+	if err == operation.ErrOperationNotFound {
+		return serviceapi.LastOperation{}, serviceapi.ErrOperationNotFound
+	}
+	if err != nil {
+		return serviceapi.LastOperation{}, err
+	}
+
+	lastOperation := serviceapi.LastOperation{
+		Description: op.Description,
+	}
+
+	switch op.State {
+	case operation.InProgress:
+		lastOperation.State = serviceapi.OperationInProgress
+	case operation.Succeeded:
+		lastOperation.State = serviceapi.OperationSucceeded
+	default:
+		lastOperation.State = serviceapi.OperationFailed
+	}
+
+	return lastOperation, nil
+}
+
+// ResumeOperations restarts the work of operations that were still in
+// progress when the broker last stopped. Provisions that had already
+// created part of an instance and updates cannot be safely resumed and are
+// failed.
+func (redisServiceBroker *RedisServiceBroker) ResumeOperations() {
+	if redisServiceBroker.Operations == nil {
+		return
+	}
+
+	for _, op := range redisServiceBroker.Operations.InProgress() {
+		op := op
+
+		redisServiceBroker.Logger.Info("resuming-operation", lager.Data{
+			"operation-id": op.ID,
+			"instance-id":  op.InstanceID,
+			"kind":         op.Kind,
+		})
+
+		switch op.Kind {
+		case operation.Provision:
+			plan, found := redisServiceBroker.planByID(op.PlanID)
+			instanceCreator, ok := redisServiceBroker.InstanceCreators[plan.Backend]
+			if !found || !ok {
+				redisServiceBroker.finishOperation(op, "", errors.New("plan_id not recognized"))
+				continue
+			}
+
+			if redisServiceBroker.instanceExists(op.InstanceID) {
+				redisServiceBroker.finishOperation(op, "", errInterruptedByRestart)
+				continue
+			}
+
+			redisServiceBroker.runInBackground(op, "", func() error {
+				return redisServiceBroker.create(instanceCreator, op.InstanceID, plan, op.Parameters)
+			})
+
+		case operation.Deprovision:
+			var instanceCreator InstanceCreator
+			for _, creator := range redisServiceBroker.InstanceCreators {
+				if exists, _ := creator.InstanceExists(op.InstanceID); exists {
+					instanceCreator = creator
+				}
+			}
+
+			if instanceCreator == nil {
+				redisServiceBroker.finishOperation(op, "", nil)
+				continue
+			}
+
+			redisServiceBroker.runInBackground(op, "", func() error {
+				return redisServiceBroker.destroy(instanceCreator, op.InstanceID)
+			})
+
+		case operation.Update:
+			redisServiceBroker.finishOperation(op, "", errInterruptedByRestart)
+		}
+	}
+}
+
+func (redisServiceBroker *RedisServiceBroker) operationInProgress(instanceID string) bool {
+	if redisServiceBroker.Operations == nil {
+		return false
+	}
+
+	op, err := redisServiceBroker.Operations.Find(instanceID, "")
+	return err == nil && op.State == operation.InProgress
+}
+
+func (redisServiceBroker *RedisServiceBroker) startOperation(kind operation.Kind, instanceID, planID string, parameters map[string]string) (operation.Operation, error) {
+	op, err := redisServiceBroker.Operations.Start(kind, instanceID, planID, parameters)
+	if err == operation.ErrOperationInProgress {
+		return op, serviceapi.ErrConcurrentOperation
+	}
+	return op, err
+}
+
+func (redisServiceBroker *RedisServiceBroker) runInBackground(op operation.Operation, description string, work func() error) {
+	redisServiceBroker.background.Add(1)
+	go func() {
+		defer redisServiceBroker.background.Done()
+		redisServiceBroker.finishOperation(op, description, work())
+	}()
+}
+
+// WaitForOperations waits until deadline for the operations running in the
+// background and tells whether they all finished.
+func (redisServiceBroker *RedisServiceBroker) WaitForOperations(deadline time.Time) bool {
+	return shutdown.Wait(&redisServiceBroker.background, deadline)
+}
+
+func (redisServiceBroker *RedisServiceBroker) finishOperation(op operation.Operation, description string, operationErr error) {
+	logData := lager.Data{
+		"operation-id": op.ID,
+		"instance-id":  op.InstanceID,
+		"kind":         op.Kind,
+	}
+
+	if operationErr != nil {
+		redisServiceBroker.Logger.Error("operation-failed", operationErr, logData)
+	} else {
+		redisServiceBroker.Logger.Info("operation-succeeded", logData)
+	}
+
+	if err := redisServiceBroker.Operations.Finish(op.ID, description, operationErr); err != nil {
+		redisServiceBroker.Logger.Error("persisting-operation-failed", err, logData)
+	}
+}
@@ -0,0 +1,221 @@
+package broker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+type blockingInstanceCreator struct {
+	fakeInstanceCreatorAndBinder
+	release chan struct{}
+}
+
+func (creator *blockingInstanceCreator) Create(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
+	<-creator.release
+	return creator.fakeInstanceCreatorAndBinder.Create(instanceID, plan, parameters)
+}
+
+func (creator *blockingInstanceCreator) Destroy(instanceID string) error {
+	<-creator.release
+	return creator.fakeInstanceCreatorAndBinder.Destroy(instanceID)
+}
+
+var _ = Describe("Asynchronous operations", func() {
+	const (
+		instanceID = "instanceID"
+		planID     = "small-id"
+	)
+
+	var (
+		redisBroker *broker.RedisServiceBroker
+		creator     *blockingInstanceCreator
+		store       *operation.Store
+		tmpDir      string
+	)
+
+	provisionDetails := func(planID string) serviceapi.ProvisionDetails {
+		return serviceapi.ProvisionDetails{
+			ServiceDetails: brokerapi.ServiceDetails{PlanID: planID},
+		}
+	}
+
+	lastOperationState := func(operationID string) func() serviceapi.OperationState {
+		return func() serviceapi.OperationState {
+			lastOperation, err := redisBroker.LastOperation(instanceID, operationID)
+			Ω(err).ShouldNot(HaveOccurred())
+			return lastOperation.State
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "async-operations")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store, err = operation.NewStore(filepath.Join(tmpDir, "operations.json"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		creator = &blockingInstanceCreator{release: make(chan struct{})}
+
+		redisBroker = &broker.RedisServiceBroker{
+			InstanceCreators: map[string]broker.InstanceCreator{
+				brokerconfig.BackendShared: creator,
+			},
+			Config: brokerconfig.Config{
+				RedisConfiguration: brokerconfig.ServiceConfiguration{
+					Plans: []brokerconfig.Plan{
+						{ID: planID, Name: "small", Backend: brokerconfig.BackendShared},
+					},
+				},
+			},
+			Operations: store,
+			Logger:     lagertest.NewTestLogger("broker"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe(".ProvisionInstance", func() {
+		It("returns an operation that is in progress until the instance is created", func() {
+			operationID, err := redisBroker.ProvisionInstance(instanceID, provisionDetails(planID), true)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(operationID).ShouldNot(BeEmpty())
+
+			Ω(lastOperationState(operationID)()).Should(Equal(serviceapi.OperationInProgress))
+
+			close(creator.release)
+
+			Eventually(lastOperationState(operationID)).Should(Equal(serviceapi.OperationSucceeded))
+			Ω(creator.createdInstanceIds).Should(Equal([]string{instanceID}))
+		})
+
+		It("rejects a second operation while the first is in progress", func() {
+			_, err := redisBroker.ProvisionInstance(instanceID, provisionDetails(planID), true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = redisBroker.ProvisionInstance(instanceID, provisionDetails(planID), true)
+			Ω(err).Should(Equal(serviceapi.ErrConcurrentOperation))
+
+			close(creator.release)
+		})
+
+		It("reports failures through the last operation", func() {
+			creator.createErr = errors.New("no capacity")
+			close(creator.release)
+
+			operationID, err := redisBroker.ProvisionInstance(instanceID, provisionDetails(planID), true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(lastOperationState(operationID)).Should(Equal(serviceapi.OperationFailed))
+
+			lastOperation, err := redisBroker.LastOperation(instanceID, operationID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lastOperation.Description).Should(Equal("no capacity"))
+		})
+
+		It("validates the request before starting an operation", func() {
+			_, err := redisBroker.ProvisionInstance(instanceID, provisionDetails("unknown"), true)
+			Ω(err).Should(MatchError("plan_id not recognized"))
+			Ω(store.InProgress()).Should(BeEmpty())
+		})
+	})
+
+	Describe(".DeprovisionInstance", func() {
+		BeforeEach(func() {
+			creator.createdInstanceIds = []string{instanceID}
+		})
+
+		It("destroys the instance in the background", func() {
+			operationID, err := redisBroker.DeprovisionInstance(instanceID, true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			close(creator.release)
+
+			Eventually(lastOperationState(operationID)).Should(Equal(serviceapi.OperationSucceeded))
+			Ω(creator.destroyedInstanceIds).Should(Equal([]string{instanceID}))
+		})
+
+		It("returns an error if the instance does not exist", func() {
+			_, err := redisBroker.DeprovisionInstance("non-existent", true)
+			Ω(err).Should(Equal(brokerapi.ErrInstanceDoesNotExist))
+		})
+	})
+
+	Describe(".WaitForOperations", func() {
+		It("waits for the operations running in the background", func() {
+			_, err := redisBroker.ProvisionInstance(instanceID, provisionDetails(planID), true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(redisBroker.WaitForOperations(time.Now().Add(50 * time.Millisecond))).Should(BeFalse())
+
+			close(creator.release)
+
+			Ω(redisBroker.WaitForOperations(time.Now().Add(5 * time.Second))).Should(BeTrue())
+			Ω(store.InProgress()).Should(BeEmpty())
+		})
+	})
+
+	Describe(".LastOperation", func() {
+		It("returns not found for unknown operations", func() {
+			_, err := redisBroker.LastOperation(instanceID, "unknown")
+			Ω(err).Should(Equal(serviceapi.ErrOperationNotFound))
+		})
+	})
+
+	Describe(".ResumeOperations", func() {
+		It("re-runs provisions that had not created the instance", func() {
+			op, err := store.Start(operation.Provision, instanceID, planID, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			close(creator.release)
+			redisBroker.ResumeOperations()
+
+			Eventually(lastOperationState(op.ID)).Should(Equal(serviceapi.OperationSucceeded))
+			Ω(creator.createdInstanceIds).Should(Equal([]string{instanceID}))
+		})
+
+		It("fails provisions that had already created the instance", func() {
+			creator.createdInstanceIds = []string{instanceID}
+			op, err := store.Start(operation.Provision, instanceID, planID, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			redisBroker.ResumeOperations()
+
+			Ω(lastOperationState(op.ID)()).Should(Equal(serviceapi.OperationFailed))
+		})
+
+		It("completes deprovisions whose instance is already gone", func() {
+			op, err := store.Start(operation.Deprovision, instanceID, "", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			redisBroker.ResumeOperations()
+
+			Ω(lastOperationState(op.ID)()).Should(Equal(serviceapi.OperationSucceeded))
+		})
+
+		It("fails updates, which cannot be safely resumed", func() {
+			creator.createdInstanceIds = []string{instanceID}
+			op, err := store.Start(operation.Update, instanceID, planID, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			redisBroker.ResumeOperations()
+
+			Ω(lastOperationState(op.ID)()).Should(Equal(serviceapi.OperationFailed))
+		})
+	})
+})
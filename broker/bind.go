@@ -0,0 +1,128 @@
+package broker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+)
+
+// BindInstance creates credentials for a binding. Every binding gets its own
+// redis user, optionally restricted by the read_only and key_prefix
+// parameters. Instances running a redis without ACL support hand out the
+// password of the instance instead, which is only possible for bindings
+// without restrictions. Instances are not bound while an operation runs on
+// them, as an instance being moved to another backend exists on both.
+func (redisServiceBroker *RedisServiceBroker) BindInstance(instanceID, bindingID string, details serviceapi.BindDetails) (interface{}, error) {
+	if redisServiceBroker.operationInProgress(instanceID) {
+		return nil, serviceapi.ErrConcurrentOperation
+	}
+
+	scope, err := bindingScope(details.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range redisServiceBroker.InstanceBinders {
+		instanceExists, _ := repo.InstanceExists(instanceID)
+		if !instanceExists {
+			continue
+		}
+
+		plan := redisServiceBroker.planNameForInstance(repo, instanceID)
+
+		started := time.Now()
+		instanceCredentials, err := repo.Bind(instanceID, bindingID, scope)
+		redisServiceBroker.observe("bind", plan, started, err)
+		if err == acl.ErrNotSupported {
+			return nil, serviceapi.InvalidParametersError{
+				Description: "read_only and key_prefix cannot be used with this instance: " + err.Error(),
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return redisServiceBroker.bindingCredentials(instanceCredentials), nil
+	}
+
+	return nil, brokerapi.ErrInstanceDoesNotExist
+}
+
+// bindingCredentials lists the connection details of an instance, leaving
+// out the fields the instance does not have and those the operator did not
+// choose with credentials_fields.
+func (redisServiceBroker *RedisServiceBroker) bindingCredentials(instanceCredentials InstanceCredentials) map[string]interface{} {
+	fields := map[string]interface{}{
+		brokerconfig.CredentialsHost:     instanceCredentials.Host,
+		brokerconfig.CredentialsPort:     instanceCredentials.Port,
+		brokerconfig.CredentialsPassword: instanceCredentials.Password,
+		brokerconfig.CredentialsURI:      instanceCredentials.URI(),
+	}
+	if instanceCredentials.Username != "" {
+		fields[brokerconfig.CredentialsUsername] = instanceCredentials.Username
+	}
+	if instanceCredentials.TLSPort != 0 {
+		fields[brokerconfig.CredentialsTLSPort] = instanceCredentials.TLSPort
+		fields[brokerconfig.CredentialsTLSURI] = instanceCredentials.TLSURI()
+	}
+	if instanceCredentials.CACert != "" {
+		fields[brokerconfig.CredentialsCACert] = instanceCredentials.CACert
+	}
+	if instanceCredentials.RedisVersion != "" {
+		fields[brokerconfig.CredentialsRedisVersion] = instanceCredentials.RedisVersion
+	}
+	if len(instanceCredentials.Replicas) > 0 {
+		fields[brokerconfig.CredentialsReplicas] = instanceCredentials.Replicas
+	}
+	if len(instanceCredentials.Sentinels) > 0 {
+		fields[brokerconfig.CredentialsSentinels] = instanceCredentials.Sentinels
+		fields[brokerconfig.CredentialsMasterName] = instanceCredentials.MasterName
+		fields[brokerconfig.CredentialsSentinelPassword] = instanceCredentials.SentinelPassword
+	}
+	if len(instanceCredentials.ClusterNodes) > 0 {
+		fields[brokerconfig.CredentialsClusterNodes] = instanceCredentials.ClusterNodes
+	}
+
+	credentials := map[string]interface{}{}
+	for name, value := range fields {
+		if redisServiceBroker.Config.RedisConfiguration.IncludesCredentialsField(name) {
+			credentials[name] = value
+		}
+	}
+	return credentials
+}
+
+func bindingScope(parameters map[string]interface{}) (acl.Scope, error) {
+	scope := acl.Scope{}
+
+	for name, value := range parameters {
+		var ok bool
+		switch name {
+		case "read_only":
+			scope.ReadOnly, ok = value.(bool)
+		case "key_prefix":
+			scope.KeyPrefix, ok = value.(string)
+		default:
+			return scope, serviceapi.InvalidParametersError{
+				Description: fmt.Sprintf("unknown binding parameter %q", name),
+			}
+		}
+
+		if !ok {
+			return scope, serviceapi.InvalidParametersError{
+				Description: fmt.Sprintf("binding parameter %q has the wrong type", name),
+			}
+		}
+	}
+
+	if err := scope.Validate(); err != nil {
+		return scope, serviceapi.InvalidParametersError{Description: err.Error()}
+	}
+
+	return scope, nil
+}
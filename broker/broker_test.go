@@ -7,24 +7,33 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
 )
 
 type fakeInstanceCreatorAndBinder struct {
 	createErr            error
 	createdInstanceIds   []string
+	createdPlans         []brokerconfig.Plan
+	createdParameters    []map[string]string
 	destroyErr           error
 	destroyedInstanceIds []string
 	instanceCredentials  broker.InstanceCredentials
+	bindErr              error
+	boundScopes          []acl.Scope
 	bindingExists        bool
+	unbindErr            error
 }
 
-func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Create(instanceID string) error {
+func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Create(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
 	if fakeInstanceCreatorAndBinder.createErr != nil {
 		return fakeInstanceCreatorAndBinder.createErr
 	}
 	fakeInstanceCreatorAndBinder.createdInstanceIds = append(fakeInstanceCreatorAndBinder.createdInstanceIds, instanceID)
+	fakeInstanceCreatorAndBinder.createdPlans = append(fakeInstanceCreatorAndBinder.createdPlans, plan)
+	fakeInstanceCreatorAndBinder.createdParameters = append(fakeInstanceCreatorAndBinder.createdParameters, parameters)
 	return nil
 }
 
@@ -36,13 +45,20 @@ func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Destroy(instan
 	return nil
 }
 
-func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Bind(instanceID string, bindingID string) (broker.InstanceCredentials, error) {
+func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Bind(instanceID string, bindingID string, scope acl.Scope) (broker.InstanceCredentials, error) {
+	if fakeInstanceCreatorAndBinder.bindErr != nil {
+		return broker.InstanceCredentials{}, fakeInstanceCreatorAndBinder.bindErr
+	}
+	fakeInstanceCreatorAndBinder.boundScopes = append(fakeInstanceCreatorAndBinder.boundScopes, scope)
 	return fakeInstanceCreatorAndBinder.instanceCredentials, nil
 }
 
 func (fakeInstanceCreatorAndBinder *fakeInstanceCreatorAndBinder) Unbind(instanceID string, bindingID string) error {
+	if fakeInstanceCreatorAndBinder.unbindErr != nil {
+		return fakeInstanceCreatorAndBinder.unbindErr
+	}
 	if !fakeInstanceCreatorAndBinder.bindingExists {
-		return errors.New("unbind error")
+		return brokerapi.ErrBindingDoesNotExist
 	}
 	return nil
 }
@@ -95,14 +111,111 @@ var _ = Describe("Redis service broker", func() {
 					DedicatedVMPlanID:    dedicatedPlanID,
 					ServiceInstanceLimit: 3,
 					Dedicated: brokerconfig.Dedicated{
-						Nodes: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+						Nodes: []brokerconfig.DedicatedNode{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"}},
 					},
 				},
 			},
 		}
 	})
 
+	Describe(".Services", func() {
+		Context("when no plans are configured", func() {
+			It("offers the shared-vm and dedicated-vm plans", func() {
+				services := redisBroker.Services()
+				Ω(services).Should(HaveLen(1))
+
+				plans := services[0].Plans
+				Ω(plans).Should(HaveLen(2))
+				Ω(plans[0].ID).Should(Equal(sharedPlanID))
+				Ω(plans[0].Name).Should(Equal(broker.PlanNameShared))
+				Ω(plans[1].ID).Should(Equal(dedicatedPlanID))
+				Ω(plans[1].Name).Should(Equal(broker.PlanNameDedicated))
+			})
+
+			It("uses the default service metadata", func() {
+				service := redisBroker.Services()[0]
+				Ω(service.Description).Should(Equal("Redis service to provide a key-value store"))
+				Ω(service.Metadata.DocumentationUrl).Should(Equal("http://docs.pivotal.io/p1-services/Redis.html"))
+				Ω(service.Metadata.Provider.Name).Should(Equal("Pivotal"))
+				Ω(service.Tags).Should(Equal([]string{"pivotal", "redis"}))
+			})
+		})
+
+		Context("when plans and metadata are configured", func() {
+			BeforeEach(func() {
+				redisBroker.Config.RedisConfiguration.Plans = []brokerconfig.Plan{
+					{
+						ID:          "small-id",
+						Name:        "small",
+						Description: "A small instance",
+						DisplayName: "Small",
+						Bullets:     []string{"64mb"},
+						Backend:     brokerconfig.BackendShared,
+					},
+					{
+						ID:      "large-id",
+						Name:    "large",
+						Backend: brokerconfig.BackendShared,
+					},
+				}
+				redisBroker.Config.RedisConfiguration.Metadata = brokerconfig.ServiceMetadata{
+					Description:      "Our Redis",
+					DocumentationURL: "http://example.com/docs",
+					ProviderName:     "Example",
+					Tags:             []string{"redis", "example"},
+				}
+			})
+
+			It("offers only the configured plans", func() {
+				plans := redisBroker.Services()[0].Plans
+				Ω(plans).Should(HaveLen(2))
+				Ω(plans[0]).Should(Equal(brokerapi.ServicePlan{
+					ID:          "small-id",
+					Name:        "small",
+					Description: "A small instance",
+					Metadata: brokerapi.ServicePlanMetadata{
+						Bullets:     []string{"64mb"},
+						DisplayName: "Small",
+					},
+				}))
+				Ω(plans[1].ID).Should(Equal("large-id"))
+			})
+
+			It("uses the configured service metadata", func() {
+				service := redisBroker.Services()[0]
+				Ω(service.Description).Should(Equal("Our Redis"))
+				Ω(service.Metadata.DocumentationUrl).Should(Equal("http://example.com/docs"))
+				Ω(service.Metadata.SupportUrl).Should(Equal("http://support.pivotal.io"))
+				Ω(service.Metadata.Provider.Name).Should(Equal("Example"))
+				Ω(service.Tags).Should(Equal([]string{"redis", "example"}))
+			})
+		})
+	})
+
 	Describe(".Provision", func() {
+		Context("when a configured plan is requested", func() {
+			BeforeEach(func() {
+				redisBroker.Config.RedisConfiguration.Plans = []brokerconfig.Plan{
+					{ID: "small-id", Name: "small", Backend: brokerconfig.BackendShared, MaxMemory: "64mb"},
+					{ID: "large-id", Name: "large", Backend: brokerconfig.BackendShared, MaxMemory: "1gb"},
+				}
+			})
+
+			It("passes the plan to the instance creator for its backend", func() {
+				err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: "large-id"})
+				Ω(err).ToNot(HaveOccurred())
+
+				Ω(someCreatorAndBinder.createdPlans).Should(HaveLen(1))
+				Ω(someCreatorAndBinder.createdPlans[0].Name).Should(Equal("large"))
+				Ω(someCreatorAndBinder.createdPlans[0].MaxMemory).Should(Equal("1gb"))
+			})
+
+			It("no longer recognises the legacy plan ids", func() {
+				err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: sharedPlanID})
+				Ω(err).To(MatchError("plan_id not recognized"))
+			})
+		})
+
 		Context("when the plan is recognized", func() {
 			It("creates an instance", func() {
 				err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: sharedPlanID})
@@ -158,6 +271,54 @@ var _ = Describe("Redis service broker", func() {
 		})
 	})
 
+	Describe(".ProvisionInstance", func() {
+		var details serviceapi.ProvisionDetails
+
+		BeforeEach(func() {
+			redisBroker.Config.RedisConfiguration.Parameters = []brokerconfig.Parameter{
+				{Name: "maxmemory-policy", AllowedValues: []string{"allkeys-lru", "noeviction"}},
+				{Name: "timeout", Integer: true, Max: 3600},
+			}
+
+			details = serviceapi.ProvisionDetails{
+				ServiceDetails: brokerapi.ServiceDetails{PlanID: sharedPlanID},
+			}
+		})
+
+		Context("when the parameters are allowed", func() {
+			BeforeEach(func() {
+				details.Parameters = map[string]interface{}{
+					"maxmemory-policy": "noeviction",
+					"timeout":          float64(300),
+				}
+			})
+
+			It("passes them to the instance creator", func() {
+				_, err := redisBroker.ProvisionInstance(instanceID, details, false)
+				Ω(err).ToNot(HaveOccurred())
+
+				Ω(someCreatorAndBinder.createdParameters).Should(Equal([]map[string]string{
+					{"maxmemory-policy": "noeviction", "timeout": "300"},
+				}))
+			})
+		})
+
+		Context("when a parameter is not allowed", func() {
+			BeforeEach(func() {
+				details.Parameters = map[string]interface{}{
+					"maxmemory-policy": "volatile-lru",
+				}
+			})
+
+			It("returns an invalid parameters error and creates nothing", func() {
+				_, err := redisBroker.ProvisionInstance(instanceID, details, false)
+				Ω(err).Should(BeAssignableToTypeOf(serviceapi.InvalidParametersError{}))
+				Ω(err).Should(MatchError("Parameter 'maxmemory-policy' must be one of: allkeys-lru, noeviction"))
+				Ω(someCreatorAndBinder.createdInstanceIds).Should(BeEmpty())
+			})
+		})
+	})
+
 	Describe(".Deprovision", func() {
 		BeforeEach(func() {
 			err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: sharedPlanID})
@@ -191,7 +352,7 @@ var _ = Describe("Redis service broker", func() {
 	Describe(".Bind", func() {
 		Context("when the instance exists", func() {
 			BeforeEach(func() {
-				someCreatorAndBinder.Create(instanceID)
+				someCreatorAndBinder.Create(instanceID, brokerconfig.Plan{}, nil)
 			})
 
 			It("returns credentials", func() {
@@ -203,6 +364,7 @@ var _ = Describe("Redis service broker", func() {
 					"host":     host,
 					"port":     port,
 					"password": password,
+					"uri":      "redis://:big_secret@an_host:1234",
 				}
 				Ω(credentials).To(Equal(expectedCredentials))
 			})
@@ -218,9 +380,125 @@ var _ = Describe("Redis service broker", func() {
 		})
 	})
 
+	Describe(".BindInstance", func() {
+		BeforeEach(func() {
+			someCreatorAndBinder.Create(instanceID, brokerconfig.Plan{}, nil)
+		})
+
+		It("binds with the scope given by the parameters", func() {
+			_, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{
+				Parameters: map[string]interface{}{"read_only": true, "key_prefix": "app:"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(someCreatorAndBinder.boundScopes).Should(Equal([]acl.Scope{{ReadOnly: true, KeyPrefix: "app:"}}))
+		})
+
+		It("includes the username in the credentials", func() {
+			someCreatorAndBinder.instanceCredentials.Username = "bindingID"
+
+			credentials, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(Equal(map[string]interface{}{
+				"host":     host,
+				"port":     port,
+				"username": "bindingID",
+				"password": password,
+				"uri":      "redis://bindingID:big_secret@an_host:1234",
+			}))
+		})
+
+		It("includes the TLS details and the redis version when the instance has them", func() {
+			someCreatorAndBinder.instanceCredentials.TLSPort = 6380
+			someCreatorAndBinder.instanceCredentials.CACert = "a-ca-cert"
+			someCreatorAndBinder.instanceCredentials.RedisVersion = "6.0.5"
+
+			credentials, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(HaveKeyWithValue("tls_port", 6380))
+			Ω(credentials).Should(HaveKeyWithValue("tls_uri", "rediss://:big_secret@an_host:6380"))
+			Ω(credentials).Should(HaveKeyWithValue("ca_cert", "a-ca-cert"))
+			Ω(credentials).Should(HaveKeyWithValue("redis_version", "6.0.5"))
+		})
+
+		It("includes the read replicas when the instance has them", func() {
+			someCreatorAndBinder.instanceCredentials.Replicas = []broker.NodeAddress{{Host: "10.0.0.2", Port: 6379}}
+
+			credentials, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(HaveKeyWithValue("replicas", []broker.NodeAddress{{Host: "10.0.0.2", Port: 6379}}))
+		})
+
+		It("includes the sentinels, the master name and the sentinel password when the instance has them", func() {
+			someCreatorAndBinder.instanceCredentials.Sentinels = []broker.NodeAddress{{Host: "10.0.0.2", Port: 26379}}
+			someCreatorAndBinder.instanceCredentials.MasterName = "instance-id"
+			someCreatorAndBinder.instanceCredentials.SentinelPassword = "sentinel-secret"
+
+			credentials, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(HaveKeyWithValue("sentinels", []broker.NodeAddress{{Host: "10.0.0.2", Port: 26379}}))
+			Ω(credentials).Should(HaveKeyWithValue("master_name", "instance-id"))
+			Ω(credentials).Should(HaveKeyWithValue("sentinel_password", "sentinel-secret"))
+		})
+
+		It("includes the seed nodes of clusters", func() {
+			someCreatorAndBinder.instanceCredentials.ClusterNodes = []broker.NodeAddress{{Host: "10.0.0.1", Port: 6379}, {Host: "10.0.0.2", Port: 6379}}
+
+			credentials, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(HaveKeyWithValue("cluster_nodes", []broker.NodeAddress{{Host: "10.0.0.1", Port: 6379}, {Host: "10.0.0.2", Port: 6379}}))
+		})
+
+		It("only includes the configured credentials fields", func() {
+			redisBroker.Config.RedisConfiguration.CredentialsFields = []string{"uri", "tls_uri"}
+			someCreatorAndBinder.instanceCredentials.TLSPort = 6380
+
+			credentials, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials).Should(Equal(map[string]interface{}{
+				"uri":     "redis://:big_secret@an_host:1234",
+				"tls_uri": "rediss://:big_secret@an_host:6380",
+			}))
+		})
+
+		It("rejects unknown parameters", func() {
+			_, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{
+				Parameters: map[string]interface{}{"admin": true},
+			})
+			Ω(err).Should(BeAssignableToTypeOf(serviceapi.InvalidParametersError{}))
+			Ω(someCreatorAndBinder.boundScopes).Should(BeEmpty())
+		})
+
+		It("rejects parameters of the wrong type", func() {
+			_, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{
+				Parameters: map[string]interface{}{"read_only": "yes"},
+			})
+			Ω(err).Should(BeAssignableToTypeOf(serviceapi.InvalidParametersError{}))
+		})
+
+		It("rejects invalid key prefixes", func() {
+			_, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{
+				Parameters: map[string]interface{}{"key_prefix": "app *"},
+			})
+			Ω(err).Should(BeAssignableToTypeOf(serviceapi.InvalidParametersError{}))
+		})
+
+		Context("when the instance does not support users", func() {
+			BeforeEach(func() {
+				someCreatorAndBinder.bindErr = acl.ErrNotSupported
+			})
+
+			It("rejects the scope parameters", func() {
+				_, err := redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{
+					Parameters: map[string]interface{}{"read_only": true},
+				})
+				Ω(err).Should(BeAssignableToTypeOf(serviceapi.InvalidParametersError{}))
+			})
+		})
+	})
+
 	Describe(".Unbind", func() {
 		BeforeEach(func() {
-			someCreatorAndBinder.Create(instanceID)
+			someCreatorAndBinder.Create(instanceID, brokerconfig.Plan{}, nil)
 			_, err := redisBroker.Bind(instanceID, "EXISTANT-BINDING")
 			Ω(err).ShouldNot(HaveOccurred())
 		})
@@ -236,5 +514,11 @@ var _ = Describe("Redis service broker", func() {
 			err := redisBroker.Unbind(instanceID, "NON-EXISTANT-BINDING")
 			Ω(err).Should(MatchError(brokerapi.ErrBindingDoesNotExist))
 		})
+
+		It("returns other errors as they are, so that the user is not left behind", func() {
+			someCreatorAndBinder.unbindErr = errors.New("agent unreachable")
+			err := redisBroker.Unbind(instanceID, "EXISTANT-BINDING")
+			Ω(err).Should(MatchError("agent unreachable"))
+		})
 	})
 })
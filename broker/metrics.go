@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+
+	unknownPlan = "unknown"
+)
+
+// Metrics records how long the operations of the broker take and whether
+// they succeeded.
+type Metrics interface {
+	ObserveOperation(operation, plan, outcome string, duration time.Duration)
+}
+
+func (redisServiceBroker *RedisServiceBroker) observe(operation, plan string, started time.Time, err error) {
+	if redisServiceBroker.Metrics == nil {
+		return
+	}
+
+	outcome := OutcomeSucceeded
+	if err != nil {
+		outcome = OutcomeFailed
+	}
+
+	redisServiceBroker.Metrics.ObserveOperation(operation, plan, outcome, time.Since(started))
+}
+
+func (redisServiceBroker *RedisServiceBroker) create(instanceCreator InstanceCreator, instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
+	started := time.Now()
+	err := instanceCreator.Create(instanceID, plan, parameters)
+	redisServiceBroker.observe("provision", plan.Name, started, err)
+	return err
+}
+
+func (redisServiceBroker *RedisServiceBroker) destroy(instanceCreator InstanceCreator, instanceID string) error {
+	plan := redisServiceBroker.planNameForInstance(instanceCreator, instanceID)
+
+	started := time.Now()
+	err := instanceCreator.Destroy(instanceID)
+	redisServiceBroker.observe("deprovision", plan, started, err)
+	return err
+}
+
+// planNameForInstance labels the metrics of an existing instance. Only
+// backends that can report the settings of their instances know the plan.
+func (redisServiceBroker *RedisServiceBroker) planNameForInstance(backend interface{}, instanceID string) string {
+	updater, ok := backend.(InstanceUpdater)
+	if !ok {
+		return unknownPlan
+	}
+
+	settings, err := updater.InstanceSettings(instanceID)
+	if err != nil {
+		return unknownPlan
+	}
+
+	plan, found := redisServiceBroker.planByID(settings.PlanID)
+	if !found {
+		return unknownPlan
+	}
+	return plan.Name
+}
@@ -0,0 +1,133 @@
+package broker_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+type observedOperation struct {
+	operation string
+	plan      string
+	outcome   string
+	duration  time.Duration
+}
+
+type fakeMetrics struct {
+	observed []observedOperation
+}
+
+func (metrics *fakeMetrics) ObserveOperation(operation, plan, outcome string, duration time.Duration) {
+	metrics.observed = append(metrics.observed, observedOperation{operation, plan, outcome, duration})
+}
+
+var _ = Describe("Broker metrics", func() {
+	const instanceID = "instanceID"
+
+	var (
+		redisBroker *broker.RedisServiceBroker
+		backend     *fakeInstanceUpdater
+		metrics     *fakeMetrics
+	)
+
+	BeforeEach(func() {
+		backend = &fakeInstanceUpdater{
+			settings: broker.InstanceSettings{PlanID: "small-id"},
+		}
+		metrics = &fakeMetrics{}
+
+		redisBroker = &broker.RedisServiceBroker{
+			InstanceCreators: map[string]broker.InstanceCreator{
+				brokerconfig.BackendShared: backend,
+			},
+			InstanceBinders: map[string]broker.InstanceBinder{
+				brokerconfig.BackendShared: backend,
+			},
+			Config: brokerconfig.Config{
+				RedisConfiguration: brokerconfig.ServiceConfiguration{
+					Plans: []brokerconfig.Plan{
+						{ID: "small-id", Name: "small", Backend: brokerconfig.BackendShared},
+					},
+				},
+			},
+			Metrics: metrics,
+		}
+	})
+
+	It("observes successful provisions with the name of the plan", func() {
+		err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: "small-id"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(metrics.observed).Should(HaveLen(1))
+		Ω(metrics.observed[0].operation).Should(Equal("provision"))
+		Ω(metrics.observed[0].plan).Should(Equal("small"))
+		Ω(metrics.observed[0].outcome).Should(Equal(broker.OutcomeSucceeded))
+	})
+
+	It("observes failed provisions", func() {
+		backend.createErr = errors.New("no free port")
+
+		err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: "small-id"})
+		Ω(err).Should(HaveOccurred())
+
+		Ω(metrics.observed).Should(HaveLen(1))
+		Ω(metrics.observed[0].outcome).Should(Equal(broker.OutcomeFailed))
+	})
+
+	It("does not observe requests rejected before reaching the backend", func() {
+		err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: "unknown-id"})
+		Ω(err).Should(HaveOccurred())
+
+		Ω(metrics.observed).Should(BeEmpty())
+	})
+
+	Context("when the instance exists", func() {
+		BeforeEach(func() {
+			err := redisBroker.Provision(instanceID, brokerapi.ServiceDetails{PlanID: "small-id"})
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics.observed = nil
+		})
+
+		It("observes binds and unbinds with the plan of the instance", func() {
+			_, err := redisBroker.Bind(instanceID, "binding-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			backend.bindingExists = true
+			err = redisBroker.Unbind(instanceID, "binding-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(metrics.observed).Should(HaveLen(2))
+			Ω(metrics.observed[0].operation).Should(Equal("bind"))
+			Ω(metrics.observed[0].plan).Should(Equal("small"))
+			Ω(metrics.observed[1].operation).Should(Equal("unbind"))
+			Ω(metrics.observed[1].outcome).Should(Equal(broker.OutcomeSucceeded))
+		})
+
+		It("observes deprovisions with the plan of the instance", func() {
+			err := redisBroker.Deprovision(instanceID)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(metrics.observed).Should(HaveLen(1))
+			Ω(metrics.observed[0].operation).Should(Equal("deprovision"))
+			Ω(metrics.observed[0].plan).Should(Equal("small"))
+		})
+
+		It("labels instances of plans that are no longer configured as unknown", func() {
+			backend.settings.PlanID = "removed-id"
+
+			backend.unbindErr = errors.New("agent unreachable")
+			err := redisBroker.Unbind(instanceID, "binding-id")
+			Ω(err).Should(HaveOccurred())
+
+			Ω(metrics.observed).Should(HaveLen(1))
+			Ω(metrics.observed[0].plan).Should(Equal("unknown"))
+			Ω(metrics.observed[0].outcome).Should(Equal(broker.OutcomeFailed))
+		})
+	})
+})
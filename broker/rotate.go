@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+)
+
+// RotatePassword gives an instance a new password. The old password stays
+// valid for the grace period, so that apps can be restaged first. Bindings
+// with a user of their own are not affected.
+func (redisServiceBroker *RedisServiceBroker) RotatePassword(instanceID string, gracePeriod time.Duration) (InstanceCredentials, error) {
+	if redisServiceBroker.operationInProgress(instanceID) {
+		return InstanceCredentials{}, serviceapi.ErrConcurrentOperation
+	}
+
+	_, instanceCreator, found := redisServiceBroker.instanceBackend(instanceID)
+	if !found {
+		return InstanceCredentials{}, brokerapi.ErrInstanceDoesNotExist
+	}
+
+	passwordRotator, ok := instanceCreator.(PasswordRotator)
+	if !ok {
+		return InstanceCredentials{}, errors.New("the password of instances of this plan cannot be rotated")
+	}
+
+	credentials, err := passwordRotator.RotatePassword(instanceID, gracePeriod)
+	if err != nil {
+		return InstanceCredentials{}, err
+	}
+
+	redisServiceBroker.Logger.Info("password-rotated", lager.Data{
+		"instance-id":  instanceID,
+		"grace-period": gracePeriod.String(),
+	})
+
+	return credentials, nil
+}
@@ -0,0 +1,114 @@
+package broker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakePasswordRotator struct {
+	fakeInstanceCreatorAndBinder
+	gracePeriods []time.Duration
+	rotateErr    error
+}
+
+func (rotator *fakePasswordRotator) RotatePassword(instanceID string, gracePeriod time.Duration) (broker.InstanceCredentials, error) {
+	if rotator.rotateErr != nil {
+		return broker.InstanceCredentials{}, rotator.rotateErr
+	}
+	rotator.gracePeriods = append(rotator.gracePeriods, gracePeriod)
+	return broker.InstanceCredentials{Host: "10.0.0.1", Port: 6379, Password: "new-password"}, nil
+}
+
+var _ = Describe("Rotating instance passwords", func() {
+	const instanceID = "instanceID"
+
+	var (
+		redisBroker *broker.RedisServiceBroker
+		rotator     *fakePasswordRotator
+		store       *operation.Store
+		tmpDir      string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "rotate-password")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store, err = operation.NewStore(filepath.Join(tmpDir, "operations.json"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		rotator = &fakePasswordRotator{
+			fakeInstanceCreatorAndBinder: fakeInstanceCreatorAndBinder{
+				createdInstanceIds: []string{instanceID},
+			},
+		}
+
+		redisBroker = &broker.RedisServiceBroker{
+			InstanceCreators: map[string]broker.InstanceCreator{
+				brokerconfig.BackendDedicated: rotator,
+			},
+			Operations: store,
+			Logger:     lagertest.NewTestLogger("broker"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("rotates the password on the backend of the instance", func() {
+		credentials, err := redisBroker.RotatePassword(instanceID, time.Minute)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(credentials.Password).Should(Equal("new-password"))
+		Ω(rotator.gracePeriods).Should(Equal([]time.Duration{time.Minute}))
+	})
+
+	It("returns brokerapi.ErrInstanceDoesNotExist for unknown instances", func() {
+		_, err := redisBroker.RotatePassword("unknown", time.Minute)
+		Ω(err).Should(Equal(brokerapi.ErrInstanceDoesNotExist))
+	})
+
+	It("returns the error of the backend", func() {
+		rotator.rotateErr = errors.New("agent unavailable")
+		_, err := redisBroker.RotatePassword(instanceID, time.Minute)
+		Ω(err).Should(MatchError("agent unavailable"))
+	})
+
+	It("refuses to rotate while another operation is in progress", func() {
+		_, err := store.Start(operation.Update, instanceID, "plan-id", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = redisBroker.RotatePassword(instanceID, time.Minute)
+		Ω(err).Should(Equal(serviceapi.ErrConcurrentOperation))
+		Ω(rotator.gracePeriods).Should(BeEmpty())
+	})
+
+	Context("when the backend cannot rotate passwords", func() {
+		BeforeEach(func() {
+			redisBroker.InstanceCreators = map[string]broker.InstanceCreator{
+				brokerconfig.BackendShared: &fakeInstanceCreatorAndBinder{
+					createdInstanceIds: []string{instanceID},
+				},
+			}
+		})
+
+		It("returns an error", func() {
+			_, err := redisBroker.RotatePassword(instanceID, time.Minute)
+			Ω(err).Should(MatchError("the password of instances of this plan cannot be rotated"))
+		})
+	})
+})
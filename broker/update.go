@@ -0,0 +1,182 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+)
+
+const rebindRequiredDescription = "The service instance was moved to a dedicated VM. Its host, port and password have changed, so existing bindings must be recreated."
+
+// UpdateInstance changes the plan or the parameters of an instance.
+// Parameters that are not given keep their current values. Changes within a
+// backend are made in place and keep the credentials. Moving a shared
+// instance to a dedicated VM copies its data to a new node and is only done
+// asynchronously. The shared instance refuses writes while its data is
+// copied, and bindings have to be recreated afterwards.
+func (redisServiceBroker *RedisServiceBroker) UpdateInstance(instanceID string, details serviceapi.UpdateDetails, acceptsIncomplete bool) (string, error) {
+	if redisServiceBroker.operationInProgress(instanceID) {
+		return "", serviceapi.ErrConcurrentOperation
+	}
+
+	backend, instanceCreator, found := redisServiceBroker.instanceBackend(instanceID)
+	if !found {
+		return "", brokerapi.ErrInstanceDoesNotExist
+	}
+
+	instanceUpdater, ok := instanceCreator.(InstanceUpdater)
+	if !ok {
+		return "", errors.New("instances of this plan cannot be updated")
+	}
+
+	settings, err := instanceUpdater.InstanceSettings(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	planID := details.PlanID
+	if planID == "" {
+		planID = settings.PlanID
+	}
+
+	plan, found := redisServiceBroker.planByID(planID)
+	if !found {
+		return "", errors.New("plan_id not recognized")
+	}
+
+	parameters, err := redisServiceBroker.validateParameters(details.Parameters)
+	if err != nil {
+		return "", err
+	}
+	parameters = mergeParameters(settings.Parameters, parameters)
+
+	if plan.Backend == backend {
+		if current, found := redisServiceBroker.planByID(settings.PlanID); found && !sameTopology(current, plan) {
+			return "", serviceapi.ErrPlanChangeNotSupported
+		}
+
+		return redisServiceBroker.runUpdate(instanceID, plan, parameters, acceptsIncomplete, "", func() error {
+			return instanceUpdater.Update(instanceID, plan, parameters)
+		})
+	}
+
+	targetCreator, ok := redisServiceBroker.InstanceCreators[plan.Backend]
+	if !ok {
+		return "", errors.New("instance creator not found for plan")
+	}
+
+	dataImporter, canImport := targetCreator.(DataImporter)
+	writeBlocker, canBlock := instanceCreator.(WriteBlocker)
+	if backend != brokerconfig.BackendShared || plan.Backend != brokerconfig.BackendDedicated || !canImport || !canBlock {
+		return "", serviceapi.ErrPlanChangeNotSupported
+	}
+
+	// The data is copied by replicating from the source, which the nodes of
+	// a cluster refuse to do.
+	if plan.Topology == brokerconfig.TopologyCluster {
+		return "", serviceapi.ErrPlanChangeNotSupported
+	}
+
+	if !acceptsIncomplete || redisServiceBroker.Operations == nil {
+		return "", serviceapi.ErrAsyncRequired
+	}
+
+	return redisServiceBroker.runUpdate(instanceID, plan, parameters, acceptsIncomplete, rebindRequiredDescription, func() error {
+		return redisServiceBroker.migrateInstance(instanceID, instanceCreator, writeBlocker, targetCreator, dataImporter, plan, parameters, settings.Credentials)
+	})
+}
+
+func (redisServiceBroker *RedisServiceBroker) runUpdate(instanceID string, plan brokerconfig.Plan, parameters map[string]string, acceptsIncomplete bool, description string, work func() error) (string, error) {
+	if !acceptsIncomplete || redisServiceBroker.Operations == nil {
+		return "", work()
+	}
+
+	op, err := redisServiceBroker.startOperation(operation.Update, instanceID, plan.ID, parameters)
+	if err != nil {
+		return "", err
+	}
+
+	redisServiceBroker.runInBackground(op, description, work)
+
+	return op.ID, nil
+}
+
+// migrateInstance creates the instance on the target backend, copies the
+// data over and only then destroys the source instance. The source refuses
+// writes while its data is copied, so that none are lost. When the data
+// cannot be copied, the target instance is destroyed again and the source
+// accepts writes again, so that the instance only exists on the source
+// backend. Once the source is being destroyed it may already be gone, so the
+// target is kept if that fails and the source is left to be cleaned up.
+func (redisServiceBroker *RedisServiceBroker) migrateInstance(instanceID string, source InstanceCreator, writeBlocker WriteBlocker, target InstanceCreator, dataImporter DataImporter, plan brokerconfig.Plan, parameters map[string]string, sourceCredentials InstanceCredentials) error {
+	logger := redisServiceBroker.Logger.Session("migrate-instance", lager.Data{
+		"instance-id": instanceID,
+		"plan-id":     plan.ID,
+	})
+
+	if err := target.Create(instanceID, plan, parameters); err != nil {
+		return err
+	}
+
+	rollback := func(writesBlocked bool) {
+		if err := target.Destroy(instanceID); err != nil {
+			logger.Error("destroying-target-failed", err)
+		}
+		if !writesBlocked {
+			return
+		}
+		if err := writeBlocker.UnblockWrites(instanceID); err != nil {
+			logger.Error("unblocking-writes-failed", err)
+		}
+	}
+
+	if err := writeBlocker.BlockWrites(instanceID); err != nil {
+		rollback(false)
+		return err
+	}
+
+	if err := dataImporter.ImportData(instanceID, sourceCredentials); err != nil {
+		rollback(true)
+		return err
+	}
+
+	if err := source.Destroy(instanceID); err != nil {
+		return fmt.Errorf("the data was copied to the dedicated VM, but the shared instance could not be removed and has to be cleaned up by an operator: %s", err)
+	}
+
+	logger.Info("migrated")
+	return nil
+}
+
+func (redisServiceBroker *RedisServiceBroker) instanceBackend(instanceID string) (string, InstanceCreator, bool) {
+	for backend, instanceCreator := range redisServiceBroker.InstanceCreators {
+		instanceExists, _ := instanceCreator.InstanceExists(instanceID)
+		if instanceExists {
+			return backend, instanceCreator, true
+		}
+	}
+	return "", nil, false
+}
+
+func mergeParameters(current, changes map[string]string) map[string]string {
+	merged := map[string]string{}
+	for name, value := range current {
+		merged[name] = value
+	}
+	for name, value := range changes {
+		merged[name] = value
+	}
+	return merged
+}
+
+// sameTopology tells whether instances can move between the plans in place,
+// which they cannot when the plans need a different set of nodes.
+func sameTopology(current, plan brokerconfig.Plan) bool {
+	return current.Topology == plan.Topology && current.NodeCount() == plan.NodeCount() && current.Shards == plan.Shards
+}
@@ -0,0 +1,369 @@
+package broker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+type fakeInstanceUpdater struct {
+	fakeInstanceCreatorAndBinder
+	settings          broker.InstanceSettings
+	updatedPlans      []brokerconfig.Plan
+	updatedParameters []map[string]string
+	updateErr         error
+	importedSources   []broker.InstanceCredentials
+	importErr         error
+	importFunc        func()
+	writesBlocked     bool
+	blockErr          error
+}
+
+func (updater *fakeInstanceUpdater) InstanceSettings(instanceID string) (broker.InstanceSettings, error) {
+	return updater.settings, nil
+}
+
+func (updater *fakeInstanceUpdater) Update(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
+	updater.updatedPlans = append(updater.updatedPlans, plan)
+	updater.updatedParameters = append(updater.updatedParameters, parameters)
+	return updater.updateErr
+}
+
+func (updater *fakeInstanceUpdater) ImportData(instanceID string, source broker.InstanceCredentials) error {
+	updater.importedSources = append(updater.importedSources, source)
+	if updater.importFunc != nil {
+		updater.importFunc()
+	}
+	return updater.importErr
+}
+
+func (updater *fakeInstanceUpdater) BlockWrites(instanceID string) error {
+	if updater.blockErr != nil {
+		return updater.blockErr
+	}
+	updater.writesBlocked = true
+	return nil
+}
+
+func (updater *fakeInstanceUpdater) UnblockWrites(instanceID string) error {
+	updater.writesBlocked = false
+	return nil
+}
+
+var _ = Describe("Updating service instances", func() {
+	const (
+		instanceID       = "instanceID"
+		smallPlanID      = "small-id"
+		largePlanID      = "large-id"
+		dedicatedPlanID  = "dedicated-id"
+		replicatedPlanID = "replicated-id"
+		clusterPlanID    = "cluster-id"
+		wideClusterID    = "wide-cluster-id"
+	)
+
+	var (
+		redisBroker *broker.RedisServiceBroker
+		shared      *fakeInstanceUpdater
+		dedicated   *fakeInstanceUpdater
+		tmpDir      string
+
+		sourceCredentials = broker.InstanceCredentials{Host: "10.0.0.5", Port: 3456, Password: "secret"}
+	)
+
+	const rebindDescription = "The service instance was moved to a dedicated VM. Its host, port and password have changed, so existing bindings must be recreated."
+
+	updateDetails := func(planID string, parameters map[string]interface{}) serviceapi.UpdateDetails {
+		return serviceapi.UpdateDetails{PlanID: planID, Parameters: parameters}
+	}
+
+	lastOperation := func(operationID string) func() serviceapi.LastOperation {
+		return func() serviceapi.LastOperation {
+			lastOperation, err := redisBroker.LastOperation(instanceID, operationID)
+			Ω(err).ShouldNot(HaveOccurred())
+			return lastOperation
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "update-operations")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store, err := operation.NewStore(filepath.Join(tmpDir, "operations.json"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		shared = &fakeInstanceUpdater{
+			fakeInstanceCreatorAndBinder: fakeInstanceCreatorAndBinder{
+				createdInstanceIds: []string{instanceID},
+			},
+			settings: broker.InstanceSettings{
+				PlanID:      smallPlanID,
+				Parameters:  map[string]string{"maxmemory-policy": "allkeys-lru", "persistence": "rdb"},
+				Credentials: sourceCredentials,
+			},
+		}
+		dedicated = &fakeInstanceUpdater{}
+
+		redisBroker = &broker.RedisServiceBroker{
+			InstanceCreators: map[string]broker.InstanceCreator{
+				brokerconfig.BackendShared:    shared,
+				brokerconfig.BackendDedicated: dedicated,
+			},
+			Config: brokerconfig.Config{
+				RedisConfiguration: brokerconfig.ServiceConfiguration{
+					Plans: []brokerconfig.Plan{
+						{ID: smallPlanID, Name: "small", Backend: brokerconfig.BackendShared},
+						{ID: largePlanID, Name: "large", Backend: brokerconfig.BackendShared},
+						{ID: dedicatedPlanID, Name: "dedicated", Backend: brokerconfig.BackendDedicated},
+						{ID: replicatedPlanID, Name: "replicated", Backend: brokerconfig.BackendDedicated, Topology: brokerconfig.TopologyReplicated, Replicas: 2},
+						{ID: clusterPlanID, Name: "cluster", Backend: brokerconfig.BackendDedicated, Topology: brokerconfig.TopologyCluster, Shards: 3, Replicas: 1},
+						{ID: wideClusterID, Name: "wide-cluster", Backend: brokerconfig.BackendDedicated, Topology: brokerconfig.TopologyCluster, Shards: 6},
+					},
+					Parameters: []brokerconfig.Parameter{
+						{Name: "maxmemory-policy"},
+						{Name: "persistence"},
+					},
+				},
+			},
+			Operations: store,
+			Logger:     lagertest.NewTestLogger("broker"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Context("when the plan stays on the same backend", func() {
+		It("updates the instance in place and merges the parameters", func() {
+			operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(largePlanID, map[string]interface{}{
+				"maxmemory-policy": "noeviction",
+			}), false)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(operationID).Should(BeEmpty())
+
+			Ω(shared.updatedPlans).Should(HaveLen(1))
+			Ω(shared.updatedPlans[0].ID).Should(Equal(largePlanID))
+			Ω(shared.updatedParameters).Should(Equal([]map[string]string{
+				{"maxmemory-policy": "noeviction", "persistence": "rdb"},
+			}))
+		})
+
+		It("keeps the current plan when no plan is given", func() {
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails("", map[string]interface{}{
+				"persistence": "aof",
+			}), false)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(shared.updatedPlans[0].ID).Should(Equal(smallPlanID))
+		})
+
+		It("runs the update in the background when the platform accepts incomplete operations", func() {
+			operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(largePlanID, nil), true)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(operationID).ShouldNot(BeEmpty())
+
+			Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+				State: serviceapi.OperationSucceeded,
+			}))
+			Ω(shared.updatedPlans).Should(HaveLen(1))
+		})
+
+		It("returns the error of the update", func() {
+			shared.updateErr = errors.New("redis did not restart")
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails(largePlanID, nil), false)
+			Ω(err).Should(MatchError("redis did not restart"))
+		})
+	})
+
+	It("rejects parameters that are not allowed", func() {
+		_, err := redisBroker.UpdateInstance(instanceID, updateDetails("", map[string]interface{}{
+			"port": 1234,
+		}), false)
+		Ω(err).Should(BeAssignableToTypeOf(serviceapi.InvalidParametersError{}))
+		Ω(shared.updatedPlans).Should(BeEmpty())
+	})
+
+	It("rejects unknown plans", func() {
+		_, err := redisBroker.UpdateInstance(instanceID, updateDetails("unknown", nil), false)
+		Ω(err).Should(MatchError("plan_id not recognized"))
+	})
+
+	It("returns an error when the instance does not exist", func() {
+		_, err := redisBroker.UpdateInstance("unknown", updateDetails(largePlanID, nil), false)
+		Ω(err).Should(Equal(brokerapi.ErrInstanceDoesNotExist))
+	})
+
+	Context("when a shared instance moves to a dedicated plan", func() {
+		It("requires the platform to accept incomplete operations", func() {
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), false)
+			Ω(err).Should(Equal(serviceapi.ErrAsyncRequired))
+			Ω(dedicated.createdInstanceIds).Should(BeEmpty())
+		})
+
+		It("copies the data to a dedicated node, removes the shared instance and asks for a rebind", func() {
+			operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+				State:       serviceapi.OperationSucceeded,
+				Description: "The service instance was moved to a dedicated VM. Its host, port and password have changed, so existing bindings must be recreated.",
+			}))
+
+			Ω(dedicated.createdInstanceIds).Should(Equal([]string{instanceID}))
+			Ω(dedicated.createdPlans[0].ID).Should(Equal(dedicatedPlanID))
+			Ω(dedicated.createdParameters[0]).Should(Equal(shared.settings.Parameters))
+			Ω(dedicated.importedSources).Should(Equal([]broker.InstanceCredentials{sourceCredentials}))
+			Ω(shared.destroyedInstanceIds).Should(Equal([]string{instanceID}))
+		})
+
+		It("has the shared instance refuse writes while its data is copied", func() {
+			blockedDuringImport := false
+			dedicated.importFunc = func() {
+				blockedDuringImport = shared.writesBlocked
+			}
+
+			operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), true)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+				State:       serviceapi.OperationSucceeded,
+				Description: rebindDescription,
+			}))
+			Ω(blockedDuringImport).Should(BeTrue())
+		})
+
+		It("refuses to bind and unbind while the data is copied", func() {
+			importing := make(chan struct{})
+			release := make(chan struct{})
+			dedicated.importFunc = func() {
+				close(importing)
+				<-release
+			}
+
+			operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), true)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(importing).Should(BeClosed())
+
+			_, err = redisBroker.BindInstance(instanceID, "bindingID", serviceapi.BindDetails{})
+			Ω(err).Should(Equal(serviceapi.ErrConcurrentOperation))
+			Ω(redisBroker.Unbind(instanceID, "bindingID")).Should(Equal(serviceapi.ErrConcurrentOperation))
+
+			close(release)
+			Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+				State:       serviceapi.OperationSucceeded,
+				Description: rebindDescription,
+			}))
+		})
+
+		Context("when the shared instance cannot refuse writes", func() {
+			BeforeEach(func() {
+				shared.blockErr = errors.New("connection refused")
+			})
+
+			It("releases the dedicated node without copying the data", func() {
+				operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), true)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+					State:       serviceapi.OperationFailed,
+					Description: "connection refused",
+				}))
+
+				Ω(dedicated.importedSources).Should(BeEmpty())
+				Ω(dedicated.destroyedInstanceIds).Should(Equal([]string{instanceID}))
+				Ω(shared.destroyedInstanceIds).Should(BeEmpty())
+			})
+		})
+
+		Context("when the shared instance cannot be removed", func() {
+			BeforeEach(func() {
+				shared.destroyErr = errors.New("process could not be killed")
+			})
+
+			It("keeps the dedicated node, which holds the data, and leaves the shared instance for cleanup", func() {
+				operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), true)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+					State:       serviceapi.OperationFailed,
+					Description: "the data was copied to the dedicated VM, but the shared instance could not be removed and has to be cleaned up by an operator: process could not be killed",
+				}))
+
+				Ω(dedicated.importedSources).Should(Equal([]broker.InstanceCredentials{sourceCredentials}))
+				Ω(dedicated.destroyedInstanceIds).Should(BeEmpty())
+			})
+		})
+
+		Context("when the data cannot be copied", func() {
+			BeforeEach(func() {
+				dedicated.importErr = errors.New("sync timed out")
+			})
+
+			It("releases the dedicated node and keeps the shared instance", func() {
+				operationID, err := redisBroker.UpdateInstance(instanceID, updateDetails(dedicatedPlanID, nil), true)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(lastOperation(operationID)).Should(Equal(serviceapi.LastOperation{
+					State:       serviceapi.OperationFailed,
+					Description: "sync timed out",
+				}))
+
+				Ω(dedicated.destroyedInstanceIds).Should(Equal([]string{instanceID}))
+				Ω(shared.destroyedInstanceIds).Should(BeEmpty())
+				Ω(shared.writesBlocked).Should(BeFalse())
+			})
+		})
+
+		It("is not supported for cluster plans", func() {
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails(clusterPlanID, nil), true)
+			Ω(err).Should(Equal(serviceapi.ErrPlanChangeNotSupported))
+			Ω(dedicated.createdInstanceIds).Should(BeEmpty())
+		})
+	})
+
+	Context("when a dedicated instance moves to a shared plan", func() {
+		BeforeEach(func() {
+			shared.createdInstanceIds = nil
+			dedicated.createdInstanceIds = []string{instanceID}
+			dedicated.settings = broker.InstanceSettings{PlanID: dedicatedPlanID}
+		})
+
+		It("is not supported", func() {
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails(smallPlanID, nil), true)
+			Ω(err).Should(Equal(serviceapi.ErrPlanChangeNotSupported))
+		})
+	})
+
+	Context("when a dedicated instance moves to a plan with another topology", func() {
+		BeforeEach(func() {
+			shared.createdInstanceIds = nil
+			dedicated.createdInstanceIds = []string{instanceID}
+			dedicated.settings = broker.InstanceSettings{PlanID: dedicatedPlanID}
+		})
+
+		It("is not supported", func() {
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails(replicatedPlanID, nil), false)
+			Ω(err).Should(Equal(serviceapi.ErrPlanChangeNotSupported))
+			Ω(dedicated.updatedPlans).Should(BeEmpty())
+		})
+
+		It("is not supported between clusters with other shards", func() {
+			dedicated.settings = broker.InstanceSettings{PlanID: clusterPlanID}
+
+			_, err := redisBroker.UpdateInstance(instanceID, updateDetails(wideClusterID, nil), false)
+			Ω(err).Should(Equal(serviceapi.ErrPlanChangeNotSupported))
+			Ω(dedicated.updatedPlans).Should(BeEmpty())
+		})
+	})
+})
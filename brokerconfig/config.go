@@ -4,8 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	"github.com/pivotal-cf/cf-redis-broker/lease"
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
 )
 
 type Config struct {
@@ -16,6 +20,90 @@ type Config struct {
 	MonitExecutablePath       string               `yaml:"monit_executable_path"`
 	RedisServerExecutablePath string               `yaml:"redis_server_executable_path"`
 	AgentPort                 string               `yaml:"agent_port"`
+	AgentTLS                  AgentTLS             `yaml:"agent_tls"`
+	AgentClient               AgentClient          `yaml:"agent_client"`
+	ShutdownTimeoutSeconds    int                  `yaml:"shutdown_timeout_seconds"`
+	Lease                     Lease                `yaml:"lease"`
+}
+
+// Lease is the file on shared storage that brokers sharing a statefile lock
+// to elect the active broker. Without a path the broker is always active.
+type Lease struct {
+	Path         string `yaml:"path"`
+	RetrySeconds int    `yaml:"retry_seconds"`
+}
+
+// RetryInterval is how often a passive broker tries to take the lease.
+func (leaseConfig Lease) RetryInterval() time.Duration {
+	if leaseConfig.RetrySeconds <= 0 {
+		return lease.DefaultRetryInterval
+	}
+	return time.Duration(leaseConfig.RetrySeconds) * time.Second
+}
+
+// AgentTLS is how the broker verifies the agents of dedicated nodes and
+// authenticates itself to them. Without a CA certificate the broker does
+// not verify agents.
+type AgentTLS struct {
+	CACertFile string `yaml:"ca_cert_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+}
+
+// AgentClient bounds the calls of the broker to the agents of dedicated
+// nodes, so that a hung agent does not hold up the broker.
+type AgentClient struct {
+	ConnectTimeoutSeconds int `yaml:"connect_timeout_seconds"`
+	TimeoutSeconds        int `yaml:"timeout_seconds"`
+	LongTimeoutSeconds    int `yaml:"long_timeout_seconds"`
+	Retries               int `yaml:"retries"`
+}
+
+const (
+	DefaultAgentConnectTimeout = 5 * time.Second
+	DefaultAgentTimeout        = 2 * time.Minute
+	DefaultAgentLongTimeout    = 30 * time.Minute
+	DefaultAgentRetries        = 2
+)
+
+// ConnectTimeout is how long the broker waits to connect to an agent.
+func (agentClient AgentClient) ConnectTimeout() time.Duration {
+	if agentClient.ConnectTimeoutSeconds <= 0 {
+		return DefaultAgentConnectTimeout
+	}
+	return time.Duration(agentClient.ConnectTimeoutSeconds) * time.Second
+}
+
+// Timeout is how long a call to an agent may take overall.
+func (agentClient AgentClient) Timeout() time.Duration {
+	if agentClient.TimeoutSeconds <= 0 {
+		return DefaultAgentTimeout
+	}
+	return time.Duration(agentClient.TimeoutSeconds) * time.Second
+}
+
+// LongTimeout is how long the calls that move data may take: resetting a
+// node, applying a config, importing data and waiting for a replica or a
+// cluster to sync. The agent allows an import up to 10 minutes, so it is
+// longer than that.
+func (agentClient AgentClient) LongTimeout() time.Duration {
+	if agentClient.LongTimeoutSeconds <= 0 {
+		return DefaultAgentLongTimeout
+	}
+	return time.Duration(agentClient.LongTimeoutSeconds) * time.Second
+}
+
+// RetryCount is how many times the broker retries the calls that are safe
+// to repeat when the agent cannot be reached. A negative number of retries
+// turns retrying off.
+func (agentClient AgentClient) RetryCount() int {
+	if agentClient.Retries < 0 {
+		return 0
+	}
+	if agentClient.Retries == 0 {
+		return DefaultAgentRetries
+	}
+	return agentClient.Retries
 }
 
 type AuthConfiguration struct {
@@ -24,24 +112,132 @@ type AuthConfiguration struct {
 }
 
 type ServiceConfiguration struct {
-	ServiceName                 string    `yaml:"service_name"`
-	ServiceID                   string    `yaml:"service_id"`
-	DedicatedVMPlanID           string    `yaml:"dedicated_vm_plan_id"`
-	SharedVMPlanID              string    `yaml:"shared_vm_plan_id"`
-	Host                        string    `yaml:"host"`
-	DefaultConfigPath           string    `yaml:"redis_conf_path"`
-	ProcessCheckIntervalSeconds int       `yaml:"process_check_interval"`
-	StartRedisTimeoutSeconds    int       `yaml:"start_redis_timeout"`
-	InstanceDataDirectory       string    `yaml:"data_directory"`
-	InstanceLogDirectory        string    `yaml:"log_directory"`
-	ServiceInstanceLimit        int       `yaml:"service_instance_limit"`
-	Dedicated                   Dedicated `yaml:"dedicated"`
+	ServiceName                 string          `yaml:"service_name"`
+	ServiceID                   string          `yaml:"service_id"`
+	DedicatedVMPlanID           string          `yaml:"dedicated_vm_plan_id"`
+	SharedVMPlanID              string          `yaml:"shared_vm_plan_id"`
+	Host                        string          `yaml:"host"`
+	DefaultConfigPath           string          `yaml:"redis_conf_path"`
+	ProcessCheckIntervalSeconds int             `yaml:"process_check_interval"`
+	StartRedisTimeoutSeconds    int             `yaml:"start_redis_timeout"`
+	InstanceDataDirectory       string          `yaml:"data_directory"`
+	InstanceLogDirectory        string          `yaml:"log_directory"`
+	ServiceInstanceLimit        int             `yaml:"service_instance_limit"`
+	Dedicated                   Dedicated       `yaml:"dedicated"`
+	Metadata                    ServiceMetadata `yaml:"metadata"`
+	Plans                       []Plan          `yaml:"plans"`
+	OperationsStatefilePath     string          `yaml:"operations_statefile_path"`
+	Parameters                  []Parameter     `yaml:"parameters"`
+	CredentialsFields           []string        `yaml:"credentials_fields"`
+	TLS                         TLS             `yaml:"tls"`
+	StateStore                  StateStore      `yaml:"state_store"`
+}
+
+type ServiceMetadata struct {
+	Description      string   `yaml:"description"`
+	DisplayName      string   `yaml:"display_name"`
+	LongDescription  string   `yaml:"long_description"`
+	DocumentationURL string   `yaml:"documentation_url"`
+	SupportURL       string   `yaml:"support_url"`
+	ImageURL         string   `yaml:"image_url"`
+	ProviderName     string   `yaml:"provider_name"`
+	Tags             []string `yaml:"tags"`
+}
+
+const (
+	BackendShared    = "shared"
+	BackendDedicated = "dedicated"
+)
+
+const (
+	PersistenceRDB  = "rdb"
+	PersistenceAOF  = "aof"
+	PersistenceNone = "none"
+)
+
+type Plan struct {
+	ID            string            `yaml:"id"`
+	Name          string            `yaml:"name"`
+	Description   string            `yaml:"description"`
+	DisplayName   string            `yaml:"display_name"`
+	Bullets       []string          `yaml:"bullets"`
+	Backend       string            `yaml:"backend"`
+	InstanceLimit int               `yaml:"instance_limit"`
+	MaxMemory     string            `yaml:"maxmemory"`
+	Persistence   string            `yaml:"persistence"`
+	RedisConf     map[string]string `yaml:"redis_conf"`
+	Topology      string            `yaml:"topology"`
+	Replicas      int               `yaml:"replicas"`
+	Quorum        int               `yaml:"quorum"`
+	Shards        int               `yaml:"shards"`
+}
+
+// TLS lets shared instances accept TLS connections on a second port. Their
+// certificates are either issued by the CA whose key is in CAKeyFile or, when
+// there is no CA key, the operator-supplied CertFile and KeyFile.
+type TLS struct {
+	Enabled    bool   `yaml:"enabled"`
+	CACertFile string `yaml:"ca_cert_file"`
+	CAKeyFile  string `yaml:"ca_key_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+}
+
+const (
+	StateStoreFile = "file"
+	StateStoreBolt = "bolt"
+)
+
+// StateStore is where the broker keeps the state of the dedicated nodes and
+// the list of shared instances. The file backend keeps them in the statefile
+// and the instance directories; the bolt backend keeps both in the BoltDB
+// file at Path.
+type StateStore struct {
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
 }
 
 type Dedicated struct {
-	Nodes         []string `yaml:"nodes"`
-	Port          int      `yaml:"port"`
-	StatefilePath string   `yaml:"statefile_path"`
+	Nodes                  []DedicatedNode `yaml:"nodes"`
+	Port                   int             `yaml:"port"`
+	StatefilePath          string          `yaml:"statefile_path"`
+	StatefileGenerations   int             `yaml:"statefile_generations"`
+	QuarantineRetrySeconds int             `yaml:"quarantine_retry_seconds"`
+	ResetRetrySeconds      int             `yaml:"reset_retry_seconds"`
+	Placement              string          `yaml:"placement"`
+}
+
+const DefaultStatefileGenerations = 3
+
+// Generations is how many previous versions of the statefile are kept to
+// recover from a corrupt statefile.
+func (dedicated Dedicated) Generations() int {
+	if dedicated.StatefileGenerations <= 0 {
+		return DefaultStatefileGenerations
+	}
+	return dedicated.StatefileGenerations
+}
+
+const DefaultQuarantineRetryInterval = time.Minute
+
+// QuarantineRetryInterval is how often the broker tries to reset the nodes
+// that failed their health check.
+func (dedicated Dedicated) QuarantineRetryInterval() time.Duration {
+	if dedicated.QuarantineRetrySeconds <= 0 {
+		return DefaultQuarantineRetryInterval
+	}
+	return time.Duration(dedicated.QuarantineRetrySeconds) * time.Second
+}
+
+const DefaultResetRetryInterval = 10 * time.Second
+
+// ResetRetryInterval is how long the broker waits before it first retries
+// to reset a node freed by a forced deprovision. It backs off from there.
+func (dedicated Dedicated) ResetRetryInterval() time.Duration {
+	if dedicated.ResetRetrySeconds <= 0 {
+		return DefaultResetRetryInterval
+	}
+	return time.Duration(dedicated.ResetRetrySeconds) * time.Second
 }
 
 func (config *Config) DedicatedEnabled() bool {
@@ -52,6 +248,24 @@ func (config *Config) SharedEnabled() bool {
 	return config.RedisConfiguration.ServiceInstanceLimit > 0
 }
 
+// ShutdownTimeout is how long the broker waits for in-flight operations when
+// it is asked to stop.
+func (config *Config) ShutdownTimeout() time.Duration {
+	if config.ShutdownTimeoutSeconds <= 0 {
+		return shutdown.DefaultTimeout
+	}
+	return time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+}
+
+func (config ServiceConfiguration) PlanByID(planID string) (Plan, bool) {
+	for _, plan := range config.Plans {
+		if plan.ID == planID {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
+
 func ParseConfig(path string) (Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -82,6 +296,113 @@ func ValidateConfig(config ServiceConfiguration) error {
 		return err
 	}
 
+	err = validatePlans(config)
+	if err != nil {
+		return err
+	}
+
+	err = validateParameters(config)
+	if err != nil {
+		return err
+	}
+
+	err = validateCredentialsFields(config)
+	if err != nil {
+		return err
+	}
+
+	err = validateStateStore(config.StateStore)
+	if err != nil {
+		return err
+	}
+
+	err = validatePlacement(config.Dedicated)
+	if err != nil {
+		return err
+	}
+
+	return validateTLS(config.TLS)
+}
+
+func validateTLS(tls TLS) error {
+	if !tls.Enabled {
+		return nil
+	}
+
+	err := checkPathExists(tls.CACertFile, "RedisConfig.TLS.CACertFile")
+	if err != nil {
+		return err
+	}
+
+	if tls.CAKeyFile != "" {
+		if tls.CertFile != "" || tls.KeyFile != "" {
+			return errors.New("TLS certificates are either issued with ca_key_file or given with cert_file and key_file, not both")
+		}
+		return checkPathExists(tls.CAKeyFile, "RedisConfig.TLS.CAKeyFile")
+	}
+
+	err = checkPathExists(tls.CertFile, "RedisConfig.TLS.CertFile")
+	if err != nil {
+		return err
+	}
+
+	return checkPathExists(tls.KeyFile, "RedisConfig.TLS.KeyFile")
+}
+
+func validateStateStore(store StateStore) error {
+	switch store.Backend {
+	case "", StateStoreFile:
+		return nil
+	case StateStoreBolt:
+		if store.Path == "" {
+			return errors.New("The bolt state store requires a path")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown state store backend '%s'", store.Backend)
+	}
+}
+
+func validatePlans(config ServiceConfiguration) error {
+	planIDs := map[string]bool{}
+	planNames := map[string]bool{}
+
+	for _, plan := range config.Plans {
+		if plan.ID == "" || plan.Name == "" {
+			return errors.New("Every plan requires an id and a name")
+		}
+
+		if planIDs[plan.ID] {
+			return fmt.Errorf("Plan id '%s' is used by more than one plan", plan.ID)
+		}
+		planIDs[plan.ID] = true
+
+		if planNames[plan.Name] {
+			return fmt.Errorf("Plan name '%s' is used by more than one plan", plan.Name)
+		}
+		planNames[plan.Name] = true
+
+		switch plan.Backend {
+		case BackendShared:
+			if config.ServiceInstanceLimit <= 0 {
+				return fmt.Errorf("Plan '%s' uses the shared backend but service_instance_limit is not set", plan.Name)
+			}
+		case BackendDedicated:
+		default:
+			return fmt.Errorf("Plan '%s' has unknown backend '%s'", plan.Name, plan.Backend)
+		}
+
+		switch plan.Persistence {
+		case "", PersistenceRDB, PersistenceAOF, PersistenceNone:
+		default:
+			return fmt.Errorf("Plan '%s' has unknown persistence mode '%s'", plan.Name, plan.Persistence)
+		}
+
+		if err := validateTopology(plan); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
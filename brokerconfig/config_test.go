@@ -4,6 +4,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -124,6 +125,51 @@ var _ = Describe("parsing the broker config file", func() {
 			It("loads the agent port", func() {
 				Ω(config.AgentPort).Should(Equal("1234"))
 			})
+
+			It("loads the TLS settings for talking to agents", func() {
+				Ω(config.AgentTLS).Should(Equal(brokerconfig.AgentTLS{
+					CACertFile: "/certs/agent-ca.crt",
+					CertFile:   "/certs/broker.crt",
+					KeyFile:    "/certs/broker.key",
+				}))
+			})
+
+			It("loads the shutdown timeout", func() {
+				Ω(config.ShutdownTimeout()).Should(Equal(45 * time.Second))
+			})
+
+			It("waits 30 seconds for in-flight operations by default", func() {
+				config.ShutdownTimeoutSeconds = 0
+				Ω(config.ShutdownTimeout()).Should(Equal(30 * time.Second))
+			})
+
+			It("loads the timeouts and retries of the calls to agents", func() {
+				Ω(config.AgentClient.ConnectTimeout()).Should(Equal(3 * time.Second))
+				Ω(config.AgentClient.Timeout()).Should(Equal(time.Minute))
+				Ω(config.AgentClient.LongTimeout()).Should(Equal(20 * time.Minute))
+				Ω(config.AgentClient.RetryCount()).Should(Equal(4))
+			})
+
+			It("bounds the calls to agents by default", func() {
+				defaults := brokerconfig.AgentClient{}
+				Ω(defaults.ConnectTimeout()).Should(Equal(5 * time.Second))
+				Ω(defaults.Timeout()).Should(Equal(2 * time.Minute))
+				Ω(defaults.LongTimeout()).Should(Equal(30 * time.Minute))
+				Ω(defaults.RetryCount()).Should(Equal(2))
+			})
+
+			It("does not retry calls to agents with negative retries", func() {
+				Ω(brokerconfig.AgentClient{Retries: -1}.RetryCount()).Should(Equal(0))
+			})
+
+			It("loads the lease that elects the active broker", func() {
+				Ω(config.Lease.Path).Should(Equal("/var/vcap/store/shared/broker.lease"))
+				Ω(config.Lease.RetryInterval()).Should(Equal(2 * time.Second))
+			})
+
+			It("retries the lease every 5 seconds by default", func() {
+				Ω(brokerconfig.Lease{}.RetryInterval()).Should(Equal(5 * time.Second))
+			})
 		})
 
 		Context("when the configuration is invalid", func() {
@@ -139,10 +185,19 @@ var _ = Describe("parsing the broker config file", func() {
 
 		Describe("dedicated nodes", func() {
 			It("loads the dedicated node ips", func() {
-				Ω(len(config.RedisConfiguration.Dedicated.Nodes)).Should(Equal(3))
-				Ω(config.RedisConfiguration.Dedicated.Nodes).Should(ContainElement("10.0.0.1"))
-				Ω(config.RedisConfiguration.Dedicated.Nodes).Should(ContainElement("10.0.0.2"))
-				Ω(config.RedisConfiguration.Dedicated.Nodes).Should(ContainElement("10.0.0.3"))
+				Ω(config.RedisConfiguration.Dedicated.Hosts()).Should(Equal([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}))
+			})
+
+			It("loads the labels of the nodes", func() {
+				Ω(config.RedisConfiguration.Dedicated.Nodes).Should(Equal([]brokerconfig.DedicatedNode{
+					{Host: "10.0.0.1"},
+					{Host: "10.0.0.2", Labels: map[string]string{"zone": "z1", "size": "large"}},
+					{Host: "10.0.0.3", Labels: map[string]string{"zone": "z2"}},
+				}))
+			})
+
+			It("loads the placement strategy", func() {
+				Ω(config.RedisConfiguration.Dedicated.Placement).Should(Equal(brokerconfig.PlacementBalanceZones))
 			})
 
 			It("sets the correct port", func() {
@@ -152,6 +207,122 @@ var _ = Describe("parsing the broker config file", func() {
 			It("sets the path to the statefile", func() {
 				Ω(config.RedisConfiguration.Dedicated.StatefilePath).Should(Equal("/tmp/redis-config-dir/statefile.json"))
 			})
+
+			It("sets how many generations of the statefile are kept", func() {
+				Ω(config.RedisConfiguration.Dedicated.Generations()).Should(Equal(5))
+			})
+
+			It("keeps 3 generations of the statefile by default", func() {
+				Ω(brokerconfig.Dedicated{}.Generations()).Should(Equal(3))
+			})
+
+			It("sets how often quarantined nodes are retried", func() {
+				Ω(config.RedisConfiguration.Dedicated.QuarantineRetryInterval()).Should(Equal(30 * time.Second))
+			})
+
+			It("retries quarantined nodes every minute by default", func() {
+				Ω(brokerconfig.Dedicated{}.QuarantineRetryInterval()).Should(Equal(time.Minute))
+			})
+
+			It("sets how soon the reset of a node freed by force is retried", func() {
+				Ω(config.RedisConfiguration.Dedicated.ResetRetryInterval()).Should(Equal(5 * time.Second))
+			})
+
+			It("retries the reset of a node freed by force after 10 seconds by default", func() {
+				Ω(brokerconfig.Dedicated{}.ResetRetryInterval()).Should(Equal(10 * time.Second))
+			})
+		})
+
+		It("loads the parameters app developers may set", func() {
+			parameters := config.RedisConfiguration.Parameters
+			Ω(parameters).Should(HaveLen(4))
+			Ω(parameters[0]).Should(Equal(brokerconfig.Parameter{
+				Name:          "maxmemory-policy",
+				AllowedValues: []string{"allkeys-lru", "noeviction"},
+			}))
+			Ω(parameters[1].Pattern).Should(Equal("^[KEg$lshzxeA]*$"))
+			Ω(parameters[2]).Should(Equal(brokerconfig.Parameter{
+				Name:    "timeout",
+				Integer: true,
+				Min:     0,
+				Max:     3600,
+			}))
+			Ω(parameters[3].Name).Should(Equal(brokerconfig.PersistenceParameter))
+		})
+
+		It("loads the fields bindings get in their credentials", func() {
+			Ω(config.RedisConfiguration.CredentialsFields).Should(Equal([]string{"host", "port", "password", "uri", "tls_uri"}))
+		})
+
+		It("loads the path to the operations statefile", func() {
+			Ω(config.RedisConfiguration.OperationsStatefilePath).Should(Equal("/tmp/redis-config-dir/operations.json"))
+		})
+
+		It("loads the state store", func() {
+			Ω(config.RedisConfiguration.StateStore).Should(Equal(brokerconfig.StateStore{
+				Backend: brokerconfig.StateStoreBolt,
+				Path:    "/tmp/redis-config-dir/state.db",
+			}))
+		})
+
+		Describe("service metadata", func() {
+			It("loads the catalog metadata", func() {
+				metadata := config.RedisConfiguration.Metadata
+				Ω(metadata.Description).Should(Equal("Redis for tests"))
+				Ω(metadata.DisplayName).Should(Equal("Test Redis"))
+				Ω(metadata.DocumentationURL).Should(Equal("http://example.com/docs"))
+				Ω(metadata.SupportURL).Should(Equal("http://example.com/support"))
+				Ω(metadata.ProviderName).Should(Equal("Example"))
+				Ω(metadata.Tags).Should(Equal([]string{"redis", "test"}))
+			})
+		})
+
+		Describe("plans", func() {
+			It("loads every plan", func() {
+				Ω(config.RedisConfiguration.Plans).Should(HaveLen(5))
+			})
+
+			It("loads the plan settings", func() {
+				plan, found := config.RedisConfiguration.PlanByID("id-for-small-plan")
+				Ω(found).Should(BeTrue())
+				Ω(plan.Name).Should(Equal("small"))
+				Ω(plan.Description).Should(Equal("A small shared instance"))
+				Ω(plan.DisplayName).Should(Equal("Small"))
+				Ω(plan.Bullets).Should(Equal([]string{"64mb of memory"}))
+				Ω(plan.Backend).Should(Equal(brokerconfig.BackendShared))
+				Ω(plan.InstanceLimit).Should(Equal(2))
+				Ω(plan.MaxMemory).Should(Equal("64mb"))
+				Ω(plan.Persistence).Should(Equal(brokerconfig.PersistenceAOF))
+				Ω(plan.RedisConf).Should(Equal(map[string]string{"maxmemory-policy": "allkeys-lru"}))
+			})
+
+			It("loads the topology of replicated plans", func() {
+				plan, found := config.RedisConfiguration.PlanByID("id-for-replicated-plan")
+				Ω(found).Should(BeTrue())
+				Ω(plan.Topology).Should(Equal(brokerconfig.TopologyReplicated))
+				Ω(plan.Replicas).Should(Equal(2))
+				Ω(plan.NodeCount()).Should(Equal(3))
+			})
+
+			It("defaults the quorum of sentinel plans to a majority of the nodes", func() {
+				plan, found := config.RedisConfiguration.PlanByID("id-for-sentinel-plan")
+				Ω(found).Should(BeTrue())
+				Ω(plan.Topology).Should(Equal(brokerconfig.TopologySentinel))
+				Ω(plan.SentinelQuorum()).Should(Equal(2))
+			})
+
+			It("counts every node of cluster plans", func() {
+				plan, found := config.RedisConfiguration.PlanByID("id-for-cluster-plan")
+				Ω(found).Should(BeTrue())
+				Ω(plan.Topology).Should(Equal(brokerconfig.TopologyCluster))
+				Ω(plan.Shards).Should(Equal(3))
+				Ω(plan.NodeCount()).Should(Equal(6))
+			})
+
+			It("does not find unknown plans", func() {
+				_, found := config.RedisConfiguration.PlanByID("unknown")
+				Ω(found).Should(BeFalse())
+			})
 		})
 	})
 
@@ -211,6 +382,314 @@ var _ = Describe("parsing the broker config file", func() {
 			})
 		})
 
+		Describe("Plans", func() {
+			var plan brokerconfig.Plan
+
+			BeforeEach(func() {
+				config.ServiceInstanceLimit = 3
+				plan = brokerconfig.Plan{
+					ID:      "plan-id",
+					Name:    "plan-name",
+					Backend: brokerconfig.BackendShared,
+				}
+			})
+
+			It("accepts a valid plan", func() {
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects a plan without an id", func() {
+				plan.ID = ""
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Every plan requires an id and a name"))
+			})
+
+			It("rejects duplicate plan ids", func() {
+				otherPlan := plan
+				otherPlan.Name = "other-name"
+				config.Plans = []brokerconfig.Plan{plan, otherPlan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan id 'plan-id' is used by more than one plan"))
+			})
+
+			It("rejects duplicate plan names", func() {
+				otherPlan := plan
+				otherPlan.ID = "other-id"
+				config.Plans = []brokerconfig.Plan{plan, otherPlan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan name 'plan-name' is used by more than one plan"))
+			})
+
+			It("rejects unknown backends", func() {
+				plan.Backend = "cluster"
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' has unknown backend 'cluster'"))
+			})
+
+			It("rejects shared plans when there is no service instance limit", func() {
+				config.ServiceInstanceLimit = 0
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' uses the shared backend but service_instance_limit is not set"))
+			})
+
+			It("accepts redis settings on dedicated plans", func() {
+				plan.Backend = brokerconfig.BackendDedicated
+				plan.MaxMemory = "1gb"
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects unknown persistence modes", func() {
+				plan.Persistence = "sometimes"
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' has unknown persistence mode 'sometimes'"))
+			})
+
+			Context("when the plan is replicated", func() {
+				BeforeEach(func() {
+					plan.Backend = brokerconfig.BackendDedicated
+					plan.Topology = brokerconfig.TopologyReplicated
+					plan.Replicas = 1
+				})
+
+				It("accepts it", func() {
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+				})
+
+				It("requires the dedicated backend", func() {
+					plan.Backend = brokerconfig.BackendShared
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' is replicated but does not use the dedicated backend"))
+				})
+
+				It("requires a replica", func() {
+					plan.Replicas = 0
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' is replicated but has no replicas"))
+				})
+			})
+
+			Context("when the plan uses sentinel", func() {
+				BeforeEach(func() {
+					plan.Backend = brokerconfig.BackendDedicated
+					plan.Topology = brokerconfig.TopologySentinel
+					plan.Replicas = 2
+				})
+
+				It("accepts it", func() {
+					plan.Quorum = 3
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+				})
+
+				It("requires at least three nodes", func() {
+					plan.Replicas = 1
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' uses sentinel and needs at least 2 replicas"))
+				})
+
+				It("rejects a quorum larger than the number of nodes", func() {
+					plan.Quorum = 4
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' has a quorum of 4 but only 3 nodes"))
+				})
+			})
+
+			Context("when the plan is a cluster", func() {
+				BeforeEach(func() {
+					plan.Backend = brokerconfig.BackendDedicated
+					plan.Topology = brokerconfig.TopologyCluster
+					plan.Shards = 3
+				})
+
+				It("accepts it without replicas", func() {
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+				})
+
+				It("requires the dedicated backend", func() {
+					plan.Backend = brokerconfig.BackendShared
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' is a cluster but does not use the dedicated backend"))
+				})
+
+				It("requires at least three shards", func() {
+					plan.Shards = 2
+					config.Plans = []brokerconfig.Plan{plan}
+					Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' is a cluster and needs at least 3 shards"))
+				})
+			})
+
+			It("rejects shards on plans that are not clusters", func() {
+				plan.Shards = 3
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' sets shards but is not a cluster"))
+			})
+
+			It("rejects a quorum on plans without sentinel", func() {
+				plan.Quorum = 2
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' sets a quorum but does not use sentinel"))
+			})
+
+			It("rejects replicas on plans that are not replicated", func() {
+				plan.Replicas = 2
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' sets replicas but is not replicated"))
+			})
+
+			It("rejects unknown topologies", func() {
+				plan.Topology = "ring"
+				config.Plans = []brokerconfig.Plan{plan}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Plan 'plan-name' has unknown topology 'ring'"))
+			})
+		})
+
+		Describe("Parameters", func() {
+			It("accepts valid parameters", func() {
+				config.Parameters = []brokerconfig.Parameter{
+					{Name: "maxmemory-policy", AllowedValues: []string{"noeviction"}},
+					{Name: "timeout", Integer: true, Max: 60},
+				}
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects parameters without a name", func() {
+				config.Parameters = []brokerconfig.Parameter{{}}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Every parameter requires a name"))
+			})
+
+			It("rejects parameters that are configured twice", func() {
+				config.Parameters = []brokerconfig.Parameter{{Name: "timeout"}, {Name: "timeout"}}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Parameter 'timeout' is configured more than once"))
+			})
+
+			It("rejects parameters the broker manages itself", func() {
+				config.Parameters = []brokerconfig.Parameter{{Name: "requirepass"}}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Parameter 'requirepass' cannot be set by app developers"))
+			})
+
+			It("rejects TLS parameters", func() {
+				config.Parameters = []brokerconfig.Parameter{{Name: "tls-port"}}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Parameter 'tls-port' cannot be set by app developers"))
+			})
+
+			It("rejects invalid patterns", func() {
+				config.Parameters = []brokerconfig.Parameter{{Name: "notify-keyspace-events", Pattern: "["}}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError(ContainSubstring("Parameter 'notify-keyspace-events' has an invalid pattern")))
+			})
+
+			It("rejects ranges where max is lower than min", func() {
+				config.Parameters = []brokerconfig.Parameter{{Name: "timeout", Integer: true, Min: 10, Max: 5}}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Parameter 'timeout' has a max lower than its min"))
+			})
+		})
+
+		Describe("CredentialsFields", func() {
+			It("accepts known fields", func() {
+				config.CredentialsFields = []string{"host", "port", "password", "uri", "tls_uri", "ca_cert"}
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects unknown fields", func() {
+				config.CredentialsFields = []string{"uri", "hostname"}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Unknown credentials field 'hostname'"))
+			})
+
+			It("includes every field when none are configured", func() {
+				Ω(config.IncludesCredentialsField("ca_cert")).Should(BeTrue())
+			})
+
+			It("includes only the configured fields", func() {
+				config.CredentialsFields = []string{"uri"}
+				Ω(config.IncludesCredentialsField("uri")).Should(BeTrue())
+				Ω(config.IncludesCredentialsField("password")).Should(BeFalse())
+			})
+		})
+
+		Describe("TLS", func() {
+			BeforeEach(func() {
+				config.TLS = brokerconfig.TLS{
+					Enabled:    true,
+					CACertFile: validFile,
+					CAKeyFile:  validFile,
+				}
+			})
+
+			It("accepts a CA to issue certificates with", func() {
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("accepts an operator-supplied certificate", func() {
+				config.TLS.CAKeyFile = ""
+				config.TLS.CertFile = validFile
+				config.TLS.KeyFile = validFile
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects a CA key together with a certificate", func() {
+				config.TLS.CertFile = validFile
+				config.TLS.KeyFile = validFile
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError(ContainSubstring("not both")))
+			})
+
+			It("rejects a missing certificate", func() {
+				config.TLS.CAKeyFile = ""
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("File '' (RedisConfig.TLS.CertFile) not found"))
+			})
+
+			It("ignores the files when TLS is disabled", func() {
+				config.TLS = brokerconfig.TLS{CACertFile: "/a/non-existent/path"}
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Describe("Placement", func() {
+			BeforeEach(func() {
+				config.Dedicated.Nodes = []brokerconfig.DedicatedNode{
+					{Host: "10.0.0.1", Labels: map[string]string{"zone": "z1"}},
+					{Host: "10.0.0.2"},
+				}
+			})
+
+			It("accepts the known strategies", func() {
+				config.Dedicated.Placement = brokerconfig.PlacementBalanceZones
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects unknown strategies", func() {
+				config.Dedicated.Placement = "random"
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Unknown placement 'random'"))
+			})
+
+			It("rejects nodes without a host", func() {
+				config.Dedicated.Nodes = append(config.Dedicated.Nodes, brokerconfig.DedicatedNode{})
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Every dedicated node requires a host"))
+			})
+
+			It("rejects nodes that are configured twice", func() {
+				config.Dedicated.Nodes = append(config.Dedicated.Nodes, brokerconfig.DedicatedNode{Host: "10.0.0.1"})
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Dedicated node '10.0.0.1' is configured more than once"))
+			})
+		})
+
+		Describe("StateStore", func() {
+			It("accepts a bolt state store with a path", func() {
+				config.StateStore = brokerconfig.StateStore{Backend: brokerconfig.StateStoreBolt, Path: "/tmp/state.db"}
+				Ω(brokerconfig.ValidateConfig(config)).ShouldNot(HaveOccurred())
+			})
+
+			It("rejects a bolt state store without a path", func() {
+				config.StateStore = brokerconfig.StateStore{Backend: brokerconfig.StateStoreBolt}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError(ContainSubstring("requires a path")))
+			})
+
+			It("rejects unknown backends", func() {
+				config.StateStore = brokerconfig.StateStore{Backend: "etcd"}
+				Ω(brokerconfig.ValidateConfig(config)).Should(MatchError("Unknown state store backend 'etcd'"))
+			})
+		})
+
 		Describe("InstanceLogDirectory", func() {
 			Context("When the instance log directory path points to an existing directory", func() {
 				It("does not return an error", func() {
@@ -0,0 +1,72 @@
+package brokerconfig
+
+import "fmt"
+
+// Names of the fields the broker can put into binding credentials.
+const (
+	CredentialsHost         = "host"
+	CredentialsPort         = "port"
+	CredentialsUsername     = "username"
+	CredentialsPassword     = "password"
+	CredentialsURI          = "uri"
+	CredentialsTLSPort      = "tls_port"
+	CredentialsTLSURI       = "tls_uri"
+	CredentialsCACert       = "ca_cert"
+	CredentialsRedisVersion = "redis_version"
+	CredentialsReplicas     = "replicas"
+	CredentialsSentinels    = "sentinels"
+	CredentialsMasterName   = "master_name"
+	CredentialsClusterNodes = "cluster_nodes"
+
+	CredentialsSentinelPassword = "sentinel_password"
+)
+
+var credentialsFields = []string{
+	CredentialsHost,
+	CredentialsPort,
+	CredentialsUsername,
+	CredentialsPassword,
+	CredentialsURI,
+	CredentialsTLSPort,
+	CredentialsTLSURI,
+	CredentialsCACert,
+	CredentialsRedisVersion,
+	CredentialsReplicas,
+	CredentialsSentinels,
+	CredentialsMasterName,
+	CredentialsSentinelPassword,
+	CredentialsClusterNodes,
+}
+
+// IncludesCredentialsField tells whether bindings should get the given
+// credentials field. Without a configured list bindings get every field.
+func (config ServiceConfiguration) IncludesCredentialsField(name string) bool {
+	if len(config.CredentialsFields) == 0 {
+		return true
+	}
+
+	for _, field := range config.CredentialsFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCredentialsFields(config ServiceConfiguration) error {
+	for _, field := range config.CredentialsFields {
+		if !isCredentialsField(field) {
+			return fmt.Errorf("Unknown credentials field '%s'", field)
+		}
+	}
+	return nil
+}
+
+func isCredentialsField(name string) bool {
+	for _, field := range credentialsFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
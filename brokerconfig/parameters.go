@@ -0,0 +1,193 @@
+package brokerconfig
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PersistenceParameter is not a redis.conf directive. It selects one of the
+// persistence modes, which the broker translates into the matching
+// appendonly and save directives.
+const PersistenceParameter = "persistence"
+
+// Parameter allows app developers to set a redis.conf directive when they
+// create a service instance. Values can be restricted to a list, to a
+// regular expression or, for integer directives, to a range.
+type Parameter struct {
+	Name          string   `yaml:"name"`
+	AllowedValues []string `yaml:"allowed_values"`
+	Pattern       string   `yaml:"pattern"`
+	Integer       bool     `yaml:"integer"`
+	Min           int      `yaml:"min"`
+	Max           int      `yaml:"max"`
+}
+
+type ParameterError struct {
+	message string
+}
+
+func (err ParameterError) Error() string {
+	return err.message
+}
+
+func parameterError(format string, args ...interface{}) error {
+	return ParameterError{message: fmt.Sprintf(format, args...)}
+}
+
+func (config ServiceConfiguration) parameterByName(name string) (Parameter, bool) {
+	for _, parameter := range config.Parameters {
+		if parameter.Name == name {
+			return parameter, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// ValidateParameters checks the parameters given by an app developer against
+// the configured allowlist and returns their values as strings. Any failure
+// is returned as a ParameterError.
+func (config ServiceConfiguration) ValidateParameters(parameters map[string]interface{}) (map[string]string, error) {
+	validated := map[string]string{}
+
+	names := []string{}
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		parameter, found := config.parameterByName(name)
+		if !found {
+			return nil, parameterError("Parameter '%s' is not supported", name)
+		}
+
+		value, err := parameterValue(name, parameters[name])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := parameter.validate(value); err != nil {
+			return nil, err
+		}
+
+		validated[name] = value
+	}
+
+	return validated, nil
+}
+
+func parameterValue(name string, rawValue interface{}) (string, error) {
+	var value string
+
+	switch typedValue := rawValue.(type) {
+	case string:
+		value = typedValue
+	case float64:
+		if typedValue != float64(int64(typedValue)) {
+			return "", parameterError("Parameter '%s' must be a whole number", name)
+		}
+		value = strconv.FormatInt(int64(typedValue), 10)
+	case bool:
+		value = "no"
+		if typedValue {
+			value = "yes"
+		}
+	default:
+		return "", parameterError("Parameter '%s' must be a string, a number or a boolean", name)
+	}
+
+	if strings.ContainsAny(value, "\r\n\"") {
+		return "", parameterError("Parameter '%s' contains characters that are not allowed", name)
+	}
+
+	return value, nil
+}
+
+func (parameter Parameter) validate(value string) error {
+	if parameter.Name == PersistenceParameter {
+		switch value {
+		case PersistenceRDB, PersistenceAOF, PersistenceNone:
+		default:
+			return parameterError("Parameter '%s' must be one of %s, %s or %s", parameter.Name, PersistenceRDB, PersistenceAOF, PersistenceNone)
+		}
+	}
+
+	if parameter.Name == PlacementParameter {
+		if _, err := PlacementLabels(map[string]string{PlacementParameter: value}); err != nil {
+			return err
+		}
+	}
+
+	if len(parameter.AllowedValues) > 0 {
+		allowed := false
+		for _, allowedValue := range parameter.AllowedValues {
+			if value == allowedValue {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return parameterError("Parameter '%s' must be one of: %s", parameter.Name, strings.Join(parameter.AllowedValues, ", "))
+		}
+	}
+
+	if parameter.Pattern != "" {
+		if !regexp.MustCompile(parameter.Pattern).MatchString(value) {
+			return parameterError("Parameter '%s' does not match the pattern '%s'", parameter.Name, parameter.Pattern)
+		}
+	}
+
+	if parameter.Integer {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return parameterError("Parameter '%s' must be an integer", parameter.Name)
+		}
+
+		if number < parameter.Min || (parameter.Max > 0 && number > parameter.Max) {
+			return parameterError("Parameter '%s' is out of range", parameter.Name)
+		}
+	}
+
+	return nil
+}
+
+func validateParameters(config ServiceConfiguration) error {
+	names := map[string]bool{}
+
+	for _, parameter := range config.Parameters {
+		if parameter.Name == "" {
+			return errors.New("Every parameter requires a name")
+		}
+
+		if names[parameter.Name] {
+			return fmt.Errorf("Parameter '%s' is configured more than once", parameter.Name)
+		}
+		names[parameter.Name] = true
+
+		switch strings.ToLower(parameter.Name) {
+		case "port", "requirepass", "bind", "dir", "include", "rename-command", "syslog-ident", "pidfile", "logfile", "dbfilename", "appendfilename":
+			return fmt.Errorf("Parameter '%s' cannot be set by app developers", parameter.Name)
+		}
+
+		if strings.HasPrefix(strings.ToLower(parameter.Name), "tls-") {
+			return fmt.Errorf("Parameter '%s' cannot be set by app developers", parameter.Name)
+		}
+
+		if parameter.Pattern != "" {
+			if _, err := regexp.Compile(parameter.Pattern); err != nil {
+				return fmt.Errorf("Parameter '%s' has an invalid pattern: %s", parameter.Name, err)
+			}
+		}
+
+		if parameter.Max > 0 && parameter.Max < parameter.Min {
+			return fmt.Errorf("Parameter '%s' has a max lower than its min", parameter.Name)
+		}
+	}
+
+	return nil
+}
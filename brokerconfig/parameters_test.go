@@ -0,0 +1,111 @@
+package brokerconfig_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+var _ = Describe("ValidateParameters", func() {
+	var config brokerconfig.ServiceConfiguration
+
+	BeforeEach(func() {
+		config = brokerconfig.ServiceConfiguration{
+			Parameters: []brokerconfig.Parameter{
+				{Name: "maxmemory-policy", AllowedValues: []string{"allkeys-lru", "noeviction"}},
+				{Name: "notify-keyspace-events", Pattern: "^[KEg$lshzxeA]*$"},
+				{Name: "timeout", Integer: true, Min: 0, Max: 3600},
+				{Name: "lazyfree-lazy-eviction"},
+				{Name: brokerconfig.PersistenceParameter},
+				{Name: brokerconfig.PlacementParameter},
+			},
+		}
+	})
+
+	It("returns the values of allowed parameters as strings", func() {
+		parameters, err := config.ValidateParameters(map[string]interface{}{
+			"maxmemory-policy":       "noeviction",
+			"notify-keyspace-events": "Ex",
+			"timeout":                float64(300),
+			"lazyfree-lazy-eviction": true,
+			"persistence":            "aof",
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(parameters).Should(Equal(map[string]string{
+			"maxmemory-policy":       "noeviction",
+			"notify-keyspace-events": "Ex",
+			"timeout":                "300",
+			"lazyfree-lazy-eviction": "yes",
+			"persistence":            "aof",
+		}))
+	})
+
+	It("accepts no parameters", func() {
+		parameters, err := config.ValidateParameters(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(parameters).Should(BeEmpty())
+	})
+
+	It("rejects parameters that are not allowed", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"requirepass": "secret"})
+		Ω(err).Should(MatchError("Parameter 'requirepass' is not supported"))
+		Ω(err).Should(BeAssignableToTypeOf(brokerconfig.ParameterError{}))
+	})
+
+	It("rejects values that are not in the allowed values", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"maxmemory-policy": "volatile-lru"})
+		Ω(err).Should(MatchError("Parameter 'maxmemory-policy' must be one of: allkeys-lru, noeviction"))
+	})
+
+	It("rejects values that do not match the pattern", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"notify-keyspace-events": "Q"})
+		Ω(err).Should(MatchError("Parameter 'notify-keyspace-events' does not match the pattern '^[KEg$lshzxeA]*$'"))
+	})
+
+	It("rejects integers that are out of range", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"timeout": float64(3601)})
+		Ω(err).Should(MatchError("Parameter 'timeout' is out of range"))
+	})
+
+	It("rejects integer parameters that are not integers", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"timeout": "soon"})
+		Ω(err).Should(MatchError("Parameter 'timeout' must be an integer"))
+
+		_, err = config.ValidateParameters(map[string]interface{}{"timeout": 1.5})
+		Ω(err).Should(MatchError("Parameter 'timeout' must be a whole number"))
+	})
+
+	It("rejects unknown persistence modes", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"persistence": "sometimes"})
+		Ω(err).Should(MatchError("Parameter 'persistence' must be one of rdb, aof or none"))
+	})
+
+	It("rejects placements that are not label=value pairs", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"placement": "zone"})
+		Ω(err).Should(MatchError("Parameter 'placement' must be a list of label=value pairs"))
+	})
+
+	It("rejects values that could inject other directives", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"lazyfree-lazy-eviction": "yes\nrequirepass x"})
+		Ω(err).Should(MatchError("Parameter 'lazyfree-lazy-eviction' contains characters that are not allowed"))
+	})
+
+	It("rejects values that are not scalars", func() {
+		_, err := config.ValidateParameters(map[string]interface{}{"lazyfree-lazy-eviction": []interface{}{"yes"}})
+		Ω(err).Should(MatchError("Parameter 'lazyfree-lazy-eviction' must be a string, a number or a boolean"))
+	})
+})
+
+var _ = Describe("PlacementLabels", func() {
+	It("parses the requested labels", func() {
+		labels, err := brokerconfig.PlacementLabels(map[string]string{"placement": "zone=z1, size=large"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(labels).Should(Equal(map[string]string{"zone": "z1", "size": "large"}))
+	})
+
+	It("requests no labels without the parameter", func() {
+		labels, err := brokerconfig.PlacementLabels(map[string]string{"maxmemory-policy": "noeviction"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(labels).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,120 @@
+package brokerconfig
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PlacementParameter is not a redis.conf directive either. It asks for a
+// dedicated node with the given labels, written as zone=z1,size=large.
+const PlacementParameter = "placement"
+
+const (
+	PlacementFIFO         = "fifo"
+	PlacementBalanceZones = "balance_zones"
+)
+
+// DedicatedNode is a dedicated node with optional labels such as its
+// availability zone. In the config a node is either its host alone or a
+// host with labels.
+type DedicatedNode struct {
+	Host   string            `yaml:"host"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+func (node *DedicatedNode) UnmarshalYAML(tag string, value interface{}) error {
+	if host, ok := value.(string); ok {
+		node.Host = host
+		return nil
+	}
+
+	fields, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Errorf("A dedicated node must be a host or a map with a host and labels, got %v", value)
+	}
+
+	for key, fieldValue := range fields {
+		switch key {
+		case "host":
+			node.Host = fmt.Sprint(fieldValue)
+		case "labels":
+			labels, ok := fieldValue.(map[interface{}]interface{})
+			if !ok {
+				return fmt.Errorf("The labels of dedicated node '%v' must be a map", fields["host"])
+			}
+			node.Labels = map[string]string{}
+			for name, labelValue := range labels {
+				node.Labels[fmt.Sprint(name)] = fmt.Sprint(labelValue)
+			}
+		default:
+			return fmt.Errorf("Unknown field '%v' of dedicated node '%v'", key, fields["host"])
+		}
+	}
+
+	return nil
+}
+
+// Hosts are the hosts of the dedicated nodes.
+func (dedicated Dedicated) Hosts() []string {
+	hosts := make([]string, 0, len(dedicated.Nodes))
+	for _, node := range dedicated.Nodes {
+		hosts = append(hosts, node.Host)
+	}
+	return hosts
+}
+
+// PlacementLabels parses the labels requested with the placement
+// parameter.
+func PlacementLabels(parameters map[string]string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	value := parameters[PlacementParameter]
+	if value == "" {
+		return labels, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, parameterError("Parameter '%s' must be a list of label=value pairs", PlacementParameter)
+		}
+		labels[name] = strings.TrimSpace(parts[1])
+	}
+
+	return labels, nil
+}
+
+func validatePlacement(dedicated Dedicated) error {
+	switch dedicated.Placement {
+	case "", PlacementFIFO, PlacementBalanceZones:
+	default:
+		return fmt.Errorf("Unknown placement '%s'", dedicated.Placement)
+	}
+
+	hosts := map[string]bool{}
+	for _, node := range dedicated.Nodes {
+		if node.Host == "" {
+			return errors.New("Every dedicated node requires a host")
+		}
+		if hosts[node.Host] {
+			return fmt.Errorf("Dedicated node '%s' is configured more than once", node.Host)
+		}
+		hosts[node.Host] = true
+	}
+
+	return nil
+}
+
+// FormatLabels writes labels the way the placement parameter takes them,
+// sorted by name.
+func FormatLabels(labels map[string]string) string {
+	pairs := []string{}
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,93 @@
+package brokerconfig
+
+import "fmt"
+
+const (
+	// TopologyReplicated plans allocate a group of dedicated nodes to each
+	// instance: a master and Replicas read replicas that follow it.
+	TopologyReplicated = "replicated"
+
+	// TopologySentinel plans allocate a replicated group with a sentinel on
+	// every node, which promotes a replica when the master fails.
+	TopologySentinel = "sentinel"
+
+	// TopologyCluster plans allocate a Redis Cluster to each instance, which
+	// shards the keys across Shards masters with Replicas replicas each.
+	TopologyCluster = "cluster"
+
+	// MinClusterShards is the smallest cluster that keeps a majority of its
+	// masters when one of them fails.
+	MinClusterShards = 3
+)
+
+// NodeCount is how many dedicated nodes an instance of the plan takes.
+func (plan Plan) NodeCount() int {
+	if plan.Topology == TopologyCluster {
+		return plan.Shards * (1 + plan.Replicas)
+	}
+	if plan.Replicated() {
+		return 1 + plan.Replicas
+	}
+	return 1
+}
+
+// Replicated tells whether instances of the plan have replicas.
+func (plan Plan) Replicated() bool {
+	return plan.Topology == TopologyReplicated || plan.Topology == TopologySentinel
+}
+
+// SentinelQuorum is how many sentinels have to agree that the master failed.
+// It defaults to a majority of the nodes.
+func (plan Plan) SentinelQuorum() int {
+	if plan.Quorum > 0 {
+		return plan.Quorum
+	}
+	return plan.NodeCount()/2 + 1
+}
+
+func validateTopology(plan Plan) error {
+	switch plan.Topology {
+	case "":
+		if plan.Replicas != 0 {
+			return fmt.Errorf("Plan '%s' sets replicas but is not replicated", plan.Name)
+		}
+	case TopologyCluster:
+		if plan.Backend != BackendDedicated {
+			return fmt.Errorf("Plan '%s' is a cluster but does not use the dedicated backend", plan.Name)
+		}
+		if plan.Shards < MinClusterShards {
+			return fmt.Errorf("Plan '%s' is a cluster and needs at least %d shards", plan.Name, MinClusterShards)
+		}
+		if plan.Replicas < 0 {
+			return fmt.Errorf("Plan '%s' has a negative number of replicas", plan.Name)
+		}
+	case TopologyReplicated, TopologySentinel:
+		if plan.Backend != BackendDedicated {
+			return fmt.Errorf("Plan '%s' is replicated but does not use the dedicated backend", plan.Name)
+		}
+		if plan.Replicas < 1 {
+			return fmt.Errorf("Plan '%s' is replicated but has no replicas", plan.Name)
+		}
+	default:
+		return fmt.Errorf("Plan '%s' has unknown topology '%s'", plan.Name, plan.Topology)
+	}
+
+	if plan.Topology == TopologySentinel {
+		// A majority of the sentinels has to be left to authorise a failover
+		// once a node is lost.
+		if plan.NodeCount() < 3 {
+			return fmt.Errorf("Plan '%s' uses sentinel and needs at least 2 replicas", plan.Name)
+		}
+		if plan.Quorum < 0 || plan.Quorum > plan.NodeCount() {
+			return fmt.Errorf("Plan '%s' has a quorum of %d but only %d nodes", plan.Name, plan.Quorum, plan.NodeCount())
+		}
+	} else if plan.Quorum != 0 {
+		return fmt.Errorf("Plan '%s' sets a quorum but does not use sentinel", plan.Name)
+	}
+
+	if plan.Topology != TopologyCluster && plan.Shards != 0 {
+		return fmt.Errorf("Plan '%s' sets shards but is not a cluster", plan.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+)
+
+// SlotCount is how many hash slots Redis Cluster shards the keys into.
+const SlotCount = 16384
+
+const DefaultTimeout = 30 * time.Second
+
+var ErrNotEnabled = errors.New("cluster mode is not enabled in the config of redis")
+
+// Slots are the hash slots from First to Last, both included.
+type Slots struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// SlotRange is the share of the hash slots served by the given shard, out
+// of shards.
+func SlotRange(shard, shards int) Slots {
+	return Slots{
+		First: shard * SlotCount / shards,
+		Last:  (shard+1)*SlotCount/shards - 1,
+	}
+}
+
+type Address struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// Join is how the node takes its place in a cluster: it meets the peers,
+// then either serves the slots as a master or replicates the master with
+// the given node ID.
+type Join struct {
+	Peers    []Address `json:"peers,omitempty"`
+	Slots    *Slots    `json:"slots,omitempty"`
+	MasterID string    `json:"master_id,omitempty"`
+}
+
+func (join Join) Validate() error {
+	if join.Slots != nil && join.MasterID != "" {
+		return errors.New("a node cannot serve slots and replicate a master")
+	}
+
+	if slots := join.Slots; slots != nil {
+		if slots.First < 0 || slots.Last >= SlotCount || slots.First > slots.Last {
+			return fmt.Errorf("invalid slots %d-%d", slots.First, slots.Last)
+		}
+	}
+
+	for _, peer := range join.Peers {
+		if peer.Host == "" || peer.Port == 0 {
+			return errors.New("peers need a host and a port")
+		}
+	}
+
+	return nil
+}
+
+// Manager has the redis of the node take part in a Redis Cluster. Redis has
+// to run with cluster-enabled already.
+type Manager struct {
+	Connect func() (client.Client, error)
+	Timeout time.Duration
+}
+
+// NodeID is the ID of the node in the cluster, which replicas use to name
+// their master.
+func (manager *Manager) NodeID() (string, error) {
+	redisClient, err := manager.connect()
+	if err != nil {
+		return "", err
+	}
+	defer redisClient.Disconnect()
+
+	return redisClient.ClusterMyID()
+}
+
+// Join meets the peers and takes the slots or the master of the join. A
+// replica can only name its master once the gossip of the cluster has told
+// it about the master, so it retries until the timeout.
+func (manager *Manager) Join(join Join) error {
+	if err := join.Validate(); err != nil {
+		return err
+	}
+
+	redisClient, err := manager.connect()
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	for _, peer := range join.Peers {
+		if err := redisClient.ClusterMeet(peer.Host, peer.Port); err != nil {
+			return err
+		}
+	}
+
+	if join.Slots != nil {
+		if err := redisClient.ClusterAddSlots(join.Slots.First, join.Slots.Last); err != nil {
+			return err
+		}
+	}
+
+	if join.MasterID == "" {
+		return nil
+	}
+
+	return manager.retry("replicating "+join.MasterID, func() error {
+		return redisClient.ClusterReplicate(join.MasterID)
+	})
+}
+
+// WaitUntilReady waits until the node sees every slot of the cluster
+// served.
+func (manager *Manager) WaitUntilReady() error {
+	redisClient, err := manager.connect()
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	return manager.retry("waiting for the cluster", func() error {
+		info, err := redisClient.ClusterInfo()
+		if err != nil {
+			return err
+		}
+
+		if state := info["cluster_state"]; state != "ok" {
+			return fmt.Errorf("cluster state is '%s'", state)
+		}
+		return nil
+	})
+}
+
+// Reset has redis forget its cluster, so that the node can be handed out
+// again. A redis that does not answer is left alone: resetting it deletes
+// the file it keeps its cluster state in.
+func (manager *Manager) Reset() error {
+	redisClient, err := manager.Connect()
+	if err != nil {
+		return nil
+	}
+	defer redisClient.Disconnect()
+
+	if enabled, err := clusterEnabled(redisClient); err != nil || !enabled {
+		return err
+	}
+
+	// Replicas refuse to be flushed, and CLUSTER RESET flushes them anyway.
+	redisClient.FlushAll()
+
+	return redisClient.ClusterResetHard()
+}
+
+func (manager *Manager) connect() (client.Client, error) {
+	redisClient, err := manager.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := clusterEnabled(redisClient)
+	if err == nil && !enabled {
+		err = ErrNotEnabled
+	}
+	if err != nil {
+		redisClient.Disconnect()
+		return nil, err
+	}
+
+	return redisClient, nil
+}
+
+func (manager *Manager) retry(action string, fn func() error) error {
+	timeout := manager.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	deadline := time.After(timeout)
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case <-deadline:
+			return fmt.Errorf("timed out %s: %s", action, err)
+		}
+	}
+}
+
+func clusterEnabled(redisClient client.Client) (bool, error) {
+	enabled, err := redisClient.InfoField("cluster_enabled")
+	if err != nil {
+		return false, err
+	}
+	return enabled == "1", nil
+}
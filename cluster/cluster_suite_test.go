@@ -0,0 +1,15 @@
+package cluster_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_cluster.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Cluster Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,185 @@
+package cluster_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SlotRange", func() {
+	It("splits the slots between the shards", func() {
+		Ω(cluster.SlotRange(0, 3)).Should(Equal(cluster.Slots{First: 0, Last: 5460}))
+		Ω(cluster.SlotRange(1, 3)).Should(Equal(cluster.Slots{First: 5461, Last: 10921}))
+		Ω(cluster.SlotRange(2, 3)).Should(Equal(cluster.Slots{First: 10922, Last: 16383}))
+	})
+})
+
+var _ = Describe("Join", func() {
+	It("is valid for a master", func() {
+		join := cluster.Join{
+			Peers: []cluster.Address{{Host: "10.0.0.2", Port: 6379}},
+			Slots: &cluster.Slots{First: 0, Last: 5460},
+		}
+		Ω(join.Validate()).Should(Succeed())
+	})
+
+	It("cannot serve slots and replicate", func() {
+		join := cluster.Join{Slots: &cluster.Slots{First: 0, Last: 10}, MasterID: "master-id"}
+		Ω(join.Validate()).ShouldNot(Succeed())
+	})
+
+	It("rejects slots out of range", func() {
+		join := cluster.Join{Slots: &cluster.Slots{First: 0, Last: cluster.SlotCount}}
+		Ω(join.Validate()).ShouldNot(Succeed())
+	})
+
+	It("rejects peers without a port", func() {
+		join := cluster.Join{Peers: []cluster.Address{{Host: "10.0.0.2"}}}
+		Ω(join.Validate()).ShouldNot(Succeed())
+	})
+})
+
+var _ = Describe("Manager", func() {
+	var (
+		manager    *cluster.Manager
+		fakeClient *fakes.Client
+		connectErr error
+	)
+
+	BeforeEach(func() {
+		connectErr = nil
+		fakeClient = &fakes.Client{
+			InfoFields: map[string]string{"cluster_enabled": "1"},
+			ClusterID:  "node-id",
+			ClusterInfoFields: map[string]string{
+				"cluster_state": "ok",
+			},
+		}
+		manager = &cluster.Manager{
+			Connect: func() (client.Client, error) {
+				if connectErr != nil {
+					return nil, connectErr
+				}
+				return fakeClient, nil
+			},
+			Timeout: 300 * time.Millisecond,
+		}
+	})
+
+	Describe("#NodeID", func() {
+		It("returns the ID of the node", func() {
+			Ω(manager.NodeID()).Should(Equal("node-id"))
+			Ω(fakeClient.DisconnectCallCount).Should(Equal(1))
+		})
+
+		Context("when cluster mode is not enabled", func() {
+			BeforeEach(func() {
+				fakeClient.InfoFields["cluster_enabled"] = "0"
+			})
+
+			It("returns ErrNotEnabled", func() {
+				_, err := manager.NodeID()
+				Ω(err).Should(Equal(cluster.ErrNotEnabled))
+			})
+		})
+	})
+
+	Describe("#Join", func() {
+		It("meets the peers and takes the slots of a master", func() {
+			err := manager.Join(cluster.Join{
+				Peers: []cluster.Address{{Host: "10.0.0.2", Port: 6379}, {Host: "10.0.0.3", Port: 6379}},
+				Slots: &cluster.Slots{First: 0, Last: 5460},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeClient.ClusterMeets).Should(Equal([]string{"10.0.0.2:6379", "10.0.0.3:6379"}))
+			Ω(fakeClient.ClusterSlots).Should(Equal([]string{"0-5460"}))
+			Ω(fakeClient.ClusterReplicated).Should(BeEmpty())
+		})
+
+		It("replicates the master of a replica", func() {
+			Ω(manager.Join(cluster.Join{MasterID: "master-id"})).Should(Succeed())
+			Ω(fakeClient.ClusterReplicated).Should(Equal([]string{"master-id"}))
+		})
+
+		It("rejects an invalid join", func() {
+			err := manager.Join(cluster.Join{Slots: &cluster.Slots{First: 10, Last: 0}})
+			Ω(err).Should(HaveOccurred())
+			Ω(fakeClient.ClusterSlots).Should(BeEmpty())
+		})
+
+		Context("when the replica does not learn about its master", func() {
+			BeforeEach(func() {
+				fakeClient.ExpectedReplicateErr = errors.New("ERR Unknown node master-id")
+			})
+
+			It("times out", func() {
+				err := manager.Join(cluster.Join{MasterID: "master-id"})
+				Ω(err).Should(MatchError("timed out replicating master-id: ERR Unknown node master-id"))
+			})
+		})
+	})
+
+	Describe("#WaitUntilReady", func() {
+		It("returns once the cluster is ok", func() {
+			Ω(manager.WaitUntilReady()).Should(Succeed())
+		})
+
+		Context("when slots are not served", func() {
+			BeforeEach(func() {
+				fakeClient.ClusterInfoFields["cluster_state"] = "fail"
+			})
+
+			It("times out", func() {
+				err := manager.WaitUntilReady()
+				Ω(err).Should(MatchError("timed out waiting for the cluster: cluster state is 'fail'"))
+			})
+		})
+	})
+
+	Describe("#Reset", func() {
+		It("flushes redis and resets its cluster state", func() {
+			Ω(manager.Reset()).Should(Succeed())
+			Ω(fakeClient.FlushAllCallCount).Should(Equal(1))
+			Ω(fakeClient.ClusterResetCallCount).Should(Equal(1))
+		})
+
+		It("still resets a replica, which refuses to be flushed", func() {
+			fakeClient.ExpectedFlushAllErr = errors.New("READONLY You can't write against a read only replica.")
+			Ω(manager.Reset()).Should(Succeed())
+			Ω(fakeClient.ClusterResetCallCount).Should(Equal(1))
+		})
+
+		It("fails when redis cannot reset its cluster state", func() {
+			fakeClient.ExpectedClusterResetErr = errors.New("ERR CLUSTER RESET can't be called with master nodes containing keys")
+			Ω(manager.Reset()).ShouldNot(Succeed())
+		})
+
+		Context("when cluster mode is not enabled", func() {
+			BeforeEach(func() {
+				fakeClient.InfoFields["cluster_enabled"] = "0"
+			})
+
+			It("does nothing", func() {
+				Ω(manager.Reset()).Should(Succeed())
+				Ω(fakeClient.ClusterResetCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("when redis does not answer", func() {
+			BeforeEach(func() {
+				connectErr = errors.New("connection refused")
+			})
+
+			It("leaves the cluster state to the reset of redis", func() {
+				Ω(manager.Reset()).Should(Succeed())
+			})
+		})
+	})
+})
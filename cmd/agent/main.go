@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"net"
 	"net/http"
@@ -9,11 +10,20 @@ import (
 	"time"
 
 	"github.com/pivotal-cf/brokerapi/auth"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/agentapi"
 	"github.com/pivotal-cf/cf-redis-broker/agentconfig"
 	"github.com/pivotal-cf/cf-redis-broker/availability"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/health"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/redisinfo"
 	"github.com/pivotal-cf/cf-redis-broker/resetter"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
+	"github.com/pivotal-cf/cf-redis-broker/tlscert"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -49,20 +59,172 @@ func main() {
 	redisResetter := resetter.New(
 		config.DefaultConfPath,
 		config.ConfPath,
+		config.OverridesConfPath,
+		config.UsersConfPath,
+		config.RedisTLS(),
 		portChecker{},
 		commandRunner{},
 		config.MonitExecutablePath,
+		connectToRedis(config),
 	)
 
 	handler := auth.NewWrapper(
 		config.AuthConfiguration.Username,
 		config.AuthConfiguration.Password,
 	).Wrap(
-		agentapi.New(redisResetter, config.ConfPath),
+		agentapi.New(agentapi.Dependencies{
+			Resetter:        redisResetter,
+			DataImporter:    importer.New(config.ConfPath),
+			UserManager:     userManager(config),
+			PasswordRotator: passwordRotator(config, logger),
+			VersionReader:   versionReader{connect: connectToRedis(config)},
+			KeyCounter:      keyCounter{connect: connectToRedis(config)},
+			InfoReader:      &redisinfo.Reader{Connect: connectToRedis(config)},
+			SentinelManager: sentinelManager(config, redisResetter),
+			SentinelPort:    config.Sentinel.Port,
+			ClusterManager:  &cluster.Manager{Connect: connectToRedis(config)},
+			ConfigPath:      config.ConfPath,
+		}),
 	)
 
 	http.Handle("/", handler)
-	logger.Fatal("http-listen", http.ListenAndServe("localhost:"+config.Port, nil))
+	http.HandleFunc("/healthz", health.LivenessHandler())
+	http.HandleFunc("/readyz", health.ReadinessHandler(
+		health.Check{Name: "redis", Run: pingRedis(connectToRedis(config))},
+		health.Check{Name: "monit", Run: redisResetter.RedisRunning},
+	))
+
+	server := &http.Server{Addr: "localhost:" + config.Port}
+	serve := server.ListenAndServe
+
+	if config.TLSEnabled() {
+		// With TLS the agent no longer relies on a proxy in front of it, so it
+		// listens on every interface.
+		tlsConfig, err := tlscert.ServerConfig(
+			config.APITLS.CertFile,
+			config.APITLS.KeyFile,
+			config.APITLS.ClientCACertFile,
+		)
+		if err != nil {
+			logger.Fatal("Error loading the TLS config of the agent API", err)
+		}
+
+		server = &http.Server{
+			Addr:      ":" + config.Port,
+			TLSConfig: tlsConfig,
+		}
+		serve = func() error {
+			return server.ListenAndServeTLS("", "")
+		}
+	}
+
+	// A reset in progress is an in-flight request, so stopping the server
+	// waits for it.
+	_, err = shutdown.Serve(server, serve, config.ShutdownTimeout())
+	if err == context.DeadlineExceeded {
+		logger.Info("requests-interrupted")
+	} else if err != nil {
+		logger.Fatal("http-listen", err)
+	}
+
+	logger.Info("stopped")
+}
+
+func userManager(config *agentconfig.Config) *acl.Manager {
+	return &acl.Manager{
+		ConfPath:  config.ConfPath,
+		UsersPath: config.UsersConfPath,
+		Connect:   connectToRedis(config),
+	}
+}
+
+func sentinelManager(config *agentconfig.Config, processes *resetter.Resetter) *sentinel.Manager {
+	return &sentinel.Manager{
+		ConfPath:  config.Sentinel.ConfPath,
+		Port:      config.Sentinel.Port,
+		Processes: processes,
+		DownAfter: time.Duration(config.Sentinel.DownAfterMilliseconds) * time.Millisecond,
+	}
+}
+
+func connectToRedis(config *agentconfig.Config) func() (client.Client, error) {
+	return func() (client.Client, error) {
+		conf, err := redisconf.Load(config.ConfPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Connect(
+			client.Port(conf.Port()),
+			client.Password(conf.Password()),
+			client.CmdAliases(conf.CommandAliases()),
+		)
+	}
+}
+
+func pingRedis(connect func() (client.Client, error)) func() error {
+	return func() error {
+		redisClient, err := connect()
+		if err != nil {
+			return err
+		}
+		defer redisClient.Disconnect()
+
+		return redisClient.Ping()
+	}
+}
+
+type versionReader struct {
+	connect func() (client.Client, error)
+}
+
+func (reader versionReader) RedisVersion() (string, error) {
+	redisClient, err := reader.connect()
+	if err != nil {
+		return "", err
+	}
+	defer redisClient.Disconnect()
+
+	return redisClient.RedisVersion()
+}
+
+type keyCounter struct {
+	connect func() (client.Client, error)
+}
+
+// KeyCount pings redis before counting its keys, so that a redis that is
+// still loading or refuses commands does not pass for an empty one.
+func (counter keyCounter) KeyCount() (int, error) {
+	redisClient, err := counter.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer redisClient.Disconnect()
+
+	if err := redisClient.Ping(); err != nil {
+		return 0, err
+	}
+
+	return redisClient.DBSize()
+}
+
+func passwordRotator(config *agentconfig.Config, logger lager.Logger) *acl.PasswordRotator {
+	return &acl.PasswordRotator{
+		ConfPath: config.ConfPath,
+		Connect: func(password string) (client.Client, error) {
+			conf, err := redisconf.Load(config.ConfPath)
+			if err != nil {
+				return nil, err
+			}
+
+			return client.Connect(
+				client.Port(conf.Port()),
+				client.Password(password),
+				client.CmdAliases(conf.CommandAliases()),
+			)
+		},
+		Logger: logger.Session("password-rotator"),
+	}
 }
 
 func templateRedisConf(config *agentconfig.Config, logger lager.Logger) {
@@ -89,6 +251,28 @@ func templateRedisConf(config *agentconfig.Config, logger lager.Logger) {
 		logger.Fatal("Error initializing redis conf for dedicated node", err)
 	}
 
+	if fileExists(config.OverridesConfPath) {
+		overrides, err := redisconf.Load(config.OverridesConfPath)
+		if err != nil {
+			logger.Fatal("Error loading redis.conf overrides", err, lager.Data{
+				"path": config.OverridesConfPath,
+			})
+		}
+		newConfig.Override(overrides...)
+	}
+
+	users, err := acl.LoadUsers(config.UsersConfPath)
+	if err != nil {
+		logger.Fatal("Error loading redis ACL users", err, lager.Data{
+			"path": config.UsersConfPath,
+		})
+	}
+	acl.ApplyUsers(&newConfig, users)
+
+	if config.TLS.Port != 0 {
+		newConfig.EnableTLS(config.RedisTLS())
+	}
+
 	err = newConfig.Save(config.ConfPath)
 	if err != nil {
 		logger.Fatal("Error saving redis.conf", err, lager.Data{
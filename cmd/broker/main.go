@@ -1,21 +1,38 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-cf/brokerapi/auth"
 	"github.com/pivotal-golang/lager"
 
 	"github.com/pivotal-cf/cf-redis-broker/availability"
+	"github.com/pivotal-cf/cf-redis-broker/boltstore"
 	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
 	"github.com/pivotal-cf/cf-redis-broker/debug"
+	"github.com/pivotal-cf/cf-redis-broker/health"
+	"github.com/pivotal-cf/cf-redis-broker/lease"
+	"github.com/pivotal-cf/cf-redis-broker/metrics"
+	"github.com/pivotal-cf/cf-redis-broker/nodepool"
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+	"github.com/pivotal-cf/cf-redis-broker/passwordrotation"
 	"github.com/pivotal-cf/cf-redis-broker/process"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
 	"github.com/pivotal-cf/cf-redis-broker/redisinstance"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
 	"github.com/pivotal-cf/cf-redis-broker/system"
+	"github.com/pivotal-cf/cf-redis-broker/tlscert"
 )
 
 func main() {
@@ -34,13 +51,80 @@ func main() {
 		})
 	}
 
+	gate := &lease.Gate{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.LivenessHandler())
+	mux.Handle("/", gate)
+
+	stop := make(chan struct{})
+	activated := make(chan *activeBroker, 1)
+	go func() {
+		activated <- activate(config, gate, stop, brokerLogger)
+	}()
+
+	server := &http.Server{Addr: config.Host + ":" + config.Port, Handler: mux}
+	deadline, err := shutdown.Serve(server, server.ListenAndServe, config.ShutdownTimeout())
+	if err == context.DeadlineExceeded {
+		brokerLogger.Info("requests-interrupted")
+	} else if err != nil {
+		brokerLogger.Fatal("http-listen", err)
+	}
+
+	close(stop)
+
+	if active := <-activated; active != nil {
+		active.stop(deadline, brokerLogger)
+	}
+
+	brokerLogger.Info("stopped")
+}
+
+// activeBroker is what the broker sets up once it holds the lease, and has
+// to flush before it exits.
+type activeBroker struct {
+	serviceBroker *broker.RedisServiceBroker
+	remoteRepo    *redis.RemoteRepository
+	localRepo     *redis.LocalRepository
+	stateStore    *boltstore.Store
+	lease         *lease.Lease
+}
+
+// activate waits for the lease when one is configured, then loads the state
+// and has gate hand the requests to the broker. The state is only read once
+// the lease is held, so a passive broker that takes over picks up whatever
+// the previous active broker wrote. It returns nil when stop is closed
+// before the lease is acquired.
+func activate(config brokerconfig.Config, gate *lease.Gate, stop <-chan struct{}, brokerLogger lager.Logger) *activeBroker {
+	brokerLease := &lease.Lease{
+		Path:          config.Lease.Path,
+		RetryInterval: config.Lease.RetryInterval(),
+	}
+	if config.Lease.Path != "" {
+		brokerLogger.Info("waiting-for-lease", lager.Data{"lease-path": config.Lease.Path})
+		err := brokerLease.Acquire(stop)
+		if err == lease.ErrStopped {
+			return nil
+		}
+		if err != nil {
+			brokerLogger.Fatal("Error acquiring the lease", err, lager.Data{"lease-path": config.Lease.Path})
+		}
+		brokerLogger.Info("lease-acquired", lager.Data{"lease-path": config.Lease.Path})
+	}
+
+	var err error
+
 	commandRunner := system.OSCommandRunner{
 		Logger: brokerLogger,
 	}
 
+	stateStore := openStateStore(config, brokerLogger)
+
 	localRepo := &redis.LocalRepository{
 		RedisConf: config.RedisConfiguration,
 	}
+	if stateStore != nil {
+		localRepo.Metadata = stateStore
+	}
 
 	processController := &redis.OSProcessController{
 		CommandRunner:            commandRunner,
@@ -56,44 +140,295 @@ func main() {
 		RedisConfiguration:      config.RedisConfiguration,
 		ProcessController:       processController,
 		LocalInstanceRepository: localRepo,
+		ConnectToRedis:          redis.ConnectToInstance,
+		Logger:                  brokerLogger,
 	}
 
-	agentClient := &redis.RemoteAgentClient{
-		HttpAuth: config.AuthConfiguration,
+	var agentTLSConfig *tls.Config
+	if config.AgentTLS.CACertFile != "" {
+		agentTLSConfig, err = tlscert.ClientConfig(
+			config.AgentTLS.CACertFile,
+			config.AgentTLS.CertFile,
+			config.AgentTLS.KeyFile,
+		)
+		if err != nil {
+			brokerLogger.Fatal("Error loading the TLS config for agents", err)
+		}
+	} else if config.DedicatedEnabled() {
+		brokerLogger.Info("agent-tls-not-verified", lager.Data{
+			"message": "agent_tls.ca_cert_file is not set, the certificates of agents are not verified",
+		})
+	}
+	agentClient := redis.NewRemoteAgentClient(config.AuthConfiguration, agentTLSConfig, config.AgentClient)
+	var remoteRepo *redis.RemoteRepository
+	if stateStore != nil {
+		remoteRepo, err = redis.NewRemoteRepositoryWithStore(agentClient, config, stateStore)
+	} else {
+		remoteRepo, err = redis.NewRemoteRepository(agentClient, config)
 	}
-	remoteRepo, err := redis.NewRemoteRepository(agentClient, config)
 	if err != nil {
 		brokerLogger.Fatal("Error initializing remote repository", err)
 	}
+	if err := remoteRepo.StatefileRecovery(); err != nil {
+		brokerLogger.Error("statefile-recovered-from-older-generation", err, lager.Data{
+			"statefile-path": config.RedisConfiguration.Dedicated.StatefilePath,
+		})
+	}
+
+	for _, host := range remoteRepo.UnpooledNodes() {
+		brokerLogger.Info("allocated-node-not-in-pool", lager.Data{
+			"host":    host,
+			"message": "the node is no longer configured; it is drained and dropped once its instance is deprovisioned",
+		})
+	}
+
+	if config.DedicatedEnabled() {
+		go recoverQuarantinedNodes(
+			remoteRepo,
+			config.RedisConfiguration.Dedicated.QuarantineRetryInterval(),
+			stop,
+			brokerLogger.Session("quarantine"),
+		)
+
+		resetReconciler := &redis.ResetReconciler{
+			Repo:          remoteRepo,
+			RetryInterval: config.RedisConfiguration.Dedicated.ResetRetryInterval(),
+			Logger:        brokerLogger.Session("reset-reconciler"),
+		}
+		go resetReconciler.Run(stop)
+	}
+
+	brokerMetrics := metrics.NewBrokerMetrics()
+	remoteRepo.SetMetrics(brokerMetrics)
+	if config.DedicatedEnabled() {
+		brokerMetrics.WatchDedicatedPool(remoteRepo)
+	}
+	if config.SharedEnabled() {
+		brokerMetrics.WatchSharedInstances(localRepo, config.RedisConfiguration.ServiceInstanceLimit)
+	}
+
+	var operationStore broker.OperationStore
+	if config.RedisConfiguration.OperationsStatefilePath != "" {
+		operationStore, err = operation.NewStore(config.RedisConfiguration.OperationsStatefilePath)
+		if err != nil {
+			brokerLogger.Fatal("Error loading operations statefile", err, lager.Data{
+				"operations-statefile-path": config.RedisConfiguration.OperationsStatefilePath,
+			})
+		}
+	}
 
 	serviceBroker := &broker.RedisServiceBroker{
 		InstanceCreators: map[string]broker.InstanceCreator{
-			"shared":    localCreator,
-			"dedicated": remoteRepo,
+			brokerconfig.BackendShared:    localCreator,
+			brokerconfig.BackendDedicated: remoteRepo,
 		},
 		InstanceBinders: map[string]broker.InstanceBinder{
-			"shared":    localRepo,
-			"dedicated": remoteRepo,
+			brokerconfig.BackendShared:    localCreator,
+			brokerconfig.BackendDedicated: remoteRepo,
 		},
-		Config: config,
+		Config:     config,
+		Operations: operationStore,
+		Metrics:    brokerMetrics,
+		Logger:     brokerLogger,
 	}
 
+	serviceBroker.ResumeOperations()
+
 	brokerCredentials := brokerapi.BrokerCredentials{
 		Username: config.AuthConfiguration.Username,
 		Password: config.AuthConfiguration.Password,
 	}
 
-	brokerAPI := brokerapi.New(serviceBroker, brokerLogger, brokerCredentials)
+	brokerAPI := serviceapi.New(serviceBroker, brokerLogger, brokerCredentials)
 
+	mux := http.NewServeMux()
 	authWrapper := auth.NewWrapper(brokerCredentials.Username, brokerCredentials.Password)
 	debugHandler := authWrapper.WrapFunc(debug.NewHandler(remoteRepo))
 	instanceHandler := authWrapper.WrapFunc(redisinstance.NewHandler(remoteRepo))
+	passwordRotationHandler := authWrapper.WrapFunc(passwordrotation.NewHandler(serviceBroker))
+	metricsHandler := authWrapper.WrapFunc(brokerMetrics.Registry.Handler())
+	nodesHandler := authWrapper.WrapFunc(nodepool.NewHandler(remoteRepo))
+	drainNodeHandler := authWrapper.WrapFunc(nodepool.NewDrainHandler(remoteRepo))
+	forceDeprovisionHandler := authWrapper.WrapFunc(nodepool.NewForceDeprovisionHandler(remoteRepo))
+
+	mux.HandleFunc("/instance", instanceHandler)
+	mux.HandleFunc("/debug", debugHandler)
+	mux.HandleFunc("/rotate_password", passwordRotationHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/nodes", nodesHandler)
+	mux.HandleFunc("/nodes/drain", drainNodeHandler)
+	mux.HandleFunc("/force_deprovision", forceDeprovisionHandler)
+	mux.HandleFunc("/readyz", health.ReadinessHandler(readinessChecks(config, remoteRepo, agentClient)...))
+	mux.Handle("/", brokerAPI)
+
+	gate.Activate(mux)
+
+	return &activeBroker{
+		serviceBroker: serviceBroker,
+		remoteRepo:    remoteRepo,
+		localRepo:     localRepo,
+		stateStore:    stateStore,
+		lease:         brokerLease,
+	}
+}
 
-	http.HandleFunc("/instance", instanceHandler)
-	http.HandleFunc("/debug", debugHandler)
-	http.Handle("/", brokerAPI)
+// stop waits for the operations in progress until deadline, writes the
+// state one last time and only then gives the lease up.
+func (active *activeBroker) stop(deadline time.Time, brokerLogger lager.Logger) {
+	if !active.serviceBroker.WaitForOperations(deadline) {
+		brokerLogger.Info("operations-interrupted")
+	}
+
+	flushed := shutdown.WaitFunc(func() {
+		if err := active.remoteRepo.Close(); err != nil {
+			brokerLogger.Error("persisting-statefile-failed", err)
+		}
+		if active.stateStore != nil {
+			if err := active.stateStore.Close(); err != nil {
+				brokerLogger.Error("closing-state-store-failed", err)
+			}
+		}
+	}, deadline)
+	if !flushed {
+		brokerLogger.Info("statefile-not-flushed")
+	}
 
-	brokerLogger.Fatal("http-listen", http.ListenAndServe(config.Host+":"+config.Port, nil))
+	if err := active.localRepo.ReleaseLocks(); err != nil {
+		brokerLogger.Error("releasing-instance-locks-failed", err)
+	}
+
+	// A statefile that was not flushed in time may still be written to, so
+	// the lease is only released when the process exits.
+	if flushed {
+		if err := active.lease.Release(); err != nil {
+			brokerLogger.Error("releasing-lease-failed", err)
+		}
+	}
+}
+
+// openStateStore opens the BoltDB state store when it is configured. It
+// refuses to start with an empty store while there is still state in the
+// statefile or the instance directories, since the broker would hand out
+// nodes that are in use.
+func openStateStore(config brokerconfig.Config, logger lager.Logger) *boltstore.Store {
+	storeConfig := config.RedisConfiguration.StateStore
+	if storeConfig.Backend != brokerconfig.StateStoreBolt {
+		return nil
+	}
+
+	store, err := boltstore.Open(storeConfig.Path)
+	if err != nil {
+		logger.Fatal("Error opening the state store", err, lager.Data{
+			"state-store-path": storeConfig.Path,
+		})
+	}
+
+	empty, err := store.IsEmpty()
+	if err != nil {
+		logger.Fatal("Error reading the state store", err)
+	}
+	if !empty {
+		return store
+	}
+
+	if config.DedicatedEnabled() {
+		if _, err := os.Stat(config.RedisConfiguration.Dedicated.StatefilePath); err == nil {
+			logger.Fatal("State store is not migrated", errors.New("run statemigrator to copy the statefile into the state store"))
+		}
+	}
+	if config.SharedEnabled() {
+		instances := &redis.DirectoryMetadataStore{
+			InstanceDataDirectory: config.RedisConfiguration.InstanceDataDirectory,
+		}
+		if allMetadata, err := instances.AllMetadata(); err == nil && len(allMetadata) > 0 {
+			logger.Fatal("State store is not migrated", errors.New("run statemigrator to copy the shared instances into the state store"))
+		}
+	}
+
+	return store
+}
+
+// recoverQuarantinedNodes periodically resets the quarantined dedicated nodes
+// until stop is closed.
+func recoverQuarantinedNodes(remoteRepo *redis.RemoteRepository, interval time.Duration, stop <-chan struct{}, logger lager.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, host := range remoteRepo.RecoverQuarantinedNodes() {
+			logger.Info("node-recovered", lager.Data{"host": host})
+		}
+		for _, node := range remoteRepo.Nodes() {
+			if node.State == redis.NodeQuarantined {
+				logger.Info("node-still-quarantined", lager.Data{"host": node.Host, "reason": node.Reason})
+			}
+		}
+	}
+}
+
+// agentSampleSize is how many agents each readiness check contacts, so that
+// large pools of dedicated nodes do not slow it down.
+const agentSampleSize = 3
+
+func readinessChecks(config brokerconfig.Config, remoteRepo *redis.RemoteRepository, agentClient *redis.RemoteAgentClient) []health.Check {
+	checks := []health.Check{}
+
+	if config.SharedEnabled() {
+		redisServer := config.RedisServerExecutablePath
+		if redisServer == "" {
+			redisServer = "redis-server"
+		}
+
+		checks = append(checks,
+			health.DirectoryExists("data-directory", config.RedisConfiguration.InstanceDataDirectory),
+			health.DirectoryExists("log-directory", config.RedisConfiguration.InstanceLogDirectory),
+			health.Runnable("redis-server", redisServer, "--version"),
+		)
+	}
+
+	statefileDir := filepath.Dir(config.RedisConfiguration.Dedicated.StatefilePath)
+	if config.RedisConfiguration.StateStore.Backend == brokerconfig.StateStoreBolt {
+		statefileDir = filepath.Dir(config.RedisConfiguration.StateStore.Path)
+	}
+
+	if config.DedicatedEnabled() {
+		checks = append(checks,
+			health.Writable("statefile", statefileDir),
+			health.Check{
+				Name: "agents",
+				Run: func() error {
+					return agentsReachable(remoteRepo.AgentURLs(), agentClient)
+				},
+			},
+		)
+	}
+
+	if config.RedisConfiguration.OperationsStatefilePath != "" {
+		checks = append(checks,
+			health.Writable("operations-statefile", filepath.Dir(config.RedisConfiguration.OperationsStatefilePath)),
+		)
+	}
+
+	return checks
+}
+
+func agentsReachable(agentURLs []string, agentClient *redis.RemoteAgentClient) error {
+	for i, index := range rand.Perm(len(agentURLs)) {
+		if i == agentSampleSize {
+			break
+		}
+
+		if err := agentClient.Ping(agentURLs[index]); err != nil {
+			return fmt.Errorf("agent %s: %s", agentURLs[index], err)
+		}
+	}
+	return nil
 }
 
 func configPath() string {
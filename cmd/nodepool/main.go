@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/nodepool"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+const usage = `usage: nodepool list
+       nodepool add HOST
+       nodepool drain HOST
+       nodepool remove HOST
+       nodepool force-deprovision INSTANCE_ID
+
+Manages the dedicated nodes of the broker configured in BROKER_CONFIG_PATH.
+force-deprovision frees the nodes of an instance whose agents cannot reset
+them; the broker keeps retrying the reset before it allocates them again.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		exit(usage)
+	}
+
+	config, err := brokerconfig.ParseConfig(configPath())
+	if err != nil {
+		exit("loading the broker config: %s\n", err)
+	}
+
+	client := &nodepool.Client{
+		BrokerURL: brokerURL(config),
+		Username:  config.AuthConfiguration.Username,
+		Password:  config.AuthConfiguration.Password,
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+
+	var nodes []redis.Node
+	switch {
+	case command == "list" && len(args) == 0:
+		nodes, err = client.Nodes()
+	case command == "add" && len(args) == 1:
+		nodes, err = client.AddNode(args[0])
+	case command == "drain" && len(args) == 1:
+		nodes, err = client.DrainNode(args[0])
+	case command == "remove" && len(args) == 1:
+		nodes, err = client.RemoveNode(args[0])
+	case command == "force-deprovision" && len(args) == 1:
+		nodes, err = client.ForceDeprovision(args[0])
+	default:
+		exit(usage)
+	}
+	if err != nil {
+		exit("%s\n", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "HOST\tSTATE\tINSTANCE\tLABELS\tREASON")
+	for _, node := range nodes {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", node.Host, node.State, node.InstanceID, brokerconfig.FormatLabels(node.Labels), node.Reason)
+	}
+	writer.Flush()
+}
+
+func brokerURL(config brokerconfig.Config) string {
+	host := config.Host
+	if host == "" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	return "http://" + host + ":" + config.Port
+}
+
+func exit(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+	os.Exit(1)
+}
+
+func configPath() string {
+	brokerConfigYamlPath := os.Getenv("BROKER_CONFIG_PATH")
+	if brokerConfigYamlPath == "" {
+		exit("BROKER_CONFIG_PATH not set\n")
+	}
+	return brokerConfigYamlPath
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
 	"github.com/pivotal-cf/cf-redis-broker/process"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
 	"github.com/pivotal-cf/cf-redis-broker/system"
 	"github.com/pivotal-golang/lager"
 )
@@ -66,6 +67,10 @@ func main() {
 		copyConfigFile(instance, repo, logger)
 	}
 
+	// The current check loop is finished before stopping, so that no redis is
+	// left half-started.
+	stop := shutdown.Notify()
+
 	for {
 		if skipProcessCheck {
 			logger.Info("Skipping instance check")
@@ -80,7 +85,12 @@ func main() {
 			}
 		}
 
-		time.Sleep(time.Second * time.Duration(checkInterval))
+		select {
+		case <-stop:
+			logger.Info("Stopping process monitor")
+			return
+		case <-time.After(time.Second * time.Duration(checkInterval)):
+		}
 	}
 }
 
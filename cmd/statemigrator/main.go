@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/pivotal-cf/cf-redis-broker/boltstore"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/statemigrator"
+	"github.com/pivotal-golang/lager"
+)
+
+// The broker has to be stopped while the state is migrated: it holds the
+// state store open, and it would keep writing the statefile.
+func main() {
+	brokerConfigPath := configPath()
+
+	log := lager.NewLogger("redis-statemigrator")
+	log.RegisterSink(lager.NewWriterSink(os.Stdout, lager.DEBUG))
+	log.RegisterSink(lager.NewWriterSink(os.Stderr, lager.ERROR))
+
+	log.Info("Config File: " + brokerConfigPath)
+
+	config, err := brokerconfig.ParseConfig(brokerConfigPath)
+	if err != nil {
+		log.Fatal("Loading config file", err, lager.Data{
+			"broker-config-path": brokerConfigPath,
+		})
+	}
+
+	stateStore := config.RedisConfiguration.StateStore
+	if stateStore.Backend != brokerconfig.StateStoreBolt {
+		log.Fatal("Checking the state store", errors.New("state_store.backend is not bolt, there is nothing to migrate to"))
+	}
+
+	store, err := boltstore.Open(stateStore.Path)
+	if err != nil {
+		log.Fatal("Opening the state store", err, lager.Data{
+			"state-store-path": stateStore.Path,
+		})
+	}
+	defer store.Close()
+
+	migrator := &statemigrator.StateMigrator{
+		ToState:    store,
+		ToMetadata: store,
+	}
+
+	if config.DedicatedEnabled() {
+		dedicated := config.RedisConfiguration.Dedicated
+		migrator.FromState = redis.NewFileStateStore(dedicated.StatefilePath, dedicated.Generations())
+	}
+
+	if config.SharedEnabled() {
+		migrator.FromMetadata = &redis.DirectoryMetadataStore{
+			InstanceDataDirectory: config.RedisConfiguration.InstanceDataDirectory,
+		}
+	}
+
+	err = migrator.Migrate()
+	if err != nil {
+		log.Fatal("Could not migrate state", err)
+	}
+
+	log.Info("Migrated state", lager.Data{
+		"state-store-path": stateStore.Path,
+	})
+}
+
+func configPath() string {
+	brokerConfigYamlPath := os.Getenv("BROKER_CONFIG_PATH")
+	if brokerConfigYamlPath == "" {
+		panic("BROKER_CONFIG_PATH not set")
+	}
+	return brokerConfigYamlPath
+}
@@ -29,6 +29,7 @@ type Binding struct {
 type Cluster struct {
 	ID       string
 	Hosts    []string  `json:"hosts"`
+	Master   string    `json:"master,omitempty"`
 	Bindings []Binding `json:"bindings"`
 }
 
@@ -92,8 +93,16 @@ func getAllocatedInfo(repo *redis.RemoteRepository) (Allocated, error) {
 		}
 
 		c := Cluster{
-			ID:    instance.ID,
-			Hosts: []string{instance.Host},
+			ID: instance.ID,
+		}
+
+		for _, node := range instance.Group() {
+			c.Hosts = append(c.Hosts, node.Host)
+		}
+
+		// The sentinels may not answer; the hosts are still worth showing.
+		if instance.MasterName != "" {
+			c.Master, _ = repo.CurrentMaster(instance.ID)
 		}
 
 		for _, id := range bindingIDs {
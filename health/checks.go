@@ -0,0 +1,80 @@
+package health
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const commandTimeout = 5 * time.Second
+
+// DirectoryExists checks that path is an existing directory.
+func DirectoryExists(name, path string) Check {
+	return Check{
+		Name: name,
+		Run: func() error {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", path)
+			}
+			return nil
+		},
+	}
+}
+
+// Writable checks that files can be created in dir, by creating and
+// removing one.
+func Writable(name, dir string) Check {
+	return Check{
+		Name: name,
+		Run: func() error {
+			file, err := ioutil.TempFile(dir, ".readyz")
+			if err != nil {
+				return err
+			}
+			file.Close()
+			return os.Remove(file.Name())
+		},
+	}
+}
+
+// Runnable checks that the executable at path starts and exits successfully
+// with the given arguments.
+func Runnable(name, path string, args ...string) Check {
+	return Check{
+		Name: name,
+		Run: func() error {
+			output := &bytes.Buffer{}
+			command := exec.Command(path, args...)
+			command.Stdout = output
+			command.Stderr = output
+
+			if err := command.Start(); err != nil {
+				return err
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- command.Wait()
+			}()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					return fmt.Errorf("%s: %s", err, bytes.TrimSpace(output.Bytes()))
+				}
+				return nil
+			case <-time.After(commandTimeout):
+				command.Process.Kill()
+				return errors.New("timed out running " + path)
+			}
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Check is a single condition a process needs to be ready.
+type Check struct {
+	Name string
+	Run  func() error
+}
+
+type Result struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Healthy bool     `json:"healthy"`
+	Checks  []Result `json:"checks"`
+}
+
+// Run runs the checks concurrently and reports them in the order given.
+func Run(checks []Check) Report {
+	report := Report{
+		Healthy: true,
+		Checks:  make([]Result, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			result := Result{Name: check.Name, Healthy: true}
+			if err := check.Run(); err != nil {
+				result.Healthy = false
+				result.Error = err.Error()
+			}
+			report.Checks[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if !result.Healthy {
+			report.Healthy = false
+		}
+	}
+
+	return report
+}
+
+// LivenessHandler answers as long as the process is able to serve requests.
+func LivenessHandler() http.HandlerFunc {
+	return ReadinessHandler()
+}
+
+// ReadinessHandler runs the checks on every request and responds with 503
+// when any of them fails.
+func ReadinessHandler(checks ...Check) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		report := Run(checks)
+
+		reportBytes, err := json.Marshal(report)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}
+		res.Write(reportBytes)
+	}
+}
@@ -0,0 +1,15 @@
+package health_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_health.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Health Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,103 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/health"
+)
+
+var _ = Describe("Health", func() {
+	serve := func(handler http.HandlerFunc) (int, health.Report) {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/readyz", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler.ServeHTTP(recorder, request)
+		Ω(recorder.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		report := health.Report{}
+		err = json.Unmarshal(recorder.Body.Bytes(), &report)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return recorder.Code, report
+	}
+
+	passing := health.Check{Name: "passing", Run: func() error { return nil }}
+	failing := health.Check{Name: "failing", Run: func() error { return errors.New("disk full") }}
+
+	Describe("LivenessHandler", func() {
+		It("responds healthy", func() {
+			code, report := serve(health.LivenessHandler())
+			Ω(code).Should(Equal(http.StatusOK))
+			Ω(report.Healthy).Should(BeTrue())
+		})
+	})
+
+	Describe("ReadinessHandler", func() {
+		It("responds 200 with every result when all checks pass", func() {
+			code, report := serve(health.ReadinessHandler(passing, passing))
+			Ω(code).Should(Equal(http.StatusOK))
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Checks).Should(HaveLen(2))
+		})
+
+		It("responds 503 and reports the failing check", func() {
+			code, report := serve(health.ReadinessHandler(passing, failing))
+			Ω(code).Should(Equal(http.StatusServiceUnavailable))
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Checks).Should(Equal([]health.Result{
+				{Name: "passing", Healthy: true},
+				{Name: "failing", Healthy: false, Error: "disk full"},
+			}))
+		})
+	})
+
+	Describe("checks", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "health")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("DirectoryExists fails for missing paths and files", func() {
+			file := filepath.Join(dir, "file")
+			err := ioutil.WriteFile(file, []byte{}, 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(health.DirectoryExists("dir", dir).Run()).Should(Succeed())
+			Ω(health.DirectoryExists("dir", file).Run()).Should(MatchError(file + " is not a directory"))
+			Ω(health.DirectoryExists("dir", filepath.Join(dir, "missing")).Run()).ShouldNot(Succeed())
+		})
+
+		It("Writable leaves nothing behind", func() {
+			Ω(health.Writable("statefile", dir).Run()).Should(Succeed())
+
+			files, err := ioutil.ReadDir(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(files).Should(BeEmpty())
+
+			Ω(health.Writable("statefile", filepath.Join(dir, "missing")).Run()).ShouldNot(Succeed())
+		})
+
+		It("Runnable reports failing executables with their output", func() {
+			Ω(health.Runnable("true", "true").Run()).Should(Succeed())
+			Ω(health.Runnable("sh", "sh", "-c", "echo broken; exit 1").Run()).Should(MatchError("exit status 1: broken"))
+			Ω(health.Runnable("missing", filepath.Join(dir, "missing")).Run()).ShouldNot(Succeed())
+		})
+	})
+})
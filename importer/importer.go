@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+type Source struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Password string `json:"password"`
+}
+
+// Importer copies the data of another redis into the local redis by
+// replicating from it until the initial sync has completed. The local data
+// is replaced.
+type Importer struct {
+	ConfPath string
+	Connect  func(options ...client.Option) (client.Client, error)
+	Timeout  time.Duration
+}
+
+func New(confPath string) *Importer {
+	return &Importer{
+		ConfPath: confPath,
+		Connect:  client.Connect,
+		Timeout:  time.Minute * 10,
+	}
+}
+
+func (importer *Importer) ImportData(source Source) error {
+	if source.Host == "" || source.Port == 0 {
+		return errors.New("source host and port are required")
+	}
+
+	conf, err := redisconf.Load(importer.ConfPath)
+	if err != nil {
+		return err
+	}
+
+	redisClient, err := importer.Connect(
+		client.Port(conf.Port()),
+		client.Password(conf.Password()),
+		client.CmdAliases(conf.CommandAliases()),
+	)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	if err := redisClient.ReplicateFrom(source.Host, source.Port, source.Password); err != nil {
+		return err
+	}
+
+	syncErr := importer.waitForSync(redisClient)
+
+	if err := redisClient.StopReplication(); err != nil {
+		return err
+	}
+
+	return syncErr
+}
+
+// WaitForSync waits until the local redis, which is the replica of another
+// redis, has completed the initial sync with it.
+func (importer *Importer) WaitForSync() error {
+	conf, err := redisconf.Load(importer.ConfPath)
+	if err != nil {
+		return err
+	}
+
+	redisClient, err := importer.Connect(
+		client.Port(conf.Port()),
+		client.Password(conf.Password()),
+		client.CmdAliases(conf.CommandAliases()),
+	)
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	return importer.waitForSync(redisClient)
+}
+
+func (importer *Importer) waitForSync(redisClient client.Client) error {
+	timeout := time.After(importer.Timeout)
+	for {
+		linkStatus, err := redisClient.InfoField("master_link_status")
+		if err != nil {
+			return err
+		}
+
+		syncInProgress, err := redisClient.InfoField("master_sync_in_progress")
+		if err != nil {
+			return err
+		}
+
+		if linkStatus == "up" && syncInProgress == "0" {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case <-timeout:
+			return errors.New("timed out waiting for the data to be copied from the source")
+		}
+	}
+}
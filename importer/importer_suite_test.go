@@ -0,0 +1,15 @@
+package importer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestImporter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_importer.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Importer Suite", []Reporter{junitReporter})
+}
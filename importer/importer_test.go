@@ -0,0 +1,133 @@
+package importer_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Importer", func() {
+	var (
+		dataImporter *importer.Importer
+		fakeClient   *fakes.Client
+		connectCount int
+		connectErr   error
+		source       importer.Source
+	)
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir("", "importer-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		confPath := filepath.Join(tmpdir, "redis.conf")
+		err = redisconf.New(
+			redisconf.Param{Key: "port", Value: "6379"},
+			redisconf.Param{Key: "requirepass", Value: "secret"},
+		).Save(confPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeClient = &fakes.Client{
+			InfoFields: map[string]string{
+				"master_link_status":      "up",
+				"master_sync_in_progress": "0",
+			},
+		}
+		connectCount = 0
+		connectErr = nil
+
+		dataImporter = &importer.Importer{
+			ConfPath: confPath,
+			Connect: func(options ...client.Option) (client.Client, error) {
+				connectCount++
+				return fakeClient, connectErr
+			},
+			Timeout: time.Millisecond * 300,
+		}
+
+		source = importer.Source{Host: "10.0.0.1", Port: 3456, Password: "source-password"}
+	})
+
+	It("replicates from the source and promotes the local redis afterwards", func() {
+		err := dataImporter.ImportData(source)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(connectCount).Should(Equal(1))
+		Ω(fakeClient.ReplicatedFrom).Should(Equal([]string{"10.0.0.1:3456:source-password"}))
+		Ω(fakeClient.StopReplicationCallCount).Should(Equal(1))
+		Ω(fakeClient.DisconnectCallCount).Should(Equal(1))
+	})
+
+	Context("when the source is incomplete", func() {
+		It("returns an error without touching redis", func() {
+			err := dataImporter.ImportData(importer.Source{Host: "10.0.0.1"})
+			Ω(err).Should(HaveOccurred())
+			Ω(connectCount).Should(Equal(0))
+		})
+	})
+
+	Context("when the local redis cannot be reached", func() {
+		BeforeEach(func() {
+			connectErr = errors.New("connection refused")
+		})
+
+		It("returns the error", func() {
+			err := dataImporter.ImportData(source)
+			Ω(err).Should(MatchError("connection refused"))
+		})
+	})
+
+	Context("when replication cannot be started", func() {
+		BeforeEach(func() {
+			fakeClient.ExpectedReplicateFromErr = errors.New("unknown command")
+		})
+
+		It("returns the error", func() {
+			err := dataImporter.ImportData(source)
+			Ω(err).Should(MatchError("unknown command"))
+			Ω(fakeClient.StopReplicationCallCount).Should(Equal(0))
+		})
+	})
+
+	Context("when the initial sync does not complete in time", func() {
+		BeforeEach(func() {
+			fakeClient.InfoFields["master_sync_in_progress"] = "1"
+		})
+
+		It("stops replicating and returns an error", func() {
+			err := dataImporter.ImportData(source)
+			Ω(err).Should(MatchError("timed out waiting for the data to be copied from the source"))
+			Ω(fakeClient.StopReplicationCallCount).Should(Equal(1))
+		})
+	})
+
+	Describe("WaitForSync", func() {
+		It("waits for the initial sync without touching the replication", func() {
+			err := dataImporter.WaitForSync()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeClient.ReplicatedFrom).Should(BeEmpty())
+			Ω(fakeClient.StopReplicationCallCount).Should(Equal(0))
+			Ω(fakeClient.DisconnectCallCount).Should(Equal(1))
+		})
+
+		Context("when the link to the master is down", func() {
+			BeforeEach(func() {
+				fakeClient.InfoFields["master_link_status"] = "down"
+			})
+
+			It("times out", func() {
+				err := dataImporter.WaitForSync()
+				Ω(err).Should(MatchError("timed out waiting for the data to be copied from the source"))
+			})
+		})
+	})
+})
@@ -89,6 +89,131 @@ type FakeRedisClient struct {
 	runBGSaveReturns     struct {
 		result1 error
 	}
+	ReplicateFromStub        func(host string, port int, password string) error
+	replicateFromMutex       sync.RWMutex
+	replicateFromArgsForCall []struct {
+		host     string
+		port     int
+		password string
+	}
+	replicateFromReturns struct {
+		result1 error
+	}
+	StopReplicationStub        func() error
+	stopReplicationMutex       sync.RWMutex
+	stopReplicationArgsForCall []struct{}
+	stopReplicationReturns     struct {
+		result1 error
+	}
+	SetPasswordStub        func(password string) error
+	setPasswordMutex       sync.RWMutex
+	setPasswordArgsForCall []struct {
+		password string
+	}
+	setPasswordReturns struct {
+		result1 error
+	}
+	BlockWritesStub        func() error
+	blockWritesMutex       sync.RWMutex
+	blockWritesArgsForCall []struct{}
+	blockWritesReturns     struct {
+		result1 error
+	}
+	UnblockWritesStub        func() error
+	unblockWritesMutex       sync.RWMutex
+	unblockWritesArgsForCall []struct{}
+	unblockWritesReturns     struct {
+		result1 error
+	}
+	RedisVersionStub        func() (string, error)
+	redisVersionMutex       sync.RWMutex
+	redisVersionArgsForCall []struct{}
+	redisVersionReturns     struct {
+		result1 string
+		result2 error
+	}
+	PingStub        func() error
+	pingMutex       sync.RWMutex
+	pingArgsForCall []struct{}
+	pingReturns     struct {
+		result1 error
+	}
+	DBSizeStub        func() (int, error)
+	dBSizeMutex       sync.RWMutex
+	dBSizeArgsForCall []struct{}
+	dBSizeReturns     struct {
+		result1 int
+		result2 error
+	}
+	SetACLUserStub        func(name string, rules ...string) error
+	setACLUserMutex       sync.RWMutex
+	setACLUserArgsForCall []struct {
+		name  string
+		rules []string
+	}
+	setACLUserReturns struct {
+		result1 error
+	}
+	DeleteACLUserStub        func(name string) error
+	deleteACLUserMutex       sync.RWMutex
+	deleteACLUserArgsForCall []struct {
+		name string
+	}
+	deleteACLUserReturns struct {
+		result1 error
+	}
+	FlushAllStub        func() error
+	flushAllMutex       sync.RWMutex
+	flushAllArgsForCall []struct{}
+	flushAllReturns     struct {
+		result1 error
+	}
+	ClusterMyIDStub        func() (string, error)
+	clusterMyIDMutex       sync.RWMutex
+	clusterMyIDArgsForCall []struct{}
+	clusterMyIDReturns     struct {
+		result1 string
+		result2 error
+	}
+	ClusterInfoStub        func() (map[string]string, error)
+	clusterInfoMutex       sync.RWMutex
+	clusterInfoArgsForCall []struct{}
+	clusterInfoReturns     struct {
+		result1 map[string]string
+		result2 error
+	}
+	ClusterMeetStub        func(host string, port int) error
+	clusterMeetMutex       sync.RWMutex
+	clusterMeetArgsForCall []struct {
+		host string
+		port int
+	}
+	clusterMeetReturns struct {
+		result1 error
+	}
+	ClusterAddSlotsStub        func(first int, last int) error
+	clusterAddSlotsMutex       sync.RWMutex
+	clusterAddSlotsArgsForCall []struct {
+		first int
+		last  int
+	}
+	clusterAddSlotsReturns struct {
+		result1 error
+	}
+	ClusterReplicateStub        func(nodeID string) error
+	clusterReplicateMutex       sync.RWMutex
+	clusterReplicateArgsForCall []struct {
+		nodeID string
+	}
+	clusterReplicateReturns struct {
+		result1 error
+	}
+	ClusterResetHardStub        func() error
+	clusterResetHardMutex       sync.RWMutex
+	clusterResetHardArgsForCall []struct{}
+	clusterResetHardReturns     struct {
+		result1 error
+	}
 }
 
 func (fake *FakeRedisClient) Disconnect() error {
@@ -393,4 +518,477 @@ func (fake *FakeRedisClient) RunBGSaveReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeRedisClient) ReplicateFrom(host string, port int, password string) error {
+	fake.replicateFromMutex.Lock()
+	fake.replicateFromArgsForCall = append(fake.replicateFromArgsForCall, struct {
+		host     string
+		port     int
+		password string
+	}{host, port, password})
+	fake.replicateFromMutex.Unlock()
+	if fake.ReplicateFromStub != nil {
+		return fake.ReplicateFromStub(host, port, password)
+	} else {
+		return fake.replicateFromReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) ReplicateFromCallCount() int {
+	fake.replicateFromMutex.RLock()
+	defer fake.replicateFromMutex.RUnlock()
+	return len(fake.replicateFromArgsForCall)
+}
+
+func (fake *FakeRedisClient) ReplicateFromArgsForCall(i int) (string, int, string) {
+	fake.replicateFromMutex.RLock()
+	defer fake.replicateFromMutex.RUnlock()
+	return fake.replicateFromArgsForCall[i].host, fake.replicateFromArgsForCall[i].port, fake.replicateFromArgsForCall[i].password
+}
+
+func (fake *FakeRedisClient) ReplicateFromReturns(result1 error) {
+	fake.ReplicateFromStub = nil
+	fake.replicateFromReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) StopReplication() error {
+	fake.stopReplicationMutex.Lock()
+	fake.stopReplicationArgsForCall = append(fake.stopReplicationArgsForCall, struct{}{})
+	fake.stopReplicationMutex.Unlock()
+	if fake.StopReplicationStub != nil {
+		return fake.StopReplicationStub()
+	} else {
+		return fake.stopReplicationReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) StopReplicationCallCount() int {
+	fake.stopReplicationMutex.RLock()
+	defer fake.stopReplicationMutex.RUnlock()
+	return len(fake.stopReplicationArgsForCall)
+}
+
+func (fake *FakeRedisClient) StopReplicationReturns(result1 error) {
+	fake.StopReplicationStub = nil
+	fake.stopReplicationReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) BlockWrites() error {
+	fake.blockWritesMutex.Lock()
+	fake.blockWritesArgsForCall = append(fake.blockWritesArgsForCall, struct{}{})
+	fake.blockWritesMutex.Unlock()
+	if fake.BlockWritesStub != nil {
+		return fake.BlockWritesStub()
+	} else {
+		return fake.blockWritesReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) BlockWritesCallCount() int {
+	fake.blockWritesMutex.RLock()
+	defer fake.blockWritesMutex.RUnlock()
+	return len(fake.blockWritesArgsForCall)
+}
+
+func (fake *FakeRedisClient) BlockWritesReturns(result1 error) {
+	fake.BlockWritesStub = nil
+	fake.blockWritesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) UnblockWrites() error {
+	fake.unblockWritesMutex.Lock()
+	fake.unblockWritesArgsForCall = append(fake.unblockWritesArgsForCall, struct{}{})
+	fake.unblockWritesMutex.Unlock()
+	if fake.UnblockWritesStub != nil {
+		return fake.UnblockWritesStub()
+	} else {
+		return fake.unblockWritesReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) UnblockWritesCallCount() int {
+	fake.unblockWritesMutex.RLock()
+	defer fake.unblockWritesMutex.RUnlock()
+	return len(fake.unblockWritesArgsForCall)
+}
+
+func (fake *FakeRedisClient) UnblockWritesReturns(result1 error) {
+	fake.UnblockWritesStub = nil
+	fake.unblockWritesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) RedisVersion() (string, error) {
+	fake.redisVersionMutex.Lock()
+	fake.redisVersionArgsForCall = append(fake.redisVersionArgsForCall, struct{}{})
+	fake.redisVersionMutex.Unlock()
+	if fake.RedisVersionStub != nil {
+		return fake.RedisVersionStub()
+	} else {
+		return fake.redisVersionReturns.result1, fake.redisVersionReturns.result2
+	}
+}
+
+func (fake *FakeRedisClient) RedisVersionCallCount() int {
+	fake.redisVersionMutex.RLock()
+	defer fake.redisVersionMutex.RUnlock()
+	return len(fake.redisVersionArgsForCall)
+}
+
+func (fake *FakeRedisClient) RedisVersionReturns(result1 string, result2 error) {
+	fake.RedisVersionStub = nil
+	fake.redisVersionReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRedisClient) Ping() error {
+	fake.pingMutex.Lock()
+	fake.pingArgsForCall = append(fake.pingArgsForCall, struct{}{})
+	fake.pingMutex.Unlock()
+	if fake.PingStub != nil {
+		return fake.PingStub()
+	} else {
+		return fake.pingReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) PingCallCount() int {
+	fake.pingMutex.RLock()
+	defer fake.pingMutex.RUnlock()
+	return len(fake.pingArgsForCall)
+}
+
+func (fake *FakeRedisClient) PingReturns(result1 error) {
+	fake.PingStub = nil
+	fake.pingReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) DBSize() (int, error) {
+	fake.dBSizeMutex.Lock()
+	fake.dBSizeArgsForCall = append(fake.dBSizeArgsForCall, struct{}{})
+	fake.dBSizeMutex.Unlock()
+	if fake.DBSizeStub != nil {
+		return fake.DBSizeStub()
+	} else {
+		return fake.dBSizeReturns.result1, fake.dBSizeReturns.result2
+	}
+}
+
+func (fake *FakeRedisClient) DBSizeCallCount() int {
+	fake.dBSizeMutex.RLock()
+	defer fake.dBSizeMutex.RUnlock()
+	return len(fake.dBSizeArgsForCall)
+}
+
+func (fake *FakeRedisClient) DBSizeReturns(result1 int, result2 error) {
+	fake.DBSizeStub = nil
+	fake.dBSizeReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRedisClient) SetACLUser(name string, rules ...string) error {
+	fake.setACLUserMutex.Lock()
+	fake.setACLUserArgsForCall = append(fake.setACLUserArgsForCall, struct {
+		name  string
+		rules []string
+	}{name, rules})
+	fake.setACLUserMutex.Unlock()
+	if fake.SetACLUserStub != nil {
+		return fake.SetACLUserStub(name, rules...)
+	} else {
+		return fake.setACLUserReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) SetACLUserCallCount() int {
+	fake.setACLUserMutex.RLock()
+	defer fake.setACLUserMutex.RUnlock()
+	return len(fake.setACLUserArgsForCall)
+}
+
+func (fake *FakeRedisClient) SetACLUserArgsForCall(i int) (string, []string) {
+	fake.setACLUserMutex.RLock()
+	defer fake.setACLUserMutex.RUnlock()
+	return fake.setACLUserArgsForCall[i].name, fake.setACLUserArgsForCall[i].rules
+}
+
+func (fake *FakeRedisClient) SetACLUserReturns(result1 error) {
+	fake.SetACLUserStub = nil
+	fake.setACLUserReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) DeleteACLUser(name string) error {
+	fake.deleteACLUserMutex.Lock()
+	fake.deleteACLUserArgsForCall = append(fake.deleteACLUserArgsForCall, struct {
+		name string
+	}{name})
+	fake.deleteACLUserMutex.Unlock()
+	if fake.DeleteACLUserStub != nil {
+		return fake.DeleteACLUserStub(name)
+	} else {
+		return fake.deleteACLUserReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) DeleteACLUserCallCount() int {
+	fake.deleteACLUserMutex.RLock()
+	defer fake.deleteACLUserMutex.RUnlock()
+	return len(fake.deleteACLUserArgsForCall)
+}
+
+func (fake *FakeRedisClient) DeleteACLUserArgsForCall(i int) string {
+	fake.deleteACLUserMutex.RLock()
+	defer fake.deleteACLUserMutex.RUnlock()
+	return fake.deleteACLUserArgsForCall[i].name
+}
+
+func (fake *FakeRedisClient) DeleteACLUserReturns(result1 error) {
+	fake.DeleteACLUserStub = nil
+	fake.deleteACLUserReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) SetPassword(password string) error {
+	fake.setPasswordMutex.Lock()
+	fake.setPasswordArgsForCall = append(fake.setPasswordArgsForCall, struct {
+		password string
+	}{password})
+	fake.setPasswordMutex.Unlock()
+	if fake.SetPasswordStub != nil {
+		return fake.SetPasswordStub(password)
+	} else {
+		return fake.setPasswordReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) SetPasswordCallCount() int {
+	fake.setPasswordMutex.RLock()
+	defer fake.setPasswordMutex.RUnlock()
+	return len(fake.setPasswordArgsForCall)
+}
+
+func (fake *FakeRedisClient) SetPasswordArgsForCall(i int) string {
+	fake.setPasswordMutex.RLock()
+	defer fake.setPasswordMutex.RUnlock()
+	return fake.setPasswordArgsForCall[i].password
+}
+
+func (fake *FakeRedisClient) SetPasswordReturns(result1 error) {
+	fake.SetPasswordStub = nil
+	fake.setPasswordReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) FlushAll() error {
+	fake.flushAllMutex.Lock()
+	fake.flushAllArgsForCall = append(fake.flushAllArgsForCall, struct{}{})
+	fake.flushAllMutex.Unlock()
+	if fake.FlushAllStub != nil {
+		return fake.FlushAllStub()
+	} else {
+		return fake.flushAllReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) FlushAllCallCount() int {
+	fake.flushAllMutex.RLock()
+	defer fake.flushAllMutex.RUnlock()
+	return len(fake.flushAllArgsForCall)
+}
+
+func (fake *FakeRedisClient) FlushAllReturns(result1 error) {
+	fake.FlushAllStub = nil
+	fake.flushAllReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) ClusterMyID() (string, error) {
+	fake.clusterMyIDMutex.Lock()
+	fake.clusterMyIDArgsForCall = append(fake.clusterMyIDArgsForCall, struct{}{})
+	fake.clusterMyIDMutex.Unlock()
+	if fake.ClusterMyIDStub != nil {
+		return fake.ClusterMyIDStub()
+	} else {
+		return fake.clusterMyIDReturns.result1, fake.clusterMyIDReturns.result2
+	}
+}
+
+func (fake *FakeRedisClient) ClusterMyIDCallCount() int {
+	fake.clusterMyIDMutex.RLock()
+	defer fake.clusterMyIDMutex.RUnlock()
+	return len(fake.clusterMyIDArgsForCall)
+}
+
+func (fake *FakeRedisClient) ClusterMyIDReturns(result1 string, result2 error) {
+	fake.ClusterMyIDStub = nil
+	fake.clusterMyIDReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRedisClient) ClusterInfo() (map[string]string, error) {
+	fake.clusterInfoMutex.Lock()
+	fake.clusterInfoArgsForCall = append(fake.clusterInfoArgsForCall, struct{}{})
+	fake.clusterInfoMutex.Unlock()
+	if fake.ClusterInfoStub != nil {
+		return fake.ClusterInfoStub()
+	} else {
+		return fake.clusterInfoReturns.result1, fake.clusterInfoReturns.result2
+	}
+}
+
+func (fake *FakeRedisClient) ClusterInfoCallCount() int {
+	fake.clusterInfoMutex.RLock()
+	defer fake.clusterInfoMutex.RUnlock()
+	return len(fake.clusterInfoArgsForCall)
+}
+
+func (fake *FakeRedisClient) ClusterInfoReturns(result1 map[string]string, result2 error) {
+	fake.ClusterInfoStub = nil
+	fake.clusterInfoReturns = struct {
+		result1 map[string]string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRedisClient) ClusterMeet(host string, port int) error {
+	fake.clusterMeetMutex.Lock()
+	fake.clusterMeetArgsForCall = append(fake.clusterMeetArgsForCall, struct {
+		host string
+		port int
+	}{host, port})
+	fake.clusterMeetMutex.Unlock()
+	if fake.ClusterMeetStub != nil {
+		return fake.ClusterMeetStub(host, port)
+	} else {
+		return fake.clusterMeetReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) ClusterMeetCallCount() int {
+	fake.clusterMeetMutex.RLock()
+	defer fake.clusterMeetMutex.RUnlock()
+	return len(fake.clusterMeetArgsForCall)
+}
+
+func (fake *FakeRedisClient) ClusterMeetArgsForCall(i int) (string, int) {
+	fake.clusterMeetMutex.RLock()
+	defer fake.clusterMeetMutex.RUnlock()
+	return fake.clusterMeetArgsForCall[i].host, fake.clusterMeetArgsForCall[i].port
+}
+
+func (fake *FakeRedisClient) ClusterMeetReturns(result1 error) {
+	fake.ClusterMeetStub = nil
+	fake.clusterMeetReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) ClusterAddSlots(first int, last int) error {
+	fake.clusterAddSlotsMutex.Lock()
+	fake.clusterAddSlotsArgsForCall = append(fake.clusterAddSlotsArgsForCall, struct {
+		first int
+		last  int
+	}{first, last})
+	fake.clusterAddSlotsMutex.Unlock()
+	if fake.ClusterAddSlotsStub != nil {
+		return fake.ClusterAddSlotsStub(first, last)
+	} else {
+		return fake.clusterAddSlotsReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) ClusterAddSlotsCallCount() int {
+	fake.clusterAddSlotsMutex.RLock()
+	defer fake.clusterAddSlotsMutex.RUnlock()
+	return len(fake.clusterAddSlotsArgsForCall)
+}
+
+func (fake *FakeRedisClient) ClusterAddSlotsArgsForCall(i int) (int, int) {
+	fake.clusterAddSlotsMutex.RLock()
+	defer fake.clusterAddSlotsMutex.RUnlock()
+	return fake.clusterAddSlotsArgsForCall[i].first, fake.clusterAddSlotsArgsForCall[i].last
+}
+
+func (fake *FakeRedisClient) ClusterAddSlotsReturns(result1 error) {
+	fake.ClusterAddSlotsStub = nil
+	fake.clusterAddSlotsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) ClusterReplicate(nodeID string) error {
+	fake.clusterReplicateMutex.Lock()
+	fake.clusterReplicateArgsForCall = append(fake.clusterReplicateArgsForCall, struct {
+		nodeID string
+	}{nodeID})
+	fake.clusterReplicateMutex.Unlock()
+	if fake.ClusterReplicateStub != nil {
+		return fake.ClusterReplicateStub(nodeID)
+	} else {
+		return fake.clusterReplicateReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) ClusterReplicateCallCount() int {
+	fake.clusterReplicateMutex.RLock()
+	defer fake.clusterReplicateMutex.RUnlock()
+	return len(fake.clusterReplicateArgsForCall)
+}
+
+func (fake *FakeRedisClient) ClusterReplicateArgsForCall(i int) string {
+	fake.clusterReplicateMutex.RLock()
+	defer fake.clusterReplicateMutex.RUnlock()
+	return fake.clusterReplicateArgsForCall[i].nodeID
+}
+
+func (fake *FakeRedisClient) ClusterReplicateReturns(result1 error) {
+	fake.ClusterReplicateStub = nil
+	fake.clusterReplicateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRedisClient) ClusterResetHard() error {
+	fake.clusterResetHardMutex.Lock()
+	fake.clusterResetHardArgsForCall = append(fake.clusterResetHardArgsForCall, struct{}{})
+	fake.clusterResetHardMutex.Unlock()
+	if fake.ClusterResetHardStub != nil {
+		return fake.ClusterResetHardStub()
+	} else {
+		return fake.clusterResetHardReturns.result1
+	}
+}
+
+func (fake *FakeRedisClient) ClusterResetHardCallCount() int {
+	fake.clusterResetHardMutex.RLock()
+	defer fake.clusterResetHardMutex.RUnlock()
+	return len(fake.clusterResetHardArgsForCall)
+}
+
+func (fake *FakeRedisClient) ClusterResetHardReturns(result1 error) {
+	fake.ClusterResetHardStub = nil
+	fake.clusterResetHardReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ client.Client = new(FakeRedisClient)
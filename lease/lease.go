@@ -0,0 +1,122 @@
+package lease
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const DefaultRetryInterval = 5 * time.Second
+
+var ErrStopped = errors.New("stopped waiting for the lease")
+
+// Lease elects the active broker among brokers that share their state. The
+// active broker holds an exclusive flock on the lease file, which the kernel
+// releases when the broker exits, so a passive broker takes over as soon as
+// the active one is gone. The file has to live on storage that every broker
+// mounts and that supports flock.
+type Lease struct {
+	Path          string
+	RetryInterval time.Duration
+
+	file *os.File
+}
+
+// TryAcquire takes the lease if no other broker holds it, and tells whether
+// this broker holds it now.
+func (lease *Lease) TryAcquire() (bool, error) {
+	if lease.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(lease.Path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return false, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		file.Close()
+		return false, nil
+	}
+	if err != nil {
+		file.Close()
+		return false, err
+	}
+
+	lease.file = file
+	return true, nil
+}
+
+// Acquire waits for the lease, trying every RetryInterval, until it holds it
+// or stop is closed.
+func (lease *Lease) Acquire(stop <-chan struct{}) error {
+	interval := lease.RetryInterval
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+
+	for {
+		acquired, err := lease.TryAcquire()
+		if err != nil || acquired {
+			return err
+		}
+
+		select {
+		case <-stop:
+			return ErrStopped
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Release gives the lease up, so that a passive broker can take over before
+// this one exits.
+func (lease *Lease) Release() error {
+	if lease.file == nil {
+		return nil
+	}
+
+	err := lease.file.Close()
+	lease.file = nil
+	return err
+}
+
+// Gate answers 503 Service Unavailable while the broker is passive, and
+// hands the requests to the handler of the broker once it is active.
+type Gate struct {
+	handler http.Handler
+	sync.RWMutex
+}
+
+// Activate starts handing the requests to handler.
+func (gate *Gate) Activate(handler http.Handler) {
+	gate.Lock()
+	defer gate.Unlock()
+
+	gate.handler = handler
+}
+
+func (gate *Gate) Active() bool {
+	gate.RLock()
+	defer gate.RUnlock()
+
+	return gate.handler != nil
+}
+
+func (gate *Gate) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	gate.RLock()
+	handler := gate.handler
+	gate.RUnlock()
+
+	if handler == nil {
+		res.Header().Set("Retry-After", "5")
+		http.Error(res, "this broker is passive, another broker holds the lease", http.StatusServiceUnavailable)
+		return
+	}
+
+	handler.ServeHTTP(res, req)
+}
@@ -0,0 +1,15 @@
+package lease_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLease(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_lease.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Lease Suite", []Reporter{junitReporter})
+}
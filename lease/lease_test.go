@@ -0,0 +1,109 @@
+package lease_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/lease"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lease", func() {
+	var (
+		tmpDir  string
+		active  *lease.Lease
+		passive *lease.Lease
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lease")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		path := filepath.Join(tmpDir, "broker.lease")
+		active = &lease.Lease{Path: path, RetryInterval: 10 * time.Millisecond}
+		passive = &lease.Lease{Path: path, RetryInterval: 10 * time.Millisecond}
+	})
+
+	AfterEach(func() {
+		active.Release()
+		passive.Release()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("is held by one broker at a time", func() {
+		Ω(active.TryAcquire()).Should(BeTrue())
+		Ω(active.TryAcquire()).Should(BeTrue())
+		Ω(passive.TryAcquire()).Should(BeFalse())
+	})
+
+	It("passes to the passive broker once the active one releases it", func() {
+		Ω(active.TryAcquire()).Should(BeTrue())
+
+		acquired := make(chan error, 1)
+		go func() {
+			acquired <- passive.Acquire(make(chan struct{}))
+		}()
+		Consistently(acquired, 50*time.Millisecond).ShouldNot(Receive())
+
+		Ω(active.Release()).Should(Succeed())
+		Eventually(acquired).Should(Receive(BeNil()))
+		Ω(active.TryAcquire()).Should(BeFalse())
+	})
+
+	It("stops waiting when asked to", func() {
+		Ω(active.TryAcquire()).Should(BeTrue())
+
+		stop := make(chan struct{})
+		close(stop)
+		Ω(passive.Acquire(stop)).Should(Equal(lease.ErrStopped))
+	})
+
+	It("fails when the lease file cannot be created", func() {
+		broken := &lease.Lease{Path: filepath.Join(tmpDir, "missing", "broker.lease")}
+		_, err := broken.TryAcquire()
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("Gate", func() {
+	var (
+		gate     *lease.Gate
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		gate = &lease.Gate{}
+		recorder = httptest.NewRecorder()
+	})
+
+	serve := func() {
+		request, err := http.NewRequest("GET", "http://localhost/v2/catalog", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		gate.ServeHTTP(recorder, request)
+	}
+
+	It("answers 503 while the broker is passive", func() {
+		serve()
+
+		Ω(gate.Active()).Should(BeFalse())
+		Ω(recorder.Code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(recorder.Header().Get("Retry-After")).ShouldNot(BeEmpty())
+	})
+
+	It("hands the requests to the broker once it is active", func() {
+		gate.Activate(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(http.StatusTeapot)
+		}))
+		serve()
+
+		Ω(gate.Active()).Should(BeTrue())
+		Ω(recorder.Code).Should(Equal(http.StatusTeapot))
+	})
+})
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+type DedicatedPool interface {
+	InstanceLimit() int
+	AvailableInstances() []*redis.Instance
+	QuarantinedNodes() []string
+	PendingResetNodes() []string
+}
+
+type SharedInstances interface {
+	InstanceCount() (int, error)
+}
+
+// BrokerMetrics are the metrics the broker serves on /metrics.
+type BrokerMetrics struct {
+	Registry *Registry
+
+	operations             *CounterVec
+	operationDurations     *HistogramVec
+	agentErrors            *CounterVec
+	statefileWriteFailures *CounterVec
+}
+
+func NewBrokerMetrics() *BrokerMetrics {
+	registry := NewRegistry()
+
+	return &BrokerMetrics{
+		Registry: registry,
+		operations: registry.NewCounterVec(
+			"redis_broker_operations_total",
+			"Number of provision, deprovision, bind and unbind requests handled by the broker.",
+			"operation", "plan", "outcome",
+		),
+		operationDurations: registry.NewHistogramVec(
+			"redis_broker_operation_duration_seconds",
+			"Time taken to provision, deprovision, bind and unbind.",
+			DefaultBuckets,
+			"operation", "plan", "outcome",
+		),
+		agentErrors: registry.NewCounterVec(
+			"redis_broker_agent_errors_total",
+			"Number of failed calls to the agents of dedicated nodes, by whether the agent was unreachable or refused the call.",
+			"call", "reason",
+		),
+		statefileWriteFailures: registry.NewCounterVec(
+			"redis_broker_statefile_write_failures_total",
+			"Number of times the statefile of the dedicated nodes could not be written.",
+		),
+	}
+}
+
+func (brokerMetrics *BrokerMetrics) ObserveOperation(operation, plan, outcome string, duration time.Duration) {
+	brokerMetrics.operations.Inc(operation, plan, outcome)
+	brokerMetrics.operationDurations.Observe(duration.Seconds(), operation, plan, outcome)
+}
+
+func (brokerMetrics *BrokerMetrics) AgentCallFailed(call, reason string) {
+	brokerMetrics.agentErrors.Inc(call, reason)
+}
+
+func (brokerMetrics *BrokerMetrics) StatefileWriteFailed() {
+	brokerMetrics.statefileWriteFailures.Inc()
+}
+
+// WatchDedicatedPool exposes the number of dedicated nodes, how many of them
+// are still free, how many failed their health check and how many wait for a
+// reset after a forced deprovision.
+func (brokerMetrics *BrokerMetrics) WatchDedicatedPool(pool DedicatedPool) {
+	brokerMetrics.Registry.NewGaugeFunc(
+		"redis_broker_dedicated_pool_size",
+		"Number of dedicated nodes configured.",
+		func() float64 { return float64(pool.InstanceLimit()) },
+	)
+	brokerMetrics.Registry.NewGaugeFunc(
+		"redis_broker_dedicated_pool_available",
+		"Number of dedicated nodes not allocated to an instance.",
+		func() float64 { return float64(len(pool.AvailableInstances())) },
+	)
+	brokerMetrics.Registry.NewGaugeFunc(
+		"redis_broker_dedicated_pool_quarantined",
+		"Number of dedicated nodes quarantined after failing their health check.",
+		func() float64 { return float64(len(pool.QuarantinedNodes())) },
+	)
+	brokerMetrics.Registry.NewGaugeFunc(
+		"redis_broker_dedicated_pool_pending_reset",
+		"Number of dedicated nodes freed by a forced deprovision and not reset yet.",
+		func() float64 { return float64(len(pool.PendingResetNodes())) },
+	)
+}
+
+// WatchSharedInstances exposes the number of shared instances and the
+// service_instance_limit they count against.
+func (brokerMetrics *BrokerMetrics) WatchSharedInstances(instances SharedInstances, limit int) {
+	brokerMetrics.Registry.NewGaugeFunc(
+		"redis_broker_shared_instances",
+		"Number of shared instances.",
+		func() float64 {
+			count, err := instances.InstanceCount()
+			if err != nil {
+				return math.NaN()
+			}
+			return float64(count)
+		},
+	)
+	brokerMetrics.Registry.NewGaugeFunc(
+		"redis_broker_shared_instance_limit",
+		"Maximum number of shared instances.",
+		func() float64 { return float64(limit) },
+	)
+}
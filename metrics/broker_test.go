@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/metrics"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+type fakePool struct {
+	available    []*redis.Instance
+	quarantined  []string
+	pendingReset []string
+}
+
+func (pool *fakePool) InstanceLimit() int {
+	return 3
+}
+
+func (pool *fakePool) AvailableInstances() []*redis.Instance {
+	return pool.available
+}
+
+func (pool *fakePool) QuarantinedNodes() []string {
+	return pool.quarantined
+}
+
+func (pool *fakePool) PendingResetNodes() []string {
+	return pool.pendingReset
+}
+
+type fakeSharedInstances struct {
+	count int
+	err   error
+}
+
+func (instances *fakeSharedInstances) InstanceCount() (int, error) {
+	return instances.count, instances.err
+}
+
+var _ = Describe("BrokerMetrics", func() {
+	var brokerMetrics *metrics.BrokerMetrics
+
+	render := func() string {
+		buffer := &bytes.Buffer{}
+		brokerMetrics.Registry.Write(buffer)
+		return buffer.String()
+	}
+
+	BeforeEach(func() {
+		brokerMetrics = metrics.NewBrokerMetrics()
+	})
+
+	It("counts and times operations per plan and outcome", func() {
+		brokerMetrics.ObserveOperation("provision", "small", "succeeded", 2*time.Second)
+
+		output := render()
+		Ω(output).Should(ContainSubstring(`redis_broker_operations_total{operation="provision",plan="small",outcome="succeeded"} 1`))
+		Ω(output).Should(ContainSubstring(`redis_broker_operation_duration_seconds_sum{operation="provision",plan="small",outcome="succeeded"} 2`))
+	})
+
+	It("counts agent errors and statefile write failures", func() {
+		brokerMetrics.AgentCallFailed("reset", "unreachable")
+		brokerMetrics.StatefileWriteFailed()
+		brokerMetrics.StatefileWriteFailed()
+
+		output := render()
+		Ω(output).Should(ContainSubstring(`redis_broker_agent_errors_total{call="reset",reason="unreachable"} 1`))
+		Ω(output).Should(ContainSubstring("redis_broker_statefile_write_failures_total 2\n"))
+	})
+
+	It("reports the size and remaining capacity of the dedicated pool", func() {
+		pool := &fakePool{
+			available:    []*redis.Instance{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}},
+			quarantined:  []string{"10.0.0.4"},
+			pendingReset: []string{"10.0.0.5", "10.0.0.6"},
+		}
+		brokerMetrics.WatchDedicatedPool(pool)
+
+		output := render()
+		Ω(output).Should(ContainSubstring("redis_broker_dedicated_pool_size 3\n"))
+		Ω(output).Should(ContainSubstring("redis_broker_dedicated_pool_available 2\n"))
+		Ω(output).Should(ContainSubstring("redis_broker_dedicated_pool_quarantined 1\n"))
+		Ω(output).Should(ContainSubstring("redis_broker_dedicated_pool_pending_reset 2\n"))
+
+		pool.available = nil
+		Ω(render()).Should(ContainSubstring("redis_broker_dedicated_pool_available 0\n"))
+	})
+
+	It("reports the shared instances against their limit", func() {
+		instances := &fakeSharedInstances{count: 4}
+		brokerMetrics.WatchSharedInstances(instances, 10)
+
+		output := render()
+		Ω(output).Should(ContainSubstring("redis_broker_shared_instances 4\n"))
+		Ω(output).Should(ContainSubstring("redis_broker_shared_instance_limit 10\n"))
+
+		instances.err = errors.New("data directory missing")
+		Ω(render()).Should(ContainSubstring("redis_broker_shared_instances NaN\n"))
+	})
+})
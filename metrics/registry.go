@@ -0,0 +1,298 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type collector interface {
+	describe() description
+	write(w io.Writer, desc description)
+}
+
+type description struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// Registry holds metrics and renders them in the Prometheus text exposition
+// format.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (registry *Registry) register(c collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	name := c.describe().name
+	for _, existing := range registry.collectors {
+		if existing.describe().name == name {
+			panic("metric registered twice: " + name)
+		}
+	}
+	registry.collectors = append(registry.collectors, c)
+}
+
+// NewCounterVec registers a counter with one series per combination of
+// label values.
+func (registry *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{
+		desc:   description{name: name, help: help, kind: "counter", labels: labels},
+		series: map[string]*counterSeries{},
+	}
+	registry.register(counter)
+	return counter
+}
+
+// NewHistogramVec registers a histogram with one series per combination of
+// label values. Observations are counted in the given upper bounds.
+func (registry *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	histogram := &HistogramVec{
+		desc:    description{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	registry.register(histogram)
+	return histogram
+}
+
+// NewGaugeFunc registers a gauge whose value is read from value every time
+// the metrics are rendered.
+func (registry *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	registry.register(&gaugeFunc{
+		desc:  description{name: name, help: help, kind: "gauge"},
+		value: value,
+	})
+}
+
+func (registry *Registry) Write(w io.Writer) {
+	registry.mutex.Lock()
+	collectors := append([]collector{}, registry.collectors...)
+	registry.mutex.Unlock()
+
+	sort.Sort(byName(collectors))
+
+	for _, c := range collectors {
+		desc := c.describe()
+		fmt.Fprintf(w, "# HELP %s %s\n", desc.name, escapeHelp(desc.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", desc.name, desc.kind)
+		c.write(w, desc)
+	}
+}
+
+func (registry *Registry) Handler() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		writer := bufio.NewWriter(res)
+		registry.Write(writer)
+		writer.Flush()
+	}
+}
+
+type CounterVec struct {
+	desc   description
+	mutex  sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc adds one to the series with the given label values, which must be
+// passed in the order the labels were registered in.
+func (counter *CounterVec) Inc(labelValues ...string) {
+	checkLabels(counter.desc, labelValues)
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	key := seriesKey(labelValues)
+	series, ok := counter.series[key]
+	if !ok {
+		series = &counterSeries{labelValues: append([]string{}, labelValues...)}
+		counter.series[key] = series
+	}
+	series.value++
+}
+
+func (counter *CounterVec) describe() description {
+	return counter.desc
+}
+
+func (counter *CounterVec) write(w io.Writer, desc description) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	keys := []string{}
+	for key := range counter.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := counter.series[key]
+		writeSample(w, desc.name, desc.labels, series.labelValues, series.value)
+	}
+}
+
+type HistogramVec struct {
+	desc    description
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Observe records value in the series with the given label values, which
+// must be passed in the order the labels were registered in.
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	checkLabels(histogram.desc, labelValues)
+
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	key := seriesKey(labelValues)
+	series, ok := histogram.series[key]
+	if !ok {
+		series = &histogramSeries{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(histogram.buckets)),
+		}
+		histogram.series[key] = series
+	}
+
+	for i, upperBound := range histogram.buckets {
+		if value <= upperBound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (histogram *HistogramVec) describe() description {
+	return histogram.desc
+}
+
+func (histogram *HistogramVec) write(w io.Writer, desc description) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	bucketLabels := append(append([]string{}, desc.labels...), "le")
+
+	keys := []string{}
+	for key := range histogram.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := histogram.series[key]
+
+		for i, upperBound := range histogram.buckets {
+			bucketValues := append(append([]string{}, series.labelValues...), formatFloat(upperBound))
+			writeSample(w, desc.name+"_bucket", bucketLabels, bucketValues, float64(series.counts[i]))
+		}
+		infValues := append(append([]string{}, series.labelValues...), "+Inf")
+		writeSample(w, desc.name+"_bucket", bucketLabels, infValues, float64(series.count))
+
+		writeSample(w, desc.name+"_sum", desc.labels, series.labelValues, series.sum)
+		writeSample(w, desc.name+"_count", desc.labels, series.labelValues, float64(series.count))
+	}
+}
+
+type gaugeFunc struct {
+	desc  description
+	value func() float64
+}
+
+func (gauge *gaugeFunc) describe() description {
+	return gauge.desc
+}
+
+func (gauge *gaugeFunc) write(w io.Writer, desc description) {
+	writeSample(w, desc.name, nil, nil, gauge.value())
+}
+
+type byName []collector
+
+func (c byName) Len() int           { return len(c) }
+func (c byName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byName) Less(i, j int) bool { return c[i].describe().name < c[j].describe().name }
+
+func checkLabels(desc description, labelValues []string) {
+	if len(labelValues) != len(desc.labels) {
+		panic(fmt.Sprintf("%s expects %d label values, got %d", desc.name, len(desc.labels), len(labelValues)))
+	}
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, value float64) {
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+		return
+	}
+
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, label, escapeLabelValue(labelValues[i]))
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,95 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/metrics"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *metrics.Registry
+
+	render := func() string {
+		buffer := &bytes.Buffer{}
+		registry.Write(buffer)
+		return buffer.String()
+	}
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+	})
+
+	It("renders counters per label values", func() {
+		counter := registry.NewCounterVec("requests_total", "Requests handled.", "method")
+		counter.Inc("GET")
+		counter.Inc("PUT")
+		counter.Inc("GET")
+
+		Ω(render()).Should(Equal(`# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{method="GET"} 2
+requests_total{method="PUT"} 1
+`))
+	})
+
+	It("renders histograms with cumulative buckets", func() {
+		histogram := registry.NewHistogramVec("duration_seconds", "Durations.", []float64{1, 0.5}, "op")
+		histogram.Observe(0.25, "a")
+		histogram.Observe(0.75, "a")
+		histogram.Observe(3, "a")
+
+		Ω(render()).Should(Equal(`# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{op="a",le="0.5"} 1
+duration_seconds_bucket{op="a",le="1"} 2
+duration_seconds_bucket{op="a",le="+Inf"} 3
+duration_seconds_sum{op="a"} 4
+duration_seconds_count{op="a"} 3
+`))
+	})
+
+	It("reads gauges when rendering and sorts metrics by name", func() {
+		value := 1.0
+		registry.NewGaugeFunc("b_gauge", "B.", func() float64 { return value })
+		registry.NewGaugeFunc("a_gauge", "A.", func() float64 { return 2 })
+		value = 5
+
+		Ω(render()).Should(Equal(`# HELP a_gauge A.
+# TYPE a_gauge gauge
+a_gauge 2
+# HELP b_gauge B.
+# TYPE b_gauge gauge
+b_gauge 5
+`))
+	})
+
+	It("escapes label values", func() {
+		counter := registry.NewCounterVec("c_total", "C.", "plan")
+		counter.Inc("a \"quoted\"\\plan\n")
+
+		Ω(render()).Should(ContainSubstring(`c_total{plan="a \"quoted\"\\plan\n"} 1`))
+	})
+
+	It("refuses to register a metric twice", func() {
+		registry.NewCounterVec("c_total", "C.")
+		Ω(func() { registry.NewCounterVec("c_total", "C.") }).Should(Panic())
+	})
+
+	It("serves the metrics over http", func() {
+		registry.NewGaugeFunc("a_gauge", "A.", func() float64 { return 2 })
+
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/metrics", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		registry.Handler().ServeHTTP(recorder, request)
+
+		Ω(recorder.Code).Should(Equal(http.StatusOK))
+		Ω(recorder.Header().Get("Content-Type")).Should(ContainSubstring("text/plain"))
+		Ω(recorder.Body.String()).Should(ContainSubstring("a_gauge 2\n"))
+	})
+})
@@ -0,0 +1,81 @@
+package nodepool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+// Client manages the node pool through the admin endpoints of the broker.
+type Client struct {
+	BrokerURL string
+	Username  string
+	Password  string
+	HTTP      *http.Client
+}
+
+func (client *Client) Nodes() ([]redis.Node, error) {
+	return client.do("GET", "/nodes", nil)
+}
+
+func (client *Client) AddNode(host string) ([]redis.Node, error) {
+	return client.do("POST", "/nodes", Request{Host: host})
+}
+
+func (client *Client) DrainNode(host string) ([]redis.Node, error) {
+	return client.do("POST", "/nodes/drain", Request{Host: host})
+}
+
+func (client *Client) RemoveNode(host string) ([]redis.Node, error) {
+	return client.do("DELETE", "/nodes", Request{Host: host})
+}
+
+func (client *Client) ForceDeprovision(instanceID string) ([]redis.Node, error) {
+	return client.do("POST", "/force_deprovision", DeprovisionRequest{InstanceID: instanceID})
+}
+
+func (client *Client) do(method, path string, request interface{}) ([]redis.Node, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(client.BrokerURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(client.Username, client.Password)
+
+	httpClient := client.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, res.Status, strings.TrimSpace(string(resBody)))
+	}
+
+	nodes := []redis.Node{}
+	err = json.Unmarshal(resBody, &nodes)
+	return nodes, err
+}
@@ -0,0 +1,132 @@
+package nodepool
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+)
+
+type NodePool interface {
+	Nodes() []redis.Node
+	AddNode(host string) error
+	DrainNode(host string) error
+	RemoveNode(host string) error
+	ForceDestroy(instanceID string) error
+}
+
+type Request struct {
+	Host string `json:"host"`
+}
+
+type DeprovisionRequest struct {
+	InstanceID string `json:"instance_id"`
+}
+
+// NewHandler serves the dedicated nodes: GET lists them, POST adds a node and
+// DELETE removes a free one.
+func NewHandler(pool NodePool) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "GET":
+			writeNodes(res, pool, http.StatusOK)
+		case "POST":
+			handleChange(res, req, pool, pool.AddNode, http.StatusCreated)
+		case "DELETE":
+			handleChange(res, req, pool, pool.RemoveNode, http.StatusOK)
+		default:
+			http.Error(res, "", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// NewDrainHandler serves POST requests that mark a node as draining.
+func NewDrainHandler(pool NodePool) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(res, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handleChange(res, req, pool, pool.DrainNode, http.StatusOK)
+	}
+}
+
+// NewForceDeprovisionHandler serves POST requests that deprovision an
+// instance without resetting its nodes. The nodes are reset in the
+// background before they are allocated again.
+func NewForceDeprovisionHandler(pool NodePool) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(res, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		request := DeprovisionRequest{}
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.InstanceID == "" {
+			http.Error(res, "instance_id is required", http.StatusBadRequest)
+			return
+		}
+
+		err := pool.ForceDestroy(request.InstanceID)
+		switch err {
+		case nil:
+		case brokerapi.ErrInstanceDoesNotExist:
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		default:
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeNodes(res, pool, http.StatusOK)
+	}
+}
+
+func handleChange(res http.ResponseWriter, req *http.Request, pool NodePool, change func(string) error, status int) {
+	request := Request{}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Host == "" {
+		http.Error(res, "host is required", http.StatusBadRequest)
+		return
+	}
+
+	err := change(request.Host)
+	switch err {
+	case nil:
+	case redis.ErrNodeNotFound:
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	case redis.ErrNodeExists, redis.ErrNodeInUse:
+		http.Error(res, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeNodes(res, pool, status)
+}
+
+func writeNodes(res http.ResponseWriter, pool NodePool, status int) {
+	payload, err := json.Marshal(pool.Nodes())
+	if err != nil {
+		http.Error(res, "", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(payload)
+}
@@ -0,0 +1,15 @@
+package nodepool_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNodePool(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_nodepool.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Node Pool Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,224 @@
+package nodepool_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/auth"
+
+	"github.com/pivotal-cf/cf-redis-broker/nodepool"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeNodePool struct {
+	nodes        []redis.Node
+	added        []string
+	drained      []string
+	removed      []string
+	deprovisions []string
+	err          error
+}
+
+func (pool *fakeNodePool) Nodes() []redis.Node {
+	return pool.nodes
+}
+
+func (pool *fakeNodePool) AddNode(host string) error {
+	pool.added = append(pool.added, host)
+	return pool.err
+}
+
+func (pool *fakeNodePool) DrainNode(host string) error {
+	pool.drained = append(pool.drained, host)
+	return pool.err
+}
+
+func (pool *fakeNodePool) RemoveNode(host string) error {
+	pool.removed = append(pool.removed, host)
+	return pool.err
+}
+
+func (pool *fakeNodePool) ForceDestroy(instanceID string) error {
+	pool.deprovisions = append(pool.deprovisions, instanceID)
+	return pool.err
+}
+
+var _ = Describe("Node pool handlers", func() {
+	var (
+		recorder *httptest.ResponseRecorder
+		pool     *fakeNodePool
+	)
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		pool = &fakeNodePool{
+			nodes: []redis.Node{{Host: "10.0.0.1", State: redis.NodeAvailable}},
+		}
+	})
+
+	serve := func(handler http.HandlerFunc, method, body string) {
+		request, err := http.NewRequest(method, "http://localhost/nodes", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(recorder, request)
+	}
+
+	responseNodes := func() []redis.Node {
+		nodes := []redis.Node{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &nodes)).To(Succeed())
+		return nodes
+	}
+
+	It("lists the nodes", func() {
+		serve(nodepool.NewHandler(pool), "GET", "")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(responseNodes()).To(Equal(pool.nodes))
+	})
+
+	It("adds nodes", func() {
+		serve(nodepool.NewHandler(pool), "POST", `{"host":"10.0.0.2"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusCreated))
+		Expect(pool.added).To(Equal([]string{"10.0.0.2"}))
+		Expect(responseNodes()).To(Equal(pool.nodes))
+	})
+
+	It("removes nodes", func() {
+		serve(nodepool.NewHandler(pool), "DELETE", `{"host":"10.0.0.1"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(pool.removed).To(Equal([]string{"10.0.0.1"}))
+	})
+
+	It("drains nodes", func() {
+		serve(nodepool.NewDrainHandler(pool), "POST", `{"host":"10.0.0.1"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(pool.drained).To(Equal([]string{"10.0.0.1"}))
+	})
+
+	It("only drains nodes on POST requests", func() {
+		serve(nodepool.NewDrainHandler(pool), "GET", "")
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("deprovisions instances by force", func() {
+		serve(nodepool.NewForceDeprovisionHandler(pool), "POST", `{"instance_id":"instance-id"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(pool.deprovisions).To(Equal([]string{"instance-id"}))
+		Expect(responseNodes()).To(Equal(pool.nodes))
+	})
+
+	It("responds with a 400 when deprovisioning without an instance ID", func() {
+		serve(nodepool.NewForceDeprovisionHandler(pool), "POST", `{"host":"10.0.0.1"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(pool.deprovisions).To(BeEmpty())
+	})
+
+	It("responds with a 404 when deprovisioning an unknown instance", func() {
+		pool.err = brokerapi.ErrInstanceDoesNotExist
+		serve(nodepool.NewForceDeprovisionHandler(pool), "POST", `{"instance_id":"unknown"}`)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("responds with a 400 without a host", func() {
+		serve(nodepool.NewHandler(pool), "POST", `{}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(pool.added).To(BeEmpty())
+	})
+
+	It("responds with a 404 for unknown nodes", func() {
+		pool.err = redis.ErrNodeNotFound
+		serve(nodepool.NewDrainHandler(pool), "POST", `{"host":"10.0.0.9"}`)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("responds with a 409 when removing an allocated node", func() {
+		pool.err = redis.ErrNodeInUse
+		serve(nodepool.NewHandler(pool), "DELETE", `{"host":"10.0.0.1"}`)
+		Expect(recorder.Code).To(Equal(http.StatusConflict))
+	})
+
+	It("responds with a 500 for other errors", func() {
+		pool.err = errors.New("disk full")
+		serve(nodepool.NewHandler(pool), "POST", `{"host":"10.0.0.2"}`)
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+	})
+})
+
+var _ = Describe("Client", func() {
+	var (
+		pool   *fakeNodePool
+		server *httptest.Server
+		client *nodepool.Client
+	)
+
+	BeforeEach(func() {
+		pool = &fakeNodePool{
+			nodes: []redis.Node{{Host: "10.0.0.1", State: redis.NodeAvailable}},
+		}
+
+		authWrapper := auth.NewWrapper("admin", "secret")
+		mux := http.NewServeMux()
+		mux.HandleFunc("/nodes", authWrapper.WrapFunc(nodepool.NewHandler(pool)))
+		mux.HandleFunc("/nodes/drain", authWrapper.WrapFunc(nodepool.NewDrainHandler(pool)))
+		mux.HandleFunc("/force_deprovision", authWrapper.WrapFunc(nodepool.NewForceDeprovisionHandler(pool)))
+		server = httptest.NewServer(mux)
+
+		client = &nodepool.Client{
+			BrokerURL: server.URL,
+			Username:  "admin",
+			Password:  "secret",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("manages the nodes through the broker", func() {
+		nodes, err := client.Nodes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodes).To(Equal(pool.nodes))
+
+		_, err = client.AddNode("10.0.0.2")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.DrainNode("10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.RemoveNode("10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.ForceDeprovision("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(pool.added).To(Equal([]string{"10.0.0.2"}))
+		Expect(pool.drained).To(Equal([]string{"10.0.0.1"}))
+		Expect(pool.removed).To(Equal([]string{"10.0.0.1"}))
+		Expect(pool.deprovisions).To(Equal([]string{"instance-id"}))
+	})
+
+	It("reports the errors of the broker", func() {
+		pool.err = redis.ErrNodeInUse
+
+		_, err := client.RemoveNode("10.0.0.1")
+		Expect(err).To(MatchError(ContainSubstring("409")))
+		Expect(err).To(MatchError(ContainSubstring(redis.ErrNodeInUse.Error())))
+	})
+
+	It("fails with the wrong credentials", func() {
+		client.Password = "wrong"
+
+		_, err := client.Nodes()
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+})
@@ -0,0 +1,15 @@
+package operation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestOperation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_operation.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Operation Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,190 @@
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pborman/uuid/uuid"
+
+	"github.com/pivotal-cf/cf-redis-broker/statefile"
+)
+
+type State string
+
+const (
+	InProgress State = "in progress"
+	Succeeded  State = "succeeded"
+	Failed     State = "failed"
+)
+
+type Kind string
+
+const (
+	Provision   Kind = "provision"
+	Deprovision Kind = "deprovision"
+	Update      Kind = "update"
+)
+
+var (
+	ErrOperationInProgress = errors.New("another operation for this service instance is in progress")
+	ErrOperationNotFound   = errors.New("operation not found")
+)
+
+type Operation struct {
+	ID          string            `json:"id"`
+	InstanceID  string            `json:"instance_id"`
+	Kind        Kind              `json:"kind"`
+	PlanID      string            `json:"plan_id"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	State       State             `json:"state"`
+	Description string            `json:"description"`
+}
+
+// Store keeps the most recent operation for every service instance and
+// persists them, so that operations survive a restart of the broker.
+type Store struct {
+	path       string
+	operations map[string]Operation
+	sync.Mutex
+}
+
+func NewStore(path string) (*Store, error) {
+	store := &Store{
+		path:       path,
+		operations: map[string]Operation{},
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (store *Store) Start(kind Kind, instanceID, planID string, parameters map[string]string) (Operation, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	previous, found := store.operations[instanceID]
+	if found && previous.State == InProgress {
+		return Operation{}, ErrOperationInProgress
+	}
+
+	operation := Operation{
+		ID:         uuid.NewRandom().String(),
+		InstanceID: instanceID,
+		Kind:       kind,
+		PlanID:     planID,
+		Parameters: parameters,
+		State:      InProgress,
+	}
+
+	store.operations[instanceID] = operation
+
+	if err := store.persist(); err != nil {
+		if found {
+			store.operations[instanceID] = previous
+		} else {
+			delete(store.operations, instanceID)
+		}
+		return Operation{}, err
+	}
+
+	return operation, nil
+}
+
+// Finish records the outcome of an operation. The description is shown to
+// users when the operation succeeded; failed operations are described by
+// their error.
+func (store *Store) Finish(operationID, description string, operationErr error) error {
+	store.Lock()
+	defer store.Unlock()
+
+	for instanceID, operation := range store.operations {
+		if operation.ID != operationID {
+			continue
+		}
+
+		if operationErr != nil {
+			operation.State = Failed
+			operation.Description = operationErr.Error()
+		} else {
+			operation.State = Succeeded
+			operation.Description = description
+		}
+
+		store.operations[instanceID] = operation
+		return store.persist()
+	}
+
+	return ErrOperationNotFound
+}
+
+func (store *Store) Find(instanceID, operationID string) (Operation, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	operation, found := store.operations[instanceID]
+	if !found {
+		return Operation{}, ErrOperationNotFound
+	}
+
+	if operationID != "" && operation.ID != operationID {
+		return Operation{}, ErrOperationNotFound
+	}
+
+	return operation, nil
+}
+
+func (store *Store) InProgress() []Operation {
+	store.Lock()
+	defer store.Unlock()
+
+	operations := []Operation{}
+	for _, operation := range store.operations {
+		if operation.State == InProgress {
+			operations = append(operations, operation)
+		}
+	}
+
+	return operations
+}
+
+func (store *Store) load() error {
+	if _, err := os.Stat(store.path); os.IsNotExist(err) {
+		return nil
+	}
+
+	operationBytes, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		return err
+	}
+
+	operations := []Operation{}
+	if err := json.Unmarshal(operationBytes, &operations); err != nil {
+		return err
+	}
+
+	for _, operation := range operations {
+		store.operations[operation.InstanceID] = operation
+	}
+
+	return nil
+}
+
+func (store *Store) persist() error {
+	operations := []Operation{}
+	for _, operation := range store.operations {
+		operations = append(operations, operation)
+	}
+
+	operationBytes, err := json.Marshal(operations)
+	if err != nil {
+		return err
+	}
+
+	return statefile.Write(store.path, operationBytes, 0)
+}
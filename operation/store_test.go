@@ -0,0 +1,148 @@
+package operation_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/cf-redis-broker/operation"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		tmpDir    string
+		storePath string
+		store     *operation.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "operation-store")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		storePath = filepath.Join(tmpDir, "operations.json")
+		store, err = operation.NewStore(storePath)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("Start", func() {
+		It("records an operation in progress", func() {
+			op, err := store.Start(operation.Provision, "instance-id", "plan-id", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(op.ID).ShouldNot(BeEmpty())
+
+			found, err := store.Find("instance-id", op.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.State).Should(Equal(operation.InProgress))
+			Ω(found.Kind).Should(Equal(operation.Provision))
+			Ω(found.PlanID).Should(Equal("plan-id"))
+		})
+
+		It("refuses to start a second operation for the same instance", func() {
+			_, err := store.Start(operation.Provision, "instance-id", "plan-id", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = store.Start(operation.Deprovision, "instance-id", "", nil)
+			Ω(err).Should(Equal(operation.ErrOperationInProgress))
+		})
+
+		It("replaces a finished operation", func() {
+			first, err := store.Start(operation.Provision, "instance-id", "plan-id", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(store.Finish(first.ID, "", nil)).Should(Succeed())
+
+			second, err := store.Start(operation.Deprovision, "instance-id", "", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = store.Find("instance-id", first.ID)
+			Ω(err).Should(Equal(operation.ErrOperationNotFound))
+
+			found, err := store.Find("instance-id", "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.ID).Should(Equal(second.ID))
+		})
+
+		Context("when the store cannot be persisted", func() {
+			BeforeEach(func() {
+				os.Mkdir(storePath, 0755)
+			})
+
+			It("returns an error and does not record the operation", func() {
+				_, err := store.Start(operation.Provision, "instance-id", "plan-id", nil)
+				Ω(err).Should(HaveOccurred())
+
+				_, err = store.Find("instance-id", "")
+				Ω(err).Should(Equal(operation.ErrOperationNotFound))
+			})
+		})
+	})
+
+	Describe("Finish", func() {
+		var op operation.Operation
+
+		BeforeEach(func() {
+			var err error
+			op, err = store.Start(operation.Provision, "instance-id", "plan-id", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("marks successful operations as succeeded", func() {
+			Ω(store.Finish(op.ID, "", nil)).Should(Succeed())
+
+			found, err := store.Find("instance-id", op.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.State).Should(Equal(operation.Succeeded))
+		})
+
+		It("keeps the description of successful operations", func() {
+			Ω(store.Finish(op.ID, "bindings must be recreated", nil)).Should(Succeed())
+
+			found, err := store.Find("instance-id", op.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.Description).Should(Equal("bindings must be recreated"))
+		})
+
+		It("marks failed operations as failed with the error as description", func() {
+			Ω(store.Finish(op.ID, "", errors.New("redis did not start"))).Should(Succeed())
+
+			found, err := store.Find("instance-id", op.ID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.State).Should(Equal(operation.Failed))
+			Ω(found.Description).Should(Equal("redis did not start"))
+		})
+
+		It("returns an error for unknown operations", func() {
+			Ω(store.Finish("unknown", "", nil)).Should(Equal(operation.ErrOperationNotFound))
+		})
+	})
+
+	Describe("NewStore", func() {
+		It("loads the operations persisted by a previous store", func() {
+			op, err := store.Start(operation.Deprovision, "instance-id", "", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reloaded, err := operation.NewStore(storePath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			inProgress := reloaded.InProgress()
+			Ω(inProgress).Should(HaveLen(1))
+			Ω(inProgress[0]).Should(Equal(op))
+		})
+
+		It("returns an error when the file is not valid JSON", func() {
+			err := ioutil.WriteFile(storePath, []byte("NOT JSON"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = operation.NewStore(storePath)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
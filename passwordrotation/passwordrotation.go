@@ -0,0 +1,80 @@
+package passwordrotation
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+)
+
+type PasswordRotator interface {
+	RotatePassword(instanceID string, gracePeriod time.Duration) (broker.InstanceCredentials, error)
+}
+
+type Request struct {
+	InstanceID         string `json:"instance_id"`
+	GracePeriodSeconds int    `json:"grace_period_seconds"`
+}
+
+type Response struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Password string `json:"password"`
+}
+
+// NewHandler serves POST requests that give an instance a new password.
+func NewHandler(passwordRotator PasswordRotator) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(res, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		request := Request{}
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.InstanceID == "" || request.GracePeriodSeconds < 0 {
+			http.Error(res, "instance_id is required and grace_period_seconds must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		gracePeriod := time.Duration(request.GracePeriodSeconds) * time.Second
+		credentials, err := passwordRotator.RotatePassword(request.InstanceID, gracePeriod)
+		switch err {
+		case nil:
+		case brokerapi.ErrInstanceDoesNotExist:
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		case serviceapi.ErrConcurrentOperation:
+			http.Error(res, err.Error(), http.StatusConflict)
+			return
+		case acl.ErrGracePeriodNotSupported:
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		payload, err := json.Marshal(Response{
+			Host:     credentials.Host,
+			Port:     credentials.Port,
+			Password: credentials.Password,
+		})
+		if err != nil {
+			http.Error(res, "", http.StatusInternalServerError)
+			return
+		}
+
+		res.Header().Add("Content-Type", "application/json")
+		res.Write(payload)
+	}
+}
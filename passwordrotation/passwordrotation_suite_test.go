@@ -0,0 +1,15 @@
+package passwordrotation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPasswordRotation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_passwordrotation.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Password Rotation Suite", []Reporter{junitReporter})
+}
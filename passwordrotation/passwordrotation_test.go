@@ -0,0 +1,112 @@
+package passwordrotation_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/passwordrotation"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakePasswordRotator struct {
+	instanceIDs  []string
+	gracePeriods []time.Duration
+	rotateErr    error
+}
+
+func (rotator *fakePasswordRotator) RotatePassword(instanceID string, gracePeriod time.Duration) (broker.InstanceCredentials, error) {
+	if rotator.rotateErr != nil {
+		return broker.InstanceCredentials{}, rotator.rotateErr
+	}
+	rotator.instanceIDs = append(rotator.instanceIDs, instanceID)
+	rotator.gracePeriods = append(rotator.gracePeriods, gracePeriod)
+	return broker.InstanceCredentials{Host: "10.0.0.1", Port: 6379, Password: "new-password"}, nil
+}
+
+var _ = Describe("Password rotation handler", func() {
+	var (
+		recorder *httptest.ResponseRecorder
+		rotator  *fakePasswordRotator
+		handler  http.HandlerFunc
+	)
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		rotator = &fakePasswordRotator{}
+		handler = passwordrotation.NewHandler(rotator)
+	})
+
+	rotate := func(method, body string) {
+		request, err := http.NewRequest(method, "http://localhost/rotate_password", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(recorder, request)
+	}
+
+	It("rotates the password of the instance and responds with the new credentials", func() {
+		rotate("POST", `{"instance_id":"instance-id","grace_period_seconds":600}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(rotator.instanceIDs).To(Equal([]string{"instance-id"}))
+		Expect(rotator.gracePeriods).To(Equal([]time.Duration{10 * time.Minute}))
+
+		response := passwordrotation.Response{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response).To(Equal(passwordrotation.Response{
+			Host:     "10.0.0.1",
+			Port:     6379,
+			Password: "new-password",
+		}))
+	})
+
+	It("only accepts POST requests", func() {
+		rotate("GET", "")
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("responds with a 400 without an instance id", func() {
+		rotate("POST", `{"grace_period_seconds":600}`)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(rotator.instanceIDs).To(BeEmpty())
+	})
+
+	It("responds with a 400 for a negative grace period", func() {
+		rotate("POST", `{"instance_id":"instance-id","grace_period_seconds":-1}`)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("responds with a 400 when redis cannot keep the old password", func() {
+		rotator.rotateErr = acl.ErrGracePeriodNotSupported
+		rotate("POST", `{"instance_id":"instance-id","grace_period_seconds":600}`)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("responds with a 404 for unknown instances", func() {
+		rotator.rotateErr = brokerapi.ErrInstanceDoesNotExist
+		rotate("POST", `{"instance_id":"instance-id"}`)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("responds with a 409 while another operation is in progress", func() {
+		rotator.rotateErr = serviceapi.ErrConcurrentOperation
+		rotate("POST", `{"instance_id":"instance-id"}`)
+		Expect(recorder.Code).To(Equal(http.StatusConflict))
+	})
+
+	It("responds with a 500 for other errors", func() {
+		rotator.rotateErr = errors.New("agent unavailable")
+		rotate("POST", `{"instance_id":"instance-id"}`)
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+	})
+})
@@ -1,30 +1,136 @@
 package redis
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
 )
 
 type Credentials struct {
-	Port     int    `json:"port"`
-	Password string `json:"password"`
+	Port         int    `json:"port"`
+	TLSPort      int    `json:"tls_port,omitempty"`
+	CACert       string `json:"ca_cert,omitempty"`
+	RedisVersion string `json:"redis_version,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password"`
 }
 
 type RemoteAgentClient struct {
 	HttpAuth brokerconfig.AuthConfiguration
+
+	// Retries is how many times the calls that are safe to repeat are
+	// retried, waiting RetryBackoff before the first retry and twice as long
+	// before each next one.
+	Retries      int
+	RetryBackoff time.Duration
+
+	httpClient  *http.Client
+	timeout     time.Duration
+	longTimeout time.Duration
+}
+
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// insecureHTTPClient talks to agents without verifying them. It is used
+// when no CA for agents has been configured.
+var insecureHTTPClient = newHTTPClient(
+	&tls.Config{InsecureSkipVerify: true},
+	brokerconfig.DefaultAgentConnectTimeout,
+)
+
+// NewRemoteAgentClient creates a client that verifies agents and presents a
+// client certificate according to the given TLS config, or that does not
+// verify agents when tlsConfig is nil. Its connections to the agents are
+// kept alive between calls. Each call is bounded by the timeout of the
+// settings, or by their long timeout for the calls that move data.
+func NewRemoteAgentClient(httpAuth brokerconfig.AuthConfiguration, tlsConfig *tls.Config, settings brokerconfig.AgentClient) *RemoteAgentClient {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &RemoteAgentClient{
+		HttpAuth:     httpAuth,
+		Retries:      settings.RetryCount(),
+		RetryBackoff: DefaultRetryBackoff,
+		httpClient:   newHTTPClient(tlsConfig, settings.ConnectTimeout()),
+		timeout:      settings.Timeout(),
+		longTimeout:  settings.LongTimeout(),
+	}
+}
+
+func newHTTPClient(tlsConfig *tls.Config, connectTimeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   connectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: connectTimeout,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// AgentUnreachableError is returned when the broker gets no answer from an
+// agent: the node is down, the connection fails or the call times out.
+type AgentUnreachableError struct {
+	Err error
+}
+
+func (err *AgentUnreachableError) Error() string {
+	return "agent unreachable: " + err.Err.Error()
+}
+
+// AgentError is returned when an agent answers but refuses the call.
+type AgentError struct {
+	StatusCode int
+	Body       string
+}
+
+func (err *AgentError) Error() string {
+	if err.Body == "" {
+		return fmt.Sprintf("Agent error: %d", err.StatusCode)
+	}
+	return fmt.Sprintf("Agent error: %d, %s", err.StatusCode, err.Body)
+}
+
+const (
+	AgentUnreachable = "unreachable"
+	AgentRefused     = "refused"
+)
+
+// AgentFailure tells whether a failed agent call did not reach the agent or
+// was refused by it.
+func AgentFailure(err error) string {
+	if _, ok := err.(*AgentUnreachableError); ok {
+		return AgentUnreachable
+	}
+	return AgentRefused
 }
 
 func (client *RemoteAgentClient) Reset(rootURL string) error {
-	response, err := client.doAuthenticatedRequest(rootURL, "DELETE")
+	response, err := client.doLongRequest(rootURL, "DELETE", nil)
 	if err != nil {
 		return err
 	}
+	defer closeResponse(response)
 
 	if response.StatusCode != http.StatusOK {
 		return client.agentError(response)
@@ -36,10 +142,11 @@ func (client *RemoteAgentClient) Reset(rootURL string) error {
 func (client *RemoteAgentClient) Credentials(rootURL string) (Credentials, error) {
 	credentials := Credentials{}
 
-	response, err := client.doAuthenticatedRequest(rootURL, "GET")
+	response, err := client.doIdempotentRequest(rootURL, "GET")
 	if err != nil {
 		return credentials, err
 	}
+	defer closeResponse(response)
 
 	if response.StatusCode != http.StatusOK {
 		return credentials, client.agentError(response)
@@ -58,27 +165,414 @@ func (client *RemoteAgentClient) Credentials(rootURL string) (Credentials, error
 	return credentials, nil
 }
 
+func (client *RemoteAgentClient) ApplyConfig(rootURL string, params []redisconf.Param) error {
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	configURL := strings.TrimSuffix(rootURL, "/") + "/config"
+	response, err := client.doLongRequest(configURL, "PUT", bytes.NewReader(paramBytes))
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+func (client *RemoteAgentClient) ImportData(rootURL string, source importer.Source) error {
+	sourceBytes, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+
+	dataURL := strings.TrimSuffix(rootURL, "/") + "/data"
+	response, err := client.doLongRequest(dataURL, "PUT", bytes.NewReader(sourceBytes))
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+// CreateUser has the agent create a redis user for the binding. It returns
+// acl.ErrNotSupported when the redis on the node does not support ACLs.
+func (client *RemoteAgentClient) CreateUser(rootURL, name string, scope acl.Scope) (Credentials, error) {
+	credentials := Credentials{}
+
+	scopeBytes, err := json.Marshal(scope)
+	if err != nil {
+		return credentials, err
+	}
+
+	response, err := client.doAuthenticatedRequest(bindingURL(rootURL, name), "PUT", bytes.NewReader(scopeBytes))
+	if err != nil {
+		return credentials, err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode == http.StatusNotImplemented {
+		return credentials, acl.ErrNotSupported
+	}
+
+	if response.StatusCode != http.StatusCreated {
+		return credentials, client.agentError(response)
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&credentials)
+	return credentials, err
+}
+
+// SetUser has the agent create the user of a binding with the given
+// password, which replicas need to accept the users of their master.
+func (client *RemoteAgentClient) SetUser(rootURL, name, password string, scope acl.Scope) error {
+	userBytes, err := json.Marshal(struct {
+		acl.Scope
+		Password string `json:"password"`
+	}{scope, password})
+	if err != nil {
+		return err
+	}
+
+	response, err := client.doAuthenticatedRequest(bindingURL(rootURL, name), "PUT", bytes.NewReader(userBytes))
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode == http.StatusNotImplemented {
+		return acl.ErrNotSupported
+	}
+
+	if response.StatusCode != http.StatusCreated {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+func (client *RemoteAgentClient) DeleteUser(rootURL, name string) error {
+	response, err := client.doAuthenticatedRequest(bindingURL(rootURL, name), "DELETE", nil)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+// RotatePassword has the agent set a new password, keeping the old one valid
+// for the grace period.
+func (client *RemoteAgentClient) RotatePassword(rootURL string, gracePeriod time.Duration) (Credentials, error) {
+	credentials := Credentials{}
+
+	rotationBytes, err := json.Marshal(acl.Rotation{
+		GracePeriodSeconds: int(gracePeriod / time.Second),
+	})
+	if err != nil {
+		return credentials, err
+	}
+
+	passwordURL := strings.TrimSuffix(rootURL, "/") + "/password"
+	response, err := client.doAuthenticatedRequest(passwordURL, "PUT", bytes.NewReader(rotationBytes))
+	if err != nil {
+		return credentials, err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode == http.StatusNotImplemented {
+		return credentials, acl.ErrGracePeriodNotSupported
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return credentials, client.agentError(response)
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&credentials)
+	return credentials, err
+}
+
+// Ping checks that the agent at rootURL is up and accepts the credentials of
+// the broker. The health checks of the agent take no credentials, so it asks
+// for the credentials of the node instead, which also needs its redis.
+func (client *RemoteAgentClient) Ping(rootURL string) error {
+	response, err := client.doAuthenticatedRequest(strings.TrimSuffix(rootURL, "/")+"/", "GET", nil)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+// WaitForSync returns once the redis at rootURL, a replica, has completed
+// the initial sync with its master.
+func (client *RemoteAgentClient) WaitForSync(rootURL string) error {
+	response, err := client.doLongRequest(strings.TrimSuffix(rootURL, "/")+"/replication", "GET", nil)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+// MonitorSentinel has the sentinel of the node at rootURL watch a master
+// and returns the port the sentinel listens on.
+func (client *RemoteAgentClient) MonitorSentinel(rootURL string, monitor sentinel.Monitor) (int, error) {
+	monitorBytes, err := json.Marshal(monitor)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := client.doAuthenticatedRequest(strings.TrimSuffix(rootURL, "/")+"/sentinel", "PUT", bytes.NewReader(monitorBytes))
+	if err != nil {
+		return 0, err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return 0, client.agentError(response)
+	}
+
+	port := struct {
+		Port int `json:"port"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&port)
+	return port.Port, err
+}
+
+// SentinelMaster asks the sentinel of the node at rootURL for the current
+// master.
+func (client *RemoteAgentClient) SentinelMaster(rootURL, masterName string) (sentinel.Address, error) {
+	master := sentinel.Address{}
+
+	response, err := client.doIdempotentRequest(strings.TrimSuffix(rootURL, "/")+"/sentinel/"+masterName, "GET")
+	if err != nil {
+		return master, err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return master, client.agentError(response)
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&master)
+	return master, err
+}
+
+// ClusterNodeID asks the agent at rootURL for the ID of its redis in the
+// cluster.
+func (client *RemoteAgentClient) ClusterNodeID(rootURL string) (string, error) {
+	response, err := client.doIdempotentRequest(strings.TrimSuffix(rootURL, "/")+"/cluster", "GET")
+	if err != nil {
+		return "", err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return "", client.agentError(response)
+	}
+
+	node := struct {
+		NodeID string `json:"node_id"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&node)
+	return node.NodeID, err
+}
+
+// JoinCluster has the redis at rootURL meet its peers and take its slots or
+// its master.
+func (client *RemoteAgentClient) JoinCluster(rootURL string, join cluster.Join) error {
+	joinBytes, err := json.Marshal(join)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.doAuthenticatedRequest(strings.TrimSuffix(rootURL, "/")+"/cluster", "PUT", bytes.NewReader(joinBytes))
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+// WaitForCluster returns once the redis at rootURL sees every slot of its
+// cluster served.
+func (client *RemoteAgentClient) WaitForCluster(rootURL string) error {
+	response, err := client.doLongRequest(strings.TrimSuffix(rootURL, "/")+"/cluster/ready", "GET", nil)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return client.agentError(response)
+	}
+
+	return nil
+}
+
+// KeyCount asks the agent at rootURL how many keys its redis holds. It fails
+// when redis does not answer.
+func (client *RemoteAgentClient) KeyCount(rootURL string) (int, error) {
+	response, err := client.doIdempotentRequest(strings.TrimSuffix(rootURL, "/")+"/keys", "GET")
+	if err != nil {
+		return 0, err
+	}
+	defer closeResponse(response)
+
+	if response.StatusCode != http.StatusOK {
+		return 0, client.agentError(response)
+	}
+
+	count := struct {
+		Keys int `json:"keys"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&count)
+	return count.Keys, err
+}
+
+func bindingURL(rootURL, name string) string {
+	return strings.TrimSuffix(rootURL, "/") + "/bindings/" + name
+}
+
 func (client *RemoteAgentClient) agentError(response *http.Response) error {
 	body, _ := ioutil.ReadAll(response.Body)
-	formattedBody := ""
-	if len(body) > 0 {
-		formattedBody = fmt.Sprintf(", %s", string(body))
+	return &AgentError{StatusCode: response.StatusCode, Body: string(body)}
+}
+
+func (client *RemoteAgentClient) doAuthenticatedRequest(rootURL, method string, body io.Reader) (*http.Response, error) {
+	timeout := client.timeout
+	if timeout <= 0 {
+		timeout = brokerconfig.DefaultAgentTimeout
 	}
-	return errors.New(fmt.Sprintf("Agent error: %d%s", response.StatusCode, formattedBody))
+	return client.doRequest(rootURL, method, body, timeout)
 }
 
-func (client *RemoteAgentClient) doAuthenticatedRequest(rootURL, method string) (*http.Response, error) {
-	request, err := http.NewRequest(method, rootURL, nil)
+// doLongRequest makes a request that moves data, which may take longer than
+// the other calls.
+func (client *RemoteAgentClient) doLongRequest(rootURL, method string, body io.Reader) (*http.Response, error) {
+	timeout := client.longTimeout
+	if timeout <= 0 {
+		timeout = brokerconfig.DefaultAgentLongTimeout
+	}
+	return client.doRequest(rootURL, method, body, timeout)
+}
+
+// doRequest makes a request that has to be answered, body included, within
+// the timeout.
+func (client *RemoteAgentClient) doRequest(rootURL, method string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	request, err := http.NewRequest(method, rootURL, body)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
 	request.SetBasicAuth(client.HttpAuth.Username, client.HttpAuth.Password)
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	httpClient := client.httpClient
+	if httpClient == nil {
+		httpClient = insecureHTTPClient
+	}
+
+	response, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, &AgentUnreachableError{Err: err}
+	}
+
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelOnClose releases the deadline of a request once its response has
+// been read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// doIdempotentRequest makes a request without a body that is safe to
+// repeat, retrying it while the agent refuses connections or is
+// unavailable. Calls that time out are not retried: the instance stays
+// locked while its operation waits for them.
+func (client *RemoteAgentClient) doIdempotentRequest(url, method string) (*http.Response, error) {
+	backoff := client.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := client.doAuthenticatedRequest(url, method, nil)
+		if attempt >= client.Retries || !retryable(response, err) {
+			return response, err
+		}
+
+		if response != nil {
+			closeResponse(response)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// closeResponse reads what is left of the body before closing it, so that
+// the connection can be reused.
+func closeResponse(response *http.Response) {
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+}
+
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		unreachable, ok := err.(*AgentUnreachableError)
+		if !ok {
+			return false
+		}
+		netErr, ok := unreachable.Err.(net.Error)
+		return !ok || !netErr.Timeout()
+	}
+
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
 	}
-	return httpClient.Do(request)
+	return false
 }
@@ -1,15 +1,28 @@
 package redis_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+	"github.com/pivotal-cf/cf-redis-broker/tlscert"
 )
 
 var _ = Describe("RemoteAgentClient", func() {
@@ -17,6 +30,7 @@ var _ = Describe("RemoteAgentClient", func() {
 	var agentCalled int
 	var remoteAgentClient redis.RemoteAgentClient
 	var status int
+	var requestBody []byte
 
 	const (
 		hostAndPort = "127.0.0.1:8080"
@@ -39,13 +53,41 @@ var _ = Describe("RemoteAgentClient", func() {
 			Expect(username).To(Equal(remoteAgentClient.HttpAuth.Username))
 			Expect(password).To(Equal(remoteAgentClient.HttpAuth.Password))
 
-			Ω([]string{"DELETE", "GET"}).Should(ContainElement(r.Method))
-			Ω(r.URL.Path).Should(Equal("/"))
+			if strings.HasPrefix(r.URL.Path, "/bindings/") {
+				Ω([]string{"PUT", "DELETE"}).Should(ContainElement(r.Method))
+				Ω(r.URL.Path).Should(Equal("/bindings/binding-id"))
+			} else if strings.HasPrefix(r.URL.Path, "/sentinel/") {
+				Ω(r.Method).Should(Equal("GET"))
+				Ω(r.URL.Path).Should(Equal("/sentinel/master-name"))
+			} else if r.Method == "PUT" {
+				Ω([]string{"/config", "/data", "/password", "/sentinel", "/cluster"}).Should(ContainElement(r.URL.Path))
+			} else {
+				Ω([]string{"DELETE", "GET"}).Should(ContainElement(r.Method))
+				Ω([]string{"/", "/keys", "/replication", "/cluster", "/cluster/ready"}).Should(ContainElement(r.URL.Path))
+			}
+
+			requestBody, _ = ioutil.ReadAll(r.Body)
 			agentCalled++
 			w.WriteHeader(status)
-			if r.Method == "GET" {
+			if r.URL.Path == "/keys" {
+				w.Write([]byte("{\"keys\": 2}"))
+			} else if strings.HasPrefix(r.URL.Path, "/cluster") {
+				if r.Method == "GET" && r.URL.Path == "/cluster" && status == http.StatusOK {
+					w.Write([]byte("{\"node_id\": \"node-id\"}"))
+				}
+			} else if strings.HasPrefix(r.URL.Path, "/sentinel") {
+				if status == http.StatusOK {
+					w.Write([]byte("{\"host\": \"10.0.0.2\", \"port\": 6379}"))
+				}
+			} else if r.Method == "GET" && r.URL.Path != "/replication" {
 				w.Write([]byte("{\"port\": 12345, \"password\": \"super-secret\"}"))
 			}
+			if r.URL.Path == "/password" && status == http.StatusOK {
+				w.Write([]byte("{\"port\": 12345, \"password\": \"new-secret\"}"))
+			}
+			if r.Method == "PUT" && status == http.StatusCreated {
+				w.Write([]byte("{\"port\": 12345, \"username\": \"binding-id\", \"password\": \"user-secret\"}"))
+			}
 		})
 
 		listener, err := net.Listen("tcp", hostAndPort)
@@ -117,4 +159,700 @@ var _ = Describe("RemoteAgentClient", func() {
 			})
 		})
 	})
+
+	Describe("#ApplyConfig", func() {
+		params := []redisconf.Param{
+			{Key: "maxmemory-policy", Value: "noeviction"},
+			{Key: "appendonly", Value: "yes"},
+		}
+
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a PUT request with the params to the config URL", func() {
+				err := remoteAgentClient.ApplyConfig(rootURL, params)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+
+				sentParams := []redisconf.Param{}
+				err = json.Unmarshal(requestBody, &sentParams)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(sentParams).Should(Equal(params))
+			})
+		})
+
+		Context("When unsuccessful", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.ApplyConfig(rootURL, params)
+				Ω(err).Should(MatchError("Agent error: 500"))
+			})
+		})
+	})
+
+	Describe("#ImportData", func() {
+		source := importer.Source{Host: "10.0.0.5", Port: 3456, Password: "secret"}
+
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a PUT request with the source to the data URL", func() {
+				err := remoteAgentClient.ImportData(rootURL, source)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+
+				sentSource := importer.Source{}
+				err = json.Unmarshal(requestBody, &sentSource)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(sentSource).Should(Equal(source))
+			})
+		})
+
+		Context("When unsuccessful", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.ImportData(rootURL, source)
+				Ω(err).Should(MatchError("Agent error: 500"))
+			})
+		})
+	})
+
+	Describe("#CreateUser", func() {
+		scope := acl.Scope{ReadOnly: true, KeyPrefix: "app:"}
+
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusCreated
+			})
+
+			It("makes a PUT request with the scope to the binding URL", func() {
+				_, err := remoteAgentClient.CreateUser(rootURL, "binding-id", scope)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+
+				sentScope := acl.Scope{}
+				err = json.Unmarshal(requestBody, &sentScope)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(sentScope).Should(Equal(scope))
+			})
+
+			It("returns the credentials of the user", func() {
+				credentials, err := remoteAgentClient.CreateUser(rootURL, "binding-id", scope)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(credentials).Should(Equal(redis.Credentials{
+					Port:     12345,
+					Username: "binding-id",
+					Password: "user-secret",
+				}))
+			})
+		})
+
+		Context("When the agent does not support users", func() {
+			BeforeEach(func() {
+				status = http.StatusNotImplemented
+			})
+
+			It("returns acl.ErrNotSupported", func() {
+				_, err := remoteAgentClient.CreateUser(rootURL, "binding-id", scope)
+				Ω(err).Should(Equal(acl.ErrNotSupported))
+			})
+		})
+
+		Context("When unsuccessful", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				_, err := remoteAgentClient.CreateUser(rootURL, "binding-id", scope)
+				Ω(err).Should(MatchError("Agent error: 500"))
+			})
+		})
+	})
+
+	Describe("#SetUser", func() {
+		scope := acl.Scope{KeyPrefix: "app:"}
+
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusCreated
+			})
+
+			It("makes a PUT request with the scope and the password to the binding URL", func() {
+				err := remoteAgentClient.SetUser(rootURL, "binding-id", "master-secret", scope)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+				Ω(requestBody).Should(MatchJSON(`{"read_only":false,"key_prefix":"app:","password":"master-secret"}`))
+			})
+		})
+
+		Context("When the agent does not support users", func() {
+			BeforeEach(func() {
+				status = http.StatusNotImplemented
+			})
+
+			It("returns acl.ErrNotSupported", func() {
+				err := remoteAgentClient.SetUser(rootURL, "binding-id", "master-secret", scope)
+				Ω(err).Should(Equal(acl.ErrNotSupported))
+			})
+		})
+	})
+
+	Describe("#DeleteUser", func() {
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a DELETE request to the binding URL", func() {
+				err := remoteAgentClient.DeleteUser(rootURL, "binding-id")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+			})
+		})
+
+		Context("When unsuccessful", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.DeleteUser(rootURL, "binding-id")
+				Ω(err).Should(MatchError("Agent error: 500"))
+			})
+		})
+	})
+
+	Describe("#Ping", func() {
+		Context("When the agent is up", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes an authenticated GET request to the root of the agent", func() {
+				err := remoteAgentClient.Ping(rootURL + "/")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+			})
+		})
+
+		Context("When the agent rejects the request", func() {
+			BeforeEach(func() {
+				status = http.StatusUnauthorized
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.Ping(rootURL)
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 401")))
+			})
+		})
+	})
+
+	Describe("#WaitForSync", func() {
+		Context("When the replica is in sync", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a GET request to the replication URL", func() {
+				err := remoteAgentClient.WaitForSync(rootURL)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+			})
+		})
+
+		Context("When the sync does not complete", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.WaitForSync(rootURL)
+				Ω(err).Should(MatchError("Agent error: 500"))
+			})
+		})
+	})
+
+	Describe("#MonitorSentinel", func() {
+		monitor := sentinel.Monitor{
+			MasterName: "master-name",
+			Host:       "10.0.0.1",
+			Port:       6379,
+			Quorum:     2,
+			Password:   "master-secret",
+
+			SentinelPassword: "sentinel-secret",
+		}
+
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a PUT request with the master to the sentinel URL", func() {
+				_, err := remoteAgentClient.MonitorSentinel(rootURL, monitor)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+				Ω(requestBody).Should(MatchJSON(`{"master_name":"master-name","host":"10.0.0.1","port":6379,"quorum":2,"password":"master-secret","sentinel_password":"sentinel-secret"}`))
+			})
+
+			It("returns the port of the sentinel", func() {
+				port, err := remoteAgentClient.MonitorSentinel(rootURL, monitor)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(port).Should(Equal(6379))
+			})
+		})
+
+		Context("When the agent has no sentinel", func() {
+			BeforeEach(func() {
+				status = http.StatusNotImplemented
+			})
+
+			It("returns the error", func() {
+				_, err := remoteAgentClient.MonitorSentinel(rootURL, monitor)
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 501")))
+			})
+		})
+	})
+
+	Describe("#SentinelMaster", func() {
+		Context("When the sentinel knows the master", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("returns its address", func() {
+				master, err := remoteAgentClient.SentinelMaster(rootURL, "master-name")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(master).Should(Equal(sentinel.Address{Host: "10.0.0.2", Port: 6379}))
+			})
+		})
+
+		Context("When the sentinel does not answer", func() {
+			BeforeEach(func() {
+				status = http.StatusServiceUnavailable
+			})
+
+			It("returns the error", func() {
+				_, err := remoteAgentClient.SentinelMaster(rootURL, "master-name")
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 503")))
+			})
+		})
+	})
+
+	Describe("#ClusterNodeID", func() {
+		Context("When redis runs in cluster mode", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("returns the ID of the node", func() {
+				nodeID, err := remoteAgentClient.ClusterNodeID(rootURL)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(nodeID).Should(Equal("node-id"))
+			})
+		})
+
+		Context("When redis does not run in cluster mode", func() {
+			BeforeEach(func() {
+				status = http.StatusConflict
+			})
+
+			It("returns the error", func() {
+				_, err := remoteAgentClient.ClusterNodeID(rootURL)
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 409")))
+			})
+		})
+	})
+
+	Describe("#JoinCluster", func() {
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a PUT request with the join to the cluster URL", func() {
+				err := remoteAgentClient.JoinCluster(rootURL, cluster.Join{
+					Peers: []cluster.Address{{Host: "10.0.0.2", Port: 6379}},
+					Slots: &cluster.Slots{First: 0, Last: 5460},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+				Ω(requestBody).Should(MatchJSON(`{"peers":[{"host":"10.0.0.2","port":6379}],"slots":{"first":0,"last":5460}}`))
+			})
+		})
+
+		Context("When the node cannot join", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.JoinCluster(rootURL, cluster.Join{MasterID: "master-id"})
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 500")))
+			})
+		})
+	})
+
+	Describe("#WaitForCluster", func() {
+		Context("When the cluster is ready", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a GET request to the cluster ready URL", func() {
+				Ω(remoteAgentClient.WaitForCluster(rootURL)).Should(Succeed())
+				Ω(agentCalled).Should(Equal(1))
+			})
+		})
+
+		Context("When the cluster does not become ready", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				err := remoteAgentClient.WaitForCluster(rootURL)
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 500")))
+			})
+		})
+	})
+
+	Describe("#KeyCount", func() {
+		Context("When redis answers", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("returns the number of keys reported by the agent", func() {
+				keys, err := remoteAgentClient.KeyCount(rootURL)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(keys).Should(Equal(2))
+			})
+		})
+
+		Context("When redis does not answer", func() {
+			BeforeEach(func() {
+				status = http.StatusServiceUnavailable
+			})
+
+			It("returns the error", func() {
+				_, err := remoteAgentClient.KeyCount(rootURL)
+				Ω(err).Should(MatchError(ContainSubstring("Agent error: 503")))
+			})
+		})
+	})
+
+	Describe("#RotatePassword", func() {
+		Context("When successful", func() {
+			BeforeEach(func() {
+				status = http.StatusOK
+			})
+
+			It("makes a PUT request with the grace period to the password URL", func() {
+				_, err := remoteAgentClient.RotatePassword(rootURL, time.Minute)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(agentCalled).Should(Equal(1))
+
+				rotation := acl.Rotation{}
+				err = json.Unmarshal(requestBody, &rotation)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(rotation.GracePeriodSeconds).Should(Equal(60))
+			})
+
+			It("returns the new credentials", func() {
+				credentials, err := remoteAgentClient.RotatePassword(rootURL, 0)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(credentials).Should(Equal(redis.Credentials{
+					Port:     12345,
+					Password: "new-secret",
+				}))
+			})
+		})
+
+		Context("When the agent cannot keep the old password", func() {
+			BeforeEach(func() {
+				status = http.StatusNotImplemented
+			})
+
+			It("returns acl.ErrGracePeriodNotSupported", func() {
+				_, err := remoteAgentClient.RotatePassword(rootURL, time.Minute)
+				Ω(err).Should(Equal(acl.ErrGracePeriodNotSupported))
+			})
+		})
+
+		Context("When unsuccessful", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns the error", func() {
+				_, err := remoteAgentClient.RotatePassword(rootURL, 0)
+				Ω(err).Should(MatchError("Agent error: 500"))
+			})
+		})
+	})
+})
+
+var _ = Describe("RemoteAgentClient over mutual TLS", func() {
+	var (
+		server  *httptest.Server
+		certDir string
+		auth    brokerconfig.AuthConfiguration
+	)
+
+	certPath := func(name string) string {
+		return filepath.Join(certDir, name)
+	}
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "agent-client-tls")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		ca, err := tlscert.NewCA("agent-ca")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ca.Save(certPath("ca.crt"), certPath("ca.key"))).Should(Succeed())
+		Ω(ca.Issue([]string{"127.0.0.1"}, certPath("agent.crt"), certPath("agent.key"))).Should(Succeed())
+		Ω(ca.IssueClient("broker", certPath("broker.crt"), certPath("broker.key"))).Should(Succeed())
+
+		auth = brokerconfig.AuthConfiguration{Username: "username", Password: "password"}
+
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.TLS, err = tlscert.ServerConfig(certPath("agent.crt"), certPath("agent.key"), certPath("ca.crt"))
+		Ω(err).ShouldNot(HaveOccurred())
+		server.StartTLS()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(certDir)
+	})
+
+	It("verifies the agent and presents its client certificate", func() {
+		tlsConfig, err := tlscert.ClientConfig(certPath("ca.crt"), certPath("broker.crt"), certPath("broker.key"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = redis.NewRemoteAgentClient(auth, tlsConfig, brokerconfig.AgentClient{}).Reset(server.URL)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("is rejected without a client certificate", func() {
+		tlsConfig, err := tlscert.ClientConfig(certPath("ca.crt"), "", "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = redis.NewRemoteAgentClient(auth, tlsConfig, brokerconfig.AgentClient{}).Reset(server.URL)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("refuses agents with a certificate from another CA", func() {
+		otherCA, err := tlscert.NewCA("other-ca")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(otherCA.Save(certPath("other-ca.crt"), certPath("other-ca.key"))).Should(Succeed())
+
+		tlsConfig, err := tlscert.ClientConfig(certPath("other-ca.crt"), certPath("broker.crt"), certPath("broker.key"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = redis.NewRemoteAgentClient(auth, tlsConfig, brokerconfig.AgentClient{}).Reset(server.URL)
+		Ω(err).Should(MatchError(ContainSubstring("certificate")))
+	})
+})
+
+var _ = Describe("RemoteAgentClient resilience", func() {
+	var (
+		server      *httptest.Server
+		client      *redis.RemoteAgentClient
+		settings    brokerconfig.AgentClient
+		handler     http.HandlerFunc
+		requests    int32
+		connections int32
+	)
+
+	BeforeEach(func() {
+		requests = 0
+		connections = 0
+		settings = brokerconfig.AgentClient{Retries: 2}
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"port": 6379, "password": "secret"}`))
+		}
+
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			handler(w, r)
+		}))
+		server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&connections, 1)
+			}
+		}
+		server.StartTLS()
+	})
+
+	JustBeforeEach(func() {
+		client = redis.NewRemoteAgentClient(brokerconfig.AuthConfiguration{}, nil, settings)
+		client.RetryBackoff = time.Millisecond
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reuses its connection to the agent", func() {
+		for i := 0; i < 3; i++ {
+			_, err := client.Credentials(server.URL)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(client.Reset(server.URL)).Should(Succeed())
+		}
+
+		Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(6))
+		Ω(atomic.LoadInt32(&connections)).Should(BeEquivalentTo(1))
+	})
+
+	Context("when the agent is unavailable for a while", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if atomic.LoadInt32(&requests) <= 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte(`{"port": 6379, "password": "secret"}`))
+			}
+		})
+
+		It("retries the calls that are safe to repeat", func() {
+			credentials, err := client.Credentials(server.URL)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials.Password).Should(Equal("secret"))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(3))
+		})
+
+		It("does not retry the other calls", func() {
+			err := client.ApplyConfig(server.URL, nil)
+			Ω(err).Should(BeAssignableToTypeOf(&redis.AgentError{}))
+			Ω(err.(*redis.AgentError).StatusCode).Should(Equal(http.StatusServiceUnavailable))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+		})
+
+		Context("for longer than the retries", func() {
+			BeforeEach(func() {
+				settings.Retries = 1
+			})
+
+			It("gives up", func() {
+				_, err := client.Credentials(server.URL)
+				Ω(err).Should(MatchError("Agent error: 503"))
+				Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(2))
+			})
+		})
+	})
+
+	Context("when the agent does not accept the credentials of the broker", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/healthz" {
+					return
+				}
+				if username, password, _ := r.BasicAuth(); username != "admin" || password != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(`{"port": 6379, "password": "secret"}`))
+			}
+		})
+
+		It("fails the ping, although the health check of the agent passes", func() {
+			err := client.Ping(server.URL)
+			Ω(err).Should(BeAssignableToTypeOf(&redis.AgentError{}))
+			Ω(err.(*redis.AgentError).StatusCode).Should(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("when the agent refuses the call", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "redis is not running", http.StatusInternalServerError)
+			}
+		})
+
+		It("returns an AgentError without retrying", func() {
+			_, err := client.Credentials(server.URL)
+			Ω(err).Should(MatchError("Agent error: 500, redis is not running\n"))
+			Ω(redis.AgentFailure(err)).Should(Equal(redis.AgentRefused))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+		})
+	})
+
+	Context("when the agent is down", func() {
+		JustBeforeEach(func() {
+			server.Close()
+		})
+
+		It("returns an AgentUnreachableError after retrying", func() {
+			_, err := client.Credentials(server.URL)
+			Ω(err).Should(BeAssignableToTypeOf(&redis.AgentUnreachableError{}))
+			Ω(redis.AgentFailure(err)).Should(Equal(redis.AgentUnreachable))
+		})
+	})
+
+	Context("when the agent hangs", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			settings.TimeoutSeconds = 1
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("times out without retrying", func() {
+			_, err := client.Credentials(server.URL)
+			Ω(err).Should(BeAssignableToTypeOf(&redis.AgentUnreachableError{}))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+		})
+
+		It("bounds the calls that move data by the long timeout", func() {
+			settings.LongTimeoutSeconds = 1
+			client = redis.NewRemoteAgentClient(brokerconfig.AuthConfiguration{}, nil, settings)
+
+			err := client.ImportData(server.URL, importer.Source{})
+			Ω(err).Should(BeAssignableToTypeOf(&redis.AgentUnreachableError{}))
+		})
+	})
+
+	Context("when the agent takes longer than the timeout to move data", func() {
+		BeforeEach(func() {
+			settings.TimeoutSeconds = 1
+			settings.LongTimeoutSeconds = 5
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(1500 * time.Millisecond)
+			}
+		})
+
+		It("waits for the calls that move data", func() {
+			Ω(client.WaitForSync(server.URL)).Should(Succeed())
+			Ω(client.ImportData(server.URL, importer.Source{})).Should(Succeed())
+		})
+
+		It("still times out the other calls", func() {
+			err := client.Ping(server.URL)
+			Ω(err).Should(BeAssignableToTypeOf(&redis.AgentUnreachableError{}))
+		})
+	})
 })
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"path/filepath"
@@ -17,6 +18,7 @@ type client struct {
 	password string
 	aliases  map[string]string
 
+	tlsConfig  *tls.Config
 	connection redisclient.Conn
 }
 
@@ -42,6 +44,14 @@ func Host(host string) Option {
 	}
 }
 
+// TLS makes the client connect with TLS. The port has to be the TLS port of
+// redis then.
+func TLS(config *tls.Config) Option {
+	return func(c *client) {
+		c.tlsConfig = config
+	}
+}
+
 func CmdAliases(aliases map[string]string) Option {
 	return func(c *client) {
 		c.aliases = map[string]string{}
@@ -77,7 +87,7 @@ func Connect(options ...Option) (Client, error) {
 	address := fmt.Sprintf("%v:%v", client.host, client.port)
 
 	var err error
-	client.connection, err = redisclient.Dial("tcp", address)
+	client.connection, err = client.dial(address)
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +102,24 @@ func Connect(options ...Option) (Client, error) {
 	return client, nil
 }
 
+func (client *client) dial(address string) (redisclient.Conn, error) {
+	if client.tlsConfig == nil {
+		return redisclient.Dial("tcp", address)
+	}
+
+	config := client.tlsConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = client.host
+	}
+
+	netConn, err := tls.Dial("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return redisclient.NewConn(netConn, 0, 0), nil
+}
+
 type Client interface {
 	Disconnect() error
 	WaitUntilRedisNotLoading(timeoutMilliseconds int) error
@@ -104,6 +132,23 @@ type Client interface {
 	Address() string
 	WaitForNewSaveSince(lastSaveTime int64, timeout time.Duration) error
 	RunBGSave() error
+	ReplicateFrom(host string, port int, password string) error
+	StopReplication() error
+	RedisVersion() (string, error)
+	Ping() error
+	DBSize() (int, error)
+	SetACLUser(name string, rules ...string) error
+	DeleteACLUser(name string) error
+	SetPassword(password string) error
+	BlockWrites() error
+	UnblockWrites() error
+	FlushAll() error
+	ClusterMyID() (string, error)
+	ClusterInfo() (map[string]string, error)
+	ClusterMeet(host string, port int) error
+	ClusterAddSlots(first, last int) error
+	ClusterReplicate(nodeID string) error
+	ClusterResetHard() error
 }
 
 func (client *client) Disconnect() error {
@@ -135,6 +180,136 @@ func (client *client) EnableAOF() error {
 	return client.setConfig("appendonly", "yes")
 }
 
+// writeBlockingReplicas is more replicas than any redis has, so that redis
+// refuses every write while it is required.
+const writeBlockingReplicas = "1000000"
+
+// BlockWrites has redis refuse writes until UnblockWrites. Reads and the
+// sync of replicas go on.
+func (client *client) BlockWrites() error {
+	return client.setConfig("min-slaves-to-write", writeBlockingReplicas)
+}
+
+func (client *client) UnblockWrites() error {
+	return client.setConfig("min-slaves-to-write", "0")
+}
+
+// ReplicateFrom makes redis a replica of the given master. Redis discards
+// its own data once the initial sync starts.
+func (client *client) ReplicateFrom(host string, port int, password string) error {
+	if err := client.setConfig("masterauth", password); err != nil {
+		return err
+	}
+
+	_, err := client.connection.Do(client.lookupAlias("SLAVEOF"), host, port)
+	return err
+}
+
+// StopReplication promotes a replica to a master and keeps its data.
+func (client *client) StopReplication() error {
+	if _, err := client.connection.Do(client.lookupAlias("SLAVEOF"), "NO", "ONE"); err != nil {
+		return err
+	}
+
+	return client.setConfig("masterauth", "")
+}
+
+func (client *client) RedisVersion() (string, error) {
+	return client.InfoField("redis_version")
+}
+
+func (client *client) Ping() error {
+	_, err := client.connection.Do(client.lookupAlias("PING"))
+	return err
+}
+
+func (client *client) DBSize() (int, error) {
+	return redisclient.Int(client.connection.Do(client.lookupAlias("DBSIZE")))
+}
+
+func (client *client) SetACLUser(name string, rules ...string) error {
+	args := []interface{}{"SETUSER", name}
+	for _, rule := range rules {
+		args = append(args, rule)
+	}
+
+	_, err := client.connection.Do(client.lookupAlias("ACL"), args...)
+	return err
+}
+
+// DeleteACLUser disables the user before disconnecting its clients, so that
+// they cannot authenticate again before the user is deleted.
+func (client *client) DeleteACLUser(name string) error {
+	aclCommand := client.lookupAlias("ACL")
+
+	if _, err := client.connection.Do(aclCommand, "SETUSER", name, "off"); err != nil {
+		return err
+	}
+
+	if _, err := client.connection.Do(client.lookupAlias("CLIENT"), "KILL", "USER", name); err != nil {
+		return err
+	}
+
+	_, err := client.connection.Do(aclCommand, "DELUSER", name)
+	return err
+}
+
+// SetPassword changes the requirepass of the running redis. Connections that
+// have already authenticated are not affected.
+func (client *client) SetPassword(password string) error {
+	return client.setConfig("requirepass", password)
+}
+
+func (client *client) FlushAll() error {
+	_, err := client.connection.Do(client.lookupAlias("FLUSHALL"))
+	return err
+}
+
+func (client *client) ClusterMyID() (string, error) {
+	return redisclient.String(client.connection.Do(client.lookupAlias("CLUSTER"), "MYID"))
+}
+
+func (client *client) ClusterInfo() (map[string]string, error) {
+	response, err := redisclient.String(client.connection.Do(client.lookupAlias("CLUSTER"), "INFO"))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseInfo(response), nil
+}
+
+// ClusterMeet has redis join the cluster of the node at host and port.
+func (client *client) ClusterMeet(host string, port int) error {
+	_, err := client.connection.Do(client.lookupAlias("CLUSTER"), "MEET", host, port)
+	return err
+}
+
+// ClusterAddSlots assigns the hash slots from first to last, both included,
+// to redis.
+func (client *client) ClusterAddSlots(first, last int) error {
+	args := []interface{}{"ADDSLOTS"}
+	for slot := first; slot <= last; slot++ {
+		args = append(args, slot)
+	}
+
+	_, err := client.connection.Do(client.lookupAlias("CLUSTER"), args...)
+	return err
+}
+
+// ClusterReplicate makes redis a replica of the cluster node with the given
+// ID. Redis has to know the node already.
+func (client *client) ClusterReplicate(nodeID string) error {
+	_, err := client.connection.Do(client.lookupAlias("CLUSTER"), "REPLICATE", nodeID)
+	return err
+}
+
+// ClusterResetHard has redis forget the other nodes of its cluster, its
+// slots and its node ID. Masters have to be empty.
+func (client *client) ClusterResetHard() error {
+	_, err := client.connection.Do(client.lookupAlias("CLUSTER"), "RESET", "HARD")
+	return err
+}
+
 func (client *client) RunBGSave() error {
 	_, err := client.connection.Do(client.lookupAlias("BGSAVE"))
 	return err
@@ -226,22 +401,30 @@ func (client *client) setConfig(key string, value string) error {
 func (client *client) Info() (map[string]string, error) {
 	infoCommand := client.lookupAlias("INFO")
 
-	info := map[string]string{}
-
 	response, err := redisclient.String(client.connection.Do(infoCommand))
 	if err != nil {
 		return nil, err
 	}
 
+	return parseInfo(response), nil
+}
+
+func parseInfo(response string) map[string]string {
+	info := map[string]string{}
+
 	for _, entry := range strings.Split(response, "\n") {
 		trimmedEntry := strings.TrimSpace(entry)
 		if trimmedEntry == "" || trimmedEntry[0] == '#' {
 			continue
 		}
 
-		pair := strings.Split(trimmedEntry, ":")
+		// Values such as the address of a master may hold colons too.
+		pair := strings.SplitN(trimmedEntry, ":", 2)
+		if len(pair) < 2 {
+			continue
+		}
 		info[pair[0]] = pair[1]
 	}
 
-	return info, nil
+	return info
 }
@@ -272,6 +272,18 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		Describe(".Ping", func() {
+			It("does not return an error", func() {
+				client, err := client.Connect(
+					client.Host(host),
+					client.Port(port),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(client.Ping()).Should(Succeed())
+			})
+		})
+
 		Describe("querying info fields", func() {
 			Context("when the field exits", func() {
 				It("returns the value", func() {
@@ -16,6 +16,45 @@ type Client struct {
 	WaitForNewSaveSinceCallCount   int
 	ExpectedWaitForNewSaveSinceErr error
 
+	EnableAOFCallCount int
+	InfoFields         map[string]string
+	ExpectedInfoErr    error
+	ConfigValues       map[string]string
+
+	ReplicatedFrom             []string
+	ExpectedReplicateFromErr   error
+	StopReplicationCallCount   int
+	ExpectedStopReplicationErr error
+	DisconnectCallCount        int
+
+	Version                  string
+	ExpectedPingErr          error
+	Keys                     int
+	ExpectedDBSizeErr        error
+	ACLUsers                 map[string][]string
+	ExpectedSetACLUserErr    error
+	DeletedACLUsers          []string
+	ExpectedDeleteACLUserErr error
+
+	Passwords              []string
+	ExpectedSetPasswordErr error
+
+	WritesBlocked          bool
+	ExpectedBlockWritesErr error
+
+	FlushAllCallCount   int
+	ExpectedFlushAllErr error
+
+	ClusterID               string
+	ClusterInfoFields       map[string]string
+	ExpectedClusterInfoErr  error
+	ClusterMeets            []string
+	ClusterSlots            []string
+	ClusterReplicated       []string
+	ExpectedReplicateErr    error
+	ClusterResetCallCount   int
+	ExpectedClusterResetErr error
+
 	Host string
 	Port int
 }
@@ -28,6 +67,7 @@ func (c *Client) Address() string {
 }
 
 func (c *Client) Disconnect() error {
+	c.DisconnectCallCount++
 	return nil
 }
 
@@ -36,6 +76,7 @@ func (c *Client) WaitUntilRedisNotLoading(timeoutMilliseconds int) error {
 }
 
 func (c *Client) EnableAOF() error {
+	c.EnableAOFCallCount++
 	return nil
 }
 
@@ -44,15 +85,23 @@ func (c *Client) LastRDBSaveTime() (int64, error) {
 }
 
 func (c *Client) InfoField(fieldName string) (string, error) {
-	return "", nil
+	return c.InfoFields[fieldName], nil
 }
 
 func (c *Client) Info() (map[string]string, error) {
-	return map[string]string{}, nil
+	if c.ExpectedInfoErr != nil {
+		return nil, c.ExpectedInfoErr
+	}
+
+	info := map[string]string{}
+	for field, value := range c.InfoFields {
+		info[field] = value
+	}
+	return info, nil
 }
 
 func (c *Client) GetConfig(key string) (string, error) {
-	return "", nil
+	return c.ConfigValues[key], nil
 }
 
 func (c *Client) RDBPath() (string, error) {
@@ -69,3 +118,106 @@ func (c *Client) WaitForNewSaveSince(lastSaveTime int64, timeout time.Duration)
 	c.WaitForNewSaveSinceCallCount++
 	return c.ExpectedWaitForNewSaveSinceErr
 }
+
+func (c *Client) BlockWrites() error {
+	if c.ExpectedBlockWritesErr != nil {
+		return c.ExpectedBlockWritesErr
+	}
+	c.WritesBlocked = true
+	return nil
+}
+
+func (c *Client) UnblockWrites() error {
+	c.WritesBlocked = false
+	return nil
+}
+
+func (c *Client) ReplicateFrom(host string, port int, password string) error {
+	c.ReplicatedFrom = append(c.ReplicatedFrom, fmt.Sprintf("%s:%d:%s", host, port, password))
+	return c.ExpectedReplicateFromErr
+}
+
+func (c *Client) StopReplication() error {
+	c.StopReplicationCallCount++
+	return c.ExpectedStopReplicationErr
+}
+
+func (c *Client) RedisVersion() (string, error) {
+	return c.Version, nil
+}
+
+func (c *Client) Ping() error {
+	return c.ExpectedPingErr
+}
+
+func (c *Client) DBSize() (int, error) {
+	return c.Keys, c.ExpectedDBSizeErr
+}
+
+func (c *Client) SetACLUser(name string, rules ...string) error {
+	if c.ExpectedSetACLUserErr != nil {
+		return c.ExpectedSetACLUserErr
+	}
+
+	if c.ACLUsers == nil {
+		c.ACLUsers = map[string][]string{}
+	}
+	c.ACLUsers[name] = rules
+	return nil
+}
+
+func (c *Client) DeleteACLUser(name string) error {
+	if c.ExpectedDeleteACLUserErr != nil {
+		return c.ExpectedDeleteACLUserErr
+	}
+
+	c.DeletedACLUsers = append(c.DeletedACLUsers, name)
+	delete(c.ACLUsers, name)
+	return nil
+}
+
+func (c *Client) SetPassword(password string) error {
+	if c.ExpectedSetPasswordErr != nil {
+		return c.ExpectedSetPasswordErr
+	}
+
+	c.Passwords = append(c.Passwords, password)
+	return nil
+}
+
+func (c *Client) FlushAll() error {
+	c.FlushAllCallCount++
+	return c.ExpectedFlushAllErr
+}
+
+func (c *Client) ClusterMyID() (string, error) {
+	return c.ClusterID, nil
+}
+
+func (c *Client) ClusterInfo() (map[string]string, error) {
+	return c.ClusterInfoFields, c.ExpectedClusterInfoErr
+}
+
+func (c *Client) ClusterMeet(host string, port int) error {
+	c.ClusterMeets = append(c.ClusterMeets, fmt.Sprintf("%s:%d", host, port))
+	return nil
+}
+
+func (c *Client) ClusterAddSlots(first, last int) error {
+	c.ClusterSlots = append(c.ClusterSlots, fmt.Sprintf("%d-%d", first, last))
+	return nil
+}
+
+func (c *Client) ClusterReplicate(nodeID string) error {
+	if c.ExpectedReplicateErr != nil {
+		return c.ExpectedReplicateErr
+	}
+
+	c.ClusterReplicated = append(c.ClusterReplicated, nodeID)
+	return nil
+}
+
+func (c *Client) ClusterResetHard() error {
+	c.ClusterResetCallCount++
+	return c.ExpectedClusterResetErr
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// Persist makes sure that the data survives redis being stopped. When AOF is
+// about to be switched on, redis is asked to write the AOF file first,
+// because redis ignores the RDB file once AOF is enabled.
+func Persist(redisClient Client, enableAOF bool, timeout time.Duration) error {
+	if enableAOF {
+		appendOnly, err := redisClient.GetConfig("appendonly")
+		if err != nil {
+			return err
+		}
+
+		if appendOnly == "yes" {
+			return nil
+		}
+
+		err = redisClient.EnableAOF()
+		if err != nil {
+			return err
+		}
+
+		return waitForAOFRewrite(redisClient, timeout)
+	}
+
+	lastSaveTime, err := redisClient.LastRDBSaveTime()
+	if err != nil {
+		return err
+	}
+
+	err = redisClient.RunBGSave()
+	if err != nil {
+		return err
+	}
+
+	return redisClient.WaitForNewSaveSince(lastSaveTime, timeout)
+}
+
+func waitForAOFRewrite(redisClient Client, timeout time.Duration) error {
+	timer := time.After(timeout)
+	for {
+		done, err := aofRewriteDone(redisClient)
+		if err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case <-timer:
+			return errors.New("Timed out waiting for the AOF rewrite to complete")
+		}
+	}
+}
+
+func aofRewriteDone(redisClient Client) (bool, error) {
+	for field, expected := range map[string]string{
+		"aof_enabled":             "1",
+		"aof_rewrite_in_progress": "0",
+		"aof_rewrite_scheduled":   "0",
+	} {
+		value, err := redisClient.InfoField(field)
+		if err != nil {
+			return false, err
+		}
+
+		if value != expected {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// startCluster forms a Redis Cluster out of the nodes of a new instance. The
+// first Shards nodes serve a share of the slots each; the others replicate
+// them in turn. The first node meets every other one, and the gossip of the
+// cluster does the rest.
+func (repo *RemoteRepository) startCluster(instance *Instance, overrides []redisconf.Param) error {
+	if err := repo.configureCluster(instance, overrides); err != nil {
+		return err
+	}
+
+	nodes := instance.Group()
+	nodeIDs := []string{}
+	for _, node := range nodes {
+		url := repo.agentURL(node)
+
+		credentials, err := repo.agentClient.Credentials(url)
+		if err != nil {
+			return err
+		}
+		node.Port = credentials.Port
+
+		nodeID, err := repo.agentClient.ClusterNodeID(url)
+		if err != nil {
+			return err
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+
+	for i, node := range nodes {
+		join := cluster.Join{}
+		if i == 0 {
+			join.Peers = clusterPeers(nodes[1:])
+		}
+
+		if i < instance.Shards {
+			slots := cluster.SlotRange(i, instance.Shards)
+			join.Slots = &slots
+		} else {
+			join.MasterID = nodeIDs[(i-instance.Shards)%instance.Shards]
+		}
+
+		if err := repo.agentClient.JoinCluster(repo.agentURL(node), join); err != nil {
+			return err
+		}
+	}
+
+	return repo.agentClient.WaitForCluster(repo.agentURL(instance))
+}
+
+// configureCluster applies the overrides of the instance to every node of a
+// cluster. The nodes take the password of the first node, so that clients
+// can follow redirects with the credentials of the instance.
+func (repo *RemoteRepository) configureCluster(instance *Instance, overrides []redisconf.Param) error {
+	credentials, err := repo.agentClient.Credentials(repo.agentURL(instance))
+	if err != nil {
+		return err
+	}
+
+	for _, node := range instance.Group() {
+		err := repo.agentClient.ApplyConfig(repo.agentURL(node), clusterOverrides(credentials, overrides))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clusterOverrides(credentials Credentials, overrides []redisconf.Param) []redisconf.Param {
+	return append(append([]redisconf.Param{}, overrides...),
+		redisconf.Param{Key: "cluster-enabled", Value: "yes"},
+		redisconf.Param{Key: "masterauth", Value: credentials.Password},
+		redisconf.Param{Key: "requirepass", Value: credentials.Password},
+	)
+}
+
+func clusterPeers(nodes []*Instance) []cluster.Address {
+	peers := []cluster.Address{}
+	for _, node := range nodes {
+		peers = append(peers, cluster.Address{Host: node.Host, Port: node.Port})
+	}
+	return peers
+}
+
+// clusterCredentials are the addresses of the nodes of a cluster instance,
+// which cluster clients use as seeds.
+func clusterCredentials(instance *Instance) []broker.NodeAddress {
+	if instance.Shards == 0 {
+		return nil
+	}
+
+	nodes := []broker.NodeAddress{}
+	for _, node := range instance.Group() {
+		nodes = append(nodes, broker.NodeAddress{
+			Host: node.Host,
+			Port: node.Port,
+		})
+	}
+	return nodes
+}
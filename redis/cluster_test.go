@@ -0,0 +1,190 @@
+package redis_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cluster instances", func() {
+	var (
+		repo        *redis.RemoteRepository
+		agentClient *fakes.FakeAgentClient
+		tmpDir      string
+		config      brokerconfig.Config
+		plan        brokerconfig.Plan
+		agents      []string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+		Expect(err).ToNot(HaveOccurred())
+
+		plan = brokerconfig.Plan{
+			ID:        "cluster-plan",
+			Backend:   brokerconfig.BackendDedicated,
+			MaxMemory: "1gb",
+			Topology:  brokerconfig.TopologyCluster,
+			Shards:    3,
+			Replicas:  1,
+		}
+
+		config = brokerconfig.Config{AgentPort: "1234"}
+		config.RedisConfiguration.Plans = []brokerconfig.Plan{plan}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{}
+		agents = nil
+		for _, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7"} {
+			config.RedisConfiguration.Dedicated.Nodes = append(config.RedisConfiguration.Dedicated.Nodes, brokerconfig.DedicatedNode{Host: host})
+			agents = append(agents, "https://"+host+":1234")
+		}
+		config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+
+		password := "master-secret"
+		agentClient = &fakes.FakeAgentClient{
+			CredentialsFunc: func(rootURL string) (redis.Credentials, error) {
+				return redis.Credentials{Port: 6379, Password: password}, nil
+			},
+			CreateUserFunc: func(rootURL, name string) (redis.Credentials, error) {
+				return redis.Credentials{Port: 6379, Username: name, Password: "user-secret"}, nil
+			},
+			RotatePasswordFunc: func(rootURL string, gracePeriod time.Duration) (redis.Credentials, error) {
+				password = "new-secret"
+				return redis.Credentials{Port: 6379, Password: password}, nil
+			},
+		}
+
+		repo, err = redis.NewRemoteRepository(agentClient, config)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Create", func() {
+		It("allocates a node for every master and replica", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			instance, err := repo.FindByID("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Shards).To(Equal(3))
+			Expect(instance.Group()).To(HaveLen(6))
+			Expect(repo.AvailableInstances()).To(HaveLen(1))
+		})
+
+		It("enables cluster mode with the password of the first node on every node", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			for _, agent := range agents[:6] {
+				Expect(agentClient.AppliedConfigs[agent]).To(Equal([]redisconf.Param{
+					{Key: "maxmemory", Value: "1gb"},
+					{Key: "cluster-enabled", Value: "yes"},
+					{Key: "masterauth", Value: "master-secret"},
+					{Key: "requirepass", Value: "master-secret"},
+				}))
+			}
+		})
+
+		It("has the first node meet the others and splits the slots between the masters", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			joins := agentClient.ClusterJoins
+			Expect(joins[agents[0]].Peers).To(HaveLen(5))
+			Expect(joins[agents[0]].Peers[0]).To(Equal(cluster.Address{Host: "10.0.0.2", Port: 6379}))
+			Expect(joins[agents[1]].Peers).To(BeEmpty())
+
+			Expect(joins[agents[0]].Slots).To(Equal(&cluster.Slots{First: 0, Last: 5460}))
+			Expect(joins[agents[1]].Slots).To(Equal(&cluster.Slots{First: 5461, Last: 10921}))
+			Expect(joins[agents[2]].Slots).To(Equal(&cluster.Slots{First: 10922, Last: 16383}))
+		})
+
+		It("has the replicas follow the masters once the masters serve their slots", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			joins := agentClient.ClusterJoins
+			Expect(joins[agents[3]]).To(Equal(cluster.Join{MasterID: "id-" + agents[0]}))
+			Expect(joins[agents[4]]).To(Equal(cluster.Join{MasterID: "id-" + agents[1]}))
+			Expect(joins[agents[5]]).To(Equal(cluster.Join{MasterID: "id-" + agents[2]}))
+			Expect(agentClient.ClusterOrder).To(Equal(agents[:6]))
+		})
+
+		It("waits for the cluster", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+			Expect(agentClient.ClusterURLs).To(Equal([]string{agents[0]}))
+		})
+
+		Context("when a node cannot join the cluster", func() {
+			BeforeEach(func() {
+				agentClient.JoinClusterErr = errors.New("cluster mode is not enabled in the config of redis")
+			})
+
+			It("resets every node and returns them to the pool", func() {
+				err := repo.Create("foo", plan, nil)
+				Expect(err).To(MatchError("cluster mode is not enabled in the config of redis"))
+
+				Expect(agentClient.ResetURLs).To(Equal(agents[:6]))
+				Expect(repo.AvailableInstances()).To(HaveLen(7))
+				Expect(repo.InstanceExists("foo")).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the instance exists", func() {
+		BeforeEach(func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+			agentClient.AppliedConfigs = nil
+		})
+
+		It("binds with the nodes of the cluster as seeds", func() {
+			credentials, err := repo.Bind("foo", "binding-id", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(credentials.Host).To(Equal("10.0.0.1"))
+			Expect(credentials.Replicas).To(BeEmpty())
+			Expect(credentials.ClusterNodes).To(HaveLen(6))
+			Expect(credentials.ClusterNodes[5]).To(Equal(broker.NodeAddress{Host: "10.0.0.6", Port: 6379}))
+			Expect(agentClient.SetUserURLs).To(Equal(agents[1:6]))
+		})
+
+		It("keeps cluster mode when the config is updated", func() {
+			plan.MaxMemory = "2gb"
+			Expect(repo.Update("foo", plan, nil)).To(Succeed())
+
+			for _, agent := range agents[:6] {
+				Expect(agentClient.AppliedConfigs[agent]).To(ContainElement(redisconf.Param{Key: "maxmemory", Value: "2gb"}))
+				Expect(agentClient.AppliedConfigs[agent]).To(ContainElement(redisconf.Param{Key: "cluster-enabled", Value: "yes"}))
+			}
+		})
+
+		It("gives every node the new password", func() {
+			_, err := repo.RotatePassword("foo", 0)
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, agent := range agents[:6] {
+				Expect(agentClient.AppliedConfigs[agent]).To(ContainElement(redisconf.Param{Key: "requirepass", Value: "new-secret"}))
+				Expect(agentClient.AppliedConfigs[agent]).To(ContainElement(redisconf.Param{Key: "masterauth", Value: "new-secret"}))
+			}
+		})
+
+		It("resets every node when it is destroyed", func() {
+			Expect(repo.Destroy("foo")).To(Succeed())
+
+			Expect(agentClient.ResetURLs).To(Equal(agents[:6]))
+			Expect(repo.AvailableInstances()).To(HaveLen(7))
+		})
+	})
+})
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"sort"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// confOverrides returns the redis.conf directives for an instance of the
+// plan. Parameters given at provision time take precedence over the plan.
+func confOverrides(plan brokerconfig.Plan, parameters map[string]string) []redisconf.Param {
+	settings := map[string]string{}
+	for key, value := range plan.RedisConf {
+		settings[key] = value
+	}
+
+	if plan.MaxMemory != "" {
+		settings["maxmemory"] = plan.MaxMemory
+	}
+
+	persistence := plan.Persistence
+	for key, value := range parameters {
+		if key == brokerconfig.PersistenceParameter {
+			persistence = value
+			continue
+		}
+		if key == brokerconfig.PlacementParameter {
+			continue
+		}
+		settings[key] = value
+	}
+
+	keys := []string{}
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	overrides := []redisconf.Param{}
+	for _, key := range keys {
+		value := settings[key]
+		if value == "" {
+			value = `""`
+		}
+		overrides = append(overrides, redisconf.Param{Key: key, Value: value})
+	}
+
+	switch persistence {
+	case brokerconfig.PersistenceRDB:
+		overrides = append(overrides, redisconf.Param{Key: "appendonly", Value: "no"})
+	case brokerconfig.PersistenceAOF:
+		overrides = append(overrides, redisconf.Param{Key: "appendonly", Value: "yes"})
+	case brokerconfig.PersistenceNone:
+		overrides = append(overrides,
+			redisconf.Param{Key: "appendonly", Value: "no"},
+			redisconf.Param{Key: "save", Value: `""`},
+		)
+	}
+
+	return overrides
+}
+
+// appendOnlyEnabled reports whether the overrides switch AOF persistence on.
+func appendOnlyEnabled(overrides []redisconf.Param) bool {
+	enabled := false
+	for _, param := range overrides {
+		if param.Key == "appendonly" {
+			enabled = param.Value == "yes"
+		}
+	}
+	return enabled
+}
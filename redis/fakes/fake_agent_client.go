@@ -1,16 +1,65 @@
 package fakes
 
-import "github.com/pivotal-cf/cf-redis-broker/redis"
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+)
 
 type FakeAgentClient struct {
 	ResetURLs       []string
 	CredentialsFunc func(string) (redis.Credentials, error)
 
 	ResetHandler func(string) error
+
+	AppliedConfigs   map[string][]redisconf.Param
+	ApplyConfigError error
+
+	ImportedSources map[string]importer.Source
+	ImportDataError error
+
+	CreatedUsers   map[string]acl.Scope
+	CreateUserFunc func(rootURL, name string) (redis.Credentials, error)
+	DeletedUsers   []string
+	DeleteUserErr  error
+
+	SetUserURLs      []string
+	SetUserPasswords map[string]string
+	DeletedUserURLs  []string
+
+	SyncedURLs     []string
+	WaitForSyncErr error
+
+	Monitors           map[string]sentinel.Monitor
+	MonitorSentinelErr error
+	SentinelMasterFunc func(rootURL, masterName string) (sentinel.Address, error)
+
+	ClusterJoins   map[string]cluster.Join
+	JoinClusterErr error
+	ClusterURLs    []string
+	ClusterOrder   []string
+
+	RotatedPasswordURLs []string
+	RotatePasswordFunc  func(rootURL string, gracePeriod time.Duration) (redis.Credentials, error)
+
+	KeyCountFunc func(rootURL string) (int, error)
+
+	// mutex guards what the fake records, so that it can be called
+	// concurrently. The funcs are called without holding it.
+	mutex sync.Mutex
 }
 
 func (fakeAgentClient *FakeAgentClient) Reset(rootURL string) error {
 	if fakeAgentClient.ResetHandler == nil {
+		fakeAgentClient.mutex.Lock()
+		defer fakeAgentClient.mutex.Unlock()
+
 		fakeAgentClient.ResetURLs = append(fakeAgentClient.ResetURLs, rootURL)
 		return nil
 	} else {
@@ -19,5 +68,149 @@ func (fakeAgentClient *FakeAgentClient) Reset(rootURL string) error {
 }
 
 func (fakeAgentClient *FakeAgentClient) Credentials(rootURL string) (redis.Credentials, error) {
+	if fakeAgentClient.CredentialsFunc == nil {
+		return redis.Credentials{}, nil
+	}
 	return fakeAgentClient.CredentialsFunc(rootURL)
 }
+
+func (fakeAgentClient *FakeAgentClient) ApplyConfig(rootURL string, params []redisconf.Param) error {
+	if fakeAgentClient.ApplyConfigError != nil {
+		return fakeAgentClient.ApplyConfigError
+	}
+
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	if fakeAgentClient.AppliedConfigs == nil {
+		fakeAgentClient.AppliedConfigs = map[string][]redisconf.Param{}
+	}
+	fakeAgentClient.AppliedConfigs[rootURL] = params
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) ImportData(rootURL string, source importer.Source) error {
+	if fakeAgentClient.ImportDataError != nil {
+		return fakeAgentClient.ImportDataError
+	}
+
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	if fakeAgentClient.ImportedSources == nil {
+		fakeAgentClient.ImportedSources = map[string]importer.Source{}
+	}
+	fakeAgentClient.ImportedSources[rootURL] = source
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) CreateUser(rootURL, name string, scope acl.Scope) (redis.Credentials, error) {
+	fakeAgentClient.mutex.Lock()
+	if fakeAgentClient.CreatedUsers == nil {
+		fakeAgentClient.CreatedUsers = map[string]acl.Scope{}
+	}
+	fakeAgentClient.CreatedUsers[name] = scope
+	fakeAgentClient.mutex.Unlock()
+
+	return fakeAgentClient.CreateUserFunc(rootURL, name)
+}
+
+func (fakeAgentClient *FakeAgentClient) DeleteUser(rootURL, name string) error {
+	if fakeAgentClient.DeleteUserErr != nil {
+		return fakeAgentClient.DeleteUserErr
+	}
+
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	fakeAgentClient.DeletedUsers = append(fakeAgentClient.DeletedUsers, name)
+	fakeAgentClient.DeletedUserURLs = append(fakeAgentClient.DeletedUserURLs, rootURL)
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) SetUser(rootURL, name, password string, scope acl.Scope) error {
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	if fakeAgentClient.SetUserPasswords == nil {
+		fakeAgentClient.SetUserPasswords = map[string]string{}
+	}
+	fakeAgentClient.SetUserURLs = append(fakeAgentClient.SetUserURLs, rootURL)
+	fakeAgentClient.SetUserPasswords[name] = password
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) WaitForSync(rootURL string) error {
+	if fakeAgentClient.WaitForSyncErr != nil {
+		return fakeAgentClient.WaitForSyncErr
+	}
+
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	fakeAgentClient.SyncedURLs = append(fakeAgentClient.SyncedURLs, rootURL)
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) RotatePassword(rootURL string, gracePeriod time.Duration) (redis.Credentials, error) {
+	fakeAgentClient.mutex.Lock()
+	fakeAgentClient.RotatedPasswordURLs = append(fakeAgentClient.RotatedPasswordURLs, rootURL)
+	fakeAgentClient.mutex.Unlock()
+
+	return fakeAgentClient.RotatePasswordFunc(rootURL, gracePeriod)
+}
+
+func (fakeAgentClient *FakeAgentClient) MonitorSentinel(rootURL string, monitor sentinel.Monitor) (int, error) {
+	if fakeAgentClient.MonitorSentinelErr != nil {
+		return 0, fakeAgentClient.MonitorSentinelErr
+	}
+
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	if fakeAgentClient.Monitors == nil {
+		fakeAgentClient.Monitors = map[string]sentinel.Monitor{}
+	}
+	fakeAgentClient.Monitors[rootURL] = monitor
+	return 26379, nil
+}
+
+func (fakeAgentClient *FakeAgentClient) SentinelMaster(rootURL, masterName string) (sentinel.Address, error) {
+	return fakeAgentClient.SentinelMasterFunc(rootURL, masterName)
+}
+
+// ClusterNodeID names the node after its agent.
+func (fakeAgentClient *FakeAgentClient) ClusterNodeID(rootURL string) (string, error) {
+	return "id-" + rootURL, nil
+}
+
+func (fakeAgentClient *FakeAgentClient) JoinCluster(rootURL string, join cluster.Join) error {
+	if fakeAgentClient.JoinClusterErr != nil {
+		return fakeAgentClient.JoinClusterErr
+	}
+
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	if fakeAgentClient.ClusterJoins == nil {
+		fakeAgentClient.ClusterJoins = map[string]cluster.Join{}
+	}
+	fakeAgentClient.ClusterJoins[rootURL] = join
+	fakeAgentClient.ClusterOrder = append(fakeAgentClient.ClusterOrder, rootURL)
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) WaitForCluster(rootURL string) error {
+	fakeAgentClient.mutex.Lock()
+	defer fakeAgentClient.mutex.Unlock()
+
+	fakeAgentClient.ClusterURLs = append(fakeAgentClient.ClusterURLs, rootURL)
+	return nil
+}
+
+func (fakeAgentClient *FakeAgentClient) KeyCount(rootURL string) (int, error) {
+	if fakeAgentClient.KeyCountFunc == nil {
+		return 0, nil
+	}
+	return fakeAgentClient.KeyCountFunc(rootURL)
+}
@@ -10,26 +10,39 @@ import (
 )
 
 type FakeLocalRepository struct {
-	FindFreePort       func() (int, error)
-	DeletedInstanceIds []string
-	CreatedInstances   []*redis.Instance
-	LockedInstances    []*redis.Instance
-	UnlockedInstances  []*redis.Instance
-	Instances          []*redis.Instance
-	InstanceCountErr   error
+	FindFreePort          func() (int, error)
+	DeletedInstanceIds    []string
+	CreatedInstances      []*redis.Instance
+	LockedInstances       []*redis.Instance
+	UnlockedInstances     []*redis.Instance
+	Instances             []*redis.Instance
+	InstanceCountErr      error
+	ReconfiguredInstances []redis.Instance
+	ConfigPath            string
+	UsersPath             string
+	SetupErr              error
 }
 
 func (repo *FakeLocalRepository) InstanceDataDir(instanceID string) string     { return "" }
-func (repo *FakeLocalRepository) InstanceConfigPath(instanceID string) string  { return "" }
+func (repo *FakeLocalRepository) InstanceConfigPath(instanceID string) string  { return repo.ConfigPath }
+func (repo *FakeLocalRepository) InstanceUsersPath(instanceID string) string   { return repo.UsersPath }
 func (repo *FakeLocalRepository) InstanceLogFilePath(instanceID string) string { return "" }
 func (repo *FakeLocalRepository) InstancePidFilePath(instanceID string) string { return "" }
 
 func (repo *FakeLocalRepository) Setup(instance *redis.Instance) error {
+	if repo.SetupErr != nil {
+		return repo.SetupErr
+	}
 	repo.CreatedInstances = append(repo.CreatedInstances, instance)
 	repo.Instances = append(repo.Instances, instance)
 	return nil
 }
 
+func (repo *FakeLocalRepository) Reconfigure(instance *redis.Instance) error {
+	repo.ReconfiguredInstances = append(repo.ReconfiguredInstances, *instance)
+	return nil
+}
+
 func (repo *FakeLocalRepository) Lock(instance *redis.Instance) error {
 	repo.LockedInstances = append(repo.LockedInstances, instance)
 	return nil
@@ -82,6 +95,21 @@ func (repo *FakeLocalRepository) InstanceCount() (int, error) {
 	return len(repo.Instances), nil
 }
 
+func (repo *FakeLocalRepository) PlanInstanceCount(planID string) (int, error) {
+	if repo.InstanceCountErr != nil {
+		return -1, repo.InstanceCountErr
+	}
+
+	count := 0
+	for _, instance := range repo.Instances {
+		if instance.PlanID == planID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
 func (repo *FakeLocalRepository) FindByID(instanceID string) (*redis.Instance, error) {
 	for _, instance := range repo.Instances {
 		if instance.ID == instanceID {
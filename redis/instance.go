@@ -3,10 +3,70 @@ package redis
 import "net"
 
 type Instance struct {
-	ID       string
-	Host     string
-	Port     int
-	Password string
+	ID         string
+	Host       string
+	Port       int
+	TLSPort    int `json:",omitempty"`
+	Password   string
+	PlanID     string
+	Parameters map[string]string
+
+	// Replicas are the nodes that follow the node of a replicated instance.
+	Replicas []*Instance `json:",omitempty"`
+
+	// MasterName is the name the sentinels of a sentinel instance monitor
+	// its master under. The master may have failed over to a replica.
+	MasterName string `json:",omitempty"`
+
+	// SentinelPassword is what clients authenticate to the sentinels of a
+	// sentinel instance with. It does not work on the nodes.
+	SentinelPassword string `json:",omitempty"`
+
+	// SentinelPort is where the sentinel of the node listens.
+	SentinelPort int `json:",omitempty"`
+
+	// Shards is how many nodes of a cluster instance serve slots. The other
+	// nodes of its group replicate them.
+	Shards int `json:",omitempty"`
+
+	// Labels of the node from the config, such as its availability zone.
+	Labels map[string]string `json:",omitempty"`
+
+	// Draining nodes are not allocated again once they are freed.
+	Draining bool `json:",omitempty"`
+
+	// Quarantined is why a free node failed its health check. Quarantined
+	// nodes are not allocated until they pass it again.
+	Quarantined string `json:",omitempty"`
+
+	// PendingReset is why a node freed by a forced deprovision has not been
+	// reset yet. It is not allocated until its agent resets it.
+	PendingReset string `json:",omitempty"`
+
+	// reservedFor is the ID of the instance being created on a free node.
+	reservedFor string
+}
+
+// copy is a snapshot of the instance and its replicas.
+func (instance *Instance) copy() *Instance {
+	snapshot := *instance
+	snapshot.Replicas = nil
+	for _, replica := range instance.Replicas {
+		snapshot.Replicas = append(snapshot.Replicas, replica.copy())
+	}
+	return &snapshot
+}
+
+// freed is the node as a free node of the pool. It keeps what belongs to
+// the node and drops the fields of the instance it was part of.
+func (instance *Instance) freed() *Instance {
+	return &Instance{
+		Host:         instance.Host,
+		Labels:       instance.Labels,
+		Draining:     instance.Draining,
+		Quarantined:  instance.Quarantined,
+		PendingReset: instance.PendingReset,
+	}
 }
 
 func (instance Instance) Address() *net.TCPAddr {
@@ -15,3 +75,16 @@ func (instance Instance) Address() *net.TCPAddr {
 		Port: instance.Port,
 	}
 }
+
+// TLSAddress is where the instance accepts TLS connections, nil when TLS is
+// off.
+func (instance Instance) TLSAddress() *net.TCPAddr {
+	if instance.TLSPort == 0 {
+		return nil
+	}
+
+	return &net.TCPAddr{
+		IP:   net.ParseIP(instance.Host),
+		Port: instance.TLSPort,
+	}
+}
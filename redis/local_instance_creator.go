@@ -1,14 +1,23 @@
 package redis
 
 import (
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/pborman/uuid/uuid"
+	"github.com/pivotal-golang/lager"
 
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
+const persistDataTimeout = time.Minute * 5
+
 type ProcessController interface {
 	StartAndWaitUntilReady(instance *Instance, configPath, instanceDataDir, pidfilePath, logfilePath string, timeout time.Duration) error
 	Kill(instance *Instance) error
@@ -21,9 +30,12 @@ type LocalInstanceRepository interface {
 	Delete(instanceID string) error
 	InstanceDataDir(instanceID string) string
 	InstanceConfigPath(instanceID string) string
+	InstanceUsersPath(instanceID string) string
 	InstanceLogFilePath(instanceID string) string
 	InstancePidFilePath(instanceID string) string
 	InstanceCount() (int, error)
+	PlanInstanceCount(planID string) (int, error)
+	Reconfigure(instance *Instance) error
 	Lock(instance *Instance) error
 	Unlock(instance *Instance) error
 }
@@ -33,9 +45,15 @@ type LocalInstanceCreator struct {
 	FindFreePort       func() (int, error)
 	ProcessController  ProcessController
 	RedisConfiguration brokerconfig.ServiceConfiguration
+	ConnectToRedis     func(instance *Instance, configPath string) (client.Client, error)
+	Logger             lager.Logger
+
+	// configMutex serialises the changes that are made to the config files
+	// of running instances.
+	configMutex sync.Mutex
 }
 
-func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string) error {
+func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
 	instanceCount, err := localInstanceCreator.InstanceCount()
 	if err != nil {
 		return err
@@ -45,16 +63,39 @@ func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string) erro
 		return brokerapi.ErrInstanceLimitMet
 	}
 
+	if plan.InstanceLimit > 0 {
+		planInstanceCount, err := localInstanceCreator.PlanInstanceCount(plan.ID)
+		if err != nil {
+			return err
+		}
+
+		if planInstanceCount >= plan.InstanceLimit {
+			return brokerapi.ErrInstanceLimitMet
+		}
+	}
+
 	port, _ := localInstanceCreator.FindFreePort()
 	instance := &Instance{
-		ID:       instanceID,
-		Port:     port,
-		Host:     localInstanceCreator.RedisConfiguration.Host,
-		Password: uuid.NewRandom().String(),
+		ID:         instanceID,
+		Port:       port,
+		Host:       localInstanceCreator.RedisConfiguration.Host,
+		Password:   uuid.NewRandom().String(),
+		PlanID:     plan.ID,
+		Parameters: parameters,
+	}
+
+	if localInstanceCreator.RedisConfiguration.TLS.Enabled {
+		instance.TLSPort, err = localInstanceCreator.findFreeTLSPort(port)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = localInstanceCreator.Setup(instance)
 	if err != nil {
+		// Without its config the instance cannot run, so what was set up
+		// is removed again rather than left to look like an instance.
+		localInstanceCreator.Delete(instanceID)
 		return err
 	}
 
@@ -71,6 +112,23 @@ func (localInstanceCreator *LocalInstanceCreator) Create(instanceID string) erro
 	return nil
 }
 
+// findFreeTLSPort finds a second free port, since the one found for plain
+// connections is not taken until redis starts.
+func (localInstanceCreator *LocalInstanceCreator) findFreeTLSPort(port int) (int, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		tlsPort, err := localInstanceCreator.FindFreePort()
+		if err != nil {
+			return 0, err
+		}
+
+		if tlsPort != port {
+			return tlsPort, nil
+		}
+	}
+
+	return 0, errors.New("could not find a free port for TLS connections")
+}
+
 func (localInstanceCreator *LocalInstanceCreator) Destroy(instanceID string) error {
 	instance, err := localInstanceCreator.FindByID(instanceID)
 	if err != nil {
@@ -90,6 +148,94 @@ func (localInstanceCreator *LocalInstanceCreator) Destroy(instanceID string) err
 	return localInstanceCreator.Delete(instanceID)
 }
 
+func (localInstanceCreator *LocalInstanceCreator) InstanceSettings(instanceID string) (broker.InstanceSettings, error) {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return broker.InstanceSettings{}, err
+	}
+
+	return broker.InstanceSettings{
+		PlanID:     instance.PlanID,
+		Parameters: instance.Parameters,
+		Credentials: broker.InstanceCredentials{
+			Host:     instance.Host,
+			Port:     instance.Port,
+			Password: instance.Password,
+		},
+	}, nil
+}
+
+// Update rewrites the redis.conf of an instance for a new plan or new
+// parameters and restarts its process. The data is saved before the process
+// is stopped, and the port and password are kept, so bindings keep working.
+func (localInstanceCreator *LocalInstanceCreator) Update(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	if plan.ID != instance.PlanID && plan.InstanceLimit > 0 {
+		planInstanceCount, err := localInstanceCreator.PlanInstanceCount(plan.ID)
+		if err != nil {
+			return err
+		}
+
+		if planInstanceCount >= plan.InstanceLimit {
+			return brokerapi.ErrInstanceLimitMet
+		}
+	}
+
+	err = localInstanceCreator.Lock(instance)
+	if err != nil {
+		return err
+	}
+
+	err = localInstanceCreator.restartWithSettings(instance, plan, parameters)
+	unlockErr := localInstanceCreator.Unlock(instance)
+	if err != nil {
+		return err
+	}
+
+	return unlockErr
+}
+
+func (localInstanceCreator *LocalInstanceCreator) restartWithSettings(instance *Instance, plan brokerconfig.Plan, parameters map[string]string) error {
+	err := localInstanceCreator.persistData(instance, appendOnlyEnabled(confOverrides(plan, parameters)))
+	if err != nil {
+		return err
+	}
+
+	instance.PlanID = plan.ID
+	instance.Parameters = parameters
+
+	err = localInstanceCreator.Reconfigure(instance)
+	if err != nil {
+		return err
+	}
+
+	err = localInstanceCreator.ProcessController.Kill(instance)
+	if err != nil {
+		return err
+	}
+
+	return localInstanceCreator.startLocalInstance(instance)
+}
+
+// persistData makes sure that the data survives the process being killed.
+func (localInstanceCreator *LocalInstanceCreator) persistData(instance *Instance, enableAOF bool) error {
+	if localInstanceCreator.ConnectToRedis == nil {
+		return errors.New("no way to connect to redis has been configured")
+	}
+
+	redisClient, err := localInstanceCreator.ConnectToRedis(instance, localInstanceCreator.InstanceConfigPath(instance.ID))
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	return client.Persist(redisClient, enableAOF, persistDataTimeout)
+}
+
 func (localInstanceCreator *LocalInstanceCreator) startLocalInstance(instance *Instance) error {
 	configPath := localInstanceCreator.InstanceConfigPath(instance.ID)
 	instanceDataDir := localInstanceCreator.InstanceDataDir(instance.ID)
@@ -99,3 +245,154 @@ func (localInstanceCreator *LocalInstanceCreator) startLocalInstance(instance *I
 	timeout := time.Duration(localInstanceCreator.RedisConfiguration.StartRedisTimeoutSeconds) * time.Second
 	return localInstanceCreator.ProcessController.StartAndWaitUntilReady(instance, configPath, instanceDataDir, pidfilePath, logfilePath, timeout)
 }
+
+// Bind creates a redis user for the binding. Instances running a redis
+// without ACL support hand out their password instead, which only works for
+// bindings without a scope.
+func (localInstanceCreator *LocalInstanceCreator) Bind(instanceID string, bindingID string, scope acl.Scope) (broker.InstanceCredentials, error) {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	credentials, err := localInstanceCreator.instanceCredentials(instance)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	localInstanceCreator.configMutex.Lock()
+	defer localInstanceCreator.configMutex.Unlock()
+
+	password, err := localInstanceCreator.userManager(instance).CreateUser(bindingID, scope)
+	if err == acl.ErrNotSupported && !scope.IsRestricted() {
+		return credentials, nil
+	}
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	credentials.Username = bindingID
+	credentials.Password = password
+	return credentials, nil
+}
+
+// Unbind deletes the redis user of the binding, which also disconnects its
+// clients.
+func (localInstanceCreator *LocalInstanceCreator) Unbind(instanceID string, bindingID string) error {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	localInstanceCreator.configMutex.Lock()
+	defer localInstanceCreator.configMutex.Unlock()
+
+	return localInstanceCreator.userManager(instance).DeleteUser(bindingID)
+}
+
+// RotatePassword sets a new password for the redis of the instance without
+// restarting it. The old password stays valid for the grace period.
+func (localInstanceCreator *LocalInstanceCreator) RotatePassword(instanceID string, gracePeriod time.Duration) (broker.InstanceCredentials, error) {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	configPath := localInstanceCreator.InstanceConfigPath(instance.ID)
+	rotator := &acl.PasswordRotator{
+		ConfPath: configPath,
+		Connect: func(password string) (client.Client, error) {
+			connectAs := *instance
+			connectAs.Password = password
+			return localInstanceCreator.ConnectToRedis(&connectAs, configPath)
+		},
+		Logger: localInstanceCreator.Logger.Session("rotate-password", lager.Data{
+			"instance-id": instance.ID,
+		}),
+	}
+
+	localInstanceCreator.configMutex.Lock()
+	defer localInstanceCreator.configMutex.Unlock()
+
+	password, err := rotator.Rotate(gracePeriod)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	return broker.InstanceCredentials{
+		Host:     instance.Host,
+		Port:     instance.Port,
+		Password: password,
+	}, nil
+}
+
+// BlockWrites has the redis of the instance refuse writes, so that its data
+// can be copied elsewhere without losing any.
+func (localInstanceCreator *LocalInstanceCreator) BlockWrites(instanceID string) error {
+	return localInstanceCreator.withRedis(instanceID, client.Client.BlockWrites)
+}
+
+func (localInstanceCreator *LocalInstanceCreator) UnblockWrites(instanceID string) error {
+	return localInstanceCreator.withRedis(instanceID, client.Client.UnblockWrites)
+}
+
+func (localInstanceCreator *LocalInstanceCreator) withRedis(instanceID string, command func(client.Client) error) error {
+	instance, err := localInstanceCreator.FindByID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	redisClient, err := localInstanceCreator.ConnectToRedis(instance, localInstanceCreator.InstanceConfigPath(instance.ID))
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	return command(redisClient)
+}
+
+// instanceCredentials reads the connection details of an instance from its
+// config. The redis version is informational only, so it is left out when the
+// instance cannot be asked for it.
+func (localInstanceCreator *LocalInstanceCreator) instanceCredentials(instance *Instance) (broker.InstanceCredentials, error) {
+	configPath := localInstanceCreator.InstanceConfigPath(instance.ID)
+	conf, err := redisconf.Load(configPath)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	caCert, err := conf.CACert()
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	credentials := broker.InstanceCredentials{
+		Host:     instance.Host,
+		Port:     instance.Port,
+		Password: instance.Password,
+		TLSPort:  conf.TLSPort(),
+		CACert:   caCert,
+	}
+
+	if localInstanceCreator.ConnectToRedis != nil {
+		redisClient, err := localInstanceCreator.ConnectToRedis(instance, configPath)
+		if err == nil {
+			credentials.RedisVersion, _ = redisClient.RedisVersion()
+			redisClient.Disconnect()
+		}
+	}
+
+	return credentials, nil
+}
+
+func (localInstanceCreator *LocalInstanceCreator) userManager(instance *Instance) *acl.Manager {
+	configPath := localInstanceCreator.InstanceConfigPath(instance.ID)
+
+	return &acl.Manager{
+		ConfPath:  configPath,
+		UsersPath: localInstanceCreator.InstanceUsersPath(instance.ID),
+		Connect: func() (client.Client, error) {
+			return localInstanceCreator.ConnectToRedis(instance, configPath)
+		},
+	}
+}
@@ -2,13 +2,22 @@ package redis_test
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/pborman/uuid/uuid"
+	"github.com/pivotal-golang/lager/lagertest"
 
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	clientfakes "github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
 	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,9 +36,11 @@ var _ = Describe("Local Redis Creator", func() {
 	var fakeProcessController *fakes.FakeProcessController
 	var fakeLocalRepository *fakes.FakeLocalRepository
 	var localInstanceCreator *redis.LocalInstanceCreator
+	var plan brokerconfig.Plan
 
 	BeforeEach(func() {
 		instanceID = uuid.NewRandom().String()
+		plan = brokerconfig.Plan{ID: "plan-id"}
 		fakeProcessController = &fakes.FakeProcessController{}
 
 		fakeLocalRepository = &fakes.FakeLocalRepository{
@@ -43,8 +54,9 @@ var _ = Describe("Local Redis Creator", func() {
 			ProcessController:       fakeProcessController,
 			LocalInstanceRepository: fakeLocalRepository,
 			RedisConfiguration: brokerconfig.ServiceConfiguration{
-				ServiceInstanceLimit: 1,
+				ServiceInstanceLimit: 2,
 			},
+			Logger: lagertest.NewTestLogger("local-instance-creator"),
 		}
 	})
 
@@ -60,25 +72,66 @@ var _ = Describe("Local Redis Creator", func() {
 			})
 
 			It("should return an error if unable to retrieve instance count", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, plan, nil)
 				Ω(err).To(HaveOccurred())
 			})
 		})
 
+		Context("when the instance cannot be set up", func() {
+			BeforeEach(func() {
+				fakeLocalRepository.SetupErr = errors.New("open /certs/ca.crt: no such file or directory")
+			})
+
+			It("returns the error, removes what was set up and does not start redis", func() {
+				err := localInstanceCreator.Create(instanceID, plan, nil)
+				Ω(err).Should(MatchError("open /certs/ca.crt: no such file or directory"))
+
+				Ω(fakeLocalRepository.DeletedInstanceIds).Should(Equal([]string{instanceID}))
+				Ω(fakeProcessController.StartedInstances).Should(BeEmpty())
+			})
+		})
+
 		Context("when the service instance limit has not been met", func() {
 			BeforeEach(func() {
 				freePortsFound = 0
 			})
 
 			It("finds a free port", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, plan, nil)
 				Ω(err).ToNot(HaveOccurred())
 
 				Ω(freePortsFound).To(Equal(1))
 			})
 
+			Context("when TLS is enabled", func() {
+				BeforeEach(func() {
+					localInstanceCreator.RedisConfiguration.TLS.Enabled = true
+					nextPort := 8080
+					localInstanceCreator.FindFreePort = func() (int, error) {
+						port := nextPort
+						nextPort++
+						return port, nil
+					}
+				})
+
+				It("finds a second port for TLS connections", func() {
+					err := localInstanceCreator.Create(instanceID, plan, nil)
+					Ω(err).ToNot(HaveOccurred())
+
+					Ω(fakeProcessController.StartedInstances[0].Port).To(Equal(8080))
+					Ω(fakeProcessController.StartedInstances[0].TLSPort).To(Equal(8081))
+				})
+
+				It("fails when no second port can be found", func() {
+					localInstanceCreator.FindFreePort = fakeFreePortFinder
+
+					err := localInstanceCreator.Create(instanceID, plan, nil)
+					Ω(err).To(MatchError("could not find a free port for TLS connections"))
+				})
+			})
+
 			It("starts a new Redis instance", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, plan, nil)
 				Ω(err).ToNot(HaveOccurred())
 
 				Ω(len(fakeProcessController.StartedInstances)).To(Equal(1))
@@ -89,12 +142,46 @@ var _ = Describe("Local Redis Creator", func() {
 				fakeProcessController.DoOnInstanceStart = func() {
 					Ω(fakeLocalRepository.UnlockedInstances).Should(BeEmpty())
 				}
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, plan, nil)
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(fakeLocalRepository.UnlockedInstances).Should(HaveLen(1))
 				Ω(fakeLocalRepository.UnlockedInstances[0].ID).Should(Equal(instanceID))
 			})
 
+			It("records the plan on the new instance", func() {
+				err := localInstanceCreator.Create(instanceID, plan, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLocalRepository.CreatedInstances).Should(HaveLen(1))
+				Ω(fakeLocalRepository.CreatedInstances[0].PlanID).Should(Equal("plan-id"))
+			})
+
+			It("records the parameters on the new instance", func() {
+				parameters := map[string]string{"maxmemory-policy": "noeviction"}
+				err := localInstanceCreator.Create(instanceID, plan, parameters)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLocalRepository.CreatedInstances).Should(HaveLen(1))
+				Ω(fakeLocalRepository.CreatedInstances[0].Parameters).Should(Equal(parameters))
+			})
+		})
+
+		Context("when the plan instance limit has been met", func() {
+			BeforeEach(func() {
+				plan.InstanceLimit = 1
+				fakeLocalRepository.Instances = []*redis.Instance{
+					&redis.Instance{
+						ID:     "1",
+						PlanID: "plan-id",
+					},
+				}
+			})
+
+			It("returns an InstanceLimitMet error", func() {
+				err := localInstanceCreator.Create(instanceID, plan, nil)
+				Ω(err).To(Equal(brokerapi.ErrInstanceLimitMet))
+				Ω(fakeProcessController.StartedInstances).To(BeEmpty())
+			})
 		})
 
 		Context("when the service instance limit has been met", func() {
@@ -106,17 +193,23 @@ var _ = Describe("Local Redis Creator", func() {
 						Host:     "whatever",
 						Password: "whatever",
 					},
+					&redis.Instance{
+						ID:       "2",
+						Port:     1235,
+						Host:     "whatever",
+						Password: "whatever",
+					},
 				}
 			})
 
 			It("does not start a new Redis instance", func() {
-				localInstanceCreator.Create(instanceID)
+				localInstanceCreator.Create(instanceID, plan, nil)
 
 				Ω(len(fakeProcessController.StartedInstances)).To(Equal(0))
 			})
 
 			It("returns an InstanceLimitMet error", func() {
-				err := localInstanceCreator.Create(instanceID)
+				err := localInstanceCreator.Create(instanceID, plan, nil)
 				Ω(err).To(Equal(brokerapi.ErrInstanceLimitMet))
 			})
 		})
@@ -125,7 +218,7 @@ var _ = Describe("Local Redis Creator", func() {
 	Describe("destroying a redis instance", func() {
 		Context("when the instance exists", func() {
 			BeforeEach(func() {
-				localInstanceCreator.Create(instanceID)
+				localInstanceCreator.Create(instanceID, plan, nil)
 			})
 
 			It("calls lock before stopping redis", func() {
@@ -173,4 +266,335 @@ var _ = Describe("Local Redis Creator", func() {
 			})
 		})
 	})
+
+	Describe("Update", func() {
+		var (
+			fakeClient     *clientfakes.Client
+			newPlan        brokerconfig.Plan
+			newParameters  map[string]string
+			connectedPaths []string
+		)
+
+		BeforeEach(func() {
+			fakeClient = &clientfakes.Client{
+				ConfigValues: map[string]string{"appendonly": "no"},
+				InfoFields: map[string]string{
+					"aof_enabled":             "1",
+					"aof_rewrite_in_progress": "0",
+					"aof_rewrite_scheduled":   "0",
+				},
+			}
+			connectedPaths = []string{}
+			localInstanceCreator.ConnectToRedis = func(instance *redis.Instance, configPath string) (client.Client, error) {
+				connectedPaths = append(connectedPaths, configPath)
+				return fakeClient, nil
+			}
+
+			newPlan = brokerconfig.Plan{ID: "new-plan-id"}
+			newParameters = map[string]string{"maxmemory-policy": "noeviction"}
+
+			err := localInstanceCreator.Create(instanceID, plan, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			fakeProcessController.StartedInstances = nil
+		})
+
+		It("saves the data before redis is stopped", func() {
+			fakeProcessController.DoOnInstanceStop = func() {
+				Ω(fakeClient.RunBGSaveCallCount).To(Equal(1))
+				Ω(fakeClient.WaitForNewSaveSinceCallCount).To(Equal(1))
+			}
+
+			err := localInstanceCreator.Update(instanceID, newPlan, newParameters)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(connectedPaths).To(HaveLen(1))
+			Ω(fakeClient.DisconnectCallCount).To(Equal(1))
+		})
+
+		It("rewrites the config with the new plan and parameters and restarts redis", func() {
+			err := localInstanceCreator.Update(instanceID, newPlan, newParameters)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeLocalRepository.ReconfiguredInstances).To(HaveLen(1))
+			Ω(fakeLocalRepository.ReconfiguredInstances[0].PlanID).To(Equal("new-plan-id"))
+			Ω(fakeLocalRepository.ReconfiguredInstances[0].Parameters).To(Equal(newParameters))
+
+			Ω(fakeProcessController.KilledInstances).To(HaveLen(1))
+			Ω(fakeProcessController.StartedInstances).To(HaveLen(1))
+			Ω(fakeProcessController.StartedInstances[0].PlanID).To(Equal("new-plan-id"))
+		})
+
+		It("keeps the port and the password", func() {
+			instance, err := fakeLocalRepository.FindByID(instanceID)
+			Ω(err).ShouldNot(HaveOccurred())
+			port, password := instance.Port, instance.Password
+
+			err = localInstanceCreator.Update(instanceID, newPlan, newParameters)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeProcessController.StartedInstances[0].Port).To(Equal(port))
+			Ω(fakeProcessController.StartedInstances[0].Password).To(Equal(password))
+		})
+
+		It("holds the lock while redis is restarted", func() {
+			fakeProcessController.DoOnInstanceStop = func() {
+				Ω(fakeLocalRepository.LockedInstances).To(HaveLen(1))
+			}
+
+			err := localInstanceCreator.Update(instanceID, newPlan, newParameters)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeLocalRepository.UnlockedInstances).To(HaveLen(2))
+		})
+
+		Context("when AOF persistence is switched on", func() {
+			BeforeEach(func() {
+				newParameters = map[string]string{"persistence": brokerconfig.PersistenceAOF}
+			})
+
+			It("has redis write the AOF file instead of an RDB snapshot", func() {
+				err := localInstanceCreator.Update(instanceID, newPlan, newParameters)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeClient.EnableAOFCallCount).To(Equal(1))
+				Ω(fakeClient.RunBGSaveCallCount).To(Equal(0))
+			})
+		})
+
+		Context("when the snapshot fails", func() {
+			BeforeEach(func() {
+				fakeClient.ExpectedRunGBSaveErr = errors.New("bgsave failed")
+			})
+
+			It("leaves redis running and returns the error", func() {
+				err := localInstanceCreator.Update(instanceID, newPlan, newParameters)
+				Ω(err).To(MatchError("bgsave failed"))
+
+				Ω(fakeProcessController.KilledInstances).To(BeEmpty())
+				Ω(fakeLocalRepository.ReconfiguredInstances).To(BeEmpty())
+				Ω(fakeLocalRepository.UnlockedInstances).To(HaveLen(2))
+			})
+		})
+
+		Context("when the new plan instance limit has been met", func() {
+			BeforeEach(func() {
+				newPlan.InstanceLimit = 1
+				fakeLocalRepository.Instances = append(fakeLocalRepository.Instances, &redis.Instance{ID: "other", PlanID: "new-plan-id"})
+			})
+
+			It("returns an InstanceLimitMet error", func() {
+				err := localInstanceCreator.Update(instanceID, newPlan, newParameters)
+				Ω(err).To(Equal(brokerapi.ErrInstanceLimitMet))
+			})
+		})
+	})
+
+	Describe("InstanceSettings", func() {
+		It("returns the plan, parameters and credentials of the instance", func() {
+			err := localInstanceCreator.Create(instanceID, plan, map[string]string{"persistence": "aof"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			settings, err := localInstanceCreator.InstanceSettings(instanceID)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(settings.PlanID).To(Equal("plan-id"))
+			Ω(settings.Parameters).To(Equal(map[string]string{"persistence": "aof"}))
+			Ω(settings.Credentials).To(Equal(broker.InstanceCredentials{
+				Port:     8080,
+				Password: fakeProcessController.StartedInstances[0].Password,
+			}))
+		})
+	})
+
+	Describe("Bind and Unbind", func() {
+		var (
+			fakeClient *clientfakes.Client
+			tmpDir     string
+			instance   *redis.Instance
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "local-instance-creator")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeLocalRepository.ConfigPath = filepath.Join(tmpDir, "redis.conf")
+			fakeLocalRepository.UsersPath = filepath.Join(tmpDir, "users.conf")
+			err = ioutil.WriteFile(fakeLocalRepository.ConfigPath, []byte("port 8080\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClient = &clientfakes.Client{Version: "6.2.6"}
+			localInstanceCreator.ConnectToRedis = func(instance *redis.Instance, configPath string) (client.Client, error) {
+				return fakeClient, nil
+			}
+
+			err = localInstanceCreator.Create(instanceID, plan, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			instance = fakeLocalRepository.Instances[0]
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		It("creates a user for the binding and keeps it in the config", func() {
+			credentials, err := localInstanceCreator.Bind(instanceID, "binding-id", acl.Scope{ReadOnly: true})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials.Username).Should(Equal("binding-id"))
+			Ω(credentials.Password).ShouldNot(Equal(instance.Password))
+			Ω(fakeClient.ACLUsers).Should(HaveKey("binding-id"))
+
+			conf, err := redisconf.Load(fakeLocalRepository.ConfigPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf.Get("user")).Should(HavePrefix("binding-id "))
+		})
+
+		It("includes the TLS details from the config and the redis version", func() {
+			caCertPath := filepath.Join(tmpDir, "ca.crt")
+			err := ioutil.WriteFile(caCertPath, []byte("a-ca-cert"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = ioutil.WriteFile(fakeLocalRepository.ConfigPath, []byte("port 8080\ntls-port 8443\ntls-ca-cert-file "+caCertPath+"\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			credentials, err := localInstanceCreator.Bind(instanceID, "binding-id", acl.Scope{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials.TLSPort).Should(Equal(8443))
+			Ω(credentials.CACert).Should(Equal("a-ca-cert"))
+			Ω(credentials.RedisVersion).Should(Equal("6.2.6"))
+		})
+
+		It("deletes the user on unbind", func() {
+			_, err := localInstanceCreator.Bind(instanceID, "binding-id", acl.Scope{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = localInstanceCreator.Unbind(instanceID, "binding-id")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeClient.DeletedACLUsers).Should(Equal([]string{"binding-id"}))
+
+			users, err := acl.LoadUsers(fakeLocalRepository.UsersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(users).Should(BeEmpty())
+		})
+
+		Context("when redis does not support ACLs", func() {
+			BeforeEach(func() {
+				fakeClient.Version = "5.0.14"
+			})
+
+			It("hands out the password of the instance", func() {
+				credentials, err := localInstanceCreator.Bind(instanceID, "binding-id", acl.Scope{})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(credentials).Should(Equal(broker.InstanceCredentials{
+					Port:         8080,
+					Password:     instance.Password,
+					RedisVersion: "5.0.14",
+				}))
+			})
+
+			It("rejects scoped bindings", func() {
+				_, err := localInstanceCreator.Bind(instanceID, "binding-id", acl.Scope{KeyPrefix: "app:"})
+				Ω(err).Should(Equal(acl.ErrNotSupported))
+			})
+
+			It("unbinds without deleting a user", func() {
+				err := localInstanceCreator.Unbind(instanceID, "binding-id")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakeClient.DeletedACLUsers).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("BlockWrites and UnblockWrites", func() {
+		var fakeClient *clientfakes.Client
+
+		BeforeEach(func() {
+			err := localInstanceCreator.Create(instanceID, plan, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClient = &clientfakes.Client{}
+			localInstanceCreator.ConnectToRedis = func(instance *redis.Instance, configPath string) (client.Client, error) {
+				return fakeClient, nil
+			}
+		})
+
+		It("has redis refuse writes and accept them again", func() {
+			Ω(localInstanceCreator.BlockWrites(instanceID)).Should(Succeed())
+			Ω(fakeClient.WritesBlocked).Should(BeTrue())
+
+			Ω(localInstanceCreator.UnblockWrites(instanceID)).Should(Succeed())
+			Ω(fakeClient.WritesBlocked).Should(BeFalse())
+			Ω(fakeClient.DisconnectCallCount).Should(Equal(2))
+		})
+
+		It("returns the error of redis", func() {
+			fakeClient.ExpectedBlockWritesErr = errors.New("ERR unknown command")
+			Ω(localInstanceCreator.BlockWrites(instanceID)).Should(MatchError("ERR unknown command"))
+		})
+
+		It("returns an error for unknown instances", func() {
+			Ω(localInstanceCreator.BlockWrites("unknown-instance")).ShouldNot(Succeed())
+		})
+	})
+
+	Describe("RotatePassword", func() {
+		var (
+			fakeClient         *clientfakes.Client
+			tmpDir             string
+			connectedPasswords []string
+			oldPassword        string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "local-instance-creator")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = localInstanceCreator.Create(instanceID, plan, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			oldPassword = fakeLocalRepository.Instances[0].Password
+
+			fakeLocalRepository.ConfigPath = filepath.Join(tmpDir, "redis.conf")
+			err = redisconf.New(
+				redisconf.Param{Key: "port", Value: "8080"},
+				redisconf.Param{Key: "requirepass", Value: oldPassword},
+			).Save(fakeLocalRepository.ConfigPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeClient = &clientfakes.Client{}
+			connectedPasswords = []string{}
+			localInstanceCreator.ConnectToRedis = func(instance *redis.Instance, configPath string) (client.Client, error) {
+				connectedPasswords = append(connectedPasswords, instance.Password)
+				return fakeClient, nil
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		It("sets a new password in redis and in the config file", func() {
+			credentials, err := localInstanceCreator.RotatePassword(instanceID, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(credentials.Port).Should(Equal(8080))
+			Ω(credentials.Password).ShouldNot(Equal(oldPassword))
+
+			Ω(connectedPasswords).Should(Equal([]string{oldPassword}))
+			Ω(fakeClient.Passwords).Should(Equal([]string{credentials.Password}))
+
+			conf, err := redisconf.Load(fakeLocalRepository.ConfigPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf.Password()).Should(Equal(credentials.Password))
+		})
+
+		It("does not restart the instance", func() {
+			fakeProcessController.StartedInstances = nil
+
+			_, err := localInstanceCreator.RotatePassword(instanceID, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakeProcessController.StartedInstances).Should(BeEmpty())
+			Ω(fakeProcessController.KilledInstances).Should(BeEmpty())
+		})
+
+		It("returns an error for unknown instances", func() {
+			_, err := localInstanceCreator.RotatePassword("unknown-instance", 0)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
 })
@@ -5,16 +5,29 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/tlscert"
 )
 
 type LocalRepository struct {
 	RedisConf brokerconfig.ServiceConfiguration
+
+	// Metadata lists the instances with their plans and parameters, so that
+	// counting them does not read every instance directory. Without it the
+	// instance directories are listed.
+	Metadata MetadataStore
+
+	// heldLocks are the lock files this process created and has not
+	// removed yet.
+	heldLocks      map[string]*Instance
+	heldLocksMutex sync.Mutex
 }
 
 func (repo *LocalRepository) FindByID(instanceID string) (*Instance, error) {
@@ -28,11 +41,19 @@ func (repo *LocalRepository) FindByID(instanceID string) (*Instance, error) {
 		return nil, err
 	}
 
+	metadata, err := repo.metadataStore().Metadata(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
 	instance := &Instance{
-		ID:       instanceID,
-		Password: conf.Get("requirepass"),
-		Port:     port,
-		Host:     repo.RedisConf.Host,
+		ID:         instanceID,
+		Password:   conf.Get("requirepass"),
+		Port:       port,
+		TLSPort:    conf.TLSPort(),
+		Host:       repo.RedisConf.Host,
+		PlanID:     metadata.PlanID,
+		Parameters: metadata.Parameters,
 	}
 
 	return instance, nil
@@ -52,11 +73,29 @@ func (repo *LocalRepository) InstanceExists(instanceID string) (bool, error) {
 // EnsureDirectoriesExist -> EnsureLogDirectoryExists
 
 func (repo *LocalRepository) Setup(instance *Instance) error {
-	repo.EnsureDirectoriesExist(instance)
-	repo.Lock(instance)
-	repo.WriteConfigFile(instance)
+	if err := repo.EnsureDirectoriesExist(instance); err != nil {
+		return err
+	}
 
-	return nil
+	if err := repo.Lock(instance); err != nil {
+		return err
+	}
+
+	if err := repo.WriteConfigFile(instance); err != nil {
+		return err
+	}
+
+	return repo.writeMetadata(instance)
+}
+
+// Reconfigure rewrites the config file and the metadata of an existing
+// instance after its plan or parameters have changed.
+func (repo *LocalRepository) Reconfigure(instance *Instance) error {
+	if err := repo.WriteConfigFile(instance); err != nil {
+		return err
+	}
+
+	return repo.writeMetadata(instance)
 }
 
 func (repo *LocalRepository) Lock(instance *Instance) error {
@@ -67,6 +106,13 @@ func (repo *LocalRepository) Lock(instance *Instance) error {
 	}
 	lockFile.Close()
 
+	repo.heldLocksMutex.Lock()
+	defer repo.heldLocksMutex.Unlock()
+	if repo.heldLocks == nil {
+		repo.heldLocks = map[string]*Instance{}
+	}
+	repo.heldLocks[instance.ID] = instance
+
 	return nil
 }
 
@@ -77,6 +123,28 @@ func (repo *LocalRepository) Unlock(instance *Instance) error {
 		return err
 	}
 
+	repo.heldLocksMutex.Lock()
+	defer repo.heldLocksMutex.Unlock()
+	delete(repo.heldLocks, instance.ID)
+
+	return nil
+}
+
+// ReleaseLocks removes the lock files left by operations of this process
+// that did not finish, so that the process monitor looks after those
+// instances again.
+func (repo *LocalRepository) ReleaseLocks() error {
+	repo.heldLocksMutex.Lock()
+	defer repo.heldLocksMutex.Unlock()
+
+	for id, instance := range repo.heldLocks {
+		err := os.Remove(repo.lockFilePath(instance))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(repo.heldLocks, id)
+	}
+
 	return nil
 }
 
@@ -87,14 +155,20 @@ func (repo *LocalRepository) lockFilePath(instance *Instance) string {
 func (repo *LocalRepository) AllInstances() ([]*Instance, error) {
 	instances := []*Instance{}
 
-	instanceDirs, err := ioutil.ReadDir(repo.RedisConf.InstanceDataDirectory)
+	allMetadata, err := repo.metadataStore().AllMetadata()
 	if err != nil {
 		return instances, err
 	}
 
-	for _, instanceDir := range instanceDirs {
+	instanceIDs := []string{}
+	for instanceID := range allMetadata {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	for _, instanceID := range instanceIDs {
 
-		instance, err := repo.FindByID(instanceDir.Name())
+		instance, err := repo.FindByID(instanceID)
 
 		if err != nil {
 			return instances, err
@@ -107,24 +181,24 @@ func (repo *LocalRepository) AllInstances() ([]*Instance, error) {
 }
 
 func (repo *LocalRepository) InstanceCount() (int, error) {
-	instances, err := repo.AllInstances()
-	return len(instances), err
+	allMetadata, err := repo.metadataStore().AllMetadata()
+	return len(allMetadata), err
 }
 
-func (repo *LocalRepository) Bind(instanceID string, bindingID string) (broker.InstanceCredentials, error) {
-	instance, err := repo.FindByID(instanceID)
+func (repo *LocalRepository) PlanInstanceCount(planID string) (int, error) {
+	allMetadata, err := repo.metadataStore().AllMetadata()
 	if err != nil {
-		return broker.InstanceCredentials{}, err
+		return 0, err
 	}
-	return broker.InstanceCredentials{
-		Host:     instance.Host,
-		Port:     instance.Port,
-		Password: instance.Password,
-	}, nil
-}
 
-func (repo *LocalRepository) Unbind(instanceID string, bindingID string) error {
-	return nil
+	count := 0
+	for _, metadata := range allMetadata {
+		if metadata.PlanID == planID {
+			count++
+		}
+	}
+
+	return count, nil
 }
 
 func (repo *LocalRepository) Delete(instanceID string) error {
@@ -138,7 +212,7 @@ func (repo *LocalRepository) Delete(instanceID string) error {
 		return err
 	}
 
-	return nil
+	return repo.metadataStore().DeleteMetadata(instanceID)
 }
 
 func (repo *LocalRepository) EnsureDirectoriesExist(instance *Instance) error {
@@ -156,15 +230,105 @@ func (repo *LocalRepository) EnsureDirectoriesExist(instance *Instance) error {
 }
 
 func (repo *LocalRepository) WriteConfigFile(instance *Instance) error {
+	plan, _ := repo.RedisConf.PlanByID(instance.PlanID)
+
+	users, err := acl.LoadUsers(repo.InstanceUsersPath(instance.ID))
+	if err != nil {
+		return err
+	}
+
+	overrides := append(confOverrides(plan, instance.Parameters), users...)
+
+	if instance.TLSPort != 0 {
+		tls, err := repo.instanceTLS(instance)
+		if err != nil {
+			return err
+		}
+		overrides = append(overrides, tls.Params()...)
+	}
+
 	return redisconf.CopyWithInstanceAdditions(
 		repo.RedisConf.DefaultConfigPath,
 		repo.InstanceConfigPath(instance.ID),
 		instance.ID,
 		strconv.Itoa(instance.Port),
 		instance.Password,
+		overrides...,
 	)
 }
 
+// instanceTLS picks the certificate an instance serves TLS with. With a CA
+// key the broker issues a certificate for the instance once and keeps it next
+// to its config; otherwise every instance uses the operator's certificate.
+func (repo *LocalRepository) instanceTLS(instance *Instance) (redisconf.TLS, error) {
+	config := repo.RedisConf.TLS
+	tls := redisconf.TLS{
+		Port:       instance.TLSPort,
+		CertFile:   config.CertFile,
+		KeyFile:    config.KeyFile,
+		CACertFile: config.CACertFile,
+	}
+
+	if config.CAKeyFile == "" {
+		return tls, nil
+	}
+
+	tls.CertFile = path.Join(repo.InstanceBaseDir(instance.ID), "tls.crt")
+	tls.KeyFile = path.Join(repo.InstanceBaseDir(instance.ID), "tls.key")
+	if fileExists(tls.CertFile) && fileExists(tls.KeyFile) {
+		return tls, nil
+	}
+
+	ca, err := tlscert.LoadCA(config.CACertFile, config.CAKeyFile)
+	if err != nil {
+		return redisconf.TLS{}, err
+	}
+
+	err = ca.Issue([]string{instance.Host}, tls.CertFile, tls.KeyFile)
+	if err != nil {
+		return redisconf.TLS{}, err
+	}
+
+	return tls, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// writeMetadata also writes the metadata to the instance directory when
+// there is a metadata store, for the process monitor, which cannot open the
+// store while the broker has it open.
+func (repo *LocalRepository) writeMetadata(instance *Instance) error {
+	metadata := InstanceMetadata{
+		PlanID:     instance.PlanID,
+		Parameters: instance.Parameters,
+	}
+
+	if repo.Metadata != nil {
+		err := repo.Metadata.PutMetadata(instance.ID, metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	return repo.directoryMetadata().PutMetadata(instance.ID, metadata)
+}
+
+func (repo *LocalRepository) metadataStore() MetadataStore {
+	if repo.Metadata != nil {
+		return repo.Metadata
+	}
+	return repo.directoryMetadata()
+}
+
+func (repo *LocalRepository) directoryMetadata() *DirectoryMetadataStore {
+	return &DirectoryMetadataStore{
+		InstanceDataDirectory: repo.RedisConf.InstanceDataDirectory,
+	}
+}
+
 func (repo *LocalRepository) InstanceBaseDir(instanceID string) string {
 	return path.Join(repo.RedisConf.InstanceDataDirectory, instanceID)
 }
@@ -186,6 +350,10 @@ func (repo *LocalRepository) InstanceConfigPath(instanceID string) string {
 	return path.Join(repo.InstanceBaseDir(instanceID), "redis.conf")
 }
 
+func (repo *LocalRepository) InstanceUsersPath(instanceID string) string {
+	return path.Join(repo.InstanceBaseDir(instanceID), "users.conf")
+}
+
 func (repo *LocalRepository) InstancePidFilePath(instanceID string) string {
 	return path.Join(repo.InstanceBaseDir(instanceID), "redis-server.pid")
 }
@@ -1,6 +1,7 @@
 package redis_test
 
 import (
+	"crypto/tls"
 	"io/ioutil"
 	"os"
 	"path"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/tlscert"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -202,6 +205,233 @@ var _ = Describe("Local Repository", func() {
 		})
 	})
 
+	Describe("plans", func() {
+		BeforeEach(func() {
+			repo.RedisConf.Plans = []brokerconfig.Plan{
+				{
+					ID:          "small-id",
+					Name:        "small",
+					Backend:     brokerconfig.BackendShared,
+					MaxMemory:   "64mb",
+					Persistence: brokerconfig.PersistenceNone,
+					RedisConf: map[string]string{
+						"maxmemory-policy": "allkeys-lru",
+					},
+				},
+			}
+		})
+
+		It("remembers the plan of an instance", func() {
+			instance := &redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 8080, PlanID: "small-id"}
+			err := repo.Setup(instance)
+			Ω(err).NotTo(HaveOccurred())
+
+			instanceFromDisk, err := repo.FindByID(instanceID)
+			Ω(err).NotTo(HaveOccurred())
+			Ω(instanceFromDisk.PlanID).Should(Equal("small-id"))
+
+			count, err := repo.PlanInstanceCount("small-id")
+			Ω(err).NotTo(HaveOccurred())
+			Ω(count).Should(Equal(1))
+		})
+
+		It("applies the plan settings to the config file", func() {
+			instance := &redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 8080, PlanID: "small-id"}
+			writeInstance(instance, repo)
+
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Ω(err).NotTo(HaveOccurred())
+			Ω(conf.Get("maxmemory")).Should(Equal("64mb"))
+			Ω(conf.Get("maxmemory-policy")).Should(Equal("allkeys-lru"))
+			Ω(conf.Get("appendonly")).Should(Equal("no"))
+			Ω(conf.Get("save")).Should(Equal(`""`))
+			Ω(conf.Get("daemonize")).Should(Equal("yes"))
+		})
+
+		Context("when the instance has parameters", func() {
+			var instance *redis.Instance
+
+			BeforeEach(func() {
+				instance = &redis.Instance{
+					ID:     instanceID,
+					Host:   "127.0.0.1",
+					Port:   8080,
+					PlanID: "small-id",
+					Parameters: map[string]string{
+						"maxmemory-policy":       "volatile-ttl",
+						"notify-keyspace-events": "",
+						"persistence":            brokerconfig.PersistenceAOF,
+					},
+				}
+				err := repo.Setup(instance)
+				Ω(err).NotTo(HaveOccurred())
+			})
+
+			It("applies them over the plan settings", func() {
+				conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+				Ω(err).NotTo(HaveOccurred())
+				Ω(conf.Get("maxmemory")).Should(Equal("64mb"))
+				Ω(conf.Get("maxmemory-policy")).Should(Equal("volatile-ttl"))
+				Ω(conf.Get("notify-keyspace-events")).Should(Equal(`""`))
+				Ω(conf.Get("appendonly")).Should(Equal("yes"))
+				Ω(conf.HasKey("persistence")).Should(BeFalse())
+			})
+
+			It("remembers them", func() {
+				instanceFromDisk, err := repo.FindByID(instanceID)
+				Ω(err).NotTo(HaveOccurred())
+				Ω(instanceFromDisk.Parameters).Should(Equal(instance.Parameters))
+			})
+
+			Context("when the instance is reconfigured", func() {
+				BeforeEach(func() {
+					instance.Parameters = map[string]string{"maxmemory-policy": "noeviction"}
+					err := repo.Reconfigure(instance)
+					Ω(err).NotTo(HaveOccurred())
+				})
+
+				It("rewrites the config file from the default config", func() {
+					conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+					Ω(err).NotTo(HaveOccurred())
+					Ω(conf.Get("maxmemory-policy")).Should(Equal("noeviction"))
+					Ω(conf.HasKey("notify-keyspace-events")).Should(BeFalse())
+					Ω(conf.Get("appendonly")).Should(Equal("no"))
+					Ω(conf.Get("port")).Should(Equal("8080"))
+				})
+
+				It("remembers the new parameters", func() {
+					instanceFromDisk, err := repo.FindByID(instanceID)
+					Ω(err).NotTo(HaveOccurred())
+					Ω(instanceFromDisk.Parameters).Should(Equal(instance.Parameters))
+				})
+			})
+
+			Context("when the instance has binding users", func() {
+				BeforeEach(func() {
+					users := redisconf.New(redisconf.Param{Key: "user", Value: "binding-id reset on #abc ~* +@all"})
+					err := users.Save(repo.InstanceUsersPath(instanceID))
+					Ω(err).NotTo(HaveOccurred())
+
+					err = repo.Reconfigure(instance)
+					Ω(err).NotTo(HaveOccurred())
+				})
+
+				It("keeps them in the config file", func() {
+					conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+					Ω(err).NotTo(HaveOccurred())
+					Ω(conf.Get("user")).Should(Equal("binding-id reset on #abc ~* +@all"))
+				})
+			})
+		})
+	})
+
+	Describe("TLS", func() {
+		var instance *redis.Instance
+		var tlsDir string
+
+		BeforeEach(func() {
+			var err error
+			tlsDir, err = ioutil.TempDir("", "local-repository-tls")
+			Ω(err).NotTo(HaveOccurred())
+
+			ca, err := tlscert.NewCA("redis-ca")
+			Ω(err).NotTo(HaveOccurred())
+			err = ca.Save(filepath.Join(tlsDir, "ca.crt"), filepath.Join(tlsDir, "ca.key"))
+			Ω(err).NotTo(HaveOccurred())
+
+			instance = &redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 8080, TLSPort: 8443}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tlsDir)
+		})
+
+		Context("when the broker holds a CA", func() {
+			BeforeEach(func() {
+				repo.RedisConf.TLS = brokerconfig.TLS{
+					Enabled:    true,
+					CACertFile: filepath.Join(tlsDir, "ca.crt"),
+					CAKeyFile:  filepath.Join(tlsDir, "ca.key"),
+				}
+				writeInstance(instance, repo)
+			})
+
+			It("issues a certificate for the instance and configures TLS", func() {
+				conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+				Ω(err).NotTo(HaveOccurred())
+				Ω(conf.TLSPort()).Should(Equal(8443))
+				Ω(conf.Get("tls-ca-cert-file")).Should(Equal(filepath.Join(tlsDir, "ca.crt")))
+				Ω(conf.Get("tls-cert-file")).Should(Equal(filepath.Join(repo.InstanceBaseDir(instanceID), "tls.crt")))
+
+				_, err = tls.LoadX509KeyPair(conf.Get("tls-cert-file"), conf.Get("tls-key-file"))
+				Ω(err).NotTo(HaveOccurred())
+			})
+
+			It("keeps the certificate when the config is rewritten", func() {
+				certFile := filepath.Join(repo.InstanceBaseDir(instanceID), "tls.crt")
+				issued, err := ioutil.ReadFile(certFile)
+				Ω(err).NotTo(HaveOccurred())
+
+				Ω(repo.WriteConfigFile(instance)).Should(Succeed())
+
+				rewritten, err := ioutil.ReadFile(certFile)
+				Ω(err).NotTo(HaveOccurred())
+				Ω(rewritten).Should(Equal(issued))
+			})
+
+			It("reads the TLS port of the instance", func() {
+				instanceFromDisk, err := repo.FindByID(instanceID)
+				Ω(err).NotTo(HaveOccurred())
+				Ω(instanceFromDisk.TLSPort).Should(Equal(8443))
+			})
+		})
+
+		Context("when the operator supplies the certificate", func() {
+			BeforeEach(func() {
+				repo.RedisConf.TLS = brokerconfig.TLS{
+					Enabled:    true,
+					CACertFile: filepath.Join(tlsDir, "ca.crt"),
+					CertFile:   "/certs/redis.crt",
+					KeyFile:    "/certs/redis.key",
+				}
+				writeInstance(instance, repo)
+			})
+
+			It("configures TLS with the operator's certificate", func() {
+				conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+				Ω(err).NotTo(HaveOccurred())
+				Ω(conf.Get("tls-cert-file")).Should(Equal("/certs/redis.crt"))
+				Ω(conf.Get("tls-key-file")).Should(Equal("/certs/redis.key"))
+				Ω(fileExists(filepath.Join(repo.InstanceBaseDir(instanceID), "tls.crt"))).Should(BeFalse())
+			})
+		})
+
+		Context("when the CA of the broker cannot be loaded", func() {
+			BeforeEach(func() {
+				repo.RedisConf.TLS = brokerconfig.TLS{
+					Enabled:    true,
+					CACertFile: filepath.Join(tlsDir, "missing-ca.crt"),
+					CAKeyFile:  filepath.Join(tlsDir, "missing-ca.key"),
+				}
+			})
+
+			It("fails to set up the instance", func() {
+				err := repo.Setup(instance)
+				Ω(err).Should(HaveOccurred())
+				Ω(fileExists(repo.InstanceConfigPath(instanceID))).Should(BeFalse())
+			})
+		})
+
+		It("does not configure TLS for instances without a TLS port", func() {
+			instance.TLSPort = 0
+			writeInstance(instance, repo)
+
+			conf, err := redisconf.Load(repo.InstanceConfigPath(instanceID))
+			Ω(err).NotTo(HaveOccurred())
+			Ω(conf.HasKey("tls-port")).Should(BeFalse())
+		})
+	})
+
 	Describe("FindByID", func() {
 		Context("when instance does not exist", func() {
 			It("returns an error", func() {
@@ -258,6 +488,72 @@ var _ = Describe("Local Repository", func() {
 		})
 	})
 
+	Describe("ReleaseLocks", func() {
+		var instance, otherInstance *redis.Instance
+
+		BeforeEach(func() {
+			instance = newTestInstance(instanceID, repo)
+			otherInstance = newTestInstance(uuid.NewRandom().String(), repo)
+
+			Ω(repo.Lock(instance)).Should(Succeed())
+			Ω(repo.Lock(otherInstance)).Should(Succeed())
+			Ω(repo.Unlock(otherInstance)).Should(Succeed())
+		})
+
+		It("removes the locks this repository still holds", func() {
+			lockFile := filepath.Join(repo.InstanceBaseDir(instance.ID), "lock")
+			Ω(fileExists(lockFile)).Should(BeTrue())
+
+			Ω(repo.ReleaseLocks()).Should(Succeed())
+			Ω(fileExists(lockFile)).Should(BeFalse())
+		})
+
+		It("ignores instances deleted while locked", func() {
+			Ω(repo.Delete(instance.ID)).Should(Succeed())
+			Ω(repo.ReleaseLocks()).Should(Succeed())
+		})
+	})
+
+	Describe("with a metadata store", func() {
+		var store *fakeMetadataStore
+
+		BeforeEach(func() {
+			store = &fakeMetadataStore{metadata: map[string]redis.InstanceMetadata{}}
+			repo.Metadata = store
+		})
+
+		It("keeps the metadata in the store and the instance directory", func() {
+			instance := &redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 8080, PlanID: "small-id"}
+			err := repo.Setup(instance)
+			Ω(err).NotTo(HaveOccurred())
+
+			Ω(store.metadata[instanceID].PlanID).Should(Equal("small-id"))
+			Ω(fileExists(filepath.Join(repo.InstanceBaseDir(instanceID), "metadata.json"))).Should(BeTrue())
+		})
+
+		It("counts the instances in the store", func() {
+			store.metadata["instance-1"] = redis.InstanceMetadata{PlanID: "small-id"}
+			store.metadata["instance-2"] = redis.InstanceMetadata{PlanID: "large-id"}
+
+			count, err := repo.InstanceCount()
+			Ω(err).NotTo(HaveOccurred())
+			Ω(count).Should(Equal(2))
+
+			count, err = repo.PlanInstanceCount("small-id")
+			Ω(err).NotTo(HaveOccurred())
+			Ω(count).Should(Equal(1))
+		})
+
+		It("removes deleted instances from the store", func() {
+			instance := &redis.Instance{ID: instanceID, Host: "127.0.0.1", Port: 8080}
+			err := repo.Setup(instance)
+			Ω(err).NotTo(HaveOccurred())
+
+			Ω(repo.Delete(instanceID)).Should(Succeed())
+			Ω(store.metadata).ShouldNot(HaveKey(instanceID))
+		})
+	})
+
 	Describe("InstanceCount", func() {
 		Context("when there are no instances", func() {
 			It("returns 0", func() {
@@ -354,3 +650,25 @@ func fileExists(path string) bool {
 	}
 	return true
 }
+
+type fakeMetadataStore struct {
+	metadata map[string]redis.InstanceMetadata
+}
+
+func (store *fakeMetadataStore) Metadata(instanceID string) (redis.InstanceMetadata, error) {
+	return store.metadata[instanceID], nil
+}
+
+func (store *fakeMetadataStore) AllMetadata() (map[string]redis.InstanceMetadata, error) {
+	return store.metadata, nil
+}
+
+func (store *fakeMetadataStore) PutMetadata(instanceID string, metadata redis.InstanceMetadata) error {
+	store.metadata[instanceID] = metadata
+	return nil
+}
+
+func (store *fakeMetadataStore) DeleteMetadata(instanceID string) error {
+	delete(store.metadata, instanceID)
+	return nil
+}
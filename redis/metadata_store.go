@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+type InstanceMetadata struct {
+	PlanID     string            `json:"plan_id"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// MetadataStore keeps the plan and the parameters of the shared instances,
+// and which instances there are.
+type MetadataStore interface {
+	// Metadata returns the zero value for instances without metadata.
+	Metadata(instanceID string) (InstanceMetadata, error)
+	AllMetadata() (map[string]InstanceMetadata, error)
+	PutMetadata(instanceID string, metadata InstanceMetadata) error
+	DeleteMetadata(instanceID string) error
+}
+
+// DirectoryMetadataStore keeps the metadata of every instance in a
+// metadata.json next to its redis.conf. The instances are the directories in
+// the data directory, so listing them reads every one of those files.
+type DirectoryMetadataStore struct {
+	InstanceDataDirectory string
+}
+
+func (store *DirectoryMetadataStore) Metadata(instanceID string) (InstanceMetadata, error) {
+	metadata := InstanceMetadata{}
+
+	metadataBytes, err := ioutil.ReadFile(store.metadataPath(instanceID))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(metadataBytes, &metadata)
+	return metadata, err
+}
+
+func (store *DirectoryMetadataStore) AllMetadata() (map[string]InstanceMetadata, error) {
+	allMetadata := map[string]InstanceMetadata{}
+
+	instanceDirs, err := ioutil.ReadDir(store.InstanceDataDirectory)
+	if err != nil {
+		return allMetadata, err
+	}
+
+	for _, instanceDir := range instanceDirs {
+		metadata, err := store.Metadata(instanceDir.Name())
+		if err != nil {
+			return allMetadata, err
+		}
+		allMetadata[instanceDir.Name()] = metadata
+	}
+
+	return allMetadata, nil
+}
+
+func (store *DirectoryMetadataStore) PutMetadata(instanceID string, metadata InstanceMetadata) error {
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(store.metadataPath(instanceID), metadataBytes, 0644)
+}
+
+func (store *DirectoryMetadataStore) DeleteMetadata(instanceID string) error {
+	err := os.Remove(store.metadataPath(instanceID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (store *DirectoryMetadataStore) metadataPath(instanceID string) string {
+	return path.Join(store.InstanceDataDirectory, instanceID, "metadata.json")
+}
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+)
+
+// Metrics records the failures of the dedicated backend.
+type Metrics interface {
+	AgentCallFailed(call, reason string)
+	StatefileWriteFailed()
+}
+
+// SetMetrics reports the failed agent calls and statefile writes of the
+// repository to metrics.
+func (repo *RemoteRepository) SetMetrics(metrics Metrics) {
+	repo.Lock()
+	defer repo.Unlock()
+
+	repo.metrics = metrics
+	repo.agentClient = &instrumentedAgentClient{
+		agentClient: repo.agentClient,
+		metrics:     metrics,
+	}
+}
+
+type instrumentedAgentClient struct {
+	agentClient AgentClient
+	metrics     Metrics
+}
+
+func (client *instrumentedAgentClient) Reset(hostIP string) error {
+	return client.observe("reset", client.agentClient.Reset(hostIP))
+}
+
+func (client *instrumentedAgentClient) Credentials(hostIP string) (Credentials, error) {
+	credentials, err := client.agentClient.Credentials(hostIP)
+	return credentials, client.observe("credentials", err)
+}
+
+func (client *instrumentedAgentClient) ApplyConfig(hostIP string, params []redisconf.Param) error {
+	return client.observe("apply_config", client.agentClient.ApplyConfig(hostIP, params))
+}
+
+func (client *instrumentedAgentClient) ImportData(hostIP string, source importer.Source) error {
+	return client.observe("import_data", client.agentClient.ImportData(hostIP, source))
+}
+
+func (client *instrumentedAgentClient) CreateUser(hostIP, name string, scope acl.Scope) (Credentials, error) {
+	credentials, err := client.agentClient.CreateUser(hostIP, name, scope)
+	return credentials, client.observe("create_user", err)
+}
+
+func (client *instrumentedAgentClient) DeleteUser(hostIP, name string) error {
+	return client.observe("delete_user", client.agentClient.DeleteUser(hostIP, name))
+}
+
+func (client *instrumentedAgentClient) SetUser(hostIP, name, password string, scope acl.Scope) error {
+	return client.observe("set_user", client.agentClient.SetUser(hostIP, name, password, scope))
+}
+
+func (client *instrumentedAgentClient) WaitForSync(hostIP string) error {
+	return client.observe("wait_for_sync", client.agentClient.WaitForSync(hostIP))
+}
+
+func (client *instrumentedAgentClient) MonitorSentinel(hostIP string, monitor sentinel.Monitor) (int, error) {
+	port, err := client.agentClient.MonitorSentinel(hostIP, monitor)
+	return port, client.observe("monitor_sentinel", err)
+}
+
+func (client *instrumentedAgentClient) SentinelMaster(hostIP, masterName string) (sentinel.Address, error) {
+	master, err := client.agentClient.SentinelMaster(hostIP, masterName)
+	return master, client.observe("sentinel_master", err)
+}
+
+func (client *instrumentedAgentClient) ClusterNodeID(hostIP string) (string, error) {
+	nodeID, err := client.agentClient.ClusterNodeID(hostIP)
+	return nodeID, client.observe("cluster_node_id", err)
+}
+
+func (client *instrumentedAgentClient) JoinCluster(hostIP string, join cluster.Join) error {
+	return client.observe("join_cluster", client.agentClient.JoinCluster(hostIP, join))
+}
+
+func (client *instrumentedAgentClient) WaitForCluster(hostIP string) error {
+	return client.observe("wait_for_cluster", client.agentClient.WaitForCluster(hostIP))
+}
+
+func (client *instrumentedAgentClient) RotatePassword(hostIP string, gracePeriod time.Duration) (Credentials, error) {
+	credentials, err := client.agentClient.RotatePassword(hostIP, gracePeriod)
+	return credentials, client.observe("rotate_password", err)
+}
+
+func (client *instrumentedAgentClient) KeyCount(hostIP string) (int, error) {
+	keys, err := client.agentClient.KeyCount(hostIP)
+	return keys, client.observe("key_count", err)
+}
+
+// observe counts err unless it only says that the redis of the node lacks a
+// feature, which the repository handles.
+func (client *instrumentedAgentClient) observe(call string, err error) error {
+	if err != nil && err != acl.ErrNotSupported && err != acl.ErrGracePeriodNotSupported {
+		client.metrics.AgentCallFailed(call, AgentFailure(err))
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// QuarantinedNodes lists the free nodes that failed their health check.
+func (repo *RemoteRepository) QuarantinedNodes() []string {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	return repo.quarantinedHosts()
+}
+
+// RecoverQuarantinedNodes resets the quarantined nodes and returns the ones
+// that pass the health check afterwards to the pool. Nodes that still fail
+// keep the latest reason. The nodes are reset without holding the lock,
+// since quarantined nodes are never allocated and a reset can take a while.
+func (repo *RemoteRepository) RecoverQuarantinedNodes() []string {
+	repo.RLock()
+	hosts := repo.quarantinedHosts()
+	agentClient := repo.agentClient
+	repo.RUnlock()
+
+	recovered := []string{}
+	for _, host := range hosts {
+		node := &Instance{Host: host}
+
+		err := agentClient.Reset(repo.agentURL(node))
+		if err != nil {
+			err = fmt.Errorf("resetting the node: %s", err)
+		} else {
+			err = repo.probe(agentClient, node)
+		}
+
+		repo.Lock()
+		if repo.updateQuarantine(host, err) {
+			recovered = append(recovered, host)
+		}
+		repo.Unlock()
+	}
+
+	return recovered
+}
+
+// healthyNodes reserves count free nodes for a new instance that the
+// placement picks for the requested labels and that pass the health check.
+// The nodes are probed without holding the lock; no other instance is given
+// them while they are reserved. The nodes that fail are quarantined and the
+// placement picks again. healthyNodes returns new nodes for the instance,
+// which take the place of the reserved ones once it is allocated.
+func (repo *RemoteRepository) healthyNodes(instanceID string, labels map[string]string, count int) ([]*Instance, error) {
+	nodes := []*Instance{}
+	for len(nodes) < count {
+		repo.Lock()
+		node, err := repo.reserveNode(instanceID, labels)
+		agentClient := repo.agentClient
+		repo.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		err = repo.probe(agentClient, node)
+		if err != nil {
+			repo.Lock()
+			if reserved := repo.freeNode(node.Host); reserved != nil && reserved.reservedFor == instanceID {
+				reserved.reservedFor = ""
+				reserved.Quarantined = err.Error()
+				// A failed write is counted by persist. The quarantine still
+				// holds until the broker restarts, when the node is checked
+				// again anyway.
+				repo.persist()
+			}
+			repo.Unlock()
+			continue
+		}
+
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// reserveNode reserves the free node that the placement picks for the
+// requested labels. The nodes reserved for any instance being created count
+// as allocated.
+func (repo *RemoteRepository) reserveNode(instanceID string, labels map[string]string) (*Instance, error) {
+	candidates := repo.freeNodes()
+	if len(candidates) == 0 {
+		return nil, brokerapi.ErrInstanceLimitMet
+	}
+
+	allocated := repo.allocatedNodes()
+	for _, node := range repo.availableInstances {
+		if node.reservedFor != "" {
+			allocated = append(allocated, node)
+		}
+	}
+
+	node := repo.placement.Place(candidates, allocated, labels)
+	if node == nil {
+		return nil, ErrNoMatchingNode
+	}
+
+	node.reservedFor = instanceID
+	return &Instance{Host: node.Host, Labels: node.Labels}, nil
+}
+
+// release returns the nodes reserved for an instance that could not be
+// created to the pool, quarantining those with a reason in quarantined.
+func (repo *RemoteRepository) release(instanceID string, quarantined map[string]string) {
+	repo.Lock()
+	defer repo.Unlock()
+
+	repo.unreserve(instanceID, quarantined)
+	if len(quarantined) > 0 {
+		// A failed write is counted by persist. The nodes are back in the
+		// pool either way, as they were before the instance was created.
+		repo.persist()
+	}
+}
+
+func (repo *RemoteRepository) unreserve(instanceID string, quarantined map[string]string) {
+	for _, node := range repo.availableInstances {
+		if node.reservedFor == instanceID {
+			node.reservedFor = ""
+			if reason, ok := quarantined[node.Host]; ok {
+				node.Quarantined = reason
+			}
+		}
+	}
+	delete(repo.creating, instanceID)
+}
+
+// probe checks that a free node can be handed out: its agent returns the
+// credentials, and its redis answers and holds no keys.
+func (repo *RemoteRepository) probe(agentClient AgentClient, node *Instance) error {
+	url := repo.agentURL(node)
+
+	if _, err := agentClient.Credentials(url); err != nil {
+		return fmt.Errorf("reading the credentials: %s", err)
+	}
+
+	keys, err := agentClient.KeyCount(url)
+	if err != nil {
+		return fmt.Errorf("counting the keys: %s", err)
+	}
+	if keys > 0 {
+		return fmt.Errorf("redis holds %d keys", keys)
+	}
+
+	return nil
+}
+
+// updateQuarantine records the outcome of a recovery attempt and reports
+// whether the node went back to the pool. Nodes that were removed or
+// allocated in the meantime are left alone.
+func (repo *RemoteRepository) updateQuarantine(host string, err error) bool {
+	node := repo.freeNode(host)
+	if node == nil || node.Quarantined == "" {
+		return false
+	}
+
+	if err != nil {
+		node.Quarantined = err.Error()
+	} else {
+		node.Quarantined = ""
+	}
+	repo.persist()
+
+	return err == nil
+}
+
+func (repo *RemoteRepository) quarantinedHosts() []string {
+	hosts := []string{}
+	for _, instance := range repo.availableInstances {
+		if instance.Quarantined != "" {
+			hosts = append(hosts, instance.Host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,159 @@
+package redis_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node health checks", func() {
+	var (
+		repo        *redis.RemoteRepository
+		agentClient *fakes.FakeAgentClient
+		tmpDir      string
+		config      brokerconfig.Config
+		keys        map[string]int
+		unreachable map[string]bool
+	)
+
+	const (
+		firstAgent  = "https://10.0.0.1:1234"
+		secondAgent = "https://10.0.0.2:1234"
+	)
+
+	newRepo := func() *redis.RemoteRepository {
+		repo, err := redis.NewRemoteRepository(agentClient, config)
+		Expect(err).ToNot(HaveOccurred())
+		return repo
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+		Expect(err).ToNot(HaveOccurred())
+
+		config = brokerconfig.Config{AgentPort: "1234"}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}}
+		config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+
+		keys = map[string]int{}
+		unreachable = map[string]bool{}
+		agentClient = &fakes.FakeAgentClient{
+			CredentialsFunc: func(rootURL string) (redis.Credentials, error) {
+				if unreachable[rootURL] {
+					return redis.Credentials{}, errors.New("connection refused")
+				}
+				return redis.Credentials{Port: 6379, Password: "secret"}, nil
+			},
+			KeyCountFunc: func(rootURL string) (int, error) {
+				return keys[rootURL], nil
+			},
+		}
+
+		repo = newRepo()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Context("when the first free node still holds data", func() {
+		BeforeEach(func() {
+			keys[firstAgent] = 12
+		})
+
+		It("quarantines it and allocates the next node", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.IDForHost("10.0.0.2")).To(Equal("foo"))
+			Expect(repo.QuarantinedNodes()).To(Equal([]string{"10.0.0.1"}))
+			Expect(repo.Nodes()).To(ContainElement(redis.Node{
+				Host:   "10.0.0.1",
+				State:  redis.NodeQuarantined,
+				Reason: "redis holds 12 keys",
+			}))
+		})
+
+		It("no longer counts it towards the instance limit", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.InstanceLimit()).To(Equal(1))
+			Expect(repo.AvailableInstances()).To(BeEmpty())
+		})
+
+		It("keeps it quarantined across restarts", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(newRepo().QuarantinedNodes()).To(Equal([]string{"10.0.0.1"}))
+		})
+	})
+
+	Context("when the agent of a node cannot be reached", func() {
+		BeforeEach(func() {
+			unreachable[firstAgent] = true
+			unreachable[secondAgent] = true
+		})
+
+		It("quarantines every node and fails to provision", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).To(MatchError(brokerapi.ErrInstanceLimitMet))
+
+			Expect(repo.QuarantinedNodes()).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Expect(repo.Nodes()[0].Reason).To(Equal("reading the credentials: connection refused"))
+		})
+	})
+
+	Describe("#RecoverQuarantinedNodes", func() {
+		BeforeEach(func() {
+			keys[firstAgent] = 12
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("resets the quarantined nodes", func() {
+			repo.RecoverQuarantinedNodes()
+			Expect(agentClient.ResetURLs).To(Equal([]string{firstAgent}))
+		})
+
+		It("returns the nodes that pass the health check to the pool", func() {
+			keys[firstAgent] = 0
+
+			Expect(repo.RecoverQuarantinedNodes()).To(Equal([]string{"10.0.0.1"}))
+			Expect(repo.QuarantinedNodes()).To(BeEmpty())
+			Expect(repo.AvailableInstances()).To(HaveLen(1))
+			Expect(newRepo().QuarantinedNodes()).To(BeEmpty())
+		})
+
+		It("keeps the nodes that still fail quarantined with the latest reason", func() {
+			agentClient.ResetHandler = func(string) error {
+				return errors.New("monit timed out")
+			}
+
+			Expect(repo.RecoverQuarantinedNodes()).To(BeEmpty())
+			Expect(repo.Nodes()).To(ContainElement(redis.Node{
+				Host:   "10.0.0.1",
+				State:  redis.NodeQuarantined,
+				Reason: "resetting the node: monit timed out",
+			}))
+		})
+
+		It("leaves nodes removed in the meantime alone", func() {
+			Expect(repo.RemoveNode("10.0.0.1")).To(Succeed())
+
+			Expect(repo.RecoverQuarantinedNodes()).To(BeEmpty())
+			Expect(repo.Nodes()).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,250 @@
+package redis
+
+import "errors"
+
+var (
+	ErrNodeExists   = errors.New("the node is already in the pool")
+	ErrNodeNotFound = errors.New("the node is not in the pool")
+	ErrNodeInUse    = errors.New("the node is allocated to a service instance")
+)
+
+const (
+	NodeAvailable = "available"
+	NodeAllocated = "allocated"
+	NodeDraining  = "draining"
+
+	NodeQuarantined  = "quarantined"
+	NodeResetPending = "reset_pending"
+)
+
+type Node struct {
+	Host       string `json:"host"`
+	State      string `json:"state"`
+	InstanceID string `json:"instance_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Nodes lists the allocated nodes followed by the free ones. The free nodes
+// reserved for an instance being created are listed as allocated to it.
+func (repo *RemoteRepository) Nodes() []Node {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	nodes := []Node{}
+	for _, instance := range repo.allocatedInstances {
+		for _, node := range instance.Group() {
+			nodes = append(nodes, Node{
+				Host:       node.Host,
+				State:      nodeState(node, NodeAllocated),
+				InstanceID: instance.ID,
+				Labels:     node.Labels,
+			})
+		}
+	}
+	for _, instance := range repo.availableInstances {
+		state := NodeAvailable
+		if instance.reservedFor != "" {
+			state = NodeAllocated
+		}
+		nodes = append(nodes, Node{
+			Host:       instance.Host,
+			State:      nodeState(instance, state),
+			InstanceID: instance.reservedFor,
+			Reason:     nodeReason(instance),
+			Labels:     instance.Labels,
+		})
+	}
+	return nodes
+}
+
+// UnpooledNodes are the allocated nodes that were neither in the config nor
+// added when the broker started. They are drained.
+func (repo *RemoteRepository) UnpooledNodes() []string {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	return append([]string{}, repo.unpooledNodes...)
+}
+
+// AddNode puts a node into the pool, where it can be allocated right away.
+func (repo *RemoteRepository) AddNode(host string) error {
+	repo.Lock()
+	defer repo.Unlock()
+
+	if repo.allocatedInstance(host) != nil || repo.freeNode(host) != nil {
+		return ErrNodeExists
+	}
+
+	previousAdded, previousRemoved := repo.addedNodes, repo.removedNodes
+	if contains(repo.configNodes, host) {
+		repo.removedNodes = without(repo.removedNodes, host)
+	} else {
+		repo.addedNodes = append(without(repo.addedNodes, host), host)
+	}
+	repo.availableInstances = append(repo.availableInstances, &Instance{Host: host, Labels: repo.nodeLabels[host]})
+
+	err := repo.persist()
+	if err != nil {
+		repo.addedNodes, repo.removedNodes = previousAdded, previousRemoved
+		repo.availableInstances = repo.availableInstances[:len(repo.availableInstances)-1]
+		return err
+	}
+
+	return nil
+}
+
+// DrainNode keeps a node from being allocated again. An allocated node keeps
+// its instance until the instance is deprovisioned.
+func (repo *RemoteRepository) DrainNode(host string) error {
+	repo.Lock()
+	defer repo.Unlock()
+
+	instance := repo.allocatedInstance(host)
+	if instance == nil {
+		instance = repo.freeNode(host)
+	}
+	if instance == nil {
+		return ErrNodeNotFound
+	}
+
+	previousDraining := instance.Draining
+	instance.Draining = true
+
+	err := repo.persist()
+	if err != nil {
+		instance.Draining = previousDraining
+		return err
+	}
+
+	return nil
+}
+
+// RemoveNode takes a free node out of the pool.
+func (repo *RemoteRepository) RemoveNode(host string) error {
+	repo.Lock()
+	defer repo.Unlock()
+
+	if repo.allocatedInstance(host) != nil {
+		return ErrNodeInUse
+	}
+	node := repo.freeNode(host)
+	if node == nil {
+		return ErrNodeNotFound
+	}
+	if node.reservedFor != "" {
+		return ErrNodeInUse
+	}
+
+	previousAvailable := repo.availableInstances
+	previousAdded, previousRemoved := repo.addedNodes, repo.removedNodes
+
+	availableInstances := []*Instance{}
+	for _, instance := range repo.availableInstances {
+		if instance.Host != host {
+			availableInstances = append(availableInstances, instance)
+		}
+	}
+	repo.availableInstances = availableInstances
+	repo.addedNodes = without(repo.addedNodes, host)
+	if contains(repo.configNodes, host) {
+		repo.removedNodes = append(without(repo.removedNodes, host), host)
+	}
+
+	err := repo.persist()
+	if err != nil {
+		repo.availableInstances = previousAvailable
+		repo.addedNodes, repo.removedNodes = previousAdded, previousRemoved
+		return err
+	}
+
+	return nil
+}
+
+// poolHosts are the nodes of the config and the nodes added through the API,
+// less the nodes removed through the API.
+func (repo *RemoteRepository) poolHosts() []string {
+	hosts := []string{}
+	for _, host := range append(append([]string{}, repo.configNodes...), repo.addedNodes...) {
+		if !contains(repo.removedNodes, host) && !contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// allocatedInstance is the allocated node on host, which is either the node
+// of an instance or one of its replicas.
+func (repo *RemoteRepository) allocatedInstance(host string) *Instance {
+	for _, node := range repo.allocatedNodes() {
+		if node.Host == host {
+			return node
+		}
+	}
+	return nil
+}
+
+func (repo *RemoteRepository) freeNode(host string) *Instance {
+	for _, instance := range repo.availableInstances {
+		if instance.Host == host {
+			return instance
+		}
+	}
+	return nil
+}
+
+// freeNodes are the free nodes that are neither draining, quarantined,
+// pending a reset nor reserved for an instance being created.
+func (repo *RemoteRepository) freeNodes() []*Instance {
+	nodes := []*Instance{}
+	for _, instance := range repo.availableInstances {
+		if allocatable(instance) {
+			nodes = append(nodes, instance)
+		}
+	}
+	return nodes
+}
+
+func allocatable(instance *Instance) bool {
+	return !instance.Draining && instance.Quarantined == "" && instance.PendingReset == "" && instance.reservedFor == ""
+}
+
+func nodeState(instance *Instance, state string) string {
+	if instance.PendingReset != "" {
+		return NodeResetPending
+	}
+	if instance.Quarantined != "" {
+		return NodeQuarantined
+	}
+	if instance.Draining {
+		return NodeDraining
+	}
+	return state
+}
+
+func nodeReason(instance *Instance) string {
+	if instance.PendingReset != "" {
+		return instance.PendingReset
+	}
+	return instance.Quarantined
+}
+
+func contains(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+func without(hosts []string, host string) []string {
+	remaining := []string{}
+	for _, h := range hosts {
+		if h != host {
+			remaining = append(remaining, h)
+		}
+	}
+	return remaining
+}
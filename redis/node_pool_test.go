@@ -0,0 +1,161 @@
+package redis_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Node pool", func() {
+	var (
+		repo   *redis.RemoteRepository
+		tmpDir string
+		config brokerconfig.Config
+	)
+
+	newRepo := func() *redis.RemoteRepository {
+		repo, err := redis.NewRemoteRepository(&fakes.FakeAgentClient{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		return repo
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+		Expect(err).ToNot(HaveOccurred())
+
+		config = brokerconfig.Config{}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}}
+		config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+
+		repo = newRepo()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("lists the state of every node", func() {
+		err := repo.Create("foo", brokerconfig.Plan{}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(repo.Nodes()).To(Equal([]redis.Node{
+			{Host: "10.0.0.1", State: redis.NodeAllocated, InstanceID: "foo"},
+			{Host: "10.0.0.2", State: redis.NodeAvailable},
+		}))
+	})
+
+	Describe("#AddNode", func() {
+		It("makes the node available for new instances", func() {
+			Expect(repo.AddNode("10.0.0.3")).To(Succeed())
+
+			Expect(repo.InstanceLimit()).To(Equal(3))
+			Expect(repo.AvailableInstances()).To(HaveLen(3))
+		})
+
+		It("keeps the node across restarts", func() {
+			Expect(repo.AddNode("10.0.0.3")).To(Succeed())
+
+			Expect(newRepo().Nodes()).To(ContainElement(redis.Node{Host: "10.0.0.3", State: redis.NodeAvailable}))
+		})
+
+		It("refuses nodes that are already in the pool", func() {
+			Expect(repo.AddNode("10.0.0.1")).To(MatchError(redis.ErrNodeExists))
+		})
+	})
+
+	Describe("#DrainNode", func() {
+		It("does not allocate a draining node", func() {
+			Expect(repo.DrainNode("10.0.0.1")).To(Succeed())
+
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.IDForHost("10.0.0.2")).To(Equal("foo"))
+
+			err = repo.Create("bar", brokerconfig.Plan{}, nil)
+			Expect(err).To(MatchError(brokerapi.ErrInstanceLimitMet))
+			Expect(repo.InstanceLimit()).To(Equal(1))
+		})
+
+		It("keeps an allocated node in use until its instance is deprovisioned", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.DrainNode("10.0.0.1")).To(Succeed())
+			Expect(repo.Nodes()[0]).To(Equal(redis.Node{Host: "10.0.0.1", State: redis.NodeDraining, InstanceID: "foo"}))
+
+			Expect(repo.Destroy("foo")).To(Succeed())
+			Expect(repo.AvailableInstances()).To(HaveLen(1))
+			Expect(repo.AvailableInstances()[0].Host).To(Equal("10.0.0.2"))
+		})
+
+		It("keeps the node draining across restarts", func() {
+			Expect(repo.DrainNode("10.0.0.2")).To(Succeed())
+
+			Expect(newRepo().Nodes()).To(ContainElement(redis.Node{Host: "10.0.0.2", State: redis.NodeDraining}))
+		})
+
+		It("fails for unknown nodes", func() {
+			Expect(repo.DrainNode("10.0.0.9")).To(MatchError(redis.ErrNodeNotFound))
+		})
+	})
+
+	Describe("#RemoveNode", func() {
+		It("takes a free node out of the pool for good", func() {
+			Expect(repo.DrainNode("10.0.0.2")).To(Succeed())
+			Expect(repo.RemoveNode("10.0.0.2")).To(Succeed())
+
+			Expect(repo.Nodes()).To(HaveLen(1))
+			Expect(newRepo().Nodes()).To(HaveLen(1))
+		})
+
+		It("lets a removed node be added again", func() {
+			Expect(repo.RemoveNode("10.0.0.2")).To(Succeed())
+			Expect(repo.AddNode("10.0.0.2")).To(Succeed())
+
+			Expect(newRepo().Nodes()).To(HaveLen(2))
+		})
+
+		It("refuses to remove allocated nodes", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.RemoveNode("10.0.0.1")).To(MatchError(redis.ErrNodeInUse))
+		})
+
+		It("fails for unknown nodes", func() {
+			Expect(repo.RemoveNode("10.0.0.9")).To(MatchError(redis.ErrNodeNotFound))
+		})
+	})
+
+	Context("when an allocated node is no longer in the config", func() {
+		BeforeEach(func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{{Host: "10.0.0.2"}}
+			repo = newRepo()
+		})
+
+		It("reports the node and drains it", func() {
+			Expect(repo.UnpooledNodes()).To(Equal([]string{"10.0.0.1"}))
+			Expect(repo.Nodes()[0]).To(Equal(redis.Node{Host: "10.0.0.1", State: redis.NodeDraining, InstanceID: "foo"}))
+		})
+
+		It("drops the node once its instance is deprovisioned", func() {
+			Expect(repo.Destroy("foo")).To(Succeed())
+
+			Expect(newRepo().Nodes()).To(Equal([]redis.Node{
+				{Host: "10.0.0.2", State: redis.NodeAvailable},
+			}))
+		})
+	})
+})
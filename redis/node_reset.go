@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+const DefaultMaxResetBackoff = 10 * time.Minute
+
+// ForceDestroy deallocates an instance without resetting its nodes, for when
+// their agents fail and Destroy keeps failing with them. The nodes go back to
+// the pool pending a reset and are not allocated until ResetPendingNode
+// succeeds on them.
+func (repo *RemoteRepository) ForceDestroy(instanceID string) error {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
+
+	repo.Lock()
+	defer repo.Unlock()
+
+	instance, err := repo.findByID(instanceID)
+	if err != nil {
+		return err
+	}
+
+	return repo.deallocatePendingReset(instance, instance.Group(), "the instance was deprovisioned by force")
+}
+
+// deallocatePendingReset deallocates the instance, freeing the given nodes of
+// it pending a reset for the reason. Nothing changes when the state cannot be
+// saved. The caller holds the lock of the instance and the one of the
+// repository.
+func (repo *RemoteRepository) deallocatePendingReset(instance *Instance, pending []*Instance, reason string) error {
+	for _, node := range pending {
+		node.PendingReset = reason
+	}
+
+	previousAvailable, previousAllocated := repo.availableInstances, repo.allocatedInstances
+	bindings := repo.instanceBindings[instance.ID]
+	repo.deallocateInstance(instance)
+
+	err := repo.persist(instance.ID)
+	if err != nil {
+		for _, node := range pending {
+			node.PendingReset = ""
+		}
+		repo.availableInstances, repo.allocatedInstances = previousAvailable, previousAllocated
+		repo.instanceBindings[instance.ID] = bindings
+		return err
+	}
+
+	return nil
+}
+
+// PendingResetNodes lists the free nodes that still have to be reset.
+func (repo *RemoteRepository) PendingResetNodes() []string {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	hosts := []string{}
+	for _, instance := range repo.availableInstances {
+		if instance.PendingReset != "" {
+			hosts = append(hosts, instance.Host)
+		}
+	}
+	return hosts
+}
+
+// ResetPendingNode has the agent of a node pending a reset reset it, and
+// returns the node to the pool once it succeeds. Like the recovery of
+// quarantined nodes, the reset runs without holding the lock.
+func (repo *RemoteRepository) ResetPendingNode(host string) error {
+	repo.RLock()
+	node := repo.freeNode(host)
+	pending := node != nil && node.PendingReset != ""
+	agentClient := repo.agentClient
+	repo.RUnlock()
+
+	if node == nil {
+		return ErrNodeNotFound
+	}
+	if !pending {
+		return nil
+	}
+
+	err := agentClient.Reset(repo.agentURL(&Instance{Host: host}))
+
+	repo.Lock()
+	defer repo.Unlock()
+
+	// The node may have been removed from the pool in the meantime.
+	node = repo.freeNode(host)
+	if node == nil || node.PendingReset == "" {
+		return err
+	}
+
+	if err != nil {
+		node.PendingReset = fmt.Sprintf("resetting the node: %s", err)
+	} else {
+		node.PendingReset = ""
+	}
+	// A failed write is counted by persist. The node is back in the pool
+	// until the broker restarts, when it is reset again.
+	repo.persist()
+
+	return err
+}
+
+// ResetReconciler keeps retrying the resets of the nodes pending one. Each
+// node backs off from RetryInterval, doubling after every failure up to
+// MaxBackoff.
+type ResetReconciler struct {
+	Repo          *RemoteRepository
+	RetryInterval time.Duration
+	MaxBackoff    time.Duration
+	Logger        lager.Logger
+
+	backoffs map[string]time.Duration
+	retries  map[string]time.Time
+}
+
+// Run reconciles every RetryInterval until stop is closed.
+func (reconciler *ResetReconciler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(reconciler.retryInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			reconciler.Reconcile(now)
+		}
+	}
+}
+
+// Reconcile resets the nodes pending a reset whose retry is due at now, and
+// returns the ones that went back to the pool.
+func (reconciler *ResetReconciler) Reconcile(now time.Time) []string {
+	if reconciler.retries == nil {
+		reconciler.backoffs = map[string]time.Duration{}
+		reconciler.retries = map[string]time.Time{}
+	}
+
+	hosts := reconciler.Repo.PendingResetNodes()
+	for host := range reconciler.retries {
+		if !contains(hosts, host) {
+			delete(reconciler.backoffs, host)
+			delete(reconciler.retries, host)
+		}
+	}
+
+	reset := []string{}
+	for _, host := range hosts {
+		if retry, ok := reconciler.retries[host]; ok && now.Before(retry) {
+			continue
+		}
+
+		err := reconciler.Repo.ResetPendingNode(host)
+		if err == nil {
+			delete(reconciler.backoffs, host)
+			delete(reconciler.retries, host)
+			reconciler.Logger.Info("node-reset", lager.Data{"host": host})
+			reset = append(reset, host)
+			continue
+		}
+
+		backoff := reconciler.nextBackoff(host)
+		reconciler.retries[host] = now.Add(backoff)
+		reconciler.Logger.Error("node-reset-failed", err, lager.Data{
+			"host":     host,
+			"retry-in": backoff.String(),
+		})
+	}
+
+	return reset
+}
+
+func (reconciler *ResetReconciler) nextBackoff(host string) time.Duration {
+	maxBackoff := reconciler.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxResetBackoff
+	}
+
+	backoff, ok := reconciler.backoffs[host]
+	if !ok {
+		backoff = reconciler.retryInterval()
+	} else {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	reconciler.backoffs[host] = backoff
+	return backoff
+}
+
+func (reconciler *ResetReconciler) retryInterval() time.Duration {
+	if reconciler.RetryInterval <= 0 {
+		return brokerconfig.DefaultResetRetryInterval
+	}
+	return reconciler.RetryInterval
+}
@@ -0,0 +1,241 @@
+package redis_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Forced deprovisioning", func() {
+	var (
+		repo        *redis.RemoteRepository
+		agentClient *fakes.FakeAgentClient
+		tmpDir      string
+		config      brokerconfig.Config
+		resetErr    error
+		resetURLs   []string
+	)
+
+	const (
+		firstAgent  = "https://10.0.0.1:1234"
+		secondAgent = "https://10.0.0.2:1234"
+	)
+
+	newRepo := func() *redis.RemoteRepository {
+		repo, err := redis.NewRemoteRepository(agentClient, config)
+		Expect(err).ToNot(HaveOccurred())
+		return repo
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+		Expect(err).ToNot(HaveOccurred())
+
+		plan := brokerconfig.Plan{
+			ID:       "replicated-plan",
+			Backend:  brokerconfig.BackendDedicated,
+			Topology: brokerconfig.TopologyReplicated,
+			Replicas: 1,
+		}
+		config = brokerconfig.Config{AgentPort: "1234"}
+		config.RedisConfiguration.Plans = []brokerconfig.Plan{plan}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{
+			{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"},
+		}
+		config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+
+		resetErr = nil
+		resetURLs = nil
+		agentClient = &fakes.FakeAgentClient{
+			ResetHandler: func(rootURL string) error {
+				resetURLs = append(resetURLs, rootURL)
+				return resetErr
+			},
+		}
+
+		repo = newRepo()
+		Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+		resetErr = errors.New("agent unreachable")
+		resetURLs = nil
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Destroy", func() {
+		It("keeps the instance when its first node cannot be reset", func() {
+			Expect(repo.Destroy("foo")).To(MatchError("agent unreachable"))
+
+			Expect(resetURLs).To(Equal([]string{firstAgent}))
+			Expect(repo.InstanceExists("foo")).To(BeTrue())
+			Expect(repo.PendingResetNodes()).To(BeEmpty())
+		})
+
+		Context("when a node cannot be reset after another one was", func() {
+			BeforeEach(func() {
+				agentClient.ResetHandler = func(rootURL string) error {
+					resetURLs = append(resetURLs, rootURL)
+					if rootURL == secondAgent {
+						return resetErr
+					}
+					return nil
+				}
+			})
+
+			It("deallocates the instance and leaves the node pending a reset", func() {
+				Expect(repo.Destroy("foo")).To(Succeed())
+
+				Expect(resetURLs).To(Equal([]string{firstAgent, secondAgent}))
+				Expect(repo.InstanceExists("foo")).To(BeFalse())
+				Expect(repo.PendingResetNodes()).To(Equal([]string{"10.0.0.2"}))
+				Expect(repo.Nodes()).To(ContainElement(redis.Node{
+					Host:   "10.0.0.2",
+					State:  redis.NodeResetPending,
+					Reason: "resetting the node: agent unreachable",
+				}))
+				Expect(newRepo().PendingResetNodes()).To(Equal([]string{"10.0.0.2"}))
+			})
+		})
+	})
+
+	Describe("#ForceDestroy", func() {
+		It("deallocates the instance without resetting its nodes", func() {
+			Expect(repo.Destroy("foo")).To(MatchError("agent unreachable"))
+			resetURLs = nil
+
+			Expect(repo.ForceDestroy("foo")).To(Succeed())
+
+			Expect(resetURLs).To(BeEmpty())
+			Expect(repo.InstanceExists("foo")).To(BeFalse())
+			Expect(repo.PendingResetNodes()).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Expect(repo.Nodes()).To(ContainElement(redis.Node{
+				Host:   "10.0.0.1",
+				State:  redis.NodeResetPending,
+				Reason: "the instance was deprovisioned by force",
+			}))
+		})
+
+		It("does not allocate the nodes until they are reset", func() {
+			Expect(repo.ForceDestroy("foo")).To(Succeed())
+
+			err := repo.Create("bar", config.RedisConfiguration.Plans[0], nil)
+			Expect(err).To(Equal(brokerapi.ErrInstanceLimitMet))
+		})
+
+		It("keeps the nodes pending a reset across restarts", func() {
+			Expect(repo.ForceDestroy("foo")).To(Succeed())
+
+			restarted := newRepo()
+			Expect(restarted.InstanceExists("foo")).To(BeFalse())
+			Expect(restarted.PendingResetNodes()).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+		})
+
+		It("fails for unknown instances", func() {
+			Expect(repo.ForceDestroy("bar")).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+		})
+	})
+
+	Describe("#ResetPendingNode", func() {
+		BeforeEach(func() {
+			Expect(repo.ForceDestroy("foo")).To(Succeed())
+		})
+
+		It("returns the node to the pool once its agent resets it", func() {
+			resetErr = nil
+
+			Expect(repo.ResetPendingNode("10.0.0.1")).To(Succeed())
+			Expect(resetURLs).To(Equal([]string{firstAgent}))
+			Expect(repo.PendingResetNodes()).To(Equal([]string{"10.0.0.2"}))
+			Expect(newRepo().PendingResetNodes()).To(Equal([]string{"10.0.0.2"}))
+		})
+
+		It("keeps the node pending with the latest error", func() {
+			Expect(repo.ResetPendingNode("10.0.0.1")).To(MatchError("agent unreachable"))
+			Expect(repo.Nodes()).To(ContainElement(redis.Node{
+				Host:   "10.0.0.1",
+				State:  redis.NodeResetPending,
+				Reason: "resetting the node: agent unreachable",
+			}))
+		})
+
+		It("leaves nodes that are not pending a reset alone", func() {
+			Expect(repo.ResetPendingNode("10.0.0.3")).To(Succeed())
+			Expect(resetURLs).To(BeEmpty())
+		})
+	})
+
+	Describe("ResetReconciler", func() {
+		var (
+			reconciler *redis.ResetReconciler
+			start      time.Time
+		)
+
+		BeforeEach(func() {
+			Expect(repo.ForceDestroy("foo")).To(Succeed())
+
+			reconciler = &redis.ResetReconciler{
+				Repo:          repo,
+				RetryInterval: 10 * time.Second,
+				MaxBackoff:    30 * time.Second,
+				Logger:        lagertest.NewTestLogger("reset-reconciler"),
+			}
+			start = time.Now()
+		})
+
+		It("returns the nodes to the pool once they are reset", func() {
+			resetErr = nil
+
+			Expect(reconciler.Reconcile(start)).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Expect(repo.PendingResetNodes()).To(BeEmpty())
+			Expect(repo.AvailableInstances()).To(HaveLen(3))
+		})
+
+		It("backs off after every failure up to the maximum", func() {
+			Expect(reconciler.Reconcile(start)).To(BeEmpty())
+			Expect(resetURLs).To(Equal([]string{firstAgent, secondAgent}))
+
+			resetURLs = nil
+			reconciler.Reconcile(start.Add(9 * time.Second))
+			Expect(resetURLs).To(BeEmpty())
+
+			reconciler.Reconcile(start.Add(10 * time.Second))
+			Expect(resetURLs).To(HaveLen(2))
+
+			resetURLs = nil
+			reconciler.Reconcile(start.Add(29 * time.Second))
+			Expect(resetURLs).To(BeEmpty())
+
+			reconciler.Reconcile(start.Add(30 * time.Second))
+			Expect(resetURLs).To(HaveLen(2))
+
+			resetURLs = nil
+			reconciler.Reconcile(start.Add(59 * time.Second))
+			Expect(resetURLs).To(BeEmpty())
+
+			reconciler.Reconcile(start.Add(60 * time.Second))
+			Expect(resetURLs).To(HaveLen(2))
+		})
+
+		It("returns the nodes to the pool when a retry succeeds", func() {
+			reconciler.Reconcile(start)
+
+			resetErr = nil
+			Expect(reconciler.Reconcile(start.Add(10 * time.Second))).To(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+			Expect(repo.PendingResetNodes()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"errors"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+)
+
+var ErrNoMatchingNode = errors.New("no free dedicated node has the requested labels")
+
+// ZoneLabel is the label of the availability zone of a node.
+const ZoneLabel = "zone"
+
+// Placement picks the free node that a new instance is allocated to.
+type Placement interface {
+	// Place returns one of the candidates, or nil when none of them suits
+	// the requested labels.
+	Place(candidates, allocated []*Instance, labels map[string]string) *Instance
+}
+
+// NewPlacement returns the configured strategy. Whichever it is, instances
+// only go to nodes with the labels requested for them.
+func NewPlacement(name string) Placement {
+	if name == brokerconfig.PlacementBalanceZones {
+		return LabelMatchingPlacement{Next: ZoneBalancedPlacement{}}
+	}
+	return LabelMatchingPlacement{Next: FIFOPlacement{}}
+}
+
+// FIFOPlacement allocates the nodes in the order of the pool.
+type FIFOPlacement struct{}
+
+func (FIFOPlacement) Place(candidates, allocated []*Instance, labels map[string]string) *Instance {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[0]
+}
+
+// ZoneBalancedPlacement picks a node in the zone that holds the fewest
+// instances, so that instances spread evenly over the zones. Nodes without a
+// zone count as one more zone.
+type ZoneBalancedPlacement struct{}
+
+func (ZoneBalancedPlacement) Place(candidates, allocated []*Instance, labels map[string]string) *Instance {
+	instancesPerZone := map[string]int{}
+	for _, instance := range allocated {
+		instancesPerZone[instance.Labels[ZoneLabel]]++
+	}
+
+	var chosen *Instance
+	for _, candidate := range candidates {
+		if chosen == nil || instancesPerZone[candidate.Labels[ZoneLabel]] < instancesPerZone[chosen.Labels[ZoneLabel]] {
+			chosen = candidate
+		}
+	}
+	return chosen
+}
+
+// LabelMatchingPlacement leaves out the nodes that lack one of the requested
+// labels and lets Next choose among the others.
+type LabelMatchingPlacement struct {
+	Next Placement
+}
+
+func (placement LabelMatchingPlacement) Place(candidates, allocated []*Instance, labels map[string]string) *Instance {
+	matching := []*Instance{}
+	for _, candidate := range candidates {
+		if hasLabels(candidate, labels) {
+			matching = append(matching, candidate)
+		}
+	}
+	return placement.Next.Place(matching, allocated, labels)
+}
+
+func hasLabels(instance *Instance, labels map[string]string) bool {
+	for name, value := range labels {
+		if instance.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPlacement replaces the placement strategy of the config.
+func (repo *RemoteRepository) SetPlacement(placement Placement) {
+	repo.Lock()
+	defer repo.Unlock()
+
+	repo.placement = placement
+}
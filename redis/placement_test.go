@@ -0,0 +1,138 @@
+package redis_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Placement", func() {
+	var (
+		z1a = &redis.Instance{Host: "10.0.1.1", Labels: map[string]string{"zone": "z1", "size": "large"}}
+		z1b = &redis.Instance{Host: "10.0.1.2", Labels: map[string]string{"zone": "z1"}}
+		z2a = &redis.Instance{Host: "10.0.2.1", Labels: map[string]string{"zone": "z2"}}
+	)
+
+	Describe("FIFOPlacement", func() {
+		It("picks the first candidate", func() {
+			placement := redis.FIFOPlacement{}
+			Expect(placement.Place([]*redis.Instance{z1a, z2a}, nil, nil)).To(Equal(z1a))
+			Expect(placement.Place(nil, nil, nil)).To(BeNil())
+		})
+	})
+
+	Describe("ZoneBalancedPlacement", func() {
+		It("picks a node in the zone with the fewest instances", func() {
+			placement := redis.ZoneBalancedPlacement{}
+			Expect(placement.Place([]*redis.Instance{z1b, z2a}, []*redis.Instance{z1a}, nil)).To(Equal(z2a))
+		})
+
+		It("keeps the order of the pool between zones with as many instances", func() {
+			placement := redis.ZoneBalancedPlacement{}
+			Expect(placement.Place([]*redis.Instance{z1a, z2a}, nil, nil)).To(Equal(z1a))
+		})
+	})
+
+	Describe("LabelMatchingPlacement", func() {
+		placement := redis.LabelMatchingPlacement{Next: redis.FIFOPlacement{}}
+
+		It("only picks nodes with every requested label", func() {
+			candidates := []*redis.Instance{z1b, z2a, z1a}
+			Expect(placement.Place(candidates, nil, map[string]string{"zone": "z2"})).To(Equal(z2a))
+			Expect(placement.Place(candidates, nil, map[string]string{"zone": "z1", "size": "large"})).To(Equal(z1a))
+		})
+
+		It("picks nothing when no node matches", func() {
+			Expect(placement.Place([]*redis.Instance{z1a, z1b}, nil, map[string]string{"zone": "z3"})).To(BeNil())
+		})
+	})
+
+	Describe("allocating dedicated nodes", func() {
+		var (
+			repo   *redis.RemoteRepository
+			tmpDir string
+			config brokerconfig.Config
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+			Expect(err).ToNot(HaveOccurred())
+
+			config = brokerconfig.Config{}
+			config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{
+				{Host: "10.0.1.1", Labels: map[string]string{"zone": "z1"}},
+				{Host: "10.0.1.2", Labels: map[string]string{"zone": "z1"}},
+				{Host: "10.0.2.1", Labels: map[string]string{"zone": "z2"}},
+			}
+			config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			repo, err = redis.NewRemoteRepository(&fakes.FakeAgentClient{}, config)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		It("allocates the nodes in order by default", func() {
+			Expect(repo.Create("foo", brokerconfig.Plan{}, nil)).To(Succeed())
+			Expect(repo.Create("bar", brokerconfig.Plan{}, nil)).To(Succeed())
+
+			Expect(repo.IDForHost("10.0.1.1")).To(Equal("foo"))
+			Expect(repo.IDForHost("10.0.1.2")).To(Equal("bar"))
+		})
+
+		It("lists the labels of the nodes", func() {
+			Expect(repo.Nodes()[2]).To(Equal(redis.Node{
+				Host:   "10.0.2.1",
+				State:  redis.NodeAvailable,
+				Labels: map[string]string{"zone": "z2"},
+			}))
+		})
+
+		It("allocates a node with the requested labels", func() {
+			err := repo.Create("dr", brokerconfig.Plan{}, map[string]string{"placement": "zone=z2"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.IDForHost("10.0.2.1")).To(Equal("dr"))
+		})
+
+		It("fails when no free node has the requested labels", func() {
+			err := repo.Create("dr", brokerconfig.Plan{}, map[string]string{"placement": "zone=z3"})
+			Expect(err).To(MatchError(redis.ErrNoMatchingNode))
+			Expect(repo.AvailableInstances()).To(HaveLen(3))
+		})
+
+		Context("when the instances are balanced across zones", func() {
+			BeforeEach(func() {
+				config.RedisConfiguration.Dedicated.Placement = brokerconfig.PlacementBalanceZones
+			})
+
+			It("spreads the instances over the zones", func() {
+				Expect(repo.Create("primary", brokerconfig.Plan{}, nil)).To(Succeed())
+				Expect(repo.Create("dr", brokerconfig.Plan{}, nil)).To(Succeed())
+
+				Expect(repo.IDForHost("10.0.1.1")).To(Equal("primary"))
+				Expect(repo.IDForHost("10.0.2.1")).To(Equal("dr"))
+			})
+
+			It("still honours the requested labels", func() {
+				Expect(repo.Create("primary", brokerconfig.Plan{}, map[string]string{"placement": "zone=z1"})).To(Succeed())
+				Expect(repo.Create("other", brokerconfig.Plan{}, map[string]string{"placement": "zone=z1"})).To(Succeed())
+
+				Expect(repo.IDForHost("10.0.1.2")).To(Equal("other"))
+			})
+		})
+	})
+})
@@ -69,7 +69,15 @@ func (controller *OSProcessController) StartAndWaitUntilReadyWithConfig(instance
 		return err
 	}
 
-	return controller.WaitUntilConnectableFunc(instance.Address(), timeout)
+	if err = controller.WaitUntilConnectableFunc(instance.Address(), timeout); err != nil {
+		return err
+	}
+
+	if tlsAddress := instance.TLSAddress(); tlsAddress != nil {
+		return controller.WaitUntilConnectableFunc(tlsAddress, timeout)
+	}
+
+	return nil
 }
 
 func (controller *OSProcessController) Kill(instance *Instance) error {
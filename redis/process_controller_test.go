@@ -52,10 +52,12 @@ var _ = Describe("Redis Process Controller", func() {
 	var fakeProcessKiller *fakeProcessKiller = &fakeProcessKiller{}
 	var commandRunner *system.FakeCommandRunner
 	var connectionTimeoutErr error
+	var checkedAddresses []*net.TCPAddr
 	var pidfilePath = "/dev/null"
 
 	BeforeEach(func() {
 		connectionTimeoutErr = nil
+		checkedAddresses = nil
 		instanceInformer = &fakeInstanceInformer{}
 		logger = lagertest.NewTestLogger("process-controller")
 		commandRunner = &system.FakeCommandRunner{}
@@ -68,7 +70,8 @@ var _ = Describe("Redis Process Controller", func() {
 			CommandRunner:    commandRunner,
 			ProcessChecker:   fakeProcessChecker,
 			ProcessKiller:    fakeProcessKiller,
-			WaitUntilConnectableFunc: func(*net.TCPAddr, time.Duration) error {
+			WaitUntilConnectableFunc: func(address *net.TCPAddr, timeout time.Duration) error {
+				checkedAddresses = append(checkedAddresses, address)
 				return connectionTimeoutErr
 			},
 		}
@@ -101,6 +104,13 @@ var _ = Describe("Redis Process Controller", func() {
 				Ω(err).To(Equal(connectionTimeoutErr))
 			})
 		})
+
+		It("also waits for the TLS port when the instance has one", func() {
+			tlsInstance := &redis.Instance{Host: "127.0.0.1", Port: 6379, TLSPort: 6380}
+			err := processController.StartAndWaitUntilReady(tlsInstance, "", "", pidfilePath, "", time.Second*1)
+			Ω(err).NotTo(HaveOccurred())
+			Ω(checkedAddresses).Should(Equal([]*net.TCPAddr{tlsInstance.Address(), tlsInstance.TLSAddress()}))
+		})
 	})
 
 	Describe("StartAndWaitUntilReadyWithConfig", func() {
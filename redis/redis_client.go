@@ -0,0 +1,22 @@
+package redis
+
+import (
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// ConnectToInstance connects to the redis of an instance, using the command
+// aliases from its config file.
+func ConnectToInstance(instance *Instance, configPath string) (client.Client, error) {
+	conf, err := redisconf.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Connect(
+		client.Host(instance.Host),
+		client.Port(instance.Port),
+		client.Password(instance.Password),
+		client.CmdAliases(conf.CommandAliases()),
+	)
+}
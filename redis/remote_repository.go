@@ -1,63 +1,107 @@
 package redis
 
 import (
-	"encoding/json"
 	"errors"
-	"io/ioutil"
-	"os"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/pborman/uuid/uuid"
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
 	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/cluster"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
 )
 
+// RemoteRepository allocates the dedicated nodes. The embedded lock guards
+// the state of the repository and is only held while the state changes,
+// never across agent calls. Operations on an instance hold the lock of the
+// instance while they call its agents instead, so that a slow node only
+// holds up its own instance. The fields of an allocated instance are written
+// holding both locks, so that either is enough to read them.
 type RemoteRepository struct {
 	availableInstances []*Instance
 	allocatedInstances []*Instance
-	instanceLimit      int
+	configNodes        []string
+	nodeLabels         map[string]map[string]string
+	addedNodes         []string
+	removedNodes       []string
+	unpooledNodes      []string
 	instanceBindings   map[string][]string
 	agentClient        AgentClient
-	statefilePath      string
+	store              StateStore
+	placement          Placement
+	plans              []brokerconfig.Plan
 	agentPort          string
+	metrics            Metrics
+	instanceLocks      map[string]*instanceLock
+	creating           map[string]string
+	closing            bool
+	idle               *sync.Cond
 	sync.RWMutex
 }
 
+type instanceLock struct {
+	sync.Mutex
+	holders int
+}
+
 type AgentClient interface {
 	Reset(hostIP string) error
 	Credentials(hostIP string) (Credentials, error)
+	ApplyConfig(hostIP string, params []redisconf.Param) error
+	ImportData(hostIP string, source importer.Source) error
+	CreateUser(hostIP, name string, scope acl.Scope) (Credentials, error)
+	DeleteUser(hostIP, name string) error
+	SetUser(hostIP, name, password string, scope acl.Scope) error
+	WaitForSync(hostIP string) error
+	MonitorSentinel(hostIP string, monitor sentinel.Monitor) (int, error)
+	SentinelMaster(hostIP, masterName string) (sentinel.Address, error)
+	ClusterNodeID(hostIP string) (string, error)
+	JoinCluster(hostIP string, join cluster.Join) error
+	WaitForCluster(hostIP string) error
+	RotatePassword(hostIP string, gracePeriod time.Duration) (Credentials, error)
+	KeyCount(hostIP string) (int, error)
 }
 
 func NewRemoteRepository(agentClient AgentClient, config brokerconfig.Config) (*RemoteRepository, error) {
+	dedicated := config.RedisConfiguration.Dedicated
+	store := NewFileStateStore(dedicated.StatefilePath, dedicated.Generations())
+
+	return NewRemoteRepositoryWithStore(agentClient, config, store)
+}
+
+// NewRemoteRepositoryWithStore is NewRemoteRepository with the state kept in
+// store rather than in the statefile.
+func NewRemoteRepositoryWithStore(agentClient AgentClient, config brokerconfig.Config, store StateStore) (*RemoteRepository, error) {
+	dedicated := config.RedisConfiguration.Dedicated
+
 	repo := RemoteRepository{
-		instanceLimit:    len(config.RedisConfiguration.Dedicated.Nodes),
+		configNodes:      dedicated.Hosts(),
+		nodeLabels:       map[string]map[string]string{},
 		instanceBindings: map[string][]string{},
-		statefilePath:    config.RedisConfiguration.Dedicated.StatefilePath,
+		instanceLocks:    map[string]*instanceLock{},
+		creating:         map[string]string{},
 		agentClient:      agentClient,
+		store:            store,
+		placement:        NewPlacement(dedicated.Placement),
+		plans:            config.RedisConfiguration.Plans,
 		agentPort:        config.AgentPort,
 	}
+	repo.idle = sync.NewCond(&repo.RWMutex)
+	for _, node := range dedicated.Nodes {
+		repo.nodeLabels[node.Host] = node.Labels
+	}
 
-	err := repo.loadStateFromFile()
+	err := repo.loadState()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, ip := range config.RedisConfiguration.Dedicated.Nodes {
-		available := true
-		for _, allocatedInstance := range repo.allocatedInstances {
-			if ip == allocatedInstance.Host {
-				available = false
-				break
-			}
-		}
-		if available {
-			instance := Instance{
-				Host: ip,
-			}
-			repo.availableInstances = append(repo.availableInstances, &instance)
-		}
-	}
-
 	err = repo.PersistStatefile()
 	if err != nil {
 		return nil, err
@@ -66,221 +110,626 @@ func NewRemoteRepository(agentClient AgentClient, config brokerconfig.Config) (*
 	return &repo, nil
 }
 
+// FindByID returns a copy of the instance, which other operations do not
+// change under the caller.
 func (repo *RemoteRepository) FindByID(instanceID string) (*Instance, error) {
-	for _, instance := range repo.allocatedInstances {
-		if instance.ID == instanceID {
-			return instance, nil
-		}
+	repo.RLock()
+	defer repo.RUnlock()
+
+	instance, err := repo.findByID(instanceID)
+	if err != nil {
+		return nil, err
 	}
-	return nil, brokerapi.ErrInstanceDoesNotExist
+	return instance.copy(), nil
 }
 
 func (repo *RemoteRepository) InstanceExists(instanceID string) (bool, error) {
-	_, err := repo.FindByID(instanceID)
+	repo.RLock()
+	defer repo.RUnlock()
+
+	_, err := repo.findByID(instanceID)
 	if err != nil {
 		return false, nil
 	}
 	return true, nil
 }
 
+// Destroy has the agents reset the nodes of the instance and returns them to
+// the pool. The instance is kept when its first node cannot be reset, as it
+// is untouched then. Once a node has been reset the instance is lost, so it
+// is deallocated anyway and the nodes that are left go back to the pool
+// pending a reset, which ResetPendingNode retries.
 func (repo *RemoteRepository) Destroy(instanceID string) error {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
+
+	repo.RLock()
+	instance, err := repo.findByID(instanceID)
+	repo.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	nodes := instance.Group()
+	reset := 0
+	for _, node := range nodes {
+		err = repo.agentClient.Reset(repo.agentURL(node))
+		if err != nil {
+			break
+		}
+		reset++
+	}
+	if err != nil && reset == 0 {
+		return err
+	}
+
+	reason := ""
+	if err != nil {
+		reason = fmt.Sprintf("resetting the node: %s", err)
+	}
+
 	repo.Lock()
 	defer repo.Unlock()
 
-	instance, err := repo.FindByID(instanceID)
+	return repo.deallocatePendingReset(instance, nodes[reset:], reason)
+}
+
+// AllInstances returns copies of the allocated instances.
+func (repo *RemoteRepository) AllInstances() ([]*Instance, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	instances := []*Instance{}
+	for _, instance := range repo.allocatedInstances {
+		instances = append(instances, instance.copy())
+	}
+	return instances, nil
+}
+
+func (repo *RemoteRepository) InstanceCount() (int, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	return len(repo.allocatedInstances), nil
+}
+
+// Create reserves the nodes of a new instance and sets them up without
+// holding the lock of the repository. The instance is only allocated, and
+// visible to the other operations, once its nodes are set up.
+func (repo *RemoteRepository) Create(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
+
+	repo.Lock()
+	labels, err := repo.admit(instanceID, plan, parameters)
+	if err == nil {
+		repo.creating[instanceID] = plan.ID
+	}
+	repo.Unlock()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := repo.healthyNodes(instanceID, labels, plan.NodeCount())
 	if err != nil {
+		repo.release(instanceID, nil)
 		return err
 	}
 
+	instance := nodes[0]
 	instance.ID = instanceID
+	instance.PlanID = plan.ID
+	instance.Parameters = parameters
+	if len(nodes) > 1 {
+		instance.Replicas = nodes[1:]
+	}
+	switch plan.Topology {
+	case brokerconfig.TopologySentinel:
+		instance.MasterName = instanceID
+		instance.SentinelPassword = uuid.NewRandom().String()
+	case brokerconfig.TopologyCluster:
+		instance.Shards = plan.Shards
+	}
+
+	// The nodes of a cluster get the overrides along with cluster mode.
+	overrides := confOverrides(plan, parameters)
+	if len(overrides) > 0 && instance.Shards == 0 {
+		err = repo.agentClient.ApplyConfig(repo.agentURL(instance), overrides)
+		if err != nil {
+			repo.release(instanceID, nil)
+			return err
+		}
+	}
 
-	instanceURL := "https://" + instance.Host + ":" + repo.agentPort
-	err = repo.agentClient.Reset(instanceURL)
+	if instance.Shards > 0 {
+		err = repo.startCluster(instance, overrides)
+	} else {
+		err = repo.startReplication(instance, overrides)
+	}
 	if err != nil {
+		repo.releaseGroup(instance)
 		return err
 	}
 
-	repo.deallocateInstance(instance)
+	if instance.MasterName != "" {
+		credentials, err := repo.agentClient.Credentials(repo.agentURL(instance))
+		var ports []int
+		if err == nil {
+			ports, err = repo.startSentinels(instance, instance, credentials)
+		}
+		if err != nil {
+			repo.releaseGroup(instance)
+			return err
+		}
+		for i, node := range instance.Group() {
+			node.SentinelPort = ports[i]
+		}
+	}
+
+	repo.Lock()
+	previousAvailable := repo.availableInstances
+	repo.allocateInstance(instance)
 
-	err = repo.PersistStatefile()
+	err = repo.persist(instanceID)
 	if err != nil {
-		repo.allocateInstance(instanceID)
+		repo.availableInstances = previousAvailable
+		repo.allocatedInstances = repo.allocatedInstances[:len(repo.allocatedInstances)-1]
+		delete(repo.instanceBindings, instanceID)
+		repo.creating[instanceID] = plan.ID
+	}
+	repo.Unlock()
+
+	// The nodes are set up by now, so they are reset before they go back to
+	// the pool.
+	if err != nil {
+		repo.releaseGroup(instance)
 		return err
 	}
 
 	return nil
 }
 
-func (repo *RemoteRepository) AllInstances() ([]*Instance, error) {
-	return repo.allocatedInstances, nil
-}
+// admit checks that the pool and the plan have room for a new instance, and
+// returns the placement labels of its parameters.
+func (repo *RemoteRepository) admit(instanceID string, plan brokerconfig.Plan, parameters map[string]string) (map[string]string, error) {
+	if len(repo.freeNodes()) < plan.NodeCount() {
+		return nil, brokerapi.ErrInstanceLimitMet
+	}
 
-func (repo *RemoteRepository) InstanceCount() (int, error) {
-	return len(repo.allocatedInstances), nil
+	if plan.InstanceLimit > 0 && repo.planInstanceCount(plan.ID) >= plan.InstanceLimit {
+		return nil, brokerapi.ErrInstanceLimitMet
+	}
+
+	if _, err := repo.findByID(instanceID); err == nil {
+		return nil, brokerapi.ErrInstanceAlreadyExists
+	}
+
+	return brokerconfig.PlacementLabels(parameters)
 }
 
-func (repo *RemoteRepository) Create(instanceID string) error {
-	repo.Lock()
-	defer repo.Unlock()
+func (repo *RemoteRepository) InstanceSettings(instanceID string) (broker.InstanceSettings, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	instance, err := repo.findByID(instanceID)
+	if err != nil {
+		return broker.InstanceSettings{}, err
+	}
+
+	return broker.InstanceSettings{
+		PlanID:     instance.PlanID,
+		Parameters: instance.Parameters,
+		Credentials: broker.InstanceCredentials{
+			Host:     instance.Host,
+			Port:     instance.Port,
+			Password: instance.Password,
+		},
+	}, nil
+}
 
-	if len(repo.availableInstances) <= 0 {
-		return brokerapi.ErrInstanceLimitMet
+// Update has the agents rewrite the redis.conf of the nodes of the instance
+// for a new plan or new parameters. The agents keep the data and the
+// password.
+func (repo *RemoteRepository) Update(instanceID string, plan brokerconfig.Plan, parameters map[string]string) error {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
+
+	repo.RLock()
+	instance, err := repo.findByID(instanceID)
+	if err == nil && plan.ID != instance.PlanID && plan.InstanceLimit > 0 && repo.planInstanceCount(plan.ID) >= plan.InstanceLimit {
+		err = brokerapi.ErrInstanceLimitMet
+	}
+	repo.RUnlock()
+	if err != nil {
+		return err
 	}
 
-	existingInstance, _ := repo.FindByID(instanceID)
-	if existingInstance != nil {
-		return brokerapi.ErrInstanceAlreadyExists
+	overrides := confOverrides(plan, parameters)
+	if instance.Shards > 0 {
+		err = repo.configureCluster(instance, overrides)
+	} else {
+		err = repo.configureGroup(instance, overrides)
+	}
+	if err != nil {
+		return err
 	}
 
-	instance := repo.allocateInstance(instanceID)
+	repo.Lock()
+	defer repo.Unlock()
+
+	previousPlanID, previousParameters := instance.PlanID, instance.Parameters
+	instance.PlanID = plan.ID
+	instance.Parameters = parameters
 
-	err := repo.PersistStatefile()
+	err = repo.persist()
 	if err != nil {
-		repo.deallocateInstance(instance)
+		instance.PlanID = previousPlanID
+		instance.Parameters = previousParameters
 		return err
 	}
 
 	return nil
 }
 
-func (repo *RemoteRepository) Bind(instanceID string, bindingID string) (broker.InstanceCredentials, error) {
-	repo.Lock()
-	defer repo.Unlock()
+// RotatePassword has the agent set a new password for the node of the
+// instance. The data is kept. Replicas are given the new password of their
+// master, and so are the sentinels watching it.
+func (repo *RemoteRepository) RotatePassword(instanceID string, gracePeriod time.Duration) (broker.InstanceCredentials, error) {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
 
-	instance, err := repo.FindByID(instanceID)
+	repo.RLock()
+	instance, err := repo.findByID(instanceID)
+	repo.RUnlock()
 	if err != nil {
 		return broker.InstanceCredentials{}, err
 	}
 
-	bindings, _ := repo.instanceBindings[instanceID]
-	for _, binding := range bindings {
-		if binding == bindingID {
-			return broker.InstanceCredentials{}, brokerapi.ErrBindingAlreadyExists
-		}
+	master, err := repo.master(instance)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
 	}
 
-	instanceURL := "https://" + instance.Host + ":" + repo.agentPort
-	credentials, err := repo.agentClient.Credentials(instanceURL)
+	credentials, err := repo.agentClient.RotatePassword(repo.agentURL(master), gracePeriod)
 	if err != nil {
 		return broker.InstanceCredentials{}, err
 	}
 
-	instance.Port = credentials.Port
+	// The master has the new password even if its followers fail to take
+	// it.
+	repo.Lock()
+	master.Port = credentials.Port
 	instance.Password = credentials.Password
+	repo.Unlock()
 
-	repo.instanceBindings[instanceID] = append(repo.instanceBindings[instanceID], bindingID)
+	overrides := confOverrides(repo.plan(instance.PlanID), instance.Parameters)
+	if instance.Shards > 0 {
+		err = repo.configureCluster(instance, overrides)
+	} else {
+		err = repo.configureReplicas(instance, master, credentials, overrides)
+	}
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
 
-	err = repo.PersistStatefile()
+	var ports []int
+	if instance.MasterName != "" {
+		ports, err = repo.startSentinels(instance, master, credentials)
+		if err != nil {
+			return broker.InstanceCredentials{}, err
+		}
+	}
+
+	repo.Lock()
+	defer repo.Unlock()
+
+	for i, port := range ports {
+		instance.Group()[i].SentinelPort = port
+	}
+
+	err = repo.persist()
 	if err != nil {
-		repo.removeBinding(instanceID, bindingID)
 		return broker.InstanceCredentials{}, err
 	}
 
 	return broker.InstanceCredentials{
-		Host:     instance.Host,
-		Port:     instance.Port,
+		Host:     master.Host,
+		Port:     master.Port,
 		Password: instance.Password,
 	}, nil
 }
 
-func (repo *RemoteRepository) Unbind(instanceID string, bindingID string) error {
-	repo.Lock()
-	defer repo.Unlock()
+// ImportData has the agent copy the data of the source into the node of the
+// instance, replacing whatever the node holds.
+func (repo *RemoteRepository) ImportData(instanceID string, source broker.InstanceCredentials) error {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
 
-	if _, err := repo.FindByID(instanceID); err != nil {
+	repo.RLock()
+	instance, err := repo.findByID(instanceID)
+	repo.RUnlock()
+	if err != nil {
 		return err
 	}
 
-	bindings, _ := repo.instanceBindings[instanceID]
+	return repo.agentClient.ImportData(repo.agentURL(instance), importer.Source{
+		Host:     source.Host,
+		Port:     source.Port,
+		Password: source.Password,
+	})
+}
 
-	for _, binding := range bindings {
+// Bind creates a redis user for the binding. Nodes running a redis without
+// ACL support fall back to the password of the instance, which only works
+// for bindings without a scope. The replicas of the instance get the same
+// user. Bindings of sentinel instances also list the sentinels, which know
+// the master after a failover, and get the password of the sentinels, which
+// does not work on the nodes.
+func (repo *RemoteRepository) Bind(instanceID string, bindingID string, scope acl.Scope) (broker.InstanceCredentials, error) {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
+
+	repo.RLock()
+	instance, err := repo.findByID(instanceID)
+	bound := err == nil && contains(repo.instanceBindings[instanceID], bindingID)
+	repo.RUnlock()
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+	if bound {
+		return broker.InstanceCredentials{}, brokerapi.ErrBindingAlreadyExists
+	}
 
-		if binding == bindingID {
-			err := repo.removeBinding(instanceID, bindingID)
-			if err != nil {
-				return err
-			}
+	master, err := repo.master(instance)
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
 
-			err = repo.PersistStatefile()
+	credentials, err := repo.agentClient.CreateUser(repo.agentURL(master), bindingID, scope)
+	if err == acl.ErrNotSupported && !scope.IsRestricted() {
+		credentials, err = repo.agentClient.Credentials(repo.agentURL(master))
+	}
+	if err != nil {
+		return broker.InstanceCredentials{}, err
+	}
+
+	if credentials.Username != "" {
+		for _, replica := range followers(instance, master) {
+			err = repo.agentClient.SetUser(repo.agentURL(replica), bindingID, credentials.Password, scope)
 			if err != nil {
-				repo.instanceBindings[instanceID] = append(repo.instanceBindings[instanceID], bindingID)
-				return err
+				repo.deleteUser(instance, bindingID)
+				return broker.InstanceCredentials{}, err
 			}
-
-			return nil
 		}
+	}
+
+	repo.Lock()
+	defer repo.Unlock()
+
+	master.Port = credentials.Port
+	if credentials.Username == "" {
+		instance.Password = credentials.Password
+	}
+
+	repo.instanceBindings[instanceID] = append(repo.instanceBindings[instanceID], bindingID)
+
+	err = repo.persist(instanceID)
+	if err != nil {
+		repo.removeBinding(instanceID, bindingID)
+		return broker.InstanceCredentials{}, err
+	}
+
+	return broker.InstanceCredentials{
+		Host:         master.Host,
+		Port:         credentials.Port,
+		Username:     credentials.Username,
+		Password:     credentials.Password,
+		TLSPort:      credentials.TLSPort,
+		CACert:       credentials.CACert,
+		RedisVersion: credentials.RedisVersion,
+		Replicas:     replicaCredentials(instance, master),
+		Sentinels:    sentinelCredentials(instance),
+		MasterName:   instance.MasterName,
+		ClusterNodes: clusterCredentials(instance),
+
+		SentinelPassword: instance.SentinelPassword,
+	}, nil
+}
+
+// Unbind deletes the redis user of the binding from every node of the
+// instance, which also disconnects its clients.
+func (repo *RemoteRepository) Unbind(instanceID string, bindingID string) error {
+	unlock := repo.lockInstance(instanceID)
+	defer unlock()
+
+	repo.RLock()
+	instance, err := repo.findByID(instanceID)
+	bound := err == nil && contains(repo.instanceBindings[instanceID], bindingID)
+	repo.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return brokerapi.ErrBindingDoesNotExist
+	}
+
+	err = repo.deleteUser(instance, bindingID)
+	if err != nil {
+		return err
+	}
+
+	repo.Lock()
+	defer repo.Unlock()
+
+	err = repo.removeBinding(instanceID, bindingID)
+	if err != nil {
+		return err
+	}
 
+	err = repo.persist(instanceID)
+	if err != nil {
+		repo.instanceBindings[instanceID] = append(repo.instanceBindings[instanceID], bindingID)
+		return err
 	}
 
-	return brokerapi.ErrBindingDoesNotExist
+	return nil
 }
 
+// InstanceLimit is how many instances the pool can hold: the allocated
+// instances, those being created and the free nodes that are neither draining
+// nor quarantined.
 func (repo *RemoteRepository) InstanceLimit() int {
-	return repo.instanceLimit
+	repo.RLock()
+	defer repo.RUnlock()
+
+	return len(repo.allocatedInstances) + len(repo.creating) + len(repo.freeNodes())
 }
 
+// AvailableInstances are copies of the free nodes that can be allocated.
 func (repo *RemoteRepository) AvailableInstances() []*Instance {
-	return repo.availableInstances
+	repo.RLock()
+	defer repo.RUnlock()
+
+	nodes := []*Instance{}
+	for _, node := range repo.freeNodes() {
+		nodes = append(nodes, node.copy())
+	}
+	return nodes
 }
 
 func (repo *RemoteRepository) BindingsForInstance(instanceID string) ([]string, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
 	bindings, ok := repo.instanceBindings[instanceID]
 	if !ok {
 		return nil, brokerapi.ErrInstanceDoesNotExist
 	}
 
-	return bindings, nil
+	return append([]string{}, bindings...), nil
 }
 
-type Statefile struct {
-	AvailableInstances []*Instance         `json:"available_instances"`
-	AllocatedInstances []*Instance         `json:"allocated_instances"`
-	InstanceBindings   map[string][]string `json:"instance_bindings"`
+// PersistStatefile saves the nodes and the bindings of every instance.
+func (repo *RemoteRepository) PersistStatefile() error {
+	repo.Lock()
+	defer repo.Unlock()
+
+	return repo.persistAll()
 }
 
-func (repo *RemoteRepository) PersistStatefile() error {
-	statefileContents := Statefile{
+func (repo *RemoteRepository) persistAll() error {
+	allocatedIDs := make([]string, 0, len(repo.allocatedInstances))
+	for _, instance := range repo.allocatedInstances {
+		allocatedIDs = append(allocatedIDs, instance.ID)
+	}
+
+	return repo.persist(allocatedIDs...)
+}
+
+// persist saves the nodes and the bindings of the given instances, removing
+// the bindings of those that are no longer allocated.
+func (repo *RemoteRepository) persist(instanceIDs ...string) error {
+	update := StateUpdate{
 		AvailableInstances: repo.availableInstances,
 		AllocatedInstances: repo.allocatedInstances,
-		InstanceBindings:   repo.instanceBindings,
+		AddedNodes:         repo.addedNodes,
+		RemovedNodes:       repo.removedNodes,
+		Bindings:           map[string][]string{},
+	}
+	for _, instanceID := range instanceIDs {
+		bindings, ok := repo.instanceBindings[instanceID]
+		if ok && bindings == nil {
+			bindings = []string{}
+		}
+		update.Bindings[instanceID] = bindings
 	}
 
-	stateBytes, err := json.Marshal(&statefileContents)
-	if err != nil {
-		return err
+	err := repo.store.Save(update)
+	if err != nil && repo.metrics != nil {
+		repo.metrics.StatefileWriteFailed()
 	}
+	return err
+}
 
-	return ioutil.WriteFile(repo.statefilePath, stateBytes, 0644)
+// Close waits for the operations in progress and writes the statefile one
+// last time. The repository stays locked afterwards, so that nothing changes
+// the state while the broker exits.
+func (repo *RemoteRepository) Close() error {
+	repo.Lock()
+	repo.closing = true
+	for len(repo.instanceLocks) > 0 {
+		repo.idle.Wait()
+	}
+	return repo.persistAll()
 }
 
 func (repo *RemoteRepository) IDForHost(host string) string {
+	repo.RLock()
+	defer repo.RUnlock()
+
 	for _, instance := range repo.allocatedInstances {
-		if instance.Host == host {
-			return instance.ID
+		for _, node := range instance.Group() {
+			if node.Host == host {
+				return instance.ID
+			}
 		}
 	}
 	return ""
 }
 
-func (repo *RemoteRepository) loadStateFromFile() error {
-	statefileContents := Statefile{}
-
-	if _, err := os.Stat(repo.statefilePath); os.IsNotExist(err) {
-		return nil
+// StatefileRecovery describes why the state was loaded from an older
+// generation of the statefile, or is nil when the statefile was intact.
+func (repo *RemoteRepository) StatefileRecovery() error {
+	if recoverable, ok := repo.store.(interface {
+		Recovery() error
+	}); ok {
+		return recoverable.Recovery()
 	}
+	return nil
+}
 
-	stateBytes, err := ioutil.ReadFile(repo.statefilePath)
+func (repo *RemoteRepository) loadState() error {
+	state, err := repo.store.Load()
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(stateBytes, &statefileContents)
-	if err != nil {
-		return err
+	repo.allocatedInstances = state.AllocatedInstances
+	for _, node := range repo.allocatedNodes() {
+		node.Labels = repo.nodeLabels[node.Host]
+	}
+	repo.addedNodes = state.AddedNodes
+	repo.removedNodes = state.RemovedNodes
+	for instanceID, bindings := range state.InstanceBindings {
+		repo.instanceBindings[instanceID] = bindings
+	}
+
+	saved := map[string]*Instance{}
+	for _, instance := range state.AvailableInstances {
+		saved[instance.Host] = instance
+	}
+
+	pool := repo.poolHosts()
+	for _, host := range pool {
+		if repo.allocatedInstance(host) != nil {
+			continue
+		}
+
+		instance := &Instance{Host: host, Labels: repo.nodeLabels[host]}
+		if previous, ok := saved[host]; ok {
+			instance.Draining = previous.Draining
+			instance.Quarantined = previous.Quarantined
+			instance.PendingReset = previous.PendingReset
+		}
+		repo.availableInstances = append(repo.availableInstances, instance)
 	}
 
-	repo.allocatedInstances = statefileContents.AllocatedInstances
-	repo.instanceBindings = statefileContents.InstanceBindings
+	for _, node := range repo.allocatedNodes() {
+		if !contains(pool, node.Host) {
+			node.Draining = true
+			repo.unpooledNodes = append(repo.unpooledNodes, node.Host)
+		}
+	}
 
 	return nil
 }
@@ -288,7 +737,7 @@ func (repo *RemoteRepository) loadStateFromFile() error {
 func (repo *RemoteRepository) removeBinding(instanceID, bindingID string) error {
 	var newInstanceBindings []string
 
-	_, err := repo.FindByID(instanceID)
+	_, err := repo.findByID(instanceID)
 	if err != nil {
 		return err
 	}
@@ -312,17 +761,64 @@ func (repo *RemoteRepository) removeBinding(instanceID, bindingID string) error
 	return nil
 }
 
-func (repo *RemoteRepository) allocateInstance(instanceID string) *Instance {
+// AgentURLs lists the agents of every dedicated node, allocated or not.
+func (repo *RemoteRepository) AgentURLs() []string {
+	repo.RLock()
+	defer repo.RUnlock()
 
-	instance := repo.availableInstances[0]
-	repo.availableInstances = repo.availableInstances[1:]
+	urls := []string{}
+	for _, instance := range repo.allocatedNodes() {
+		urls = append(urls, repo.agentURL(instance))
+	}
+	for _, instance := range repo.availableInstances {
+		urls = append(urls, repo.agentURL(instance))
+	}
+	return urls
+}
 
-	instance.ID = instanceID
-	repo.allocatedInstances = append(repo.allocatedInstances, instance)
+func (repo *RemoteRepository) agentURL(instance *Instance) string {
+	return "https://" + instance.Host + ":" + repo.agentPort
+}
 
-	repo.instanceBindings[instanceID] = []string{}
+// planInstanceCount counts the instances of the plan, including those being
+// created.
+func (repo *RemoteRepository) planInstanceCount(planID string) int {
+	count := 0
+	for _, instance := range repo.allocatedInstances {
+		if instance.PlanID == planID {
+			count++
+		}
+	}
+	for _, creatingPlanID := range repo.creating {
+		if creatingPlanID == planID {
+			count++
+		}
+	}
+	return count
+}
+
+// allocateInstance allocates a new instance, whose nodes take the place of
+// the free nodes reserved for it.
+func (repo *RemoteRepository) allocateInstance(instance *Instance) {
+	group := instance.Group()
+	availableInstances := []*Instance{}
+	for _, available := range repo.availableInstances {
+		if available.reservedFor != instance.ID {
+			availableInstances = append(availableInstances, available)
+			continue
+		}
+		// The node may have been drained while the instance was created.
+		for _, node := range group {
+			if node.Host == available.Host {
+				node.Draining = available.Draining
+			}
+		}
+	}
+	repo.availableInstances = availableInstances
 
-	return instance
+	repo.allocatedInstances = append(repo.allocatedInstances, instance)
+	repo.instanceBindings[instance.ID] = []string{}
+	delete(repo.creating, instance.ID)
 }
 
 func (repo *RemoteRepository) deallocateInstance(instance *Instance) {
@@ -335,7 +831,54 @@ func (repo *RemoteRepository) deallocateInstance(instance *Instance) {
 
 	repo.allocatedInstances = nowAllocatedInstances
 
-	repo.availableInstances = append([]*Instance{instance}, repo.availableInstances...)
+	// The nodes are freed as new structs, which leaves the instance as it
+	// was for a rollback.
+	freed := []*Instance{}
+	for _, node := range instance.Group() {
+		freed = append(freed, node.freed())
+	}
+	repo.availableInstances = append(freed, repo.availableInstances...)
 
 	delete(repo.instanceBindings, instance.ID)
 }
+
+func (repo *RemoteRepository) findByID(instanceID string) (*Instance, error) {
+	for _, instance := range repo.allocatedInstances {
+		if instance.ID == instanceID {
+			return instance, nil
+		}
+	}
+	return nil, brokerapi.ErrInstanceDoesNotExist
+}
+
+// lockInstance waits for the operation in progress on the instance, if any,
+// and returns the function that ends the operation started instead. The lock
+// of the repository is not held while waiting.
+func (repo *RemoteRepository) lockInstance(instanceID string) func() {
+	repo.Lock()
+	// Once closed, the repository takes no more operations.
+	for repo.closing {
+		repo.idle.Wait()
+	}
+	lock, ok := repo.instanceLocks[instanceID]
+	if !ok {
+		lock = &instanceLock{}
+		repo.instanceLocks[instanceID] = lock
+	}
+	lock.holders++
+	repo.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		repo.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(repo.instanceLocks, instanceID)
+		}
+		repo.idle.Broadcast()
+		repo.Unlock()
+	}
+}
@@ -2,14 +2,21 @@ package redis_test
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
+	"time"
 
 	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
 	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/importer"
 	"github.com/pivotal-cf/cf-redis-broker/redis"
 	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -26,7 +33,7 @@ var _ = Describe("RemoteRepository", func() {
 
 	BeforeEach(func() {
 		config = brokerconfig.Config{}
-		config.RedisConfiguration.Dedicated.Nodes = []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"}}
 		config.RedisConfiguration.Dedicated.Port = 6379
 		config.AgentPort = "1234"
 
@@ -41,6 +48,9 @@ var _ = Describe("RemoteRepository", func() {
 				Password: "password",
 			}, nil
 		}
+		fakeAgentClient.CreateUserFunc = func(rootURL, name string) (redis.Credentials, error) {
+			return redis.Credentials{}, acl.ErrNotSupported
+		}
 
 		statefilePath = path.Join(tmpDir, "statefile.json")
 		config.RedisConfiguration.Dedicated.StatefilePath = statefilePath
@@ -87,7 +97,7 @@ var _ = Describe("RemoteRepository", func() {
 				})
 
 				It("adds new nodes from config", func() {
-					nodes := append(config.RedisConfiguration.Dedicated.Nodes, "10.0.0.4")
+					nodes := append(config.RedisConfiguration.Dedicated.Nodes, brokerconfig.DedicatedNode{Host: "10.0.0.4"})
 					config.RedisConfiguration.Dedicated.Nodes = nodes
 
 					repo, err := redis.NewRemoteRepository(fakeAgentClient, config)
@@ -99,7 +109,7 @@ var _ = Describe("RemoteRepository", func() {
 				})
 
 				It("saves the statefile", func() {
-					nodes := append(config.RedisConfiguration.Dedicated.Nodes, "10.0.0.4")
+					nodes := append(config.RedisConfiguration.Dedicated.Nodes, brokerconfig.DedicatedNode{Host: "10.0.0.4"})
 					config.RedisConfiguration.Dedicated.Nodes = nodes
 
 					_, err := redis.NewRemoteRepository(fakeAgentClient, config)
@@ -139,6 +149,42 @@ var _ = Describe("RemoteRepository", func() {
 					Expect(err).To(HaveOccurred())
 				})
 			})
+
+			Context("When the state file is corrupt but an older generation is intact", func() {
+				BeforeEach(func() {
+					repo, err := redis.NewRemoteRepository(fakeAgentClient, config)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(repo.StatefileRecovery()).To(BeNil())
+
+					err = repo.Create("foo", brokerconfig.Plan{}, nil)
+					Expect(err).ToNot(HaveOccurred())
+					err = repo.Create("bar", brokerconfig.Plan{}, nil)
+					Expect(err).ToNot(HaveOccurred())
+
+					err = ioutil.WriteFile(statefilePath, []byte(`{"available_instances": [`), 0644)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("loads the state from the newest intact generation", func() {
+					repo, err := redis.NewRemoteRepository(fakeAgentClient, config)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(repo.StatefileRecovery()).To(MatchError(ContainSubstring(statefilePath + ".1")))
+
+					allocatedInstances, err := repo.AllInstances()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(allocatedInstances).To(HaveLen(2))
+					Expect(repo.IDForHost("10.0.0.1")).To(Equal("foo"))
+				})
+
+				It("replaces the corrupt state file", func() {
+					_, err := redis.NewRemoteRepository(fakeAgentClient, config)
+					Expect(err).ToNot(HaveOccurred())
+
+					state := getStatefileContents(statefilePath)
+					Expect(state.AllocatedInstances).To(HaveLen(2))
+				})
+			})
 		})
 	})
 
@@ -177,7 +223,7 @@ var _ = Describe("RemoteRepository", func() {
 
 	Context("When one node is allocated", func() {
 		BeforeEach(func() {
-			err := repo.Create("foo")
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -196,7 +242,7 @@ var _ = Describe("RemoteRepository", func() {
 			})
 
 			It("returns the instance information", func() {
-				instanceCredentials, err := repo.Bind("foo", "foo-binding")
+				instanceCredentials, err := repo.Bind("foo", "foo-binding", acl.Scope{})
 				Expect(err).ToNot(HaveOccurred())
 				Expect(instanceCredentials.Host).To(Equal("10.0.0.1"))
 				Expect(instanceCredentials.Port).To(Equal(123456))
@@ -204,7 +250,7 @@ var _ = Describe("RemoteRepository", func() {
 			})
 
 			It("writes the new state to the statefile", func() {
-				_, err := repo.Bind("foo", "foo-binding")
+				_, err := repo.Bind("foo", "foo-binding", acl.Scope{})
 				Expect(err).ToNot(HaveOccurred())
 
 				statefileContents := getStatefileContents(statefilePath)
@@ -212,6 +258,53 @@ var _ = Describe("RemoteRepository", func() {
 				Expect(statefileContents.InstanceBindings["foo"][0]).To(Equal("foo-binding"))
 			})
 
+			It("rejects scoped bindings when the node does not support users", func() {
+				_, err := repo.Bind("foo", "foo-binding", acl.Scope{ReadOnly: true})
+				Expect(err).To(Equal(acl.ErrNotSupported))
+
+				bindings, err := repo.BindingsForInstance("foo")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bindings).To(BeEmpty())
+			})
+
+			Context("when the node supports users", func() {
+				BeforeEach(func() {
+					fakeAgentClient.CreateUserFunc = func(rootURL, name string) (redis.Credentials, error) {
+						Expect(rootURL).To(Equal("https://10.0.0.1:1234"))
+						return redis.Credentials{
+							Port:         123456,
+							TLSPort:      123457,
+							CACert:       "a-ca-cert",
+							RedisVersion: "6.0.5",
+							Username:     name,
+							Password:     "user-secret",
+						}, nil
+					}
+				})
+
+				It("creates a user with the scope of the binding", func() {
+					_, err := repo.Bind("foo", "foo-binding", acl.Scope{KeyPrefix: "app:"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(fakeAgentClient.CreatedUsers).To(Equal(map[string]acl.Scope{
+						"foo-binding": {KeyPrefix: "app:"},
+					}))
+				})
+
+				It("returns the credentials of the user", func() {
+					instanceCredentials, err := repo.Bind("foo", "foo-binding", acl.Scope{})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(instanceCredentials).To(Equal(broker.InstanceCredentials{
+						Host:         "10.0.0.1",
+						Port:         123456,
+						Username:     "foo-binding",
+						Password:     "user-secret",
+						TLSPort:      123457,
+						CACert:       "a-ca-cert",
+						RedisVersion: "6.0.5",
+					}))
+				})
+			})
+
 			Context("when it cannot persist the state to the state file", func() {
 				BeforeEach(func() {
 					os.Remove(statefilePath)
@@ -223,7 +316,7 @@ var _ = Describe("RemoteRepository", func() {
 				})
 
 				It("does not bind", func() {
-					_, err := repo.Bind("foo", "bar-binding")
+					_, err := repo.Bind("foo", "bar-binding", acl.Scope{})
 					Expect(err).To(HaveOccurred())
 
 					bindings, err := repo.BindingsForInstance("foo")
@@ -237,7 +330,7 @@ var _ = Describe("RemoteRepository", func() {
 		Describe("#Unbind", func() {
 			Context("when the binding exists", func() {
 				BeforeEach(func() {
-					_, err := repo.Bind("foo", "foo-binding")
+					_, err := repo.Bind("foo", "foo-binding", acl.Scope{})
 					Expect(err).ToNot(HaveOccurred())
 				})
 
@@ -253,6 +346,27 @@ var _ = Describe("RemoteRepository", func() {
 					Expect(state.InstanceBindings["foo"]).To(BeEmpty())
 				})
 
+				It("deletes the user of the binding", func() {
+					err := repo.Unbind("foo", "foo-binding")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(fakeAgentClient.DeletedUsers).To(Equal([]string{"foo-binding"}))
+				})
+
+				Context("when the user cannot be deleted", func() {
+					BeforeEach(func() {
+						fakeAgentClient.DeleteUserErr = errors.New("agent unavailable")
+					})
+
+					It("keeps the binding", func() {
+						err := repo.Unbind("foo", "foo-binding")
+						Expect(err).To(MatchError("agent unavailable"))
+
+						bindings, err := repo.BindingsForInstance("foo")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(bindings).To(Equal([]string{"foo-binding"}))
+					})
+				})
+
 				Context("Concurrency", func() {
 					It("prevents simultaneous edits", func() {
 						chan1 := make(chan struct{})
@@ -328,7 +442,7 @@ var _ = Describe("RemoteRepository", func() {
 
 		Describe("#Create", func() {
 			It("allocates the next available node", func() {
-				err := repo.Create("bar")
+				err := repo.Create("bar", brokerconfig.Plan{}, nil)
 				Expect(err).ToNot(HaveOccurred())
 
 				hosts := []string{}
@@ -343,7 +457,7 @@ var _ = Describe("RemoteRepository", func() {
 			})
 
 			It("writes the new state to the statefile", func() {
-				err := repo.Create("bar")
+				err := repo.Create("bar", brokerconfig.Plan{}, nil)
 				Expect(err).ToNot(HaveOccurred())
 
 				statefileContents := getStatefileContents(statefilePath)
@@ -362,7 +476,7 @@ var _ = Describe("RemoteRepository", func() {
 				})
 
 				It("does not allocate an instance", func() {
-					err := repo.Create("bar")
+					err := repo.Create("bar", brokerconfig.Plan{}, nil)
 					Expect(err).To(HaveOccurred())
 
 					_, err = repo.FindByID("bar")
@@ -372,7 +486,7 @@ var _ = Describe("RemoteRepository", func() {
 
 			Context("when the instanceID is already allocated", func() {
 				It("returns brokerapi.ErrInstanceAlreadyExists", func() {
-					err := repo.Create("foo")
+					err := repo.Create("foo", brokerconfig.Plan{}, nil)
 					Expect(err).To(HaveOccurred())
 					Expect(err).To(Equal(brokerapi.ErrInstanceAlreadyExists))
 				})
@@ -380,16 +494,81 @@ var _ = Describe("RemoteRepository", func() {
 
 			Context("when instance capacity has been reached", func() {
 				BeforeEach(func() {
-					repo.Create("bar")
-					repo.Create("baz")
+					repo.Create("bar", brokerconfig.Plan{}, nil)
+					repo.Create("baz", brokerconfig.Plan{}, nil)
 				})
 
 				It("returns brokerapi.ErrInstanceLimitMet", func() {
-					err := repo.Create("another")
+					err := repo.Create("another", brokerconfig.Plan{}, nil)
 					Expect(err).To(HaveOccurred())
 					Expect(err).To(Equal(brokerapi.ErrInstanceLimitMet))
 				})
 			})
+
+			Context("when the plan has an instance limit", func() {
+				var plan brokerconfig.Plan
+
+				BeforeEach(func() {
+					plan = brokerconfig.Plan{ID: "limited-plan", InstanceLimit: 1}
+				})
+
+				It("records the plan on the allocated instance", func() {
+					err := repo.Create("bar", plan, nil)
+					Expect(err).ToNot(HaveOccurred())
+
+					instance, err := repo.FindByID("bar")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(instance.PlanID).To(Equal("limited-plan"))
+				})
+
+				It("returns brokerapi.ErrInstanceLimitMet once the plan limit is reached", func() {
+					err := repo.Create("bar", plan, nil)
+					Expect(err).ToNot(HaveOccurred())
+
+					err = repo.Create("baz", plan, nil)
+					Expect(err).To(Equal(brokerapi.ErrInstanceLimitMet))
+				})
+			})
+
+			Context("when the instance has redis settings", func() {
+				var plan brokerconfig.Plan
+
+				BeforeEach(func() {
+					plan = brokerconfig.Plan{ID: "tuned-plan", MaxMemory: "1gb"}
+				})
+
+				It("applies them through the agent", func() {
+					err := repo.Create("bar", plan, map[string]string{"maxmemory-policy": "noeviction"})
+					Expect(err).ToNot(HaveOccurred())
+
+					instance, err := repo.FindByID("bar")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(instance.Parameters).To(Equal(map[string]string{"maxmemory-policy": "noeviction"}))
+
+					Expect(fakeAgentClient.AppliedConfigs).To(Equal(map[string][]redisconf.Param{
+						"https://" + instance.Host + ":1234": {
+							{Key: "maxmemory", Value: "1gb"},
+							{Key: "maxmemory-policy", Value: "noeviction"},
+						},
+					}))
+				})
+
+				It("does not allocate the instance when the agent fails", func() {
+					fakeAgentClient.ApplyConfigError = errors.New("agent unavailable")
+
+					err := repo.Create("bar", plan, nil)
+					Expect(err).To(MatchError("agent unavailable"))
+
+					exists, _ := repo.InstanceExists("bar")
+					Expect(exists).To(BeFalse())
+				})
+			})
+
+			It("does not call the agent when there is nothing to configure", func() {
+				err := repo.Create("bar", brokerconfig.Plan{}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeAgentClient.AppliedConfigs).To(BeEmpty())
+			})
 		})
 
 		Describe("FindByID", func() {
@@ -433,6 +612,120 @@ var _ = Describe("RemoteRepository", func() {
 			})
 		})
 
+		Describe("#Update", func() {
+			var plan brokerconfig.Plan
+
+			BeforeEach(func() {
+				plan = brokerconfig.Plan{ID: "tuned-plan", MaxMemory: "1gb"}
+			})
+
+			It("applies the new settings through the agent", func() {
+				err := repo.Update("foo", plan, map[string]string{"maxmemory-policy": "noeviction"})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(fakeAgentClient.AppliedConfigs).To(Equal(map[string][]redisconf.Param{
+					"https://10.0.0.1:1234": {
+						{Key: "maxmemory", Value: "1gb"},
+						{Key: "maxmemory-policy", Value: "noeviction"},
+					},
+				}))
+			})
+
+			It("records the new plan and parameters in the state file", func() {
+				err := repo.Update("foo", plan, map[string]string{"maxmemory-policy": "noeviction"})
+				Expect(err).ToNot(HaveOccurred())
+
+				settings, err := repo.InstanceSettings("foo")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(settings.PlanID).To(Equal("tuned-plan"))
+				Expect(settings.Parameters).To(Equal(map[string]string{"maxmemory-policy": "noeviction"}))
+
+				statefileContents := getStatefileContents(statefilePath)
+				Expect(statefileContents.AllocatedInstances[0].PlanID).To(Equal("tuned-plan"))
+			})
+
+			Context("when the agent fails", func() {
+				BeforeEach(func() {
+					fakeAgentClient.ApplyConfigError = errors.New("agent unavailable")
+				})
+
+				It("keeps the previous plan", func() {
+					err := repo.Update("foo", plan, nil)
+					Expect(err).To(MatchError("agent unavailable"))
+
+					settings, err := repo.InstanceSettings("foo")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(settings.PlanID).To(BeEmpty())
+				})
+			})
+
+			Context("when the instance does not exist", func() {
+				It("returns an error", func() {
+					err := repo.Update("bar", plan, nil)
+					Expect(err).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+				})
+			})
+		})
+
+		Describe("#ImportData", func() {
+			It("has the agent of the node copy the data from the source", func() {
+				err := repo.ImportData("foo", broker.InstanceCredentials{Host: "10.1.1.1", Port: 3456, Password: "secret"})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(fakeAgentClient.ImportedSources).To(Equal(map[string]importer.Source{
+					"https://10.0.0.1:1234": {Host: "10.1.1.1", Port: 3456, Password: "secret"},
+				}))
+			})
+
+			It("returns the error of the agent", func() {
+				fakeAgentClient.ImportDataError = errors.New("sync timed out")
+				err := repo.ImportData("foo", broker.InstanceCredentials{Host: "10.1.1.1", Port: 3456})
+				Expect(err).To(MatchError("sync timed out"))
+			})
+		})
+
+		Describe("#RotatePassword", func() {
+			BeforeEach(func() {
+				fakeAgentClient.RotatePasswordFunc = func(rootURL string, gracePeriod time.Duration) (redis.Credentials, error) {
+					Expect(gracePeriod).To(Equal(time.Minute))
+					return redis.Credentials{Port: 6666, Password: "new-password"}, nil
+				}
+			})
+
+			It("has the agent of the node set a new password", func() {
+				credentials, err := repo.RotatePassword("foo", time.Minute)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fakeAgentClient.RotatedPasswordURLs).To(Equal([]string{"https://10.0.0.1:1234"}))
+				Expect(credentials).To(Equal(broker.InstanceCredentials{
+					Host:     "10.0.0.1",
+					Port:     6666,
+					Password: "new-password",
+				}))
+			})
+
+			It("writes the new password to the statefile", func() {
+				_, err := repo.RotatePassword("foo", time.Minute)
+				Expect(err).ToNot(HaveOccurred())
+
+				statefileContents := getStatefileContents(statefilePath)
+				Expect(statefileContents.AllocatedInstances[0].Password).To(Equal("new-password"))
+			})
+
+			It("returns the error of the agent", func() {
+				fakeAgentClient.RotatePasswordFunc = func(string, time.Duration) (redis.Credentials, error) {
+					return redis.Credentials{}, errors.New("agent unavailable")
+				}
+
+				_, err := repo.RotatePassword("foo", time.Minute)
+				Expect(err).To(MatchError("agent unavailable"))
+			})
+
+			It("returns an error for unknown instances", func() {
+				_, err := repo.RotatePassword("bar", time.Minute)
+				Expect(err).To(MatchError(brokerapi.ErrInstanceDoesNotExist))
+			})
+		})
+
 		Describe("#Destroy", func() {
 			Context("when deleting an existing instance", func() {
 				It("deallocates the instance", func() {
@@ -449,6 +742,18 @@ var _ = Describe("RemoteRepository", func() {
 					Expect(len(statefileContents.AllocatedInstances)).To(Equal(0))
 				})
 
+				It("frees the node without the fields of the instance", func() {
+					_, err := repo.Bind("foo", "binding-id", acl.Scope{})
+					Expect(err).ToNot(HaveOccurred())
+
+					err = repo.Destroy("foo")
+					Expect(err).ToNot(HaveOccurred())
+
+					for _, node := range getStatefileContents(statefilePath).AvailableInstances {
+						Expect(node).To(Equal(&redis.Instance{Host: node.Host}))
+					}
+				})
+
 				It("resets the instance data", func() {
 					instance, err := repo.FindByID("foo")
 					Expect(err).ToNot(HaveOccurred())
@@ -476,8 +781,10 @@ var _ = Describe("RemoteRepository", func() {
 						err = repo.Destroy("foo")
 						Expect(err).To(HaveOccurred())
 
-						_, err = repo.FindByID("foo")
+						instance, err := repo.FindByID("foo")
 						Expect(err).ToNot(HaveOccurred())
+						Expect(instance.ID).To(Equal("foo"))
+						Expect(repo.AvailableInstances()).To(HaveLen(2))
 					})
 				})
 
@@ -521,11 +828,11 @@ var _ = Describe("RemoteRepository", func() {
 
 	Context("When all nodes are allocated", func() {
 		BeforeEach(func() {
-			err := repo.Create("foo")
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
 			Expect(err).ToNot(HaveOccurred())
-			err = repo.Create("bar")
+			err = repo.Create("bar", brokerconfig.Plan{}, nil)
 			Expect(err).ToNot(HaveOccurred())
-			err = repo.Create("baz")
+			err = repo.Create("baz", brokerconfig.Plan{}, nil)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -548,7 +855,7 @@ var _ = Describe("RemoteRepository", func() {
 
 		Describe("#Create", func() {
 			It("returns an error", func() {
-				err := repo.Create("foo")
+				err := repo.Create("foo", brokerconfig.Plan{}, nil)
 				Expect(err).To(HaveOccurred())
 				Expect(err).To(Equal(brokerapi.ErrInstanceLimitMet))
 			})
@@ -563,10 +870,10 @@ var _ = Describe("RemoteRepository", func() {
 
 	Describe("#PersistStatefile", func() {
 		BeforeEach(func() {
-			err := repo.Create("foo")
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
 			Expect(err).ToNot(HaveOccurred())
 
-			_, err = repo.Bind("foo", "foo-binding")
+			_, err = repo.Bind("foo", "foo-binding", acl.Scope{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -587,16 +894,337 @@ var _ = Describe("RemoteRepository", func() {
 		})
 	})
 
+	Describe("#Close", func() {
+		It("writes the statefile", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Remove(statefilePath)).To(Succeed())
+
+			Expect(repo.Close()).To(Succeed())
+
+			statefileContents := getStatefileContents(statefilePath)
+			Expect(statefileContents.AllocatedInstances).To(HaveLen(1))
+		})
+
+		It("blocks operations started afterwards", func() {
+			closed := repo
+			Expect(closed.Close()).To(Succeed())
+
+			created := make(chan error, 1)
+			go func() {
+				created <- closed.Create("foo", brokerconfig.Plan{}, nil)
+			}()
+			Consistently(created, "100ms").ShouldNot(Receive())
+		})
+	})
+
+	Describe("#SetMetrics", func() {
+		var metrics *fakeRepositoryMetrics
+
+		BeforeEach(func() {
+			metrics = &fakeRepositoryMetrics{}
+			repo.SetMetrics(metrics)
+		})
+
+		It("counts failed agent calls", func() {
+			fakeAgentClient.ResetHandler = func(string) error {
+				return &redis.AgentError{StatusCode: 500}
+			}
+
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Destroy("foo")
+			Expect(err).To(HaveOccurred())
+
+			Expect(metrics.agentCallsFailed).To(Equal([]string{"reset"}))
+			Expect(metrics.agentFailureReasons).To(Equal([]string{redis.AgentRefused}))
+		})
+
+		It("tells unreachable agents apart", func() {
+			fakeAgentClient.ResetHandler = func(string) error {
+				return &redis.AgentUnreachableError{Err: errors.New("connection refused")}
+			}
+
+			Expect(repo.Create("foo", brokerconfig.Plan{}, nil)).To(Succeed())
+			Expect(repo.Destroy("foo")).ToNot(Succeed())
+
+			Expect(metrics.agentFailureReasons).To(Equal([]string{redis.AgentUnreachable}))
+		})
+
+		It("does not count nodes without ACL support as failures", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = repo.Bind("foo", "foo-binding", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(metrics.agentCallsFailed).To(BeEmpty())
+		})
+
+		It("counts statefile write failures", func() {
+			err := os.RemoveAll(tmpDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = repo.PersistStatefile()
+			Expect(err).To(HaveOccurred())
+
+			Expect(metrics.statefileWritesFailed).To(Equal(1))
+		})
+	})
+
+	Describe("with a state store", func() {
+		var store *fakeStateStore
+
+		BeforeEach(func() {
+			store = &fakeStateStore{
+				state: redis.Statefile{
+					AllocatedInstances: []*redis.Instance{{ID: "foo", Host: "10.0.0.1"}},
+					InstanceBindings:   map[string][]string{"foo": {"foo-binding"}},
+				},
+			}
+
+			var err error
+			repo, err = redis.NewRemoteRepositoryWithStore(fakeAgentClient, config, store)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("loads the state from the store", func() {
+			Expect(repo.IDForHost("10.0.0.1")).To(Equal("foo"))
+			Expect(repo.BindingsForInstance("foo")).To(Equal([]string{"foo-binding"}))
+			Expect(repo.AvailableInstances()).To(HaveLen(2))
+		})
+
+		It("only saves the bindings of the instance that is bound", func() {
+			err := repo.Create("bar", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = repo.Bind("bar", "bar-binding", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+
+			lastUpdate := store.updates[len(store.updates)-1]
+			Expect(lastUpdate.Bindings).To(Equal(map[string][]string{"bar": {"bar-binding"}}))
+			Expect(lastUpdate.AllocatedInstances).To(HaveLen(2))
+		})
+
+		It("removes the bindings of destroyed instances", func() {
+			err := repo.Destroy("foo")
+			Expect(err).ToNot(HaveOccurred())
+
+			lastUpdate := store.updates[len(store.updates)-1]
+			Expect(lastUpdate.Bindings).To(HaveKey("foo"))
+			Expect(lastUpdate.Bindings["foo"]).To(BeNil())
+		})
+
+		It("does not report a statefile recovery", func() {
+			Expect(repo.StatefileRecovery()).To(BeNil())
+		})
+	})
+
+	Describe("concurrent operations", func() {
+		var (
+			release     chan struct{}
+			createdUser chan string
+		)
+
+		BeforeEach(func() {
+			config.RedisConfiguration.Dedicated.Nodes = nil
+			for i := 1; i <= 20; i++ {
+				config.RedisConfiguration.Dedicated.Nodes = append(config.RedisConfiguration.Dedicated.Nodes, brokerconfig.DedicatedNode{Host: fmt.Sprintf("10.0.0.%d", i)})
+			}
+
+			var err error
+			repo, err = redis.NewRemoteRepository(fakeAgentClient, config)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.Create("slow", brokerconfig.Plan{}, nil)).To(Succeed())
+			Expect(repo.Create("fast", brokerconfig.Plan{}, nil)).To(Succeed())
+
+			release = make(chan struct{})
+			createdUser = make(chan string, 100)
+			fakeAgentClient.CreateUserFunc = func(rootURL, name string) (redis.Credentials, error) {
+				createdUser <- name
+				if rootURL == "https://10.0.0.1:1234" {
+					<-release
+				}
+				return redis.Credentials{}, acl.ErrNotSupported
+			}
+		})
+
+		AfterEach(func() {
+			select {
+			case <-release:
+			default:
+				close(release)
+			}
+		})
+
+		It("does not hold up the other instances while an agent is slow", func() {
+			bound := make(chan error, 1)
+			go func() {
+				_, err := repo.Bind("slow", "slow-binding", acl.Scope{})
+				bound <- err
+			}()
+			Eventually(createdUser).Should(Receive(Equal("slow-binding")))
+
+			_, err := repo.Bind("fast", "fast-binding", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Unbind("fast", "fast-binding")).To(Succeed())
+			Expect(repo.Create("new", brokerconfig.Plan{}, nil)).To(Succeed())
+			Expect(repo.Destroy("new")).To(Succeed())
+
+			instances, err := repo.AllInstances()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(2))
+			Expect(repo.BindingsForInstance("slow")).To(BeEmpty())
+			Expect(repo.CurrentMaster("slow")).To(Equal("10.0.0.1"))
+			Expect(bound).ToNot(Receive())
+
+			close(release)
+			Eventually(bound).Should(Receive(BeNil()))
+			Expect(repo.BindingsForInstance("slow")).To(Equal([]string{"slow-binding"}))
+		})
+
+		It("runs the operations on an instance one at a time", func() {
+			bound := make(chan error, 1)
+			go func() {
+				_, err := repo.Bind("slow", "slow-binding", acl.Scope{})
+				bound <- err
+			}()
+			Eventually(createdUser).Should(Receive(Equal("slow-binding")))
+
+			destroyed := make(chan error, 1)
+			go func() {
+				destroyed <- repo.Destroy("slow")
+			}()
+			Consistently(destroyed).ShouldNot(Receive())
+			Expect(fakeAgentClient.ResetURLs).To(BeEmpty())
+
+			close(release)
+			Eventually(bound).Should(Receive(BeNil()))
+			Eventually(destroyed).Should(Receive(BeNil()))
+			Expect(repo.InstanceExists("slow")).To(BeFalse())
+		})
+
+		It("does not import data while another operation runs on the instance", func() {
+			bound := make(chan error, 1)
+			go func() {
+				_, err := repo.Bind("slow", "slow-binding", acl.Scope{})
+				bound <- err
+			}()
+			Eventually(createdUser).Should(Receive(Equal("slow-binding")))
+
+			imported := make(chan error, 1)
+			go func() {
+				imported <- repo.ImportData("slow", broker.InstanceCredentials{Host: "10.1.1.1", Port: 3456})
+			}()
+			Consistently(imported).ShouldNot(Receive())
+			Expect(fakeAgentClient.ImportedSources).To(BeEmpty())
+
+			close(release)
+			Eventually(bound).Should(Receive(BeNil()))
+			Eventually(imported).Should(Receive(BeNil()))
+		})
+
+		It("keeps the state consistent under concurrent provisions, binds and unbinds", func() {
+			close(release)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(instanceID string) {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					Expect(repo.Create(instanceID, brokerconfig.Plan{}, nil)).To(Succeed())
+					for j := 0; j < 5; j++ {
+						bindingID := fmt.Sprintf("%s-binding-%d", instanceID, j)
+
+						_, err := repo.Bind(instanceID, bindingID, acl.Scope{})
+						Expect(err).ToNot(HaveOccurred())
+						_, err = repo.Bind("fast", bindingID, acl.Scope{})
+						Expect(err).ToNot(HaveOccurred())
+
+						_, err = repo.AllInstances()
+						Expect(err).ToNot(HaveOccurred())
+						repo.Nodes()
+					}
+					Expect(repo.Unbind(instanceID, instanceID+"-binding-0")).To(Succeed())
+					Expect(repo.Unbind("fast", instanceID+"-binding-0")).To(Succeed())
+				}(fmt.Sprintf("instance-%d", i))
+			}
+			wg.Wait()
+
+			instances, err := repo.AllInstances()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(12))
+
+			hosts := map[string]bool{}
+			for _, instance := range instances {
+				Expect(hosts).ToNot(HaveKey(instance.Host))
+				hosts[instance.Host] = true
+			}
+
+			Expect(repo.BindingsForInstance("fast")).To(HaveLen(40))
+			Expect(repo.BindingsForInstance("instance-3")).To(ConsistOf(
+				"instance-3-binding-1",
+				"instance-3-binding-2",
+				"instance-3-binding-3",
+				"instance-3-binding-4",
+			))
+
+			statefileContents := getStatefileContents(statefilePath)
+			Expect(statefileContents.AllocatedInstances).To(HaveLen(12))
+			Expect(statefileContents.AvailableInstances).To(HaveLen(8))
+			Expect(statefileContents.InstanceBindings["fast"]).To(HaveLen(40))
+		})
+
+		It("does not exceed the instance limit of a plan with concurrent provisions", func() {
+			plan := brokerconfig.Plan{ID: "limited", InstanceLimit: 3}
+
+			errs := make(chan error, 10)
+			for i := 0; i < 10; i++ {
+				go func(instanceID string) {
+					errs <- repo.Create(instanceID, plan, nil)
+				}(fmt.Sprintf("instance-%d", i))
+			}
+
+			created := 0
+			for i := 0; i < 10; i++ {
+				var err error
+				Eventually(errs).Should(Receive(&err))
+				if err == nil {
+					created++
+				} else {
+					Expect(err).To(Equal(brokerapi.ErrInstanceLimitMet))
+				}
+			}
+			Expect(created).To(Equal(3))
+			Expect(repo.AvailableInstances()).To(HaveLen(15))
+		})
+	})
+
+	Describe("#AgentURLs", func() {
+		It("lists the agents of allocated and available nodes", func() {
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.AgentURLs()).To(ConsistOf(
+				"https://10.0.0.1:1234",
+				"https://10.0.0.2:1234",
+				"https://10.0.0.3:1234",
+			))
+		})
+	})
+
 	Describe("#IDForHost", func() {
 		It("returns the corresponding instance ID", func() {
-			err := repo.Create("foo")
+			err := repo.Create("foo", brokerconfig.Plan{}, nil)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(repo.IDForHost(config.RedisConfiguration.Dedicated.Nodes[0])).To(Equal("foo"))
+			Expect(repo.IDForHost(config.RedisConfiguration.Dedicated.Nodes[0].Host)).To(Equal("foo"))
 		})
 
 		It("returns an empty string when the host is not allocated", func() {
-			Expect(repo.IDForHost(config.RedisConfiguration.Dedicated.Nodes[0])).To(Equal(""))
+			Expect(repo.IDForHost(config.RedisConfiguration.Dedicated.Nodes[0].Host)).To(Equal(""))
 		})
 
 		It("returns an empty string when the host is unknown", func() {
@@ -604,3 +1232,32 @@ var _ = Describe("RemoteRepository", func() {
 		})
 	})
 })
+
+type fakeRepositoryMetrics struct {
+	agentCallsFailed      []string
+	agentFailureReasons   []string
+	statefileWritesFailed int
+}
+
+func (metrics *fakeRepositoryMetrics) AgentCallFailed(call, reason string) {
+	metrics.agentCallsFailed = append(metrics.agentCallsFailed, call)
+	metrics.agentFailureReasons = append(metrics.agentFailureReasons, reason)
+}
+
+func (metrics *fakeRepositoryMetrics) StatefileWriteFailed() {
+	metrics.statefileWritesFailed++
+}
+
+type fakeStateStore struct {
+	state   redis.Statefile
+	updates []redis.StateUpdate
+}
+
+func (store *fakeStateStore) Load() (redis.Statefile, error) {
+	return store.state, nil
+}
+
+func (store *fakeStateStore) Save(update redis.StateUpdate) error {
+	store.updates = append(store.updates, update)
+	return nil
+}
@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// Group is the node of the instance followed by its replicas.
+func (instance *Instance) Group() []*Instance {
+	return append([]*Instance{instance}, instance.Replicas...)
+}
+
+// startReplication has the replicas of a new instance follow its master and
+// waits until each of them holds a copy of the data.
+func (repo *RemoteRepository) startReplication(instance *Instance, overrides []redisconf.Param) error {
+	if len(instance.Replicas) == 0 {
+		return nil
+	}
+
+	credentials, err := repo.agentClient.Credentials(repo.agentURL(instance))
+	if err != nil {
+		return err
+	}
+	// Any node may be the master after a failover, so every node records
+	// its port.
+	instance.Port = credentials.Port
+
+	if err := repo.configureReplicas(instance, instance, credentials, overrides); err != nil {
+		return err
+	}
+
+	for _, replica := range instance.Replicas {
+		url := repo.agentURL(replica)
+
+		if err := repo.agentClient.WaitForSync(url); err != nil {
+			return err
+		}
+
+		replicaCredentials, err := repo.agentClient.Credentials(url)
+		if err != nil {
+			return err
+		}
+		replica.Port = replicaCredentials.Port
+	}
+
+	return nil
+}
+
+// configureGroup applies the overrides of the instance to its current
+// master, and has the other nodes follow it.
+func (repo *RemoteRepository) configureGroup(instance *Instance, overrides []redisconf.Param) error {
+	master, err := repo.master(instance)
+	if err != nil {
+		return err
+	}
+
+	err = repo.agentClient.ApplyConfig(repo.agentURL(master), overrides)
+	if err != nil {
+		return err
+	}
+
+	if len(instance.Replicas) == 0 {
+		return nil
+	}
+
+	credentials, err := repo.agentClient.Credentials(repo.agentURL(master))
+	if err != nil {
+		return err
+	}
+
+	return repo.configureReplicas(instance, master, credentials, overrides)
+}
+
+// configureReplicas applies the overrides of the instance to every node but
+// its current master, along with the address and the password of the master
+// given by credentials.
+func (repo *RemoteRepository) configureReplicas(instance, master *Instance, credentials Credentials, overrides []redisconf.Param) error {
+	for _, replica := range followers(instance, master) {
+		err := repo.agentClient.ApplyConfig(repo.agentURL(replica), replicaOverrides(master, credentials, overrides))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicaOverrides are the overrides of a replica of master. Replicas take
+// the password of their master, so that clients can read from them with the
+// credentials of the instance.
+func replicaOverrides(master *Instance, credentials Credentials, overrides []redisconf.Param) []redisconf.Param {
+	return append(append([]redisconf.Param{}, overrides...),
+		redisconf.Param{Key: "replicaof", Value: master.Host + " " + strconv.Itoa(credentials.Port)},
+		redisconf.Param{Key: "masterauth", Value: credentials.Password},
+		redisconf.Param{Key: "requirepass", Value: credentials.Password},
+	)
+}
+
+// followers are the nodes of the instance other than master.
+func followers(instance, master *Instance) []*Instance {
+	nodes := []*Instance{}
+	for _, node := range instance.Group() {
+		if node != master {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// releaseGroup returns the nodes of an instance that could not be set up to
+// the pool. The replicas may already follow the master, so they are reset
+// first; those that cannot be reset are quarantined. The nodes of a sentinel
+// instance may all run a sentinel and those of a cluster may all have joined
+// it, so the master is reset as well.
+func (repo *RemoteRepository) releaseGroup(instance *Instance) {
+	nodes := instance.Replicas
+	if instance.MasterName != "" || instance.Shards > 0 {
+		nodes = instance.Group()
+	}
+
+	quarantined := map[string]string{}
+	for _, node := range nodes {
+		if err := repo.agentClient.Reset(repo.agentURL(node)); err != nil {
+			quarantined[node.Host] = fmt.Sprintf("resetting the node: %s", err)
+		}
+	}
+
+	repo.release(instance.ID, quarantined)
+}
+
+// replicaCredentials are the addresses of the nodes of the instance other
+// than master, which clients can read from.
+func replicaCredentials(instance, master *Instance) []broker.NodeAddress {
+	if len(instance.Replicas) == 0 || instance.Shards > 0 {
+		return nil
+	}
+
+	replicas := []broker.NodeAddress{}
+	for _, replica := range followers(instance, master) {
+		replicas = append(replicas, broker.NodeAddress{
+			Host: replica.Host,
+			Port: replica.Port,
+		})
+	}
+	return replicas
+}
+
+// deleteUser deletes the user of a binding from every node of the
+// instance.
+func (repo *RemoteRepository) deleteUser(instance *Instance, bindingID string) error {
+	for _, node := range instance.Group() {
+		if err := repo.agentClient.DeleteUser(repo.agentURL(node), bindingID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocatedNodes are the nodes of every allocated instance, replicas
+// included.
+func (repo *RemoteRepository) allocatedNodes() []*Instance {
+	nodes := []*Instance{}
+	for _, instance := range repo.allocatedInstances {
+		nodes = append(nodes, instance.Group()...)
+	}
+	return nodes
+}
+
+func (repo *RemoteRepository) plan(planID string) brokerconfig.Plan {
+	for _, plan := range repo.plans {
+		if plan.ID == planID {
+			return plan
+		}
+	}
+	return brokerconfig.Plan{ID: planID}
+}
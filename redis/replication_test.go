@@ -0,0 +1,238 @@
+package redis_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replicated instances", func() {
+	var (
+		repo        *redis.RemoteRepository
+		agentClient *fakes.FakeAgentClient
+		tmpDir      string
+		config      brokerconfig.Config
+		plan        brokerconfig.Plan
+	)
+
+	const (
+		masterAgent  = "https://10.0.0.1:1234"
+		replicaAgent = "https://10.0.0.2:1234"
+	)
+
+	newRepo := func() *redis.RemoteRepository {
+		repo, err := redis.NewRemoteRepository(agentClient, config)
+		Expect(err).ToNot(HaveOccurred())
+		return repo
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+		Expect(err).ToNot(HaveOccurred())
+
+		plan = brokerconfig.Plan{
+			ID:        "replicated-plan",
+			Backend:   brokerconfig.BackendDedicated,
+			MaxMemory: "1gb",
+			Topology:  brokerconfig.TopologyReplicated,
+			Replicas:  1,
+		}
+
+		config = brokerconfig.Config{AgentPort: "1234"}
+		config.RedisConfiguration.Plans = []brokerconfig.Plan{plan}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{
+			{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"},
+		}
+		config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+
+		agentClient = &fakes.FakeAgentClient{
+			CredentialsFunc: func(rootURL string) (redis.Credentials, error) {
+				if rootURL == masterAgent {
+					return redis.Credentials{Port: 6379, Password: "master-secret"}, nil
+				}
+				return redis.Credentials{Port: 6380, Password: "master-secret"}, nil
+			},
+			CreateUserFunc: func(rootURL, name string) (redis.Credentials, error) {
+				return redis.Credentials{Port: 6379, Username: name, Password: "user-secret"}, nil
+			},
+			RotatePasswordFunc: func(rootURL string, gracePeriod time.Duration) (redis.Credentials, error) {
+				return redis.Credentials{Port: 6379, Password: "new-secret"}, nil
+			},
+		}
+
+		repo = newRepo()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Create", func() {
+		It("allocates a master and its replicas", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			instance, err := repo.FindByID("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Host).To(Equal("10.0.0.1"))
+			Expect(instance.Replicas).To(HaveLen(1))
+			Expect(instance.Replicas[0].Host).To(Equal("10.0.0.2"))
+			Expect(instance.Replicas[0].Port).To(Equal(6380))
+
+			Expect(repo.IDForHost("10.0.0.2")).To(Equal("foo"))
+			Expect(repo.AvailableInstances()).To(HaveLen(1))
+		})
+
+		It("has the replicas follow the master and waits for the initial sync", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			Expect(agentClient.AppliedConfigs[masterAgent]).To(Equal([]redisconf.Param{
+				{Key: "maxmemory", Value: "1gb"},
+			}))
+			Expect(agentClient.AppliedConfigs[replicaAgent]).To(Equal([]redisconf.Param{
+				{Key: "maxmemory", Value: "1gb"},
+				{Key: "replicaof", Value: "10.0.0.1 6379"},
+				{Key: "masterauth", Value: "master-secret"},
+				{Key: "requirepass", Value: "master-secret"},
+			}))
+			Expect(agentClient.SyncedURLs).To(Equal([]string{replicaAgent}))
+		})
+
+		It("lists the replicas as nodes of the instance", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			Expect(repo.Nodes()[:2]).To(Equal([]redis.Node{
+				{Host: "10.0.0.1", State: redis.NodeAllocated, InstanceID: "foo"},
+				{Host: "10.0.0.2", State: redis.NodeAllocated, InstanceID: "foo"},
+			}))
+		})
+
+		It("keeps the replicas across restarts", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			restarted := newRepo()
+			Expect(restarted.IDForHost("10.0.0.2")).To(Equal("foo"))
+			Expect(restarted.AvailableInstances()).To(HaveLen(1))
+		})
+
+		Context("when the pool has too few free nodes", func() {
+			BeforeEach(func() {
+				plan.Replicas = 3
+			})
+
+			It("fails without allocating any", func() {
+				err := repo.Create("foo", plan, nil)
+				Expect(err).To(MatchError(brokerapi.ErrInstanceLimitMet))
+				Expect(repo.AvailableInstances()).To(HaveLen(3))
+			})
+		})
+
+		Context("when a replica does not complete the initial sync", func() {
+			BeforeEach(func() {
+				agentClient.WaitForSyncErr = errors.New("timed out")
+			})
+
+			It("resets the replicas and returns the nodes to the pool", func() {
+				err := repo.Create("foo", plan, nil)
+				Expect(err).To(MatchError("timed out"))
+
+				Expect(agentClient.ResetURLs).To(Equal([]string{replicaAgent}))
+				Expect(repo.AvailableInstances()).To(HaveLen(3))
+				Expect(repo.InstanceExists("foo")).To(BeFalse())
+			})
+
+			It("quarantines the replicas that cannot be reset", func() {
+				agentClient.ResetHandler = func(string) error {
+					return errors.New("monit timed out")
+				}
+
+				Expect(repo.Create("foo", plan, nil)).ToNot(Succeed())
+				Expect(repo.QuarantinedNodes()).To(Equal([]string{"10.0.0.2"}))
+			})
+		})
+
+		Context("when the state cannot be saved", func() {
+			BeforeEach(func() {
+				statefilePath := config.RedisConfiguration.Dedicated.StatefilePath
+				Expect(os.Remove(statefilePath)).To(Succeed())
+				Expect(os.Mkdir(statefilePath, 0755)).To(Succeed())
+			})
+
+			It("resets the replicas and returns the nodes to the pool", func() {
+				Expect(repo.Create("foo", plan, nil)).ToNot(Succeed())
+
+				Expect(agentClient.ResetURLs).To(Equal([]string{replicaAgent}))
+				Expect(repo.AvailableInstances()).To(HaveLen(3))
+				Expect(repo.InstanceLimit()).To(Equal(3))
+				Expect(repo.InstanceExists("foo")).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the instance exists", func() {
+		BeforeEach(func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+			agentClient.AppliedConfigs = nil
+		})
+
+		It("creates the user of a binding on every node and returns the replicas", func() {
+			credentials, err := repo.Bind("foo", "binding-id", acl.Scope{ReadOnly: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(agentClient.SetUserURLs).To(Equal([]string{replicaAgent}))
+			Expect(agentClient.SetUserPasswords).To(Equal(map[string]string{"binding-id": "user-secret"}))
+			Expect(credentials.Replicas).To(Equal([]broker.NodeAddress{{Host: "10.0.0.2", Port: 6380}}))
+		})
+
+		It("deletes the user of a binding from every node", func() {
+			_, err := repo.Bind("foo", "binding-id", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.Unbind("foo", "binding-id")).To(Succeed())
+			Expect(agentClient.DeletedUserURLs).To(Equal([]string{masterAgent, replicaAgent}))
+		})
+
+		It("updates the config of the replicas", func() {
+			plan.MaxMemory = "2gb"
+			Expect(repo.Update("foo", plan, nil)).To(Succeed())
+
+			Expect(agentClient.AppliedConfigs[replicaAgent]).To(ContainElement(redisconf.Param{Key: "maxmemory", Value: "2gb"}))
+			Expect(agentClient.AppliedConfigs[replicaAgent]).To(ContainElement(redisconf.Param{Key: "replicaof", Value: "10.0.0.1 6379"}))
+		})
+
+		It("gives the replicas the new password of the master", func() {
+			_, err := repo.RotatePassword("foo", 0)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(agentClient.AppliedConfigs[replicaAgent]).To(Equal([]redisconf.Param{
+				{Key: "maxmemory", Value: "1gb"},
+				{Key: "replicaof", Value: "10.0.0.1 6379"},
+				{Key: "masterauth", Value: "new-secret"},
+				{Key: "requirepass", Value: "new-secret"},
+			}))
+		})
+
+		It("resets every node when it is destroyed", func() {
+			Expect(repo.Destroy("foo")).To(Succeed())
+
+			Expect(agentClient.ResetURLs).To(Equal([]string{masterAgent, replicaAgent}))
+			Expect(repo.AvailableInstances()).To(HaveLen(3))
+			for _, node := range repo.AvailableInstances() {
+				Expect(node.Replicas).To(BeEmpty())
+			}
+		})
+	})
+})
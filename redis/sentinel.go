@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+)
+
+// startSentinels has the sentinel of every node of the instance monitor
+// master, whose address and password are given by credentials. The sentinels
+// require the sentinel password of the instance. It returns the ports the
+// sentinels listen on, in the order of the group.
+func (repo *RemoteRepository) startSentinels(instance, master *Instance, credentials Credentials) ([]int, error) {
+	monitor := sentinel.Monitor{
+		MasterName: instance.MasterName,
+		Host:       master.Host,
+		Port:       credentials.Port,
+		Quorum:     repo.plan(instance.PlanID).SentinelQuorum(),
+		Password:   credentials.Password,
+
+		SentinelPassword: instance.SentinelPassword,
+	}
+
+	ports := []int{}
+	for _, node := range instance.Group() {
+		port, err := repo.agentClient.MonitorSentinel(repo.agentURL(node), monitor)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
+// master is the node of the instance that currently takes writes. The
+// sentinels of a sentinel instance may have promoted one of its replicas, so
+// they are asked in turn until one of them answers.
+func (repo *RemoteRepository) master(instance *Instance) (*Instance, error) {
+	if instance.MasterName == "" {
+		return instance, nil
+	}
+
+	var err error
+	for _, node := range instance.Group() {
+		var address sentinel.Address
+		address, err = repo.agentClient.SentinelMaster(repo.agentURL(node), instance.MasterName)
+		if err != nil {
+			continue
+		}
+
+		for _, candidate := range instance.Group() {
+			if candidate.Host == address.Host {
+				return candidate, nil
+			}
+		}
+		return nil, fmt.Errorf("the sentinels report %s as the master of instance %s, which is not one of its nodes", address.Host, instance.ID)
+	}
+
+	return nil, err
+}
+
+// CurrentMaster is the host of the node that currently takes writes for the
+// instance. The sentinels are asked without holding any lock.
+func (repo *RemoteRepository) CurrentMaster(instanceID string) (string, error) {
+	instance, err := repo.FindByID(instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	master, err := repo.master(instance)
+	if err != nil {
+		return "", err
+	}
+
+	return master.Host, nil
+}
+
+// sentinelCredentials are the addresses of the sentinels of the instance,
+// which Sentinel-aware clients ask for the current master.
+func sentinelCredentials(instance *Instance) []broker.NodeAddress {
+	if instance.MasterName == "" {
+		return nil
+	}
+
+	sentinels := []broker.NodeAddress{}
+	for _, node := range instance.Group() {
+		sentinels = append(sentinels, broker.NodeAddress{
+			Host: node.Host,
+			Port: node.SentinelPort,
+		})
+	}
+	return sentinels
+}
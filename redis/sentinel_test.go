@@ -0,0 +1,261 @@
+package redis_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/broker"
+	"github.com/pivotal-cf/cf-redis-broker/brokerconfig"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/redis/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sentinel instances", func() {
+	var (
+		repo          *redis.RemoteRepository
+		agentClient   *fakes.FakeAgentClient
+		tmpDir        string
+		config        brokerconfig.Config
+		plan          brokerconfig.Plan
+		currentMaster string
+		rotatedURLs   []string
+	)
+
+	const (
+		firstAgent  = "https://10.0.0.1:1234"
+		secondAgent = "https://10.0.0.2:1234"
+		thirdAgent  = "https://10.0.0.3:1234"
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cf-redis-broker")
+		Expect(err).ToNot(HaveOccurred())
+
+		plan = brokerconfig.Plan{
+			ID:        "sentinel-plan",
+			Backend:   brokerconfig.BackendDedicated,
+			MaxMemory: "1gb",
+			Topology:  brokerconfig.TopologySentinel,
+			Replicas:  2,
+		}
+
+		config = brokerconfig.Config{AgentPort: "1234"}
+		config.RedisConfiguration.Plans = []brokerconfig.Plan{plan}
+		config.RedisConfiguration.Dedicated.Nodes = []brokerconfig.DedicatedNode{
+			{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"}, {Host: "10.0.0.4"},
+		}
+		config.RedisConfiguration.Dedicated.StatefilePath = path.Join(tmpDir, "statefile.json")
+
+		currentMaster = "10.0.0.1"
+		rotatedURLs = nil
+		agentClient = &fakes.FakeAgentClient{
+			CredentialsFunc: func(rootURL string) (redis.Credentials, error) {
+				return redis.Credentials{Port: 6379, Password: "master-secret"}, nil
+			},
+			CreateUserFunc: func(rootURL, name string) (redis.Credentials, error) {
+				return redis.Credentials{Port: 6379, Username: name, Password: "user-secret"}, nil
+			},
+			RotatePasswordFunc: func(rootURL string, gracePeriod time.Duration) (redis.Credentials, error) {
+				rotatedURLs = append(rotatedURLs, rootURL)
+				return redis.Credentials{Port: 6379, Password: "new-secret"}, nil
+			},
+			SentinelMasterFunc: func(rootURL, masterName string) (sentinel.Address, error) {
+				return sentinel.Address{Host: currentMaster, Port: 6379}, nil
+			},
+		}
+
+		repo, err = redis.NewRemoteRepository(agentClient, config)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("#Create", func() {
+		It("has the sentinel of every node monitor the master", func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+
+			instance, err := repo.FindByID("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.SentinelPassword).ToNot(BeEmpty())
+			Expect(instance.SentinelPassword).ToNot(Equal("master-secret"))
+
+			monitor := sentinel.Monitor{
+				MasterName: "foo",
+				Host:       "10.0.0.1",
+				Port:       6379,
+				Quorum:     2,
+				Password:   "master-secret",
+
+				SentinelPassword: instance.SentinelPassword,
+			}
+			Expect(agentClient.Monitors).To(Equal(map[string]sentinel.Monitor{
+				firstAgent:  monitor,
+				secondAgent: monitor,
+				thirdAgent:  monitor,
+			}))
+
+			Expect(instance.MasterName).To(Equal("foo"))
+			Expect(instance.SentinelPort).To(Equal(26379))
+		})
+
+		It("uses the quorum of the plan", func() {
+			plan.Quorum = 3
+			config.RedisConfiguration.Plans = []brokerconfig.Plan{plan}
+			repo, err := redis.NewRemoteRepository(agentClient, config)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+			Expect(agentClient.Monitors[firstAgent].Quorum).To(Equal(3))
+		})
+
+		Context("when a sentinel cannot be started", func() {
+			BeforeEach(func() {
+				agentClient.MonitorSentinelErr = errors.New("sentinel is not configured")
+			})
+
+			It("resets every node and returns them to the pool", func() {
+				err := repo.Create("foo", plan, nil)
+				Expect(err).To(MatchError("sentinel is not configured"))
+
+				Expect(agentClient.ResetURLs).To(Equal([]string{firstAgent, secondAgent, thirdAgent}))
+				Expect(repo.AvailableInstances()).To(HaveLen(4))
+				Expect(repo.InstanceExists("foo")).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the instance exists", func() {
+		BeforeEach(func() {
+			Expect(repo.Create("foo", plan, nil)).To(Succeed())
+			agentClient.AppliedConfigs = nil
+		})
+
+		It("binds with the sentinels and the master name", func() {
+			credentials, err := repo.Bind("foo", "binding-id", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(credentials.Host).To(Equal("10.0.0.1"))
+			Expect(credentials.MasterName).To(Equal("foo"))
+			Expect(credentials.Sentinels).To(Equal([]broker.NodeAddress{
+				{Host: "10.0.0.1", Port: 26379},
+				{Host: "10.0.0.2", Port: 26379},
+				{Host: "10.0.0.3", Port: 26379},
+			}))
+		})
+
+		It("binds with the password of the sentinels, not the one of the master", func() {
+			credentials, err := repo.Bind("foo", "binding-id", acl.Scope{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(credentials.Password).To(Equal("user-secret"))
+			Expect(credentials.SentinelPassword).To(Equal(agentClient.Monitors[firstAgent].SentinelPassword))
+			Expect(credentials.SentinelPassword).ToNot(Equal("master-secret"))
+
+			instance, err := repo.FindByID("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Password).ToNot(Equal("master-secret"))
+		})
+
+		It("frees the nodes without the sentinel fields of the instance", func() {
+			Expect(repo.Destroy("foo")).To(Succeed())
+
+			for _, node := range repo.AvailableInstances() {
+				Expect(node.MasterName).To(BeEmpty())
+				Expect(node.SentinelPort).To(BeZero())
+				Expect(node.SentinelPassword).To(BeEmpty())
+				Expect(node.Replicas).To(BeEmpty())
+			}
+		})
+
+		It("reports the current master", func() {
+			Expect(repo.CurrentMaster("foo")).To(Equal("10.0.0.1"))
+		})
+
+		Context("after a failover", func() {
+			BeforeEach(func() {
+				currentMaster = "10.0.0.2"
+			})
+
+			It("reports the promoted replica as the master", func() {
+				Expect(repo.CurrentMaster("foo")).To(Equal("10.0.0.2"))
+			})
+
+			It("binds to the promoted replica", func() {
+				credentials, err := repo.Bind("foo", "binding-id", acl.Scope{})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(credentials.Host).To(Equal("10.0.0.2"))
+				Expect(agentClient.SetUserURLs).To(Equal([]string{firstAgent, thirdAgent}))
+				Expect(credentials.Replicas).To(Equal([]broker.NodeAddress{
+					{Host: "10.0.0.1", Port: 6379},
+					{Host: "10.0.0.3", Port: 6379},
+				}))
+			})
+
+			It("updates the config of the promoted replica and has the others follow it", func() {
+				plan.MaxMemory = "2gb"
+				Expect(repo.Update("foo", plan, nil)).To(Succeed())
+
+				Expect(agentClient.AppliedConfigs[secondAgent]).To(Equal([]redisconf.Param{
+					{Key: "maxmemory", Value: "2gb"},
+				}))
+				Expect(agentClient.AppliedConfigs[firstAgent]).To(ContainElement(redisconf.Param{Key: "replicaof", Value: "10.0.0.2 6379"}))
+			})
+
+			It("has the sentinels monitor the promoted replica with the new password", func() {
+				sentinelPassword := agentClient.Monitors[firstAgent].SentinelPassword
+
+				credentials, err := repo.RotatePassword("foo", 0)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(credentials.Host).To(Equal("10.0.0.2"))
+				Expect(rotatedURLs).To(Equal([]string{secondAgent}))
+				for _, url := range []string{firstAgent, secondAgent, thirdAgent} {
+					Expect(agentClient.Monitors[url].Host).To(Equal("10.0.0.2"))
+					Expect(agentClient.Monitors[url].Password).To(Equal("new-secret"))
+					Expect(agentClient.Monitors[url].SentinelPassword).To(Equal(sentinelPassword))
+				}
+
+				credentials, err = repo.Bind("foo", "binding-id", acl.Scope{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(credentials.SentinelPassword).To(Equal(sentinelPassword))
+			})
+		})
+
+		Context("when the sentinels report a master outside the instance", func() {
+			BeforeEach(func() {
+				currentMaster = "10.0.0.9"
+			})
+
+			It("fails", func() {
+				_, err := repo.CurrentMaster("foo")
+				Expect(err).To(MatchError(ContainSubstring("10.0.0.9")))
+			})
+		})
+
+		Context("when no sentinel answers", func() {
+			BeforeEach(func() {
+				agentClient.SentinelMasterFunc = func(string, string) (sentinel.Address, error) {
+					return sentinel.Address{}, errors.New("connection refused")
+				}
+			})
+
+			It("fails to bind", func() {
+				_, err := repo.Bind("foo", "binding-id", acl.Scope{})
+				Expect(err).To(MatchError("connection refused"))
+			})
+		})
+	})
+})
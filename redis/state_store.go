@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pivotal-cf/cf-redis-broker/statefile"
+)
+
+// StateStore persists the nodes of the dedicated plan and the bindings of
+// their instances.
+type StateStore interface {
+	// Load returns the saved state, which is empty when nothing was saved yet.
+	Load() (Statefile, error)
+	// Save applies the update atomically.
+	Save(update StateUpdate) error
+}
+
+// StateUpdate is a change to the saved state. The nodes are always saved in
+// full; only the bindings of the instances in Bindings are written, so that
+// binding does not rewrite the bindings of every other instance. A nil list
+// of bindings removes the instance from the saved bindings.
+type StateUpdate struct {
+	AvailableInstances []*Instance
+	AllocatedInstances []*Instance
+	AddedNodes         []string
+	RemovedNodes       []string
+	Bindings           map[string][]string
+}
+
+// Statefile is the saved state. AddedNodes and RemovedNodes are the changes
+// made to the nodes of the config through the node pool API.
+type Statefile struct {
+	AvailableInstances []*Instance         `json:"available_instances"`
+	AllocatedInstances []*Instance         `json:"allocated_instances"`
+	AddedNodes         []string            `json:"added_nodes,omitempty"`
+	RemovedNodes       []string            `json:"removed_nodes,omitempty"`
+	InstanceBindings   map[string][]string `json:"instance_bindings"`
+}
+
+// FileStateStore keeps the state in a single JSON statefile, which is
+// rewritten as a whole on every save.
+type FileStateStore struct {
+	path        string
+	generations int
+	state       Statefile
+	recovery    error
+}
+
+func NewFileStateStore(path string, generations int) *FileStateStore {
+	return &FileStateStore{
+		path:        path,
+		generations: generations,
+		state:       Statefile{InstanceBindings: map[string][]string{}},
+	}
+}
+
+func (store *FileStateStore) Load() (Statefile, error) {
+	contents := Statefile{}
+
+	_, generation, err := statefile.Read(store.path, store.generations, func(stateBytes []byte) error {
+		contents = Statefile{}
+		return json.Unmarshal(stateBytes, &contents)
+	})
+	if err == statefile.ErrNotFound {
+		return Statefile{}, nil
+	}
+	if err != nil {
+		return Statefile{}, err
+	}
+
+	if generation > 0 {
+		store.recovery = fmt.Errorf(
+			"statefile %s is missing or corrupt, the state was loaded from %s",
+			store.path,
+			statefile.Generation(store.path, generation),
+		)
+	}
+
+	if contents.InstanceBindings == nil {
+		contents.InstanceBindings = map[string][]string{}
+	}
+	store.state = contents
+
+	return contents, nil
+}
+
+func (store *FileStateStore) Save(update StateUpdate) error {
+	state := Statefile{
+		AvailableInstances: update.AvailableInstances,
+		AllocatedInstances: update.AllocatedInstances,
+		AddedNodes:         update.AddedNodes,
+		RemovedNodes:       update.RemovedNodes,
+		InstanceBindings:   map[string][]string{},
+	}
+	for instanceID, bindings := range store.state.InstanceBindings {
+		state.InstanceBindings[instanceID] = bindings
+	}
+	for instanceID, bindings := range update.Bindings {
+		if bindings == nil {
+			delete(state.InstanceBindings, instanceID)
+		} else {
+			state.InstanceBindings[instanceID] = bindings
+		}
+	}
+
+	stateBytes, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+
+	err = statefile.Write(store.path, stateBytes, store.generations)
+	if err != nil {
+		return err
+	}
+
+	store.state = state
+	return nil
+}
+
+// Recovery describes why the state was loaded from an older generation of
+// the statefile, or is nil when the statefile was intact.
+func (store *FileStateStore) Recovery() error {
+	return store.recovery
+}
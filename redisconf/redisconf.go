@@ -15,8 +15,8 @@ import (
 )
 
 type Param struct {
-	Key   string
-	Value string
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
 const (
@@ -99,6 +99,56 @@ func (conf Conf) Password() string {
 	return conf.Get("requirepass")
 }
 
+// TLSPort is the port redis accepts TLS connections on, 0 when TLS is off.
+func (conf Conf) TLSPort() int {
+	port, err := strconv.Atoi(conf.Get("tls-port"))
+	if err != nil {
+		return 0
+	}
+	return port
+}
+
+// CACert reads the certificate of the CA that clients need to verify the TLS
+// certificate of redis. It is empty when no CA certificate is configured.
+func (conf Conf) CACert() (string, error) {
+	caCertFile := conf.Get("tls-ca-cert-file")
+	if caCertFile == "" {
+		return "", nil
+	}
+
+	caCert, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return "", err
+	}
+	return string(caCert), nil
+}
+
+// TLS holds the settings that let redis 6 accept TLS connections on a port
+// of its own, next to the plain port.
+type TLS struct {
+	Port       int
+	CertFile   string
+	KeyFile    string
+	CACertFile string
+}
+
+// Params are the redis.conf directives for the TLS settings. Clients are not
+// asked for certificates, they authenticate with a password as usual.
+func (tls TLS) Params() []Param {
+	return []Param{
+		{Key: "tls-port", Value: strconv.Itoa(tls.Port)},
+		{Key: "tls-cert-file", Value: tls.CertFile},
+		{Key: "tls-key-file", Value: tls.KeyFile},
+		{Key: "tls-ca-cert-file", Value: tls.CACertFile},
+		{Key: "tls-auth-clients", Value: "no"},
+	}
+}
+
+// EnableTLS sets the TLS directives, replacing any that are already set.
+func (conf *Conf) EnableTLS(tls TLS) {
+	conf.Override(tls.Params()...)
+}
+
 func (conf Conf) Get(key string) string {
 	params := conf.getAll(key)
 	if len(params) < 1 {
@@ -156,6 +206,26 @@ func (conf *Conf) Set(key string, value string) {
 	*conf = append(*conf, newParam)
 }
 
+func (conf *Conf) Delete(key string) {
+	remaining := Conf{}
+	for _, param := range *conf {
+		if key != param.Key {
+			remaining = append(remaining, param)
+		}
+	}
+	*conf = remaining
+}
+
+// Override replaces every occurrence of the given keys, so that directives
+// such as save, which may appear many times, are fully replaced.
+func (conf *Conf) Override(params ...Param) {
+	for _, param := range params {
+		conf.Delete(param.Key)
+	}
+
+	*conf = append(*conf, params...)
+}
+
 func (conf Conf) Encode() []byte {
 	output := []byte{}
 
@@ -180,12 +250,14 @@ func parseParam(line string) (Param, error) {
 	}, nil
 }
 
-func CopyWithInstanceAdditions(fromPath, toPath, syslogIdentSuffix, port, password string) error {
+func CopyWithInstanceAdditions(fromPath, toPath, syslogIdentSuffix, port, password string, overrides ...Param) error {
 	defaultConfig, err := Load(fromPath)
 	if err != nil {
 		return err
 	}
 
+	defaultConfig.Override(overrides...)
+
 	defaultConfig.Set("syslog-enabled", "yes")
 	defaultConfig.Set("syslog-ident", fmt.Sprintf("redis-server-%s", syslogIdentSuffix))
 	defaultConfig.Set("syslog-facility", "local0")
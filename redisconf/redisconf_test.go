@@ -197,6 +197,96 @@ var _ = Describe("redisconf", func() {
 		})
 	})
 
+	Describe("Delete", func() {
+		It("removes every occurrence of the key", func() {
+			conf := redisconf.New(
+				redisconf.Param{Key: "save", Value: "900 1"},
+				redisconf.Param{Key: "daemonize", Value: "yes"},
+				redisconf.Param{Key: "save", Value: "300 10"},
+			)
+
+			conf.Delete("save")
+			Expect(conf.HasKey("save")).To(BeFalse())
+			Expect(conf.Get("daemonize")).To(Equal("yes"))
+		})
+	})
+
+	Describe("TLS", func() {
+		It("has no TLS port or CA certificate by default", func() {
+			conf := redisconf.New(redisconf.Param{Key: "port", Value: "6379"})
+			Expect(conf.TLSPort()).To(Equal(0))
+
+			caCert, err := conf.CACert()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caCert).To(BeEmpty())
+		})
+
+		It("reads the TLS port and the CA certificate", func() {
+			caCertFile, err := ioutil.TempFile("", "ca-cert")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(caCertFile.Name())
+			caCertFile.WriteString("-----BEGIN CERTIFICATE-----")
+			caCertFile.Close()
+
+			conf := redisconf.New(
+				redisconf.Param{Key: "tls-port", Value: "6380"},
+				redisconf.Param{Key: "tls-ca-cert-file", Value: caCertFile.Name()},
+			)
+			Expect(conf.TLSPort()).To(Equal(6380))
+
+			caCert, err := conf.CACert()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caCert).To(Equal("-----BEGIN CERTIFICATE-----"))
+		})
+
+		It("returns an error when the CA certificate cannot be read", func() {
+			conf := redisconf.New(redisconf.Param{Key: "tls-ca-cert-file", Value: "/does/not/exist"})
+			_, err := conf.CACert()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("enables TLS", func() {
+			conf := redisconf.New(
+				redisconf.Param{Key: "port", Value: "6379"},
+				redisconf.Param{Key: "tls-port", Value: "7000"},
+			)
+			conf.EnableTLS(redisconf.TLS{
+				Port:       6380,
+				CertFile:   "/certs/redis.crt",
+				KeyFile:    "/certs/redis.key",
+				CACertFile: "/certs/ca.crt",
+			})
+
+			Expect(conf.Get("port")).To(Equal("6379"))
+			Expect(conf.TLSPort()).To(Equal(6380))
+			Expect(conf.Get("tls-cert-file")).To(Equal("/certs/redis.crt"))
+			Expect(conf.Get("tls-key-file")).To(Equal("/certs/redis.key"))
+			Expect(conf.Get("tls-ca-cert-file")).To(Equal("/certs/ca.crt"))
+			Expect(conf.Get("tls-auth-clients")).To(Equal("no"))
+		})
+	})
+
+	Describe("Override", func() {
+		It("replaces every occurrence of the overridden keys", func() {
+			conf := redisconf.New(
+				redisconf.Param{Key: "save", Value: "900 1"},
+				redisconf.Param{Key: "daemonize", Value: "yes"},
+				redisconf.Param{Key: "save", Value: "300 10"},
+			)
+
+			conf.Override(
+				redisconf.Param{Key: "save", Value: `""`},
+				redisconf.Param{Key: "appendonly", Value: "no"},
+			)
+
+			Expect(conf).To(Equal(redisconf.New(
+				redisconf.Param{Key: "daemonize", Value: "yes"},
+				redisconf.Param{Key: "save", Value: `""`},
+				redisconf.Param{Key: "appendonly", Value: "no"},
+			)))
+		})
+	})
+
 	Describe("CopyWithInstanceAdditions", func() {
 		It("writes the instance configuration", func() {
 			fromPath, err := filepath.Abs(path.Join("assets", "redis.conf"))
@@ -222,5 +312,34 @@ var _ = Describe("redisconf", func() {
 			Ω(resultingConf.Get("port")).Should(Equal(port))
 			Ω(resultingConf.Get("requirepass")).Should(Equal(password))
 		})
+
+		It("replaces default settings with the overrides", func() {
+			fromPath, err := filepath.Abs(path.Join("assets", "redis.conf"))
+			Expect(err).ToNot(HaveOccurred())
+
+			dir, err := ioutil.TempDir("", "redisconf-test")
+			Expect(err).ToNot(HaveOccurred())
+			toPath := filepath.Join(dir, "redis.conf")
+
+			err = redisconf.CopyWithInstanceAdditions(fromPath, toPath, "an-instance-id", "1234", "an-password",
+				redisconf.Param{Key: "save", Value: `""`},
+				redisconf.Param{Key: "maxmemory", Value: "64mb"},
+			)
+			Ω(err).ToNot(HaveOccurred())
+
+			resultingConf, err := redisconf.Load(toPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			saves := 0
+			for _, param := range resultingConf {
+				if param.Key == "save" {
+					saves++
+				}
+			}
+			Ω(saves).Should(Equal(1))
+			Ω(resultingConf.Get("save")).Should(Equal(`""`))
+			Ω(resultingConf.Get("maxmemory")).Should(Equal("64mb"))
+			Ω(resultingConf.Get("port")).Should(Equal("1234"))
+		})
 	})
 })
@@ -0,0 +1,225 @@
+package redisinfo
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+)
+
+// Info is the runtime state of a redis as its INFO command reports it.
+// Fields that the redis does not report, such as those of older versions,
+// are left at their zero value.
+type Info struct {
+	Memory      Memory              `json:"memory"`
+	Clients     Clients             `json:"clients"`
+	Persistence Persistence         `json:"persistence"`
+	Replication Replication         `json:"replication"`
+	Keyspace    map[string]Keyspace `json:"keyspace"`
+	Stats       Stats               `json:"stats"`
+}
+
+type Memory struct {
+	UsedMemory            int64   `json:"used_memory"`
+	UsedMemoryRSS         int64   `json:"used_memory_rss"`
+	UsedMemoryPeak        int64   `json:"used_memory_peak"`
+	MaxMemory             int64   `json:"maxmemory"`
+	MaxMemoryPolicy       string  `json:"maxmemory_policy,omitempty"`
+	MemFragmentationRatio float64 `json:"mem_fragmentation_ratio"`
+}
+
+type Clients struct {
+	ConnectedClients int64 `json:"connected_clients"`
+	BlockedClients   int64 `json:"blocked_clients"`
+	MaxClients       int64 `json:"maxclients,omitempty"`
+}
+
+type Persistence struct {
+	Loading                 bool   `json:"loading"`
+	RDBChangesSinceLastSave int64  `json:"rdb_changes_since_last_save"`
+	RDBBgsaveInProgress     bool   `json:"rdb_bgsave_in_progress"`
+	RDBLastSaveTime         int64  `json:"rdb_last_save_time"`
+	RDBLastBgsaveStatus     string `json:"rdb_last_bgsave_status,omitempty"`
+	AOFEnabled              bool   `json:"aof_enabled"`
+	AOFRewriteInProgress    bool   `json:"aof_rewrite_in_progress"`
+	AOFLastBgrewriteStatus  string `json:"aof_last_bgrewrite_status,omitempty"`
+	AOFLastWriteStatus      string `json:"aof_last_write_status,omitempty"`
+}
+
+type Replication struct {
+	Role             string    `json:"role"`
+	ConnectedSlaves  int64     `json:"connected_slaves"`
+	MasterHost       string    `json:"master_host,omitempty"`
+	MasterPort       int64     `json:"master_port,omitempty"`
+	MasterLinkStatus string    `json:"master_link_status,omitempty"`
+	MasterReplOffset int64     `json:"master_repl_offset"`
+	Replicas         []Replica `json:"replicas,omitempty"`
+}
+
+// Replica is a replica connected to a master, as listed by the slaveN
+// fields of its INFO.
+type Replica struct {
+	IP     string `json:"ip"`
+	Port   int64  `json:"port"`
+	State  string `json:"state"`
+	Offset int64  `json:"offset"`
+	Lag    int64  `json:"lag"`
+}
+
+// Keyspace is what a database of redis holds, as listed by the dbN fields of
+// INFO.
+type Keyspace struct {
+	Keys    int64 `json:"keys"`
+	Expires int64 `json:"expires"`
+	AvgTTL  int64 `json:"avg_ttl"`
+}
+
+type Stats struct {
+	TotalConnectionsReceived int64 `json:"total_connections_received"`
+	TotalCommandsProcessed   int64 `json:"total_commands_processed"`
+	InstantaneousOpsPerSec   int64 `json:"instantaneous_ops_per_sec"`
+	RejectedConnections      int64 `json:"rejected_connections"`
+	ExpiredKeys              int64 `json:"expired_keys"`
+	EvictedKeys              int64 `json:"evicted_keys"`
+	KeyspaceHits             int64 `json:"keyspace_hits"`
+	KeyspaceMisses           int64 `json:"keyspace_misses"`
+}
+
+// Reader reads the INFO of the redis that Connect connects to. Connect has
+// to register the command aliases of redis.conf, so that a renamed INFO
+// still works.
+type Reader struct {
+	Connect func() (client.Client, error)
+}
+
+func (reader *Reader) Info() (Info, error) {
+	redisClient, err := reader.Connect()
+	if err != nil {
+		return Info{}, err
+	}
+	defer redisClient.Disconnect()
+
+	fields, err := redisClient.Info()
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Parse(fields), nil
+}
+
+// Parse structures the fields of INFO.
+func Parse(fields map[string]string) Info {
+	info := Info{
+		Memory: Memory{
+			UsedMemory:            integer(fields["used_memory"]),
+			UsedMemoryRSS:         integer(fields["used_memory_rss"]),
+			UsedMemoryPeak:        integer(fields["used_memory_peak"]),
+			MaxMemory:             integer(fields["maxmemory"]),
+			MaxMemoryPolicy:       fields["maxmemory_policy"],
+			MemFragmentationRatio: float(fields["mem_fragmentation_ratio"]),
+		},
+		Clients: Clients{
+			ConnectedClients: integer(fields["connected_clients"]),
+			BlockedClients:   integer(fields["blocked_clients"]),
+			MaxClients:       integer(fields["maxclients"]),
+		},
+		Persistence: Persistence{
+			Loading:                 flag(fields["loading"]),
+			RDBChangesSinceLastSave: integer(fields["rdb_changes_since_last_save"]),
+			RDBBgsaveInProgress:     flag(fields["rdb_bgsave_in_progress"]),
+			RDBLastSaveTime:         integer(fields["rdb_last_save_time"]),
+			RDBLastBgsaveStatus:     fields["rdb_last_bgsave_status"],
+			AOFEnabled:              flag(fields["aof_enabled"]),
+			AOFRewriteInProgress:    flag(fields["aof_rewrite_in_progress"]),
+			AOFLastBgrewriteStatus:  fields["aof_last_bgrewrite_status"],
+			AOFLastWriteStatus:      fields["aof_last_write_status"],
+		},
+		Replication: Replication{
+			Role:             fields["role"],
+			ConnectedSlaves:  integer(fields["connected_slaves"]),
+			MasterHost:       fields["master_host"],
+			MasterPort:       integer(fields["master_port"]),
+			MasterLinkStatus: fields["master_link_status"],
+			MasterReplOffset: integer(fields["master_repl_offset"]),
+		},
+		Keyspace: map[string]Keyspace{},
+		Stats: Stats{
+			TotalConnectionsReceived: integer(fields["total_connections_received"]),
+			TotalCommandsProcessed:   integer(fields["total_commands_processed"]),
+			InstantaneousOpsPerSec:   integer(fields["instantaneous_ops_per_sec"]),
+			RejectedConnections:      integer(fields["rejected_connections"]),
+			ExpiredKeys:              integer(fields["expired_keys"]),
+			EvictedKeys:              integer(fields["evicted_keys"]),
+			KeyspaceHits:             integer(fields["keyspace_hits"]),
+			KeyspaceMisses:           integer(fields["keyspace_misses"]),
+		},
+	}
+
+	replicaNames := []string{}
+	for name, value := range fields {
+		if numbered(name, "db") {
+			values := pairs(value)
+			info.Keyspace[name] = Keyspace{
+				Keys:    integer(values["keys"]),
+				Expires: integer(values["expires"]),
+				AvgTTL:  integer(values["avg_ttl"]),
+			}
+		}
+		if numbered(name, "slave") {
+			replicaNames = append(replicaNames, name)
+		}
+	}
+
+	sort.Slice(replicaNames, func(i, j int) bool {
+		return integer(replicaNames[i][len("slave"):]) < integer(replicaNames[j][len("slave"):])
+	})
+	for _, name := range replicaNames {
+		values := pairs(fields[name])
+		info.Replication.Replicas = append(info.Replication.Replicas, Replica{
+			IP:     values["ip"],
+			Port:   integer(values["port"]),
+			State:  values["state"],
+			Offset: integer(values["offset"]),
+			Lag:    integer(values["lag"]),
+		})
+	}
+
+	return info
+}
+
+// numbered reports whether name is prefix followed by a number, such as db0
+// or slave1.
+func numbered(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+		return false
+	}
+	_, err := strconv.Atoi(name[len(prefix):])
+	return err == nil
+}
+
+// pairs splits a value such as keys=1,expires=0,avg_ttl=0.
+func pairs(value string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) == 2 {
+			values[keyValue[0]] = keyValue[1]
+		}
+	}
+	return values
+}
+
+func integer(value string) int64 {
+	i, _ := strconv.ParseInt(value, 10, 64)
+	return i
+}
+
+func float(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+func flag(value string) bool {
+	return value == "1"
+}
@@ -0,0 +1,171 @@
+package redisinfo_test
+
+import (
+	"errors"
+
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
+	"github.com/pivotal-cf/cf-redis-broker/redisinfo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	var fields map[string]string
+
+	BeforeEach(func() {
+		fields = map[string]string{
+			"redis_version":               "6.0.5",
+			"used_memory":                 "1048576",
+			"used_memory_rss":             "2097152",
+			"used_memory_peak":            "3145728",
+			"maxmemory":                   "104857600",
+			"maxmemory_policy":            "allkeys-lru",
+			"mem_fragmentation_ratio":     "2.00",
+			"connected_clients":           "4",
+			"blocked_clients":             "1",
+			"loading":                     "0",
+			"rdb_changes_since_last_save": "12",
+			"rdb_bgsave_in_progress":      "1",
+			"rdb_last_save_time":          "1600000000",
+			"rdb_last_bgsave_status":      "ok",
+			"aof_enabled":                 "1",
+			"aof_last_write_status":       "ok",
+			"role":                        "master",
+			"connected_slaves":            "2",
+			"master_repl_offset":          "4242",
+			"slave1":                      "ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=1",
+			"slave0":                      "ip=10.0.0.2,port=6379,state=online,offset=4242,lag=0",
+			"total_commands_processed":    "100",
+			"instantaneous_ops_per_sec":   "7",
+			"evicted_keys":                "3",
+			"keyspace_hits":               "80",
+			"keyspace_misses":             "20",
+			"db0":                         "keys=10,expires=2,avg_ttl=3000",
+			"db3":                         "keys=1,expires=0,avg_ttl=0",
+		}
+	})
+
+	It("structures memory and clients", func() {
+		info := redisinfo.Parse(fields)
+
+		Ω(info.Memory).Should(Equal(redisinfo.Memory{
+			UsedMemory:            1048576,
+			UsedMemoryRSS:         2097152,
+			UsedMemoryPeak:        3145728,
+			MaxMemory:             104857600,
+			MaxMemoryPolicy:       "allkeys-lru",
+			MemFragmentationRatio: 2,
+		}))
+		Ω(info.Clients).Should(Equal(redisinfo.Clients{ConnectedClients: 4, BlockedClients: 1}))
+	})
+
+	It("structures persistence", func() {
+		persistence := redisinfo.Parse(fields).Persistence
+
+		Ω(persistence.Loading).Should(BeFalse())
+		Ω(persistence.RDBChangesSinceLastSave).Should(BeEquivalentTo(12))
+		Ω(persistence.RDBBgsaveInProgress).Should(BeTrue())
+		Ω(persistence.RDBLastSaveTime).Should(BeEquivalentTo(1600000000))
+		Ω(persistence.AOFEnabled).Should(BeTrue())
+		Ω(persistence.AOFLastWriteStatus).Should(Equal("ok"))
+	})
+
+	It("lists the replicas of a master in order", func() {
+		replication := redisinfo.Parse(fields).Replication
+
+		Ω(replication.Role).Should(Equal("master"))
+		Ω(replication.ConnectedSlaves).Should(BeEquivalentTo(2))
+		Ω(replication.MasterReplOffset).Should(BeEquivalentTo(4242))
+		Ω(replication.Replicas).Should(Equal([]redisinfo.Replica{
+			{IP: "10.0.0.2", Port: 6379, State: "online", Offset: 4242, Lag: 0},
+			{IP: "10.0.0.3", Port: 6379, State: "wait_bgsave", Offset: 0, Lag: 1},
+		}))
+	})
+
+	It("reports the master of a replica", func() {
+		fields["role"] = "slave"
+		fields["master_host"] = "10.0.0.1"
+		fields["master_port"] = "6379"
+		fields["master_link_status"] = "up"
+
+		replication := redisinfo.Parse(fields).Replication
+		Ω(replication.MasterHost).Should(Equal("10.0.0.1"))
+		Ω(replication.MasterPort).Should(BeEquivalentTo(6379))
+		Ω(replication.MasterLinkStatus).Should(Equal("up"))
+	})
+
+	It("structures the keyspace of every database", func() {
+		Ω(redisinfo.Parse(fields).Keyspace).Should(Equal(map[string]redisinfo.Keyspace{
+			"db0": {Keys: 10, Expires: 2, AvgTTL: 3000},
+			"db3": {Keys: 1},
+		}))
+	})
+
+	It("structures stats", func() {
+		stats := redisinfo.Parse(fields).Stats
+
+		Ω(stats.TotalCommandsProcessed).Should(BeEquivalentTo(100))
+		Ω(stats.InstantaneousOpsPerSec).Should(BeEquivalentTo(7))
+		Ω(stats.EvictedKeys).Should(BeEquivalentTo(3))
+		Ω(stats.KeyspaceHits).Should(BeEquivalentTo(80))
+		Ω(stats.KeyspaceMisses).Should(BeEquivalentTo(20))
+	})
+
+	It("leaves out the fields redis does not report", func() {
+		info := redisinfo.Parse(map[string]string{"role": "master"})
+
+		Ω(info.Memory).Should(Equal(redisinfo.Memory{}))
+		Ω(info.Replication.Replicas).Should(BeEmpty())
+		Ω(info.Keyspace).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("Reader", func() {
+	var (
+		fakeClient *fakes.Client
+		reader     *redisinfo.Reader
+		connectErr error
+	)
+
+	BeforeEach(func() {
+		connectErr = nil
+		fakeClient = &fakes.Client{InfoFields: map[string]string{
+			"used_memory": "1024",
+			"db0":         "keys=5,expires=0,avg_ttl=0",
+		}}
+		reader = &redisinfo.Reader{
+			Connect: func() (client.Client, error) {
+				if connectErr != nil {
+					return nil, connectErr
+				}
+				return fakeClient, nil
+			},
+		}
+	})
+
+	It("parses the INFO of redis", func() {
+		info, err := reader.Info()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(info.Memory.UsedMemory).Should(BeEquivalentTo(1024))
+		Ω(info.Keyspace["db0"].Keys).Should(BeEquivalentTo(5))
+		Ω(fakeClient.DisconnectCallCount).Should(Equal(1))
+	})
+
+	It("fails when redis cannot be reached", func() {
+		connectErr = errors.New("connection refused")
+
+		_, err := reader.Info()
+		Ω(err).Should(MatchError("connection refused"))
+	})
+
+	It("fails when INFO fails", func() {
+		fakeClient.ExpectedInfoErr = errors.New("ERR unknown command 'INFO'")
+
+		_, err := reader.Info()
+		Ω(err).Should(MatchError("ERR unknown command 'INFO'"))
+		Ω(fakeClient.DisconnectCallCount).Should(Equal(1))
+	})
+})
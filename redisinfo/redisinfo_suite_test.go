@@ -0,0 +1,15 @@
+package redisinfo_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRedisinfo(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_redisinfo.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Redisinfo Suite", []Reporter{junitReporter})
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pivotal-cf/cf-redis-broker/acl"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 )
 
@@ -20,26 +22,42 @@ type runner interface {
 	Run(command *exec.Cmd) ([]byte, error)
 }
 
+// persistTimeout bounds how long redis may take to write its data before a
+// restart.
+const persistTimeout = time.Minute * 5
+
 type Resetter struct {
 	defaultConfPath     string
 	liveConfPath        string
+	overridesConfPath   string
+	usersConfPath       string
+	tls                 redisconf.TLS
 	portChecker         checker
 	commandRunner       runner
 	monitExecutablePath string
+	connectToRedis      func() (client.Client, error)
 	timeout             time.Duration
 }
 
 func New(defaultConfPath string,
 	liveConfPath string,
+	overridesConfPath string,
+	usersConfPath string,
+	tls redisconf.TLS,
 	portChecker checker,
 	commandRunner runner,
-	monitExecutablePath string) *Resetter {
+	monitExecutablePath string,
+	connectToRedis func() (client.Client, error)) *Resetter {
 	return &Resetter{
 		defaultConfPath:     defaultConfPath,
 		liveConfPath:        liveConfPath,
+		overridesConfPath:   overridesConfPath,
+		usersConfPath:       usersConfPath,
+		tls:                 tls,
 		portChecker:         portChecker,
 		commandRunner:       commandRunner,
 		monitExecutablePath: monitExecutablePath,
+		connectToRedis:      connectToRedis,
 		timeout:             time.Second * 30,
 	}
 }
@@ -61,6 +79,74 @@ func (resetter *Resetter) ResetRedis() error {
 		return err
 	}
 
+	return resetter.waitForRedis()
+}
+
+// ApplyConfig replaces the redis.conf overrides of the current service
+// instance and restarts redis so that they take effect. The config is rebuilt
+// from the default config, so directives dropped from the overrides return to
+// their defaults. The password, the ACL users of bindings and the data are
+// kept: before the restart redis writes its data in the format that the new
+// config loads it from. The overrides are recorded so that they survive a
+// restart of the agent and are discarded when redis is reset.
+func (resetter *Resetter) ApplyConfig(overrides redisconf.Conf) error {
+	liveConf, err := redisconf.Load(resetter.liveConfPath)
+	if err != nil {
+		return err
+	}
+
+	conf, err := redisconf.Load(resetter.defaultConfPath)
+	if err != nil {
+		return err
+	}
+
+	if err := conf.InitForDedicatedNode(liveConf.Password()); err != nil {
+		return err
+	}
+
+	conf.Override(overrides...)
+	resetter.enableTLS(&conf)
+
+	users, err := acl.LoadUsers(resetter.usersConfPath)
+	if err != nil {
+		return err
+	}
+	acl.ApplyUsers(&conf, users)
+
+	if err := resetter.persistData(conf.Get("appendonly") == "yes"); err != nil {
+		return err
+	}
+
+	if err := overrides.Save(resetter.overridesConfPath); err != nil {
+		return err
+	}
+
+	if err := conf.Save(resetter.liveConfPath); err != nil {
+		return err
+	}
+
+	if err := resetter.stopRedis(); err != nil {
+		return err
+	}
+
+	if err := resetter.startRedis(); err != nil {
+		return err
+	}
+
+	return resetter.waitForRedis()
+}
+
+func (resetter *Resetter) persistData(enableAOF bool) error {
+	redisClient, err := resetter.connectToRedis()
+	if err != nil {
+		return err
+	}
+	defer redisClient.Disconnect()
+
+	return client.Persist(redisClient, enableAOF, persistTimeout)
+}
+
+func (resetter *Resetter) waitForRedis() error {
 	conf, err := redisconf.Load(resetter.liveConfPath)
 	if err != nil {
 		return err
@@ -76,7 +162,6 @@ func (resetter *Resetter) ResetRedis() error {
 
 const (
 	monitNotMonitoredStatus = "not monitored"
-	monitRedisProcessPrefix = "Process 'redis'"
 	monitRunningStatus      = "running"
 	monitStart              = "start"
 	monitStop               = "stop"
@@ -85,30 +170,50 @@ const (
 )
 
 func (resetter *Resetter) stopRedis() error {
-	resetter.commandRunner.Run(exec.Command(resetter.monitExecutablePath, monitStop, redisServer))
+	return resetter.StopProcess(redisServer)
+}
+
+func (resetter *Resetter) startRedis() error {
+	return resetter.StartProcess(redisServer)
+}
 
-	return resetter.loopWithTimeout("stopped", func() bool {
-		redisServerStatus := resetter.redisProcessStatus()
-		return redisServerStatus == monitNotMonitoredStatus
+// StopProcess has monit stop the named process and waits until monit no
+// longer monitors it.
+func (resetter *Resetter) StopProcess(name string) error {
+	resetter.commandRunner.Run(exec.Command(resetter.monitExecutablePath, monitStop, name))
+
+	return resetter.loopWithTimeout(name, "stopped", func() bool {
+		return resetter.processStatus(name) == monitNotMonitoredStatus
 	})
 }
 
-func (resetter *Resetter) startRedis() error {
-	resetter.commandRunner.Run(exec.Command(resetter.monitExecutablePath, monitStart, redisServer))
+// StartProcess has monit start the named process and waits until monit
+// reports it as running.
+func (resetter *Resetter) StartProcess(name string) error {
+	resetter.commandRunner.Run(exec.Command(resetter.monitExecutablePath, monitStart, name))
 
-	return resetter.loopWithTimeout("started", func() bool {
-		redisServerStatus := resetter.redisProcessStatus()
-		return redisServerStatus == monitRunningStatus
+	return resetter.loopWithTimeout(name, "started", func() bool {
+		return resetter.processStatus(name) == monitRunningStatus
 	})
 }
 
-func (resetter *Resetter) redisProcessStatus() string {
+// RedisRunning checks that monit reports the redis process as running.
+func (resetter *Resetter) RedisRunning() error {
+	status := resetter.processStatus(redisServer)
+	if status != monitRunningStatus {
+		return fmt.Errorf("monit reports the redis process as '%s'", status)
+	}
+	return nil
+}
+
+func (resetter *Resetter) processStatus(name string) string {
 	output, _ := resetter.commandRunner.Run(exec.Command(resetter.monitExecutablePath, monitSummary))
 	lines := strings.Split(string(output), "\n")
 
+	prefix := "Process '" + name + "'"
 	for _, line := range lines {
-		if strings.HasPrefix(line, monitRedisProcessPrefix) {
-			status := strings.Replace(line, monitRedisProcessPrefix, "", 1)
+		if strings.HasPrefix(line, prefix) {
+			status := strings.Replace(line, prefix, "", 1)
 			return strings.TrimSpace(status)
 		}
 	}
@@ -116,26 +221,26 @@ func (resetter *Resetter) redisProcessStatus() string {
 	return ""
 }
 
-func (resetter *Resetter) loopWithTimeout(desiredState string, redisProcessAction func() bool) error {
-	redisProcessInDesiredState := make(chan bool)
+func (resetter *Resetter) loopWithTimeout(name, desiredState string, processAction func() bool) error {
+	processInDesiredState := make(chan bool)
 
 	go func(successChan chan<- bool) {
 		for {
-			if redisProcessAction() {
+			if processAction() {
 				successChan <- true
 				return
 			}
 			time.Sleep(time.Millisecond * 100)
 		}
-	}(redisProcessInDesiredState)
+	}(processInDesiredState)
 
 	timer := time.NewTimer(resetter.timeout)
 	defer timer.Stop()
 	select {
-	case <-redisProcessInDesiredState:
+	case <-processInDesiredState:
 		break
 	case <-timer.C:
-		return errors.New(fmt.Sprintf("timed out waiting for redis process to be %s by monit after %d seconds", desiredState, resetter.timeout/time.Second))
+		return errors.New(fmt.Sprintf("timed out waiting for %s process to be %s by monit after %d seconds", name, desiredState, resetter.timeout/time.Second))
 	}
 
 	return nil
@@ -147,10 +252,21 @@ func (_ *Resetter) deleteData() error {
 	}
 
 	os.Remove("dump.rdb")
+	// The node may have been part of a Redis Cluster, which keeps its state
+	// next to the data.
+	os.Remove("nodes.conf")
 	return nil
 }
 
 func (resetter *Resetter) resetConfigWithNewPassword() error {
+	if err := os.Remove(resetter.overridesConfPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Remove(resetter.usersConfPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
 	conf, err := redisconf.Load(resetter.defaultConfPath)
 	if err != nil {
 		return err
@@ -161,9 +277,17 @@ func (resetter *Resetter) resetConfigWithNewPassword() error {
 		return err
 	}
 
+	resetter.enableTLS(&conf)
+
 	if err := conf.Save(resetter.liveConfPath); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (resetter *Resetter) enableTLS(conf *redisconf.Conf) {
+	if resetter.tls.Port != 0 {
+		conf.EnableTLS(resetter.tls)
+	}
+}
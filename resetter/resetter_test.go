@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/pivotal-cf/cf-redis-broker/redis/client"
+	"github.com/pivotal-cf/cf-redis-broker/redis/client/fakes"
 	"github.com/pivotal-cf/cf-redis-broker/redisconf"
 	"github.com/pivotal-cf/cf-redis-broker/resetter"
 
@@ -59,11 +61,16 @@ var _ = Describe("Client", func() {
 		redisClient     *resetter.Resetter
 		fakePortChecker *fakeChecker
 		commandRunner   *fakeRunner
+		fakeRedis       *fakes.Client
+		connectToRedis  func() (client.Client, error)
 		aofPath         string
 		rdbPath         string
+		clusterConfPath string
 		redisPort       int
 		confPath        string
 		defaultConfPath string
+		overridesPath   string
+		usersPath       string
 		conf            redisconf.Conf
 
 		monitExecutablePath = "/path/to/monit"
@@ -74,11 +81,24 @@ var _ = Describe("Client", func() {
 		commandRunner = new(fakeRunner)
 		commandRunner.redisProcessStatus = "running"
 		fakePortChecker = new(fakeChecker)
+		fakeRedis = &fakes.Client{
+			ConfigValues: map[string]string{"appendonly": "no"},
+			InfoFields: map[string]string{
+				"aof_enabled":             "1",
+				"aof_rewrite_in_progress": "0",
+				"aof_rewrite_scheduled":   "0",
+			},
+		}
+		connectToRedis = func() (client.Client, error) {
+			return fakeRedis, nil
+		}
 
 		tmpdir, err := ioutil.TempDir("", "redisconf-test")
 		Ω(err).ToNot(HaveOccurred())
 		defaultConfPath = filepath.Join(tmpdir, "redis.conf-default")
 		confPath = filepath.Join(tmpdir, "redis.conf")
+		overridesPath = filepath.Join(tmpdir, "redis.conf.overrides")
+		usersPath = filepath.Join(tmpdir, "redis.conf.users")
 
 		err = redisconf.New(
 			redisconf.Param{
@@ -125,12 +145,17 @@ var _ = Describe("Client", func() {
 		_, err = os.Create(rdbPath)
 		Ω(err).ShouldNot(HaveOccurred())
 
-		redisClient = resetter.New(defaultConfPath, confPath, fakePortChecker, commandRunner, monitExecutablePath)
+		clusterConfPath = filepath.Join(cwd, "nodes.conf")
+		_, err = os.Create(clusterConfPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		redisClient = resetter.New(defaultConfPath, confPath, overridesPath, usersPath, redisconf.TLS{}, fakePortChecker, commandRunner, monitExecutablePath, connectToRedis)
 	})
 
 	AfterEach(func() {
 		os.Remove(aofPath)
 		os.Remove(rdbPath)
+		os.Remove(clusterConfPath)
 	})
 
 	Describe("#ResetRedis", func() {
@@ -207,6 +232,14 @@ System 'system_d289e4bf-dc4b-4369-a7a7-a45e71319fe0' running`,
 			Ω(os.IsNotExist(err)).To(BeTrue())
 		})
 
+		It("removes the cluster state", func() {
+			err := redisClient.ResetRedis()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = os.Stat(clusterConfPath)
+			Ω(os.IsNotExist(err)).To(BeTrue())
+		})
+
 		It("nukes the config file and replaces it with one containing a new password", func() {
 			err := redisClient.ResetRedis()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -219,6 +252,19 @@ System 'system_d289e4bf-dc4b-4369-a7a7-a45e71319fe0' running`,
 			Ω(newPassword).NotTo(Equal(redisPassword))
 		})
 
+		It("keeps TLS enabled", func() {
+			tls := redisconf.TLS{Port: 6380, CertFile: "/certs/redis.crt", KeyFile: "/certs/redis.key", CACertFile: "/certs/ca.crt"}
+			redisClient = resetter.New(defaultConfPath, confPath, overridesPath, usersPath, tls, fakePortChecker, commandRunner, monitExecutablePath, connectToRedis)
+
+			err := redisClient.ResetRedis()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			newConfig, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(newConfig.TLSPort()).Should(Equal(6380))
+			Ω(newConfig.Get("tls-cert-file")).Should(Equal("/certs/redis.crt"))
+		})
+
 		It("does not return until redis is available again", func() {
 			err := redisClient.ResetRedis()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -237,6 +283,32 @@ System 'system_d289e4bf-dc4b-4369-a7a7-a45e71319fe0' running`,
 			})
 		})
 
+		It("discards the config overrides of the previous service instance", func() {
+			err := redisconf.New(redisconf.Param{Key: "maxmemory-policy", Value: "noeviction"}).Save(overridesPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = redisClient.ResetRedis()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = os.Stat(overridesPath)
+			Ω(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("discards the ACL users of the previous service instance", func() {
+			err := redisconf.New(redisconf.Param{Key: "user", Value: "binding-id on #hash ~* +@all"}).Save(usersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = redisClient.ResetRedis()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = os.Stat(usersPath)
+			Ω(os.IsNotExist(err)).To(BeTrue())
+
+			newConfig, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(newConfig.HasKey("user")).To(BeFalse())
+		})
+
 		Context("when the AOF file cannot be removed", func() {
 			JustBeforeEach(func() {
 				err := os.Remove(aofPath)
@@ -248,4 +320,161 @@ System 'system_d289e4bf-dc4b-4369-a7a7-a45e71319fe0' running`,
 			})
 		})
 	})
+
+	Describe("#ApplyConfig", func() {
+		overrides := redisconf.New(
+			redisconf.Param{Key: "appendonly", Value: "yes"},
+			redisconf.Param{Key: "maxmemory-policy", Value: "noeviction"},
+		)
+
+		It("applies the overrides to the config file and keeps the password", func() {
+			err := redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			newConfig, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(newConfig.Get("appendonly")).Should(Equal("yes"))
+			Ω(newConfig.Get("maxmemory-policy")).Should(Equal("noeviction"))
+			Ω(newConfig.Get("requirepass")).Should(Equal(redisPassword))
+		})
+
+		It("keeps TLS enabled", func() {
+			tls := redisconf.TLS{Port: 6380, CertFile: "/certs/redis.crt", KeyFile: "/certs/redis.key", CACertFile: "/certs/ca.crt"}
+			redisClient = resetter.New(defaultConfPath, confPath, overridesPath, usersPath, tls, fakePortChecker, commandRunner, monitExecutablePath, connectToRedis)
+
+			err := redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			newConfig, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(newConfig.TLSPort()).Should(Equal(6380))
+			Ω(newConfig.Get("tls-ca-cert-file")).Should(Equal("/certs/ca.crt"))
+		})
+
+		It("drops directives that are no longer overridden", func() {
+			err := redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = redisClient.ApplyConfig(redisconf.New(
+				redisconf.Param{Key: "appendonly", Value: "yes"},
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			newConfig, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(newConfig.HasKey("maxmemory-policy")).Should(BeFalse())
+			Ω(newConfig.Get("requirepass")).Should(Equal(redisPassword))
+		})
+
+		It("keeps the ACL users of bindings", func() {
+			user := redisconf.Param{Key: "user", Value: "binding-id on #hash ~* +@all"}
+			err := redisconf.New(user).Save(usersPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			newConfig, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(newConfig).Should(ContainElement(user))
+		})
+
+		It("records the overrides", func() {
+			err := redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recordedOverrides, err := redisconf.Load(overridesPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(recordedOverrides).Should(Equal(overrides))
+		})
+
+		It("restarts redis with monit and keeps the data", func() {
+			err := redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			commands := [][]string{}
+			for _, command := range commandRunner.commandsRan {
+				commands = append(commands, command.Args)
+			}
+			Ω(commands[0]).To(Equal([]string{monitExecutablePath, "stop", "redis"}))
+			Ω(commands).To(ContainElement([]string{monitExecutablePath, "start", "redis"}))
+
+			_, err = os.Stat(aofPath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("does not return until redis is available again", func() {
+			err := redisClient.ApplyConfig(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fakePortChecker.addressesWaitedOn).To(HaveLen(1))
+		})
+
+		Context("when the overrides switch AOF on", func() {
+			It("has redis write the AOF file before the restart", func() {
+				err := redisClient.ApplyConfig(overrides)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRedis.EnableAOFCallCount).Should(Equal(1))
+				Ω(fakeRedis.RunBGSaveCallCount).Should(Equal(0))
+				Ω(fakeRedis.DisconnectCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("when AOF is off in the new config", func() {
+			It("has redis save an RDB snapshot before the restart", func() {
+				err := redisClient.ApplyConfig(redisconf.New(
+					redisconf.Param{Key: "appendonly", Value: "no"},
+				))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRedis.EnableAOFCallCount).Should(Equal(0))
+				Ω(fakeRedis.RunBGSaveCallCount).Should(Equal(1))
+				Ω(fakeRedis.WaitForNewSaveSinceCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("when redis fails to save its data", func() {
+			BeforeEach(func() {
+				fakeRedis.ExpectedWaitForNewSaveSinceErr = errors.New("Timed out waiting for background save to complete")
+			})
+
+			It("leaves redis and its config alone", func() {
+				err := redisClient.ApplyConfig(redisconf.New(
+					redisconf.Param{Key: "appendonly", Value: "no"},
+				))
+				Ω(err).Should(MatchError("Timed out waiting for background save to complete"))
+
+				Ω(commandRunner.commandsRan).Should(BeEmpty())
+				liveConf, err := redisconf.Load(confPath)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(liveConf).Should(Equal(conf))
+			})
+		})
+
+		Context("when redis cannot be reached", func() {
+			BeforeEach(func() {
+				connectToRedis = func() (client.Client, error) {
+					return nil, errors.New("connection refused")
+				}
+				redisClient = resetter.New(defaultConfPath, confPath, overridesPath, usersPath, redisconf.TLS{}, fakePortChecker, commandRunner, monitExecutablePath, connectToRedis)
+			})
+
+			It("does not restart redis", func() {
+				err := redisClient.ApplyConfig(overrides)
+				Ω(err).Should(MatchError("connection refused"))
+				Ω(commandRunner.commandsRan).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("#RedisRunning", func() {
+		It("succeeds when monit reports redis as running", func() {
+			Ω(redisClient.RedisRunning()).Should(Succeed())
+		})
+
+		It("returns an error with the status reported by monit otherwise", func() {
+			commandRunner.redisProcessStatus = "not monitored"
+			Ω(redisClient.RedisRunning()).Should(MatchError("monit reports the redis process as 'not monitored'"))
+		})
+	})
 })
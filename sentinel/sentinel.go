@@ -0,0 +1,185 @@
+// Package sentinel runs redis-sentinel next to the redis of a dedicated
+// node, so that the sentinels of a group of nodes promote a replica when
+// the master fails.
+package sentinel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	redisclient "github.com/garyburd/redigo/redis"
+
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+)
+
+// ProcessName is the name of the sentinel process in monit.
+const ProcessName = "redis-sentinel"
+
+const (
+	DefaultDownAfter       = 5 * time.Second
+	DefaultFailoverTimeout = time.Minute
+)
+
+var (
+	ErrNotConfigured = errors.New("sentinel is not configured on this node")
+	ErrUnknownMaster = errors.New("sentinel does not monitor the master")
+)
+
+// Monitor is the master that the sentinel of a node watches.
+type Monitor struct {
+	MasterName string `json:"master_name"`
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Quorum     int    `json:"quorum"`
+	Password   string `json:"password"`
+
+	// SentinelPassword is what clients authenticate to the sentinel with.
+	// It only works on the sentinels, unlike Password.
+	SentinelPassword string `json:"sentinel_password"`
+}
+
+func (monitor Monitor) Validate() error {
+	if monitor.MasterName == "" || monitor.Host == "" || monitor.Port == 0 {
+		return errors.New("master_name, host and port are required")
+	}
+	if monitor.Quorum < 1 {
+		return errors.New("quorum must be at least 1")
+	}
+	return nil
+}
+
+// Address is where a redis or a sentinel accepts connections.
+type Address struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+type processController interface {
+	StartProcess(name string) error
+	StopProcess(name string) error
+}
+
+// Manager writes the config of the sentinel of the node and has monit run
+// it. Without a port sentinel is not configured on the node.
+type Manager struct {
+	ConfPath        string
+	Port            int
+	Processes       processController
+	DownAfter       time.Duration
+	FailoverTimeout time.Duration
+}
+
+// Monitor has the sentinel watch the given master, replacing whatever it
+// watched before.
+func (manager *Manager) Monitor(monitor Monitor) error {
+	if manager.Port == 0 {
+		return ErrNotConfigured
+	}
+
+	if err := monitor.Validate(); err != nil {
+		return err
+	}
+
+	if err := manager.Processes.StopProcess(ProcessName); err != nil {
+		return err
+	}
+
+	if err := manager.Conf(monitor).Save(manager.ConfPath); err != nil {
+		return err
+	}
+
+	return manager.Processes.StartProcess(ProcessName)
+}
+
+// Reset stops the sentinel and discards its config, so that it no longer
+// reconfigures the redis of the node.
+func (manager *Manager) Reset() error {
+	if manager.Port == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(manager.ConfPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := manager.Processes.StopProcess(ProcessName); err != nil {
+		return err
+	}
+
+	return os.Remove(manager.ConfPath)
+}
+
+// Master asks the sentinel for the current address of the master.
+func (manager *Manager) Master(masterName string) (Address, error) {
+	if manager.Port == 0 {
+		return Address{}, ErrNotConfigured
+	}
+
+	conf, err := redisconf.Load(manager.ConfPath)
+	if os.IsNotExist(err) {
+		return Address{}, ErrUnknownMaster
+	}
+	if err != nil {
+		return Address{}, err
+	}
+
+	conn, err := redisclient.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(manager.Port)))
+	if err != nil {
+		return Address{}, err
+	}
+	defer conn.Close()
+
+	if password := conf.Get("requirepass"); password != "" {
+		if _, err := conn.Do("AUTH", password); err != nil {
+			return Address{}, err
+		}
+	}
+
+	reply, err := redisclient.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", masterName))
+	if err == redisclient.ErrNil {
+		return Address{}, ErrUnknownMaster
+	}
+	if err != nil {
+		return Address{}, err
+	}
+	if len(reply) != 2 {
+		return Address{}, fmt.Errorf("unexpected reply from sentinel: %v", reply)
+	}
+
+	port, err := strconv.Atoi(reply[1])
+	if err != nil {
+		return Address{}, err
+	}
+
+	return Address{Host: reply[0], Port: port}, nil
+}
+
+// Conf is the sentinel.conf that watches the master. The sentinel requires
+// a password of its own, so that only clients of the instance can ask it for
+// the master or reconfigure it, without being able to log in to the master.
+func (manager *Manager) Conf(monitor Monitor) redisconf.Conf {
+	downAfter := manager.DownAfter
+	if downAfter <= 0 {
+		downAfter = DefaultDownAfter
+	}
+
+	failoverTimeout := manager.FailoverTimeout
+	if failoverTimeout <= 0 {
+		failoverTimeout = DefaultFailoverTimeout
+	}
+
+	name := monitor.MasterName
+	return redisconf.New(
+		redisconf.Param{Key: "port", Value: strconv.Itoa(manager.Port)},
+		redisconf.Param{Key: "protected-mode", Value: "no"},
+		redisconf.Param{Key: "requirepass", Value: monitor.SentinelPassword},
+		redisconf.Param{Key: "sentinel", Value: fmt.Sprintf("monitor %s %s %d %d", name, monitor.Host, monitor.Port, monitor.Quorum)},
+		redisconf.Param{Key: "sentinel", Value: fmt.Sprintf("auth-pass %s %s", name, monitor.Password)},
+		redisconf.Param{Key: "sentinel", Value: fmt.Sprintf("down-after-milliseconds %s %d", name, downAfter/time.Millisecond)},
+		redisconf.Param{Key: "sentinel", Value: fmt.Sprintf("failover-timeout %s %d", name, failoverTimeout/time.Millisecond)},
+	)
+}
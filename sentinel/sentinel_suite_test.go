@@ -0,0 +1,15 @@
+package sentinel_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSentinel(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_sentinel.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Sentinel Suite", []Reporter{junitReporter})
+}
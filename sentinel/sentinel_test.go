@@ -0,0 +1,151 @@
+package sentinel_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-broker/redisconf"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeProcesses struct {
+	calls   []string
+	stopErr error
+}
+
+func (processes *fakeProcesses) StartProcess(name string) error {
+	processes.calls = append(processes.calls, "start "+name)
+	return nil
+}
+
+func (processes *fakeProcesses) StopProcess(name string) error {
+	processes.calls = append(processes.calls, "stop "+name)
+	return processes.stopErr
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		manager   *sentinel.Manager
+		processes *fakeProcesses
+		tmpDir    string
+		confPath  string
+		monitor   sentinel.Monitor
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "sentinel")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		confPath = filepath.Join(tmpDir, "sentinel.conf")
+		processes = &fakeProcesses{}
+		manager = &sentinel.Manager{
+			ConfPath:  confPath,
+			Port:      26379,
+			Processes: processes,
+		}
+
+		monitor = sentinel.Monitor{
+			MasterName: "instance-id",
+			Host:       "10.0.0.1",
+			Port:       6379,
+			Quorum:     2,
+			Password:   "secret",
+
+			SentinelPassword: "sentinel-secret",
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Describe("Conf", func() {
+		It("watches the master with the default timeouts", func() {
+			Ω(manager.Conf(monitor)).Should(Equal(redisconf.New(
+				redisconf.Param{Key: "port", Value: "26379"},
+				redisconf.Param{Key: "protected-mode", Value: "no"},
+				redisconf.Param{Key: "requirepass", Value: "sentinel-secret"},
+				redisconf.Param{Key: "sentinel", Value: "monitor instance-id 10.0.0.1 6379 2"},
+				redisconf.Param{Key: "sentinel", Value: "auth-pass instance-id secret"},
+				redisconf.Param{Key: "sentinel", Value: "down-after-milliseconds instance-id 5000"},
+				redisconf.Param{Key: "sentinel", Value: "failover-timeout instance-id 60000"},
+			)))
+		})
+
+		It("takes the configured timeouts", func() {
+			manager.DownAfter = time.Second
+			manager.FailoverTimeout = 10 * time.Second
+
+			conf := manager.Conf(monitor)
+			Ω(conf).Should(ContainElement(redisconf.Param{Key: "sentinel", Value: "down-after-milliseconds instance-id 1000"}))
+			Ω(conf).Should(ContainElement(redisconf.Param{Key: "sentinel", Value: "failover-timeout instance-id 10000"}))
+		})
+	})
+
+	Describe("Monitor", func() {
+		It("writes the config and restarts the sentinel", func() {
+			Ω(manager.Monitor(monitor)).Should(Succeed())
+
+			conf, err := redisconf.Load(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf).Should(Equal(manager.Conf(monitor)))
+			Ω(processes.calls).Should(Equal([]string{"stop redis-sentinel", "start redis-sentinel"}))
+		})
+
+		It("rejects incomplete masters", func() {
+			monitor.Quorum = 0
+			Ω(manager.Monitor(monitor)).ShouldNot(Succeed())
+			Ω(processes.calls).Should(BeEmpty())
+		})
+
+		Context("when sentinel is not configured", func() {
+			BeforeEach(func() {
+				manager.Port = 0
+			})
+
+			It("returns ErrNotConfigured", func() {
+				Ω(manager.Monitor(monitor)).Should(Equal(sentinel.ErrNotConfigured))
+			})
+		})
+	})
+
+	Describe("Master", func() {
+		It("returns ErrUnknownMaster when the sentinel watches no master", func() {
+			_, err := manager.Master("instance-id")
+			Ω(err).Should(Equal(sentinel.ErrUnknownMaster))
+		})
+	})
+
+	Describe("Reset", func() {
+		It("does nothing when the sentinel watches no master", func() {
+			Ω(manager.Reset()).Should(Succeed())
+			Ω(processes.calls).Should(BeEmpty())
+		})
+
+		It("stops the sentinel and removes its config", func() {
+			Ω(manager.Monitor(monitor)).Should(Succeed())
+			processes.calls = nil
+
+			Ω(manager.Reset()).Should(Succeed())
+			Ω(processes.calls).Should(Equal([]string{"stop redis-sentinel"}))
+			_, err := os.Stat(confPath)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("keeps the config when the sentinel cannot be stopped", func() {
+			Ω(manager.Monitor(monitor)).Should(Succeed())
+			processes.stopErr = errors.New("monit timed out")
+
+			Ω(manager.Reset()).Should(MatchError("monit timed out"))
+			_, err := os.Stat(confPath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,156 @@
+package sentinelintegration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	redisclient "github.com/garyburd/redigo/redis"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/pivotal-cf/cf-redis-broker/integration/helpers"
+	"github.com/pivotal-cf/cf-redis-broker/sentinel"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// localProcesses runs redis-sentinel directly instead of through monit.
+type localProcesses struct {
+	confPath string
+	session  *gexec.Session
+}
+
+func (processes *localProcesses) StartProcess(name string) error {
+	var err error
+	processes.session, err = gexec.Start(exec.Command(name, processes.confPath), GinkgoWriter, GinkgoWriter)
+	return err
+}
+
+func (processes *localProcesses) StopProcess(name string) error {
+	if processes.session != nil {
+		processes.session.Kill().Wait()
+		processes.session = nil
+	}
+	return nil
+}
+
+var _ = Describe("Failover", func() {
+	const (
+		masterName = "failover-test"
+		password   = "secret"
+	)
+
+	var (
+		tmpDir    string
+		redises   []*gexec.Session
+		managers  []*sentinel.Manager
+		redisPort = []int{6491, 6492, 6493}
+	)
+
+	startRedis := func(port int, args ...string) *gexec.Session {
+		dir := filepath.Join(tmpDir, strconv.Itoa(port))
+		Ω(os.MkdirAll(dir, 0755)).Should(Succeed())
+
+		args = append([]string{
+			"--port", strconv.Itoa(port),
+			"--dir", dir,
+			"--requirepass", password,
+			"--masterauth", password,
+		}, args...)
+
+		session, err := gexec.Start(exec.Command("redis-server", args...), GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+		Eventually(func() bool { return helpers.ServiceAvailable(uint(port)) }).Should(BeTrue())
+		return session
+	}
+
+	role := func(port int) func() string {
+		return func() string {
+			client := helpers.BuildRedisClient(uint(port), "127.0.0.1", password)
+			defer client.Close()
+
+			reply, err := redisclient.Values(client.Do("ROLE"))
+			if err != nil || len(reply) == 0 {
+				return ""
+			}
+			role, _ := redisclient.String(reply[0], nil)
+			return role
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "sentinelintegration")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		redises = []*gexec.Session{startRedis(redisPort[0])}
+		for _, port := range redisPort[1:] {
+			redises = append(redises, startRedis(port, "--replicaof", "127.0.0.1", strconv.Itoa(redisPort[0])))
+		}
+
+		managers = nil
+		for i := range redisPort {
+			confPath := filepath.Join(tmpDir, "sentinel-"+strconv.Itoa(i)+".conf")
+			manager := &sentinel.Manager{
+				ConfPath:        confPath,
+				Port:            26491 + i,
+				Processes:       &localProcesses{confPath: confPath},
+				DownAfter:       time.Second,
+				FailoverTimeout: 5 * time.Second,
+			}
+
+			err := manager.Monitor(sentinel.Monitor{
+				MasterName: masterName,
+				Host:       "127.0.0.1",
+				Port:       redisPort[0],
+				Quorum:     2,
+				Password:   password,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			managers = append(managers, manager)
+		}
+	})
+
+	AfterEach(func() {
+		for _, manager := range managers {
+			manager.Reset()
+		}
+		for _, redis := range redises {
+			redis.Kill().Wait()
+		}
+		os.RemoveAll(tmpDir)
+	})
+
+	It("reports the master", func() {
+		for _, manager := range managers {
+			Eventually(func() (sentinel.Address, error) {
+				return manager.Master(masterName)
+			}).Should(Equal(sentinel.Address{Host: "127.0.0.1", Port: redisPort[0]}))
+		}
+	})
+
+	It("promotes a replica when the master goes down", func() {
+		for _, port := range redisPort[1:] {
+			Eventually(role(port), 10*time.Second).Should(Equal("slave"))
+		}
+
+		redises[0].Kill().Wait()
+
+		var promoted sentinel.Address
+		Eventually(func() bool {
+			promoted, _ = managers[0].Master(masterName)
+			return promoted.Port == redisPort[1] || promoted.Port == redisPort[2]
+		}, 30*time.Second, 500*time.Millisecond).Should(BeTrue())
+
+		Eventually(role(promoted.Port), 10*time.Second).Should(Equal("master"))
+		for _, manager := range managers[1:] {
+			Eventually(func() (sentinel.Address, error) {
+				return manager.Master(masterName)
+			}, 10*time.Second).Should(Equal(promoted))
+		}
+	})
+})
@@ -0,0 +1,15 @@
+package sentinelintegration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSentinelintegration(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_sentinelintegration.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Sentinel Integration Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,510 @@
+package serviceapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/auth"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	provisionLogKey     = "provision"
+	deprovisionLogKey   = "deprovision"
+	updateLogKey        = "update"
+	bindLogKey          = "bind"
+	unbindLogKey        = "unbind"
+	lastOperationLogKey = "last-operation"
+
+	instanceIDLogKey      = "instance-id"
+	bindingIDLogKey       = "binding-id"
+	instanceDetailsLogKey = "instance-details"
+	operationIDLogKey     = "operation-id"
+
+	statusUnprocessableEntity = 422
+)
+
+type OperationState string
+
+const (
+	OperationInProgress OperationState = "in progress"
+	OperationSucceeded  OperationState = "succeeded"
+	OperationFailed     OperationState = "failed"
+)
+
+var (
+	ErrConcurrentOperation    = errors.New("another operation for this service instance is in progress")
+	ErrOperationNotFound      = errors.New("operation does not exist")
+	ErrAsyncRequired          = errors.New("this update can only be completed asynchronously")
+	ErrPlanChangeNotSupported = errors.New("the service instance cannot be moved to the requested plan")
+)
+
+// InvalidParametersError is returned by brokers when the parameters given
+// with a request are not accepted.
+type InvalidParametersError struct {
+	Description string
+}
+
+func (err InvalidParametersError) Error() string {
+	return err.Description
+}
+
+type ProvisionDetails struct {
+	brokerapi.ServiceDetails
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+type PreviousValues struct {
+	PlanID    string `json:"plan_id"`
+	ServiceID string `json:"service_id"`
+}
+
+type UpdateDetails struct {
+	ServiceID      string                 `json:"service_id"`
+	PlanID         string                 `json:"plan_id"`
+	Parameters     map[string]interface{} `json:"parameters"`
+	PreviousValues PreviousValues         `json:"previous_values"`
+}
+
+type BindDetails struct {
+	AppGUID    string                 `json:"app_guid"`
+	PlanID     string                 `json:"plan_id"`
+	ServiceID  string                 `json:"service_id"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+type LastOperation struct {
+	State       OperationState `json:"state"`
+	Description string         `json:"description,omitempty"`
+}
+
+// ServiceBroker is implemented by brokers that can run provisioning,
+// deprovisioning and updates in the background when the platform accepts
+// incomplete operations. An empty operation ID means the work was completed
+// synchronously. Bindings can be given parameters.
+type ServiceBroker interface {
+	ProvisionInstance(instanceID string, details ProvisionDetails, acceptsIncomplete bool) (string, error)
+	DeprovisionInstance(instanceID string, acceptsIncomplete bool) (string, error)
+	UpdateInstance(instanceID string, details UpdateDetails, acceptsIncomplete bool) (string, error)
+	LastOperation(instanceID, operationID string) (LastOperation, error)
+	BindInstance(instanceID, bindingID string, details BindDetails) (interface{}, error)
+
+	brokerapi.ServiceBroker
+}
+
+// service adds the fields that the vendored brokerapi does not know about to
+// the catalog.
+type service struct {
+	brokerapi.Service
+	PlanUpdateable bool `json:"plan_updateable"`
+}
+
+type catalogResponse struct {
+	Services []service `json:"services"`
+}
+
+type operationResponse struct {
+	Operation string `json:"operation,omitempty"`
+}
+
+type bindingResponse struct {
+	Credentials interface{} `json:"credentials"`
+}
+
+type errorResponse struct {
+	Error       string `json:"error,omitempty"`
+	Description string `json:"description"`
+}
+
+// New serves the parts of the service broker API that brokerapi does not
+// implement, or cannot answer with the errors of the broker. Every other
+// request is handed to the brokerapi handler.
+func New(serviceBroker ServiceBroker, logger lager.Logger, brokerCredentials brokerapi.BrokerCredentials) http.Handler {
+	router := mux.NewRouter()
+
+	router.Path("/v2/catalog").
+		Methods("GET").
+		HandlerFunc(catalog(serviceBroker))
+
+	router.Path("/v2/service_instances/{instance_id}").
+		Methods("PUT").
+		HandlerFunc(provision(serviceBroker, logger))
+
+	router.Path("/v2/service_instances/{instance_id}").
+		Methods("DELETE").
+		HandlerFunc(deprovision(serviceBroker, logger))
+
+	router.Path("/v2/service_instances/{instance_id}").
+		Methods("PATCH").
+		HandlerFunc(update(serviceBroker, logger))
+
+	router.Path("/v2/service_instances/{instance_id}/last_operation").
+		Methods("GET").
+		HandlerFunc(lastOperation(serviceBroker, logger))
+
+	router.Path("/v2/service_instances/{instance_id}/service_bindings/{binding_id}").
+		Methods("PUT").
+		HandlerFunc(bind(serviceBroker, logger))
+
+	router.Path("/v2/service_instances/{instance_id}/service_bindings/{binding_id}").
+		Methods("DELETE").
+		HandlerFunc(unbind(serviceBroker, logger))
+
+	router.NotFoundHandler = brokerapi.New(serviceBroker, logger, brokerCredentials)
+
+	return auth.NewWrapper(brokerCredentials.Username, brokerCredentials.Password).Wrap(router)
+}
+
+func catalog(serviceBroker ServiceBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		services := []service{}
+		for _, brokerService := range serviceBroker.Services() {
+			services = append(services, service{
+				Service:        brokerService,
+				PlanUpdateable: true,
+			})
+		}
+
+		respond(w, http.StatusOK, catalogResponse{Services: services})
+	}
+}
+
+func provision(serviceBroker ServiceBroker, logger lager.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		instanceID := mux.Vars(req)["instance_id"]
+
+		logger := logger.Session(provisionLogKey, lager.Data{
+			instanceIDLogKey: instanceID,
+		})
+
+		var details ProvisionDetails
+		if err := json.NewDecoder(req.Body).Decode(&details); err != nil {
+			logger.Error("invalid-service-details", err)
+			respond(w, statusUnprocessableEntity, errorResponse{
+				Description: err.Error(),
+			})
+			return
+		}
+
+		logger = logger.WithData(lager.Data{
+			instanceDetailsLogKey: details,
+		})
+
+		operationID, err := serviceBroker.ProvisionInstance(instanceID, details, acceptsIncomplete(req))
+		if err != nil {
+			respondWithProvisionError(w, logger, err)
+			return
+		}
+
+		if operationID == "" {
+			respond(w, http.StatusCreated, brokerapi.ProvisioningResponse{})
+			return
+		}
+
+		logger.Info("accepted", lager.Data{operationIDLogKey: operationID})
+		respond(w, http.StatusAccepted, operationResponse{Operation: operationID})
+	}
+}
+
+func deprovision(serviceBroker ServiceBroker, logger lager.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		instanceID := mux.Vars(req)["instance_id"]
+
+		logger := logger.Session(deprovisionLogKey, lager.Data{
+			instanceIDLogKey: instanceID,
+		})
+
+		operationID, err := serviceBroker.DeprovisionInstance(instanceID, acceptsIncomplete(req))
+		if err != nil {
+			respondWithDeprovisionError(w, logger, err)
+			return
+		}
+
+		if operationID == "" {
+			respond(w, http.StatusOK, brokerapi.EmptyResponse{})
+			return
+		}
+
+		logger.Info("accepted", lager.Data{operationIDLogKey: operationID})
+		respond(w, http.StatusAccepted, operationResponse{Operation: operationID})
+	}
+}
+
+func update(serviceBroker ServiceBroker, logger lager.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		instanceID := mux.Vars(req)["instance_id"]
+
+		logger := logger.Session(updateLogKey, lager.Data{
+			instanceIDLogKey: instanceID,
+		})
+
+		var details UpdateDetails
+		if err := json.NewDecoder(req.Body).Decode(&details); err != nil {
+			logger.Error("invalid-update-details", err)
+			respond(w, statusUnprocessableEntity, errorResponse{
+				Description: err.Error(),
+			})
+			return
+		}
+
+		logger = logger.WithData(lager.Data{
+			instanceDetailsLogKey: details,
+		})
+
+		operationID, err := serviceBroker.UpdateInstance(instanceID, details, acceptsIncomplete(req))
+		if err != nil {
+			respondWithUpdateError(w, logger, err)
+			return
+		}
+
+		if operationID == "" {
+			respond(w, http.StatusOK, brokerapi.EmptyResponse{})
+			return
+		}
+
+		logger.Info("accepted", lager.Data{operationIDLogKey: operationID})
+		respond(w, http.StatusAccepted, operationResponse{Operation: operationID})
+	}
+}
+
+func bind(serviceBroker ServiceBroker, logger lager.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		instanceID := vars["instance_id"]
+		bindingID := vars["binding_id"]
+
+		logger := logger.Session(bindLogKey, lager.Data{
+			instanceIDLogKey: instanceID,
+			bindingIDLogKey:  bindingID,
+		})
+
+		var details BindDetails
+		if err := json.NewDecoder(req.Body).Decode(&details); err != nil {
+			logger.Error("invalid-binding-details", err)
+			respond(w, statusUnprocessableEntity, errorResponse{
+				Description: err.Error(),
+			})
+			return
+		}
+
+		credentials, err := serviceBroker.BindInstance(instanceID, bindingID, details)
+		if err != nil {
+			respondWithBindError(w, logger, err)
+			return
+		}
+
+		respond(w, http.StatusCreated, bindingResponse{Credentials: credentials})
+	}
+}
+
+func unbind(serviceBroker ServiceBroker, logger lager.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		instanceID := vars["instance_id"]
+		bindingID := vars["binding_id"]
+
+		logger := logger.Session(unbindLogKey, lager.Data{
+			instanceIDLogKey: instanceID,
+			bindingIDLogKey:  bindingID,
+		})
+
+		if err := serviceBroker.Unbind(instanceID, bindingID); err != nil {
+			respondWithUnbindError(w, logger, err)
+			return
+		}
+
+		respond(w, http.StatusOK, brokerapi.EmptyResponse{})
+	}
+}
+
+func lastOperation(serviceBroker ServiceBroker, logger lager.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		instanceID := mux.Vars(req)["instance_id"]
+		operationID := req.URL.Query().Get("operation")
+
+		logger := logger.Session(lastOperationLogKey, lager.Data{
+			instanceIDLogKey:  instanceID,
+			operationIDLogKey: operationID,
+		})
+
+		operation, err := serviceBroker.LastOperation(instanceID, operationID)
+		if err != nil {
+			switch err {
+			case ErrOperationNotFound, brokerapi.ErrInstanceDoesNotExist:
+				logger.Error("operation-missing", err)
+				respond(w, http.StatusGone, brokerapi.EmptyResponse{})
+			default:
+				logger.Error("unknown-error", err)
+				respond(w, http.StatusInternalServerError, errorResponse{
+					Description: err.Error(),
+				})
+			}
+			return
+		}
+
+		respond(w, http.StatusOK, operation)
+	}
+}
+
+func respondWithProvisionError(w http.ResponseWriter, logger lager.Logger, err error) {
+	if _, ok := err.(InvalidParametersError); ok {
+		logger.Error("invalid-parameters", err)
+		respond(w, http.StatusBadRequest, errorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	switch err {
+	case brokerapi.ErrInstanceAlreadyExists:
+		logger.Error("instance-already-exists", err)
+		respond(w, http.StatusConflict, brokerapi.EmptyResponse{})
+	case ErrConcurrentOperation:
+		logger.Error("concurrent-operation", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "ConcurrencyError",
+			Description: err.Error(),
+		})
+	case brokerapi.ErrInstanceLimitMet:
+		logger.Error("instance-limit-reached", err)
+		respond(w, http.StatusInternalServerError, errorResponse{
+			Description: err.Error(),
+		})
+	default:
+		logger.Error("unknown-error", err)
+		respond(w, http.StatusInternalServerError, errorResponse{
+			Description: err.Error(),
+		})
+	}
+}
+
+func respondWithDeprovisionError(w http.ResponseWriter, logger lager.Logger, err error) {
+	switch err {
+	case brokerapi.ErrInstanceDoesNotExist:
+		logger.Error("instance-missing", err)
+		respond(w, http.StatusGone, brokerapi.EmptyResponse{})
+	case ErrConcurrentOperation:
+		logger.Error("concurrent-operation", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "ConcurrencyError",
+			Description: err.Error(),
+		})
+	default:
+		logger.Error("unknown-error", err)
+		respond(w, http.StatusInternalServerError, errorResponse{
+			Description: err.Error(),
+		})
+	}
+}
+
+func respondWithUpdateError(w http.ResponseWriter, logger lager.Logger, err error) {
+	if _, ok := err.(InvalidParametersError); ok {
+		logger.Error("invalid-parameters", err)
+		respond(w, http.StatusBadRequest, errorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	switch err {
+	case brokerapi.ErrInstanceDoesNotExist:
+		logger.Error("instance-missing", err)
+		respond(w, http.StatusNotFound, errorResponse{
+			Description: err.Error(),
+		})
+	case ErrConcurrentOperation:
+		logger.Error("concurrent-operation", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "ConcurrencyError",
+			Description: err.Error(),
+		})
+	case ErrAsyncRequired:
+		logger.Error("async-required", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "AsyncRequired",
+			Description: err.Error(),
+		})
+	case ErrPlanChangeNotSupported:
+		logger.Error("plan-change-not-supported", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "PlanChangeNotSupported",
+			Description: err.Error(),
+		})
+	default:
+		logger.Error("unknown-error", err)
+		respond(w, http.StatusInternalServerError, errorResponse{
+			Description: err.Error(),
+		})
+	}
+}
+
+func respondWithBindError(w http.ResponseWriter, logger lager.Logger, err error) {
+	if _, ok := err.(InvalidParametersError); ok {
+		logger.Error("invalid-parameters", err)
+		respond(w, http.StatusBadRequest, errorResponse{
+			Description: err.Error(),
+		})
+		return
+	}
+
+	switch err {
+	case brokerapi.ErrInstanceDoesNotExist:
+		logger.Error("instance-missing", err)
+		respond(w, http.StatusNotFound, errorResponse{
+			Description: err.Error(),
+		})
+	case brokerapi.ErrBindingAlreadyExists:
+		logger.Error("binding-already-exists", err)
+		respond(w, http.StatusConflict, errorResponse{
+			Description: err.Error(),
+		})
+	case ErrConcurrentOperation:
+		logger.Error("concurrent-operation", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "ConcurrencyError",
+			Description: err.Error(),
+		})
+	default:
+		logger.Error("unknown-error", err)
+		respond(w, http.StatusInternalServerError, errorResponse{
+			Description: err.Error(),
+		})
+	}
+}
+
+func respondWithUnbindError(w http.ResponseWriter, logger lager.Logger, err error) {
+	switch err {
+	case brokerapi.ErrInstanceDoesNotExist:
+		logger.Error("instance-missing", err)
+		respond(w, http.StatusNotFound, brokerapi.EmptyResponse{})
+	case brokerapi.ErrBindingDoesNotExist:
+		logger.Error("binding-missing", err)
+		respond(w, http.StatusGone, brokerapi.EmptyResponse{})
+	case ErrConcurrentOperation:
+		logger.Error("concurrent-operation", err)
+		respond(w, statusUnprocessableEntity, errorResponse{
+			Error:       "ConcurrencyError",
+			Description: err.Error(),
+		})
+	default:
+		logger.Error("unknown-error", err)
+		respond(w, http.StatusInternalServerError, errorResponse{
+			Description: err.Error(),
+		})
+	}
+}
+
+func acceptsIncomplete(req *http.Request) bool {
+	return req.URL.Query().Get("accepts_incomplete") == "true"
+}
+
+func respond(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.Encode(response)
+}
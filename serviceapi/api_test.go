@@ -0,0 +1,402 @@
+package serviceapi_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/cf-redis-broker/serviceapi"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeServiceBroker struct {
+	provisionedInstanceIDs      []string
+	asyncProvisionedInstanceIDs []string
+	deprovisionedInstanceIDs    []string
+	provisionDetails            serviceapi.ProvisionDetails
+	operationID                 string
+	provisionErr                error
+	deprovisionErr              error
+	updateDetails               serviceapi.UpdateDetails
+	updateAcceptsIncomplete     bool
+	updateErr                   error
+	lastOperation               serviceapi.LastOperation
+	lastOperationErr            error
+	requestedOperationID        string
+	bindDetails                 serviceapi.BindDetails
+	bindErr                     error
+	unbindErr                   error
+}
+
+func (broker *fakeServiceBroker) Services() []brokerapi.Service {
+	return []brokerapi.Service{{ID: "service-id"}}
+}
+
+func (broker *fakeServiceBroker) Provision(instanceID string, details brokerapi.ServiceDetails) error {
+	return errors.New("not used by the service API")
+}
+
+func (broker *fakeServiceBroker) ProvisionInstance(instanceID string, details serviceapi.ProvisionDetails, acceptsIncomplete bool) (string, error) {
+	broker.provisionDetails = details
+	if !acceptsIncomplete {
+		broker.provisionedInstanceIDs = append(broker.provisionedInstanceIDs, instanceID)
+		return "", broker.provisionErr
+	}
+
+	broker.asyncProvisionedInstanceIDs = append(broker.asyncProvisionedInstanceIDs, instanceID)
+	return broker.operationID, broker.provisionErr
+}
+
+func (broker *fakeServiceBroker) Deprovision(instanceID string) error {
+	return errors.New("not used by the service API")
+}
+
+func (broker *fakeServiceBroker) DeprovisionInstance(instanceID string, acceptsIncomplete bool) (string, error) {
+	if !acceptsIncomplete {
+		broker.deprovisionedInstanceIDs = append(broker.deprovisionedInstanceIDs, instanceID)
+		return "", broker.deprovisionErr
+	}
+
+	return broker.operationID, broker.deprovisionErr
+}
+
+func (broker *fakeServiceBroker) UpdateInstance(instanceID string, details serviceapi.UpdateDetails, acceptsIncomplete bool) (string, error) {
+	broker.updateDetails = details
+	broker.updateAcceptsIncomplete = acceptsIncomplete
+	if !acceptsIncomplete {
+		return "", broker.updateErr
+	}
+
+	return broker.operationID, broker.updateErr
+}
+
+func (broker *fakeServiceBroker) LastOperation(instanceID, operationID string) (serviceapi.LastOperation, error) {
+	broker.requestedOperationID = operationID
+	return broker.lastOperation, broker.lastOperationErr
+}
+
+func (broker *fakeServiceBroker) BindInstance(instanceID, bindingID string, details serviceapi.BindDetails) (interface{}, error) {
+	broker.bindDetails = details
+	if broker.bindErr != nil {
+		return nil, broker.bindErr
+	}
+	return map[string]interface{}{"username": bindingID}, nil
+}
+
+func (broker *fakeServiceBroker) Bind(instanceID, bindingID string) (interface{}, error) {
+	return nil, nil
+}
+
+func (broker *fakeServiceBroker) Unbind(instanceID, bindingID string) error {
+	return broker.unbindErr
+}
+
+var _ = Describe("Service API", func() {
+	var (
+		server        *httptest.Server
+		serviceBroker *fakeServiceBroker
+	)
+
+	BeforeEach(func() {
+		serviceBroker = &fakeServiceBroker{}
+		handler := serviceapi.New(serviceBroker, lagertest.NewTestLogger("serviceapi"), brokerapi.BrokerCredentials{
+			Username: "admin",
+			Password: "secret",
+		})
+		server = httptest.NewServer(handler)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	makeRequest := func(method, path, body string) (int, map[string]interface{}) {
+		request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		Ω(err).ShouldNot(HaveOccurred())
+		request.SetBasicAuth("admin", "secret")
+
+		response, err := http.DefaultClient.Do(request)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer response.Body.Close()
+
+		responseBody, err := ioutil.ReadAll(response.Body)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		parsed := map[string]interface{}{}
+		json.Unmarshal(responseBody, &parsed)
+		return response.StatusCode, parsed
+	}
+
+	It("requires basic auth", func() {
+		response, err := http.Get(server.URL + "/v2/service_instances/instance-id/last_operation")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(response.StatusCode).Should(Equal(http.StatusUnauthorized))
+	})
+
+	It("serves the catalog with plan changes enabled", func() {
+		code, body := makeRequest("GET", "/v2/catalog", "")
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(body["services"]).Should(HaveLen(1))
+
+		service := body["services"].([]interface{})[0].(map[string]interface{})
+		Ω(service["id"]).Should(Equal("service-id"))
+		Ω(service["plan_updateable"]).Should(BeTrue())
+	})
+
+	Describe("PUT /v2/service_instances/:id", func() {
+		const details = `{"service_id":"service-id","plan_id":"plan-id"}`
+
+		Context("when accepts_incomplete is not set", func() {
+			It("provisions synchronously", func() {
+				code, _ := makeRequest("PUT", "/v2/service_instances/instance-id", details)
+				Ω(code).Should(Equal(http.StatusCreated))
+				Ω(serviceBroker.provisionedInstanceIDs).Should(Equal([]string{"instance-id"}))
+				Ω(serviceBroker.asyncProvisionedInstanceIDs).Should(BeEmpty())
+			})
+		})
+
+		Context("when accepts_incomplete is true", func() {
+			BeforeEach(func() {
+				serviceBroker.operationID = "operation-id"
+			})
+
+			It("returns 202 with the operation id", func() {
+				code, body := makeRequest("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", details)
+				Ω(code).Should(Equal(http.StatusAccepted))
+				Ω(body["operation"]).Should(Equal("operation-id"))
+				Ω(serviceBroker.asyncProvisionedInstanceIDs).Should(Equal([]string{"instance-id"}))
+			})
+
+			It("returns 201 when the broker completed the work synchronously", func() {
+				serviceBroker.operationID = ""
+				code, _ := makeRequest("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", details)
+				Ω(code).Should(Equal(http.StatusCreated))
+			})
+
+			It("returns 409 when the instance already exists", func() {
+				serviceBroker.provisionErr = brokerapi.ErrInstanceAlreadyExists
+				code, _ := makeRequest("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", details)
+				Ω(code).Should(Equal(http.StatusConflict))
+			})
+
+			It("returns 422 when another operation is in progress", func() {
+				serviceBroker.provisionErr = serviceapi.ErrConcurrentOperation
+				code, body := makeRequest("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", details)
+				Ω(code).Should(Equal(422))
+				Ω(body["error"]).Should(Equal("ConcurrencyError"))
+			})
+		})
+
+		It("passes the parameters to the broker", func() {
+			code, _ := makeRequest("PUT", "/v2/service_instances/instance-id", `{"plan_id":"plan-id","parameters":{"maxmemory-policy":"noeviction"}}`)
+			Ω(code).Should(Equal(http.StatusCreated))
+			Ω(serviceBroker.provisionDetails.PlanID).Should(Equal("plan-id"))
+			Ω(serviceBroker.provisionDetails.Parameters).Should(Equal(map[string]interface{}{
+				"maxmemory-policy": "noeviction",
+			}))
+		})
+
+		It("returns 400 when the parameters are rejected", func() {
+			serviceBroker.provisionErr = serviceapi.InvalidParametersError{Description: "Parameter 'foo' is not supported"}
+			code, body := makeRequest("PUT", "/v2/service_instances/instance-id", details)
+			Ω(code).Should(Equal(http.StatusBadRequest))
+			Ω(body["description"]).Should(Equal("Parameter 'foo' is not supported"))
+		})
+
+		It("returns 422 when the body is not valid JSON", func() {
+			code, _ := makeRequest("PUT", "/v2/service_instances/instance-id", "{{")
+			Ω(code).Should(Equal(422))
+		})
+	})
+
+	Describe("DELETE /v2/service_instances/:id", func() {
+		It("deprovisions synchronously when accepts_incomplete is not set", func() {
+			code, _ := makeRequest("DELETE", "/v2/service_instances/instance-id", "")
+			Ω(code).Should(Equal(http.StatusOK))
+			Ω(serviceBroker.deprovisionedInstanceIDs).Should(Equal([]string{"instance-id"}))
+		})
+
+		It("returns 202 with the operation id when accepts_incomplete is true", func() {
+			serviceBroker.operationID = "operation-id"
+			code, body := makeRequest("DELETE", "/v2/service_instances/instance-id?accepts_incomplete=true", "")
+			Ω(code).Should(Equal(http.StatusAccepted))
+			Ω(body["operation"]).Should(Equal("operation-id"))
+		})
+
+		It("returns 410 when the instance does not exist", func() {
+			serviceBroker.deprovisionErr = brokerapi.ErrInstanceDoesNotExist
+			code, _ := makeRequest("DELETE", "/v2/service_instances/instance-id?accepts_incomplete=true", "")
+			Ω(code).Should(Equal(http.StatusGone))
+		})
+	})
+
+	Describe("PATCH /v2/service_instances/:id", func() {
+		const details = `{"service_id":"service-id","plan_id":"new-plan-id","parameters":{"maxmemory-policy":"noeviction"},"previous_values":{"plan_id":"old-plan-id"}}`
+
+		It("updates synchronously when accepts_incomplete is not set", func() {
+			code, _ := makeRequest("PATCH", "/v2/service_instances/instance-id", details)
+			Ω(code).Should(Equal(http.StatusOK))
+			Ω(serviceBroker.updateAcceptsIncomplete).Should(BeFalse())
+			Ω(serviceBroker.updateDetails).Should(Equal(serviceapi.UpdateDetails{
+				ServiceID:      "service-id",
+				PlanID:         "new-plan-id",
+				Parameters:     map[string]interface{}{"maxmemory-policy": "noeviction"},
+				PreviousValues: serviceapi.PreviousValues{PlanID: "old-plan-id"},
+			}))
+		})
+
+		It("returns 202 with the operation id when accepts_incomplete is true", func() {
+			serviceBroker.operationID = "operation-id"
+			code, body := makeRequest("PATCH", "/v2/service_instances/instance-id?accepts_incomplete=true", details)
+			Ω(code).Should(Equal(http.StatusAccepted))
+			Ω(body["operation"]).Should(Equal("operation-id"))
+		})
+
+		It("returns 400 when the parameters are rejected", func() {
+			serviceBroker.updateErr = serviceapi.InvalidParametersError{Description: "Parameter 'port' is not supported"}
+			code, body := makeRequest("PATCH", "/v2/service_instances/instance-id", details)
+			Ω(code).Should(Equal(http.StatusBadRequest))
+			Ω(body["description"]).Should(Equal("Parameter 'port' is not supported"))
+		})
+
+		It("returns 404 when the instance does not exist", func() {
+			serviceBroker.updateErr = brokerapi.ErrInstanceDoesNotExist
+			code, _ := makeRequest("PATCH", "/v2/service_instances/instance-id", details)
+			Ω(code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("returns 422 AsyncRequired when the update has to run in the background", func() {
+			serviceBroker.updateErr = serviceapi.ErrAsyncRequired
+			code, body := makeRequest("PATCH", "/v2/service_instances/instance-id", details)
+			Ω(code).Should(Equal(422))
+			Ω(body["error"]).Should(Equal("AsyncRequired"))
+		})
+
+		It("returns 422 PlanChangeNotSupported when the plan cannot be changed", func() {
+			serviceBroker.updateErr = serviceapi.ErrPlanChangeNotSupported
+			code, body := makeRequest("PATCH", "/v2/service_instances/instance-id", details)
+			Ω(code).Should(Equal(422))
+			Ω(body["error"]).Should(Equal("PlanChangeNotSupported"))
+		})
+	})
+
+	Describe("PUT /v2/service_instances/:id/service_bindings/:binding_id", func() {
+		const path = "/v2/service_instances/instance-id/service_bindings/binding-id"
+		const details = `{"app_guid":"app-guid","plan_id":"plan-id","service_id":"service-id","parameters":{"read_only":true}}`
+
+		It("returns 201 with the credentials", func() {
+			code, body := makeRequest("PUT", path, details)
+			Ω(code).Should(Equal(http.StatusCreated))
+			Ω(body["credentials"]).Should(Equal(map[string]interface{}{"username": "binding-id"}))
+			Ω(serviceBroker.bindDetails).Should(Equal(serviceapi.BindDetails{
+				AppGUID:    "app-guid",
+				PlanID:     "plan-id",
+				ServiceID:  "service-id",
+				Parameters: map[string]interface{}{"read_only": true},
+			}))
+		})
+
+		It("returns 400 when the parameters are rejected", func() {
+			serviceBroker.bindErr = serviceapi.InvalidParametersError{Description: "unknown binding parameter"}
+			code, body := makeRequest("PUT", path, details)
+			Ω(code).Should(Equal(http.StatusBadRequest))
+			Ω(body["description"]).Should(Equal("unknown binding parameter"))
+		})
+
+		It("returns 404 when the instance does not exist", func() {
+			serviceBroker.bindErr = brokerapi.ErrInstanceDoesNotExist
+			code, _ := makeRequest("PUT", path, details)
+			Ω(code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("returns 409 when the binding already exists", func() {
+			serviceBroker.bindErr = brokerapi.ErrBindingAlreadyExists
+			code, _ := makeRequest("PUT", path, details)
+			Ω(code).Should(Equal(http.StatusConflict))
+		})
+
+		It("returns 422 when an operation is in progress", func() {
+			serviceBroker.bindErr = serviceapi.ErrConcurrentOperation
+			code, body := makeRequest("PUT", path, details)
+			Ω(code).Should(Equal(422))
+			Ω(body["error"]).Should(Equal("ConcurrencyError"))
+		})
+
+		It("returns 500 for other errors", func() {
+			serviceBroker.bindErr = errors.New("agent unreachable")
+			code, body := makeRequest("PUT", path, details)
+			Ω(code).Should(Equal(http.StatusInternalServerError))
+			Ω(body["description"]).Should(Equal("agent unreachable"))
+		})
+	})
+
+	Describe("DELETE /v2/service_instances/:id/service_bindings/:binding_id", func() {
+		const path = "/v2/service_instances/instance-id/service_bindings/binding-id?service_id=service-id&plan_id=plan-id"
+
+		It("returns 200", func() {
+			code, _ := makeRequest("DELETE", path, "")
+			Ω(code).Should(Equal(http.StatusOK))
+		})
+
+		It("returns 404 when the instance does not exist", func() {
+			serviceBroker.unbindErr = brokerapi.ErrInstanceDoesNotExist
+			code, _ := makeRequest("DELETE", path, "")
+			Ω(code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("returns 410 when the binding does not exist", func() {
+			serviceBroker.unbindErr = brokerapi.ErrBindingDoesNotExist
+			code, _ := makeRequest("DELETE", path, "")
+			Ω(code).Should(Equal(http.StatusGone))
+		})
+
+		It("returns 422 when an operation is in progress", func() {
+			serviceBroker.unbindErr = serviceapi.ErrConcurrentOperation
+			code, body := makeRequest("DELETE", path, "")
+			Ω(code).Should(Equal(422))
+			Ω(body["error"]).Should(Equal("ConcurrencyError"))
+		})
+
+		It("returns 500 for other errors", func() {
+			serviceBroker.unbindErr = errors.New("agent unreachable")
+			code, body := makeRequest("DELETE", path, "")
+			Ω(code).Should(Equal(http.StatusInternalServerError))
+			Ω(body["description"]).Should(Equal("agent unreachable"))
+		})
+	})
+
+	Describe("GET /v2/service_instances/:id/last_operation", func() {
+		It("returns the state of the operation", func() {
+			serviceBroker.lastOperation = serviceapi.LastOperation{
+				State:       serviceapi.OperationFailed,
+				Description: "redis did not start",
+			}
+
+			code, body := makeRequest("GET", "/v2/service_instances/instance-id/last_operation?operation=operation-id", "")
+			Ω(code).Should(Equal(http.StatusOK))
+			Ω(body["state"]).Should(Equal("failed"))
+			Ω(body["description"]).Should(Equal("redis did not start"))
+			Ω(serviceBroker.requestedOperationID).Should(Equal("operation-id"))
+		})
+
+		It("returns 410 when the operation does not exist", func() {
+			serviceBroker.lastOperationErr = serviceapi.ErrOperationNotFound
+			code, _ := makeRequest("GET", "/v2/service_instances/instance-id/last_operation", "")
+			Ω(code).Should(Equal(http.StatusGone))
+		})
+
+		It("returns 500 for other errors", func() {
+			serviceBroker.lastOperationErr = errors.New("disk on fire")
+			code, body := makeRequest("GET", "/v2/service_instances/instance-id/last_operation", "")
+			Ω(code).Should(Equal(http.StatusInternalServerError))
+			Ω(body["description"]).Should(Equal("disk on fire"))
+		})
+	})
+})
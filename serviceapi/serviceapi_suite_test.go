@@ -0,0 +1,15 @@
+package serviceapi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestServiceAPI(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_serviceapi.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Service API Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,73 @@
+package shutdown
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const DefaultTimeout = 30 * time.Second
+
+// Signals are the signals that ask a process to stop.
+var Signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+
+// Notify relays Signals to the returned channel instead of letting them kill
+// the process.
+func Notify() chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, Signals...)
+	return signals
+}
+
+// Serve runs serve, typically server.ListenAndServe, until it fails or the
+// process receives one of Signals. It then stops accepting connections and
+// waits for in-flight requests until the deadline it returns.
+func Serve(server *http.Server, serve func() error, timeout time.Duration) (time.Time, error) {
+	signals := Notify()
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serve()
+	}()
+
+	select {
+	case err := <-served:
+		return time.Now(), err
+	case <-signals:
+	}
+
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	return deadline, server.Shutdown(ctx)
+}
+
+// Wait waits for wg until deadline and tells whether it finished in time.
+func Wait(wg *sync.WaitGroup, deadline time.Time) bool {
+	return WaitFunc(wg.Wait, deadline)
+}
+
+// WaitFunc runs wait until deadline and tells whether it returned in time.
+func WaitFunc(wait func(), deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
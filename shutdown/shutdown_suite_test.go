@@ -0,0 +1,15 @@
+package shutdown_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestShutdown(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_shutdown.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Shutdown Suite", []Reporter{junitReporter})
+}
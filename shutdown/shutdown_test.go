@@ -0,0 +1,98 @@
+package shutdown_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/shutdown"
+)
+
+var _ = Describe("Shutdown", func() {
+	Describe("Serve", func() {
+		var (
+			listener        net.Listener
+			server          *http.Server
+			requestStarted  chan struct{}
+			releaseRequest  chan struct{}
+			requestFinished chan struct{}
+		)
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			requestStarted = make(chan struct{})
+			releaseRequest = make(chan struct{})
+			requestFinished = make(chan struct{})
+
+			server = &http.Server{
+				Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					close(requestStarted)
+					<-releaseRequest
+					res.Write([]byte("done"))
+				}),
+			}
+		})
+
+		It("returns the error of the server", func() {
+			_, err := shutdown.Serve(server, func() error {
+				return errors.New("address in use")
+			}, time.Second)
+			Ω(err).Should(MatchError("address in use"))
+		})
+
+		It("lets in-flight requests finish when the process is asked to stop", func() {
+			go func() {
+				defer GinkgoRecover()
+
+				response, err := http.Get("http://" + listener.Addr().String())
+				Ω(err).ShouldNot(HaveOccurred())
+				body, _ := ioutil.ReadAll(response.Body)
+				Ω(string(body)).Should(Equal("done"))
+				close(requestFinished)
+			}()
+
+			served := make(chan error, 1)
+			go func() {
+				_, err := shutdown.Serve(server, func() error {
+					return server.Serve(listener)
+				}, 5*time.Second)
+				served <- err
+			}()
+
+			Eventually(requestStarted).Should(BeClosed())
+			Ω(syscall.Kill(syscall.Getpid(), syscall.SIGTERM)).Should(Succeed())
+
+			Consistently(served, "200ms").ShouldNot(Receive())
+			close(releaseRequest)
+
+			Eventually(served).Should(Receive(BeNil()))
+			Eventually(requestFinished).Should(BeClosed())
+
+			_, err := net.Dial("tcp", listener.Addr().String())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Wait", func() {
+		It("tells whether the work finished before the deadline", func() {
+			var wg sync.WaitGroup
+			Ω(shutdown.Wait(&wg, time.Now().Add(time.Second))).Should(BeTrue())
+
+			wg.Add(1)
+			Ω(shutdown.Wait(&wg, time.Now().Add(50*time.Millisecond))).Should(BeFalse())
+
+			wg.Done()
+			Ω(shutdown.Wait(&wg, time.Now().Add(time.Second))).Should(BeTrue())
+		})
+	})
+})
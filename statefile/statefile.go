@@ -0,0 +1,126 @@
+package statefile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound is returned by Read when neither the statefile nor any of its
+// generations exist.
+var ErrNotFound = errors.New("statefile not found")
+
+// Generation is the path of an older version of the statefile at path.
+// Generation 0 is the statefile itself.
+func Generation(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, generation)
+}
+
+// Write replaces the statefile at path with data, keeping the previous
+// versions as the given number of generations. The data is written to a
+// temporary file and synced before it is renamed into place, so a crash
+// leaves either the old or the new contents behind, never a mix.
+func Write(path string, data []byte, generations int) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := rotate(path, generations); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// rotate shifts the generations of the statefile by one. The current
+// statefile is hard linked rather than moved, so that it stays in place
+// until the new version replaces it.
+func rotate(path string, generations int) error {
+	if generations <= 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	for generation := generations - 1; generation > 0; generation-- {
+		err := os.Rename(Generation(path, generation), Generation(path, generation+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	newest := Generation(path, 1)
+	if err := os.Remove(newest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(path, newest)
+}
+
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+
+	return dirFile.Sync()
+}
+
+// Read returns the contents of the newest generation of the statefile that
+// valid accepts, along with that generation. Generations that are missing
+// or invalid are skipped.
+func Read(path string, generations int, valid func([]byte) error) ([]byte, int, error) {
+	var firstErr error
+
+	for generation := 0; generation <= generations; generation++ {
+		data, err := ioutil.ReadFile(Generation(path, generation))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = valid(data)
+		}
+		if err == nil {
+			return data, generation, nil
+		}
+
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %s", Generation(path, generation), err)
+		}
+	}
+
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	return nil, 0, ErrNotFound
+}
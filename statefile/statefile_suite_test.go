@@ -0,0 +1,15 @@
+package statefile_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStatefile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_statefile.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Statefile Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,130 @@
+package statefile_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/statefile"
+)
+
+var _ = Describe("Statefile", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	validJSON := func(data []byte) error {
+		var value interface{}
+		return json.Unmarshal(data, &value)
+	}
+
+	contents := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "statefile")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "statefile.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Write", func() {
+		It("writes the statefile readable by others and leaves no temporary files", func() {
+			Ω(statefile.Write(path, []byte(`{"a":1}`), 2)).Should(Succeed())
+
+			Ω(contents(path)).Should(Equal(`{"a":1}`))
+
+			info, err := os.Stat(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0644)))
+
+			files, err := ioutil.ReadDir(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(files).Should(HaveLen(1))
+		})
+
+		It("keeps the given number of previous versions", func() {
+			for _, version := range []string{"1", "2", "3", "4"} {
+				Ω(statefile.Write(path, []byte(version), 2)).Should(Succeed())
+			}
+
+			Ω(contents(path)).Should(Equal("4"))
+			Ω(contents(statefile.Generation(path, 1))).Should(Equal("3"))
+			Ω(contents(statefile.Generation(path, 2))).Should(Equal("2"))
+			Ω(statefile.Generation(path, 3)).ShouldNot(BeAnExistingFile())
+		})
+
+		It("keeps no previous versions without generations", func() {
+			Ω(statefile.Write(path, []byte("1"), 0)).Should(Succeed())
+			Ω(statefile.Write(path, []byte("2"), 0)).Should(Succeed())
+
+			Ω(contents(path)).Should(Equal("2"))
+			Ω(statefile.Generation(path, 1)).ShouldNot(BeAnExistingFile())
+		})
+
+		It("leaves the statefile untouched when the directory is gone", func() {
+			Ω(statefile.Write(filepath.Join(dir, "missing", "statefile.json"), []byte("1"), 2)).ShouldNot(Succeed())
+		})
+	})
+
+	Describe("Read", func() {
+		It("returns ErrNotFound when there is no statefile", func() {
+			_, _, err := statefile.Read(path, 2, validJSON)
+			Ω(err).Should(Equal(statefile.ErrNotFound))
+		})
+
+		It("returns the current statefile when it is valid", func() {
+			Ω(statefile.Write(path, []byte(`{"a":1}`), 2)).Should(Succeed())
+			Ω(statefile.Write(path, []byte(`{"a":2}`), 2)).Should(Succeed())
+
+			data, generation, err := statefile.Read(path, 2, validJSON)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(data)).Should(Equal(`{"a":2}`))
+			Ω(generation).Should(Equal(0))
+		})
+
+		It("falls back to the newest valid generation", func() {
+			Ω(statefile.Write(path, []byte(`{"a":1}`), 2)).Should(Succeed())
+			Ω(statefile.Write(path, []byte(`{"a":2}`), 2)).Should(Succeed())
+			Ω(statefile.Write(path, []byte(`{"a":3}`), 2)).Should(Succeed())
+
+			Ω(ioutil.WriteFile(path, []byte(`{"a":`), 0644)).Should(Succeed())
+			Ω(ioutil.WriteFile(statefile.Generation(path, 1), []byte(``), 0644)).Should(Succeed())
+
+			data, generation, err := statefile.Read(path, 2, validJSON)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(data)).Should(Equal(`{"a":1}`))
+			Ω(generation).Should(Equal(2))
+		})
+
+		It("falls back when the current statefile is missing", func() {
+			Ω(statefile.Write(path, []byte(`{"a":1}`), 2)).Should(Succeed())
+			Ω(statefile.Write(path, []byte(`{"a":2}`), 2)).Should(Succeed())
+			Ω(os.Remove(path)).Should(Succeed())
+
+			data, generation, err := statefile.Read(path, 2, validJSON)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(data)).Should(Equal(`{"a":1}`))
+			Ω(generation).Should(Equal(1))
+		})
+
+		It("returns the error of the current statefile when no generation is valid", func() {
+			Ω(ioutil.WriteFile(path, []byte(`{"a":`), 0644)).Should(Succeed())
+
+			_, _, err := statefile.Read(path, 2, validJSON)
+			Ω(err).Should(MatchError(ContainSubstring(path + ": unexpected end of JSON input")))
+		})
+	})
+})
@@ -0,0 +1,66 @@
+package statemigrator
+
+import "github.com/pivotal-cf/cf-redis-broker/redis"
+
+// StateMigrator copies the state of the broker from one store to another,
+// e.g. from the statefile and the instance directories into BoltDB. Either
+// half is skipped when its source is nil.
+type StateMigrator struct {
+	FromState    redis.StateStore
+	ToState      redis.StateStore
+	FromMetadata redis.MetadataStore
+	ToMetadata   redis.MetadataStore
+}
+
+func (migrator *StateMigrator) Migrate() error {
+	if migrator.FromState != nil {
+		if err := migrator.migrateState(); err != nil {
+			return err
+		}
+	}
+
+	if migrator.FromMetadata != nil {
+		return migrator.migrateMetadata()
+	}
+
+	return nil
+}
+
+func (migrator *StateMigrator) migrateState() error {
+	state, err := migrator.FromState.Load()
+	if err != nil {
+		return err
+	}
+
+	update := redis.StateUpdate{
+		AvailableInstances: state.AvailableInstances,
+		AllocatedInstances: state.AllocatedInstances,
+		AddedNodes:         state.AddedNodes,
+		RemovedNodes:       state.RemovedNodes,
+		Bindings:           map[string][]string{},
+	}
+	for instanceID, bindings := range state.InstanceBindings {
+		if bindings == nil {
+			bindings = []string{}
+		}
+		update.Bindings[instanceID] = bindings
+	}
+
+	return migrator.ToState.Save(update)
+}
+
+func (migrator *StateMigrator) migrateMetadata() error {
+	allMetadata, err := migrator.FromMetadata.AllMetadata()
+	if err != nil {
+		return err
+	}
+
+	for instanceID, metadata := range allMetadata {
+		err := migrator.ToMetadata.PutMetadata(instanceID, metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package statemigrator_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStatemigrator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_statemigrator.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "Statemigrator Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,93 @@
+package statemigrator_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-broker/boltstore"
+	"github.com/pivotal-cf/cf-redis-broker/redis"
+	"github.com/pivotal-cf/cf-redis-broker/statemigrator"
+)
+
+var _ = Describe("StateMigrator", func() {
+	var (
+		tmpDir    string
+		dataDir   string
+		statefile *redis.FileStateStore
+		instances *redis.DirectoryMetadataStore
+		store     *boltstore.Store
+		migrator  *statemigrator.StateMigrator
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "statemigrator")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		statefile = redis.NewFileStateStore(filepath.Join(tmpDir, "statefile.json"), 0)
+		err = statefile.Save(redis.StateUpdate{
+			AvailableInstances: []*redis.Instance{{Host: "10.0.0.2"}},
+			AllocatedInstances: []*redis.Instance{{ID: "dedicated-1", Host: "10.0.0.1"}},
+			Bindings:           map[string][]string{"dedicated-1": {"binding-1", "binding-2"}},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Ω(os.MkdirAll(filepath.Join(dataDir, "shared-1"), 0755)).Should(Succeed())
+		Ω(os.MkdirAll(filepath.Join(dataDir, "shared-2"), 0755)).Should(Succeed())
+		instances = &redis.DirectoryMetadataStore{InstanceDataDirectory: dataDir}
+		err = instances.PutMetadata("shared-1", redis.InstanceMetadata{PlanID: "small-id"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store, err = boltstore.Open(filepath.Join(tmpDir, "state.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		migrator = &statemigrator.StateMigrator{
+			FromState:    statefile,
+			ToState:      store,
+			FromMetadata: instances,
+			ToMetadata:   store,
+		}
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("copies the dedicated nodes and their bindings", func() {
+		Ω(migrator.Migrate()).Should(Succeed())
+
+		state, err := store.Load()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(state.AvailableInstances).Should(Equal([]*redis.Instance{{Host: "10.0.0.2"}}))
+		Ω(state.AllocatedInstances).Should(Equal([]*redis.Instance{{ID: "dedicated-1", Host: "10.0.0.1"}}))
+		Ω(state.InstanceBindings).Should(Equal(map[string][]string{
+			"dedicated-1": {"binding-1", "binding-2"},
+		}))
+	})
+
+	It("copies every shared instance, including those without metadata", func() {
+		Ω(migrator.Migrate()).Should(Succeed())
+
+		allMetadata, err := store.AllMetadata()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(allMetadata).Should(Equal(map[string]redis.InstanceMetadata{
+			"shared-1": {PlanID: "small-id"},
+			"shared-2": {},
+		}))
+	})
+
+	It("skips the shared instances when there is no source for them", func() {
+		migrator.FromMetadata = nil
+		Ω(migrator.Migrate()).Should(Succeed())
+
+		allMetadata, err := store.AllMetadata()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(allMetadata).Should(BeEmpty())
+	})
+})
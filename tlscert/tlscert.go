@@ -0,0 +1,282 @@
+// Package tlscert issues the certificates redis instances serve TLS with.
+package tlscert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"time"
+)
+
+const certificateValidity = 2 * 365 * 24 * time.Hour
+
+// CA is a certificate authority whose key is held by the broker.
+type CA struct {
+	Certificate *x509.Certificate
+	key         crypto.Signer
+}
+
+// NewCA creates a self-signed certificate authority.
+func NewCA(commonName string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := certificateTemplate(commonName)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Certificate: certificate, key: key}, nil
+}
+
+// LoadCA reads a certificate authority from PEM encoded files.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	certificate, err := readCertificate(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !certificate.IsCA {
+		return nil, fmt.Errorf("the certificate in %s is not a CA certificate", certFile)
+	}
+
+	key, err := readKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Certificate: certificate, key: key}, nil
+}
+
+// Save writes the certificate and the key of the CA to PEM encoded files.
+func (ca *CA) Save(certFile, keyFile string) error {
+	if err := writeCertificate(certFile, ca.Certificate.Raw); err != nil {
+		return err
+	}
+
+	return writeKey(keyFile, ca.key)
+}
+
+// Issue creates a server certificate for the given hosts, which can be names
+// or IP addresses, and writes it with its key to PEM encoded files.
+func (ca *CA) Issue(hosts []string, certFile, keyFile string) error {
+	if len(hosts) == 0 {
+		return errors.New("a certificate needs at least one host")
+	}
+
+	template, err := certificateTemplate(hosts[0])
+	if err != nil {
+		return err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	return ca.issue(template, certFile, keyFile)
+}
+
+// IssueClient creates a certificate clients authenticate with and writes it
+// with its key to PEM encoded files.
+func (ca *CA) IssueClient(commonName, certFile, keyFile string) error {
+	template, err := certificateTemplate(commonName)
+	if err != nil {
+		return err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	return ca.issue(template, certFile, keyFile)
+}
+
+func (ca *CA) issue(template *x509.Certificate, certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, key.Public(), ca.key)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertificate(certFile, der); err != nil {
+		return err
+	}
+
+	return writeKey(keyFile, key)
+}
+
+// ClientConfig is the TLS config for clients that trust the certificates
+// issued by the CA in caCertFile. Clients present the certificate in certFile
+// when one is given.
+func ClientConfig(caCertFile, certFile, keyFile string) (*tls.Config, error) {
+	roots, err := certPool(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{RootCAs: roots}
+
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// ServerConfig is the TLS config for servers presenting the certificate in
+// certFile. With a clientCACertFile, clients must present a certificate issued
+// by that CA.
+func ServerConfig(certFile, keyFile, clientCACertFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCACertFile != "" {
+		config.ClientCAs, err = certPool(clientCACertFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+func certPool(caCertFile string) (*x509.CertPool, error) {
+	caCert, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", caCertFile)
+	}
+
+	return pool, nil
+}
+
+func certificateTemplate(commonName string) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+	}, nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func readKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			return key, nil
+		case *rsa.PrivateKey:
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported private key in %s", path)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	return block, nil
+}
+
+func writeCertificate(path string, der []byte) error {
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func writeKey(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+}
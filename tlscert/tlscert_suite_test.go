@@ -0,0 +1,15 @@
+package tlscert_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/reporters"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTLSCert(t *testing.T) {
+	RegisterFailHandler(Fail)
+	junitReporter := reporters.NewJUnitReporter("junit_tlscert.xml")
+	RunSpecsWithDefaultAndCustomReporters(t, "TLS Certificate Suite", []Reporter{junitReporter})
+}
@@ -0,0 +1,168 @@
+package tlscert_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/cf-redis-broker/tlscert"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("tlscert", func() {
+	var (
+		tmpDir     string
+		caCertFile string
+		caKeyFile  string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "tlscert")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		caCertFile = filepath.Join(tmpDir, "ca.crt")
+		caKeyFile = filepath.Join(tmpDir, "ca.key")
+
+		ca, err := tlscert.NewCA("redis-ca")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ca.Save(caCertFile, caKeyFile)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("loads a saved CA", func() {
+		ca, err := tlscert.LoadCA(caCertFile, caKeyFile)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ca.Certificate.Subject.CommonName).Should(Equal("redis-ca"))
+		Ω(ca.Certificate.IsCA).Should(BeTrue())
+	})
+
+	It("refuses to load a certificate that is not a CA", func() {
+		ca, err := tlscert.LoadCA(caCertFile, caKeyFile)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		certFile := filepath.Join(tmpDir, "redis.crt")
+		keyFile := filepath.Join(tmpDir, "redis.key")
+		Ω(ca.Issue([]string{"10.0.0.1"}, certFile, keyFile)).Should(Succeed())
+
+		_, err = tlscert.LoadCA(certFile, keyFile)
+		Ω(err).Should(MatchError(ContainSubstring("not a CA certificate")))
+	})
+
+	It("issues server certificates that clients trusting the CA accept", func() {
+		ca, err := tlscert.LoadCA(caCertFile, caKeyFile)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		certFile := filepath.Join(tmpDir, "redis.crt")
+		keyFile := filepath.Join(tmpDir, "redis.key")
+		Ω(ca.Issue([]string{"127.0.0.1", "redis.example.com"}, certFile, keyFile)).Should(Succeed())
+
+		keyInfo, err := os.Stat(keyFile)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(keyInfo.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+
+		serverCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+		Ω(err).ShouldNot(HaveOccurred())
+		defer listener.Close()
+
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+
+		clientConfig, err := tlscert.ClientConfig(caCertFile, "", "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		leaf := conn.ConnectionState().PeerCertificates[0]
+		Ω(leaf.DNSNames).Should(Equal([]string{"redis.example.com"}))
+		Ω(leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1"))).Should(BeTrue())
+		Ω(leaf.ExtKeyUsage).Should(Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}))
+	})
+
+	Describe("mutual TLS", func() {
+		var (
+			serverConfig *tls.Config
+			listener     net.Listener
+		)
+
+		BeforeEach(func() {
+			ca, err := tlscert.LoadCA(caCertFile, caKeyFile)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(ca.Issue([]string{"127.0.0.1"}, filepath.Join(tmpDir, "server.crt"), filepath.Join(tmpDir, "server.key"))).Should(Succeed())
+			Ω(ca.IssueClient("broker", filepath.Join(tmpDir, "client.crt"), filepath.Join(tmpDir, "client.key"))).Should(Succeed())
+
+			serverConfig, err = tlscert.ServerConfig(filepath.Join(tmpDir, "server.crt"), filepath.Join(tmpDir, "server.key"), caCertFile)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			listener, err = tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			go func() {
+				defer GinkgoRecover()
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.(*tls.Conn).Handshake()
+					conn.Write([]byte("ok"))
+					conn.Close()
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		handshake := func(config *tls.Config) error {
+			conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			_, err = ioutil.ReadAll(conn)
+			return err
+		}
+
+		It("accepts clients presenting a certificate issued by the CA", func() {
+			clientConfig, err := tlscert.ClientConfig(caCertFile, filepath.Join(tmpDir, "client.crt"), filepath.Join(tmpDir, "client.key"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(handshake(clientConfig)).Should(Succeed())
+		})
+
+		It("rejects clients without a certificate", func() {
+			clientConfig, err := tlscert.ClientConfig(caCertFile, "", "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(handshake(clientConfig)).ShouldNot(Succeed())
+		})
+	})
+
+	It("fails to build a client config without CA certificates", func() {
+		emptyFile := filepath.Join(tmpDir, "empty.crt")
+		Ω(ioutil.WriteFile(emptyFile, []byte{}, 0644)).Should(Succeed())
+
+		_, err := tlscert.ClientConfig(emptyFile, "", "")
+		Ω(err).Should(HaveOccurred())
+	})
+})